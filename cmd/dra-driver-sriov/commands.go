@@ -0,0 +1,410 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	resourceapi "k8s.io/api/resource/v1"
+	"sigs.k8s.io/yaml"
+
+	sriovdrav1alpha1 "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/sriovdra/v1alpha1"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/audit"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/cdi"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/controller"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/devicestate"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
+)
+
+// Supported values for the output flag of the inspection commands.
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+// newCommands returns the commands inspecting the node, they use the global flags of the
+// driver for the paths and the discovery mode
+func newCommands(flagsOptions *types.Flags) []*cli.Command {
+	return []*cli.Command{
+		{
+			Name:   "discover",
+			Usage:  "Print the devices the driver publishes for this node.",
+			Flags:  []cli.Flag{outputFlag()},
+			Action: func(c *cli.Context) error { return discoverCommand(c, flagsOptions) },
+		},
+		{
+			Name:  "filter",
+			Usage: "Evaluate a SriovResourceFilter against the devices of this node. The node selector of the filter is not evaluated.",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     "file",
+					Usage:    "Path of the SriovResourceFilter YAML or JSON manifest.",
+					Required: true,
+				},
+				outputFlag(),
+			},
+			Action: func(c *cli.Context) error { return filterCommand(c, flagsOptions) },
+		},
+		{
+			Name:  "checkpoint",
+			Usage: "Inspect the checkpoint of the prepared claims.",
+			Subcommands: []*cli.Command{
+				{
+					Name:   "show",
+					Usage:  "Print the prepared claims of the checkpoint.",
+					Flags:  []cli.Flag{checkpointFileFlag(), outputFlag()},
+					Action: func(c *cli.Context) error { return checkpointShowCommand(c, flagsOptions) },
+				},
+				{
+					Name:   "verify",
+					Usage:  "Check the checksum of the checkpoint.",
+					Flags:  []cli.Flag{checkpointFileFlag(), outputFlag()},
+					Action: func(c *cli.Context) error { return checkpointVerifyCommand(c, flagsOptions) },
+				},
+			},
+		},
+		{
+			Name:  "cdi",
+			Usage: "Inspect the CDI specs of the driver.",
+			Subcommands: []*cli.Command{
+				{
+					Name:   "list",
+					Usage:  "Print the transient CDI specs of the driver under the CDI root.",
+					Flags:  []cli.Flag{outputFlag()},
+					Action: func(c *cli.Context) error { return cdiListCommand(c, flagsOptions) },
+				},
+			},
+		},
+		{
+			Name:  "audit",
+			Usage: "Print the host mutations of the audit log, oldest first, including the rotated files.",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "file",
+					Usage: "Path of the audit log. Defaults to the audit log of the driver under the kubelet plugins directory.",
+				},
+				&cli.StringFlag{
+					Name:  "claim-uid",
+					Usage: "Only print the events of the claim.",
+				},
+				&cli.StringFlag{
+					Name:  "pod-uid",
+					Usage: "Only print the events of the pod.",
+				},
+				&cli.StringFlag{
+					Name:  "pci-address",
+					Usage: "Only print the events of the device.",
+				},
+				&cli.StringFlag{
+					Name:  "operation",
+					Usage: "Only print the events of the operation: 'prepare', 'unprepare', 'bind', 'unbind', 'module-load', 'cni-add', 'cni-del' or 'resource-name'.",
+				},
+				&cli.DurationFlag{
+					Name:  "since",
+					Usage: "Only print the events more recent than the duration, e.g. 1h.",
+				},
+				outputFlag(),
+			},
+			Action: func(c *cli.Context) error { return auditCommand(c, flagsOptions) },
+		},
+	}
+}
+
+func outputFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:    "output",
+		Aliases: []string{"o"},
+		Usage:   "Output format: 'table' or 'json'.",
+		Value:   outputTable,
+		Action: func(_ *cli.Context, output string) error {
+			if output != outputTable && output != outputJSON {
+				return fmt.Errorf("unsupported output %q, must be %q or %q", output, outputTable, outputJSON)
+			}
+			return nil
+		},
+	}
+}
+
+func checkpointFileFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "file",
+		Usage: "Path of the checkpoint. Defaults to the checkpoint of the driver under the kubelet plugins directory.",
+	}
+}
+
+// printOutput writes v as indented JSON, or as the table written by printTable
+func printOutput(c *cli.Context, v interface{}, header string, printTable func(w io.Writer)) error {
+	if c.String("output") == outputJSON {
+		encoder := json.NewEncoder(c.App.Writer)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	}
+	w := tabwriter.NewWriter(c.App.Writer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, header)
+	printTable(w)
+	return w.Flush()
+}
+
+func discoverDevices(flagsOptions *types.Flags) (types.AllocatableDevices, error) {
+	if flagsOptions.PFBandwidthMode {
+		devices, _, err := devicestate.DiscoverBandwidthDevices(host.NewHost())
+		return devices, err
+	}
+	return devicestate.DiscoverSriovDevices(host.NewHost())
+}
+
+// sortedDevices returns the devices sorted by name
+func sortedDevices(devices types.AllocatableDevices) []resourceapi.Device {
+	sorted := make([]resourceapi.Device, 0, len(devices))
+	for _, device := range devices {
+		sorted = append(sorted, device)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	return sorted
+}
+
+// attribute returns the value of a device attribute as a string, empty when not set
+func attribute(device resourceapi.Device, name resourceapi.QualifiedName) string {
+	value := device.Attributes[name]
+	switch {
+	case value.StringValue != nil:
+		return *value.StringValue
+	case value.IntValue != nil:
+		return strconv.FormatInt(*value.IntValue, 10)
+	case value.BoolValue != nil:
+		return strconv.FormatBool(*value.BoolValue)
+	case value.VersionValue != nil:
+		return *value.VersionValue
+	}
+	return ""
+}
+
+func discoverCommand(c *cli.Context, flagsOptions *types.Flags) error {
+	devices, err := discoverDevices(flagsOptions)
+	if err != nil {
+		return fmt.Errorf("failed to discover devices: %w", err)
+	}
+	sorted := sortedDevices(devices)
+	return printOutput(c, sorted, "NAME\tPCI ADDRESS\tPF\tVENDOR\tDEVICE\tVF ID\tNUMA\tTYPE", func(w io.Writer) {
+		for _, device := range sorted {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", device.Name,
+				orDash(attribute(device, consts.AttributePciAddress)),
+				orDash(attribute(device, consts.AttributePFName)),
+				orDash(attribute(device, consts.AttributeVendorID)),
+				orDash(attribute(device, consts.AttributeDeviceID)),
+				orDash(attribute(device, consts.AttributeVFID)),
+				orDash(attribute(device, consts.AttributeNumaNode)),
+				orDash(attribute(device, consts.AttributeDeviceType)))
+		}
+	})
+}
+
+// filterResult is the resource name a filter assigns to a device
+type filterResult struct {
+	Device       string `json:"device"`
+	PciAddress   string `json:"pciAddress"`
+	PFName       string `json:"pfName"`
+	ResourceName string `json:"resourceName,omitempty"`
+}
+
+func filterCommand(c *cli.Context, flagsOptions *types.Flags) error {
+	data, err := os.ReadFile(c.String("file"))
+	if err != nil {
+		return fmt.Errorf("failed to read filter: %w", err)
+	}
+	filter := &sriovdrav1alpha1.SriovResourceFilter{}
+	if err := yaml.UnmarshalStrict(data, filter); err != nil {
+		return fmt.Errorf("failed to decode filter %s: %w", c.String("file"), err)
+	}
+	if filter.Kind != "" && filter.Kind != "SriovResourceFilter" {
+		return fmt.Errorf("unexpected kind %q in %s, expected SriovResourceFilter", filter.Kind, c.String("file"))
+	}
+
+	devices, err := discoverDevices(flagsOptions)
+	if err != nil {
+		return fmt.Errorf("failed to discover devices: %w", err)
+	}
+	resourceNames, err := controller.FilterDevices(filter, devices)
+	if err != nil {
+		return err
+	}
+	results := []filterResult{}
+	for _, device := range sortedDevices(devices) {
+		results = append(results, filterResult{
+			Device:       device.Name,
+			PciAddress:   attribute(device, consts.AttributePciAddress),
+			PFName:       attribute(device, consts.AttributePFName),
+			ResourceName: resourceNames[device.Name],
+		})
+	}
+	return printOutput(c, results, "NAME\tPCI ADDRESS\tPF\tRESOURCE", func(w io.Writer) {
+		for _, result := range results {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", result.Device, orDash(result.PciAddress), orDash(result.PFName), orDash(result.ResourceName))
+		}
+	})
+}
+
+// readCheckpoint decodes the checkpoint without verifying its checksum
+func readCheckpoint(c *cli.Context, flagsOptions *types.Flags) (string, *types.Checkpoint, error) {
+	path := c.String("file")
+	if path == "" {
+		path = filepath.Join(types.Config{Flags: flagsOptions}.DriverPluginPath(), consts.DriverPluginCheckpointFile)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return path, nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	checkpoint := types.NewCheckpoint()
+	if err := checkpoint.UnmarshalCheckpoint(data); err != nil {
+		return path, nil, fmt.Errorf("failed to decode checkpoint %s: %w", path, err)
+	}
+	return path, checkpoint, nil
+}
+
+func checkpointShowCommand(c *cli.Context, flagsOptions *types.Flags) error {
+	_, checkpoint, err := readCheckpoint(c, flagsOptions)
+	if err != nil {
+		return err
+	}
+	return printOutput(c, checkpoint, "POD UID\tCLAIM\tCLAIM UID\tDEVICE\tPCI ADDRESS\tIFNAME\tDRIVER", func(w io.Writer) {
+		if checkpoint.V1 == nil {
+			return
+		}
+		rows := []string{}
+		for podUID, claims := range checkpoint.V1.PreparedClaimsByPodUID {
+			for claimUID, devices := range claims {
+				for _, device := range devices {
+					rows = append(rows, fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s\t%s", podUID,
+						device.ClaimNamespacedName.NamespacedName.String(), claimUID,
+						device.Device.DeviceName, device.PciAddress, orDash(device.IfName), orDash(device.Driver)))
+				}
+			}
+		}
+		sort.Strings(rows)
+		for _, row := range rows {
+			fmt.Fprintln(w, row)
+		}
+	})
+}
+
+// checkpointVerification is the result of the verification of a checkpoint
+type checkpointVerification struct {
+	Path     string `json:"path"`
+	Checksum uint64 `json:"checksum"`
+	Valid    bool   `json:"valid"`
+	Error    string `json:"error,omitempty"`
+}
+
+func checkpointVerifyCommand(c *cli.Context, flagsOptions *types.Flags) error {
+	path, checkpoint, err := readCheckpoint(c, flagsOptions)
+	if err != nil {
+		return err
+	}
+	verification := checkpointVerification{Path: path, Checksum: uint64(checkpoint.Checksum), Valid: true}
+	verifyErr := checkpoint.VerifyChecksum()
+	if verifyErr != nil {
+		verification.Valid = false
+		verification.Error = verifyErr.Error()
+	}
+	err = printOutput(c, verification, "PATH\tCHECKSUM\tVALID", func(w io.Writer) {
+		fmt.Fprintf(w, "%s\t%d\t%t\n", verification.Path, verification.Checksum, verification.Valid)
+	})
+	if err != nil {
+		return err
+	}
+	if verifyErr != nil {
+		return cli.Exit(fmt.Sprintf("checkpoint %s is corrupted: %v", path, verifyErr), 1)
+	}
+	return nil
+}
+
+// cdiSpec is a transient CDI spec of the driver
+type cdiSpec struct {
+	Path    string      `json:"path"`
+	Kind    string      `json:"kind"`
+	Devices []cdiDevice `json:"devices"`
+}
+
+type cdiDevice struct {
+	Name        string   `json:"name"`
+	DeviceNodes []string `json:"deviceNodes,omitempty"`
+	Env         []string `json:"env,omitempty"`
+}
+
+func cdiListCommand(c *cli.Context, flagsOptions *types.Flags) error {
+	handler, err := cdi.NewHandler(flagsOptions.CdiRoot)
+	if err != nil {
+		return fmt.Errorf("unable to create CDI handler: %w", err)
+	}
+	specs, err := handler.ListSpecs()
+	if err != nil {
+		fmt.Fprintf(c.App.ErrWriter, "Warning: some CDI specs couldn't be loaded: %v\n", err)
+	}
+
+	result := []cdiSpec{}
+	for _, spec := range specs {
+		s := cdiSpec{Path: spec.GetPath(), Kind: spec.Kind, Devices: []cdiDevice{}}
+		for _, device := range spec.Devices {
+			d := cdiDevice{Name: device.Name, Env: device.ContainerEdits.Env}
+			for _, node := range device.ContainerEdits.DeviceNodes {
+				d.DeviceNodes = append(d.DeviceNodes, node.Path)
+			}
+			s.Devices = append(s.Devices, d)
+		}
+		result = append(result, s)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Path < result[j].Path })
+
+	return printOutput(c, result, "SPEC\tDEVICE\tDEVICE NODES\tENV", func(w io.Writer) {
+		for _, spec := range result {
+			for _, device := range spec.Devices {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", filepath.Base(spec.Path), device.Name,
+					orDash(strings.Join(device.DeviceNodes, ",")), orDash(strings.Join(device.Env, ",")))
+			}
+		}
+	})
+}
+
+func auditCommand(c *cli.Context, flagsOptions *types.Flags) error {
+	path := c.String("file")
+	if path == "" {
+		path = types.Config{Flags: flagsOptions}.AuditLogPath()
+	}
+	filter := audit.Filter{
+		ClaimUID:   c.String("claim-uid"),
+		PodUID:     c.String("pod-uid"),
+		PciAddress: c.String("pci-address"),
+		Operation:  c.String("operation"),
+	}
+	if since := c.Duration("since"); since > 0 {
+		filter.Since = time.Now().Add(-since)
+	}
+	events, err := audit.Query(path, filter)
+	if err != nil {
+		return err
+	}
+	return printOutput(c, events, "TIME\tOPERATION\tCLAIM UID\tPOD UID\tPCI ADDRESS\tDRIVER\tOUTCOME\tERROR", func(w io.Writer) {
+		for _, event := range events {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", event.Time.Format(time.RFC3339), event.Operation,
+				orDash(event.ClaimUID), orDash(event.PodUID), orDash(event.PciAddress), orDash(event.Driver),
+				event.Outcome, orDash(event.Error))
+		}
+	})
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
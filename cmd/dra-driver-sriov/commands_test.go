@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/urfave/cli/v2"
+	resourceapi "k8s.io/api/resource/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	logsapi "k8s.io/component-base/logs/api/v1"
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+	drapbv1 "k8s.io/kubelet/pkg/apis/dra/v1beta1"
+	cdiapi "tags.cncf.io/container-device-interface/pkg/cdi"
+	cdispec "tags.cncf.io/container-device-interface/specs-go"
+
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/cdi"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
+)
+
+var _ = Describe("Inspection commands", func() {
+	var (
+		pluginsDir     string
+		cdiRoot        string
+		checkpointPath string
+	)
+
+	// run runs the driver with the arguments and returns what it printed
+	run := func(args ...string) (string, error) {
+		out := &bytes.Buffer{}
+		app := newApp()
+		app.Writer = out
+		app.ErrWriter = GinkgoWriter
+		// keep the exit errors from exiting the test binary
+		app.ExitErrHandler = func(*cli.Context, error) {}
+		args = append([]string{"dra-driver-sriov", "--kubelet-plugins-directory-path", pluginsDir, "--cdi-root", cdiRoot}, args...)
+		err := app.Run(args)
+		// the logging configuration is applied once per process
+		Expect(logsapi.ResetForTest(nil)).To(Succeed())
+		return out.String(), err
+	}
+
+	preparedDevice := &types.PreparedDevice{
+		Device: drapbv1.Device{RequestNames: []string{"req"}, PoolName: "node1", DeviceName: "0000-01-01-0"},
+		ClaimNamespacedName: kubeletplugin.NamespacedObject{
+			NamespacedName: k8stypes.NamespacedName{Namespace: "default", Name: "claim1"},
+			UID:            "claim1-uid",
+		},
+		ContainerEdits: &cdiapi.ContainerEdits{ContainerEdits: &cdispec.ContainerEdits{
+			DeviceNodes: []*cdispec.DeviceNode{{Path: "/dev/vfio/40"}},
+		}},
+		PciAddress: "0000:01:01.0",
+		PodUID:     "pod1",
+		Driver:     "vfio-pci",
+	}
+
+	BeforeEach(func() {
+		pluginsDir = GinkgoT().TempDir()
+		cdiRoot = GinkgoT().TempDir()
+		config := types.Config{Flags: &types.Flags{KubeletPluginsDirectoryPath: pluginsDir}}
+		Expect(os.MkdirAll(config.DriverPluginPath(), 0750)).To(Succeed())
+		checkpointPath = filepath.Join(config.DriverPluginPath(), consts.DriverPluginCheckpointFile)
+
+		checkpoint := types.NewCheckpoint()
+		checkpoint.V1.PreparedClaimsByPodUID["pod1"] = types.PreparedDevicesByClaimID{
+			"claim1-uid": types.PreparedDevices{preparedDevice},
+		}
+		data, err := checkpoint.MarshalCheckpoint()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.WriteFile(checkpointPath, data, 0600)).To(Succeed())
+	})
+
+	Context("on the sysfs topology of a node", func() {
+		var filterPath string
+
+		BeforeEach(func() {
+			topology, err := host.LoadTopologyFile("../../pkg/host/testdata/topology.yaml")
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(topology.Use())
+
+			filterPath = filepath.Join(GinkgoT().TempDir(), "filter.yaml")
+			Expect(os.WriteFile(filterPath, []byte(`
+apiVersion: sriovnetwork.k8snetworkplumbingwg.io/v1alpha1
+kind: SriovResourceFilter
+metadata:
+  name: filter
+spec:
+  configs:
+  - resourceName: mlx
+    resourceFilters:
+    - vendors: ["15b3"]
+`), 0600)).To(Succeed())
+		})
+
+		It("discovers the VFs", func() {
+			out, err := run("discover", "-o", "json")
+			Expect(err).NotTo(HaveOccurred())
+			devices := []resourceapi.Device{}
+			Expect(json.Unmarshal([]byte(out), &devices)).To(Succeed())
+			Expect(devices).To(HaveLen(3))
+			Expect(devices[0].Name).To(Equal("0000-01-01-0"))
+			Expect(attribute(devices[0], consts.AttributePFName)).To(Equal("ens1f0"))
+			Expect(attribute(devices[2], consts.AttributeVendorID)).To(Equal("15b3"))
+
+			out, err = run("discover", "-o", "table")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(out).To(HavePrefix("NAME "))
+			Expect(out).To(MatchRegexp(`0000-01-01-1\s+0000:01:01.1\s+ens1f0\s+8086\s+1889\s+1\s+0`))
+			Expect(out).To(MatchRegexp(`0000-81-00-2\s+0000:81:00.2\s+ens2f0np0\s+15b3\s+101e\s+0\s+1`))
+		})
+
+		It("evaluates a resource filter", func() {
+			out, err := run("filter", "--file", filterPath, "-o", "json")
+			Expect(err).NotTo(HaveOccurred())
+			results := []filterResult{}
+			Expect(json.Unmarshal([]byte(out), &results)).To(Succeed())
+			Expect(results).To(Equal([]filterResult{
+				{Device: "0000-01-01-0", PciAddress: "0000:01:01.0", PFName: "ens1f0"},
+				{Device: "0000-01-01-1", PciAddress: "0000:01:01.1", PFName: "ens1f0"},
+				{Device: "0000-81-00-2", PciAddress: "0000:81:00.2", PFName: "ens2f0np0", ResourceName: "mlx"},
+			}))
+
+			out, err = run("filter", "--file", filterPath, "-o", "table")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(out).To(MatchRegexp(`0000-01-01-0\s+0000:01:01.0\s+ens1f0\s+-\n`))
+			Expect(out).To(MatchRegexp(`0000-81-00-2\s+0000:81:00.2\s+ens2f0np0\s+mlx\n`))
+		})
+
+		It("rejects a manifest of another kind", func() {
+			Expect(os.WriteFile(filterPath, []byte("kind: ConfigMap\n"), 0600)).To(Succeed())
+			_, err := run("filter", "--file", filterPath)
+			Expect(err).To(MatchError(ContainSubstring(`unexpected kind "ConfigMap"`)))
+		})
+	})
+
+	It("shows the prepared claims of the checkpoint", func() {
+		out, err := run("checkpoint", "show", "-o", "json")
+		Expect(err).NotTo(HaveOccurred())
+		checkpoint := types.NewCheckpoint()
+		Expect(checkpoint.UnmarshalCheckpoint([]byte(out))).To(Succeed())
+		Expect(checkpoint.VerifyChecksum()).To(Succeed())
+		Expect(checkpoint.V1.PreparedClaimsByPodUID).To(HaveKey(k8stypes.UID("pod1")))
+
+		out, err = run("checkpoint", "show", "-o", "table")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(HavePrefix("POD UID "))
+		Expect(out).To(MatchRegexp(`pod1\s+default/claim1\s+claim1-uid\s+0000-01-01-0\s+0000:01:01.0\s+-\s+vfio-pci\n`))
+	})
+
+	It("verifies the checksum of the checkpoint", func() {
+		out, err := run("checkpoint", "verify", "-o", "json")
+		Expect(err).NotTo(HaveOccurred())
+		verification := checkpointVerification{}
+		Expect(json.Unmarshal([]byte(out), &verification)).To(Succeed())
+		Expect(verification.Path).To(Equal(checkpointPath))
+		Expect(verification.Valid).To(BeTrue())
+		Expect(verification.Checksum).NotTo(BeZero())
+
+		out, err = run("checkpoint", "verify", "-o", "table")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(MatchRegexp(regexp.QuoteMeta(checkpointPath) + `\s+\d+\s+true\n`))
+	})
+
+	It("reports a corrupted checkpoint", func() {
+		data, err := os.ReadFile(checkpointPath)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.WriteFile(checkpointPath, bytes.Replace(data, []byte("claim1"), []byte("claim2"), 1), 0600)).To(Succeed())
+
+		out, err := run("checkpoint", "verify", "-o", "json")
+		Expect(err).To(MatchError(ContainSubstring("is corrupted")))
+		verification := checkpointVerification{}
+		Expect(json.Unmarshal([]byte(out), &verification)).To(Succeed())
+		Expect(verification.Valid).To(BeFalse())
+		Expect(verification.Error).NotTo(BeEmpty())
+
+		out, err = run("checkpoint", "verify", "-o", "table")
+		Expect(err).To(MatchError(ContainSubstring("is corrupted")))
+		Expect(out).To(MatchRegexp(`\s+false\n`))
+	})
+
+	It("lists the CDI specs of the driver", func() {
+		handler, err := cdi.NewHandler(cdiRoot)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(handler.CreateClaimSpecFile(types.PreparedDevices{preparedDevice})).To(Succeed())
+		Expect(handler.CreateGlobalPodSpecFile("pod1", []string{"0000:01:01.0"})).To(Succeed())
+
+		out, err := run("cdi", "list", "-o", "json")
+		Expect(err).NotTo(HaveOccurred())
+		specs := []cdiSpec{}
+		Expect(json.Unmarshal([]byte(out), &specs)).To(Succeed())
+		Expect(specs).To(HaveLen(2))
+		devices := []cdiDevice{}
+		for _, spec := range specs {
+			Expect(spec.Path).To(HavePrefix(cdiRoot))
+			devices = append(devices, spec.Devices...)
+		}
+		Expect(devices).To(ConsistOf(
+			cdiDevice{Name: "claim1-uid-0000-01-01-0", DeviceNodes: []string{"/dev/vfio/40"}},
+			cdiDevice{Name: "pod1", Env: []string{"SRIOVNETWORK_PCI_ADDRESSES=0000:01:01.0"}},
+		))
+
+		out, err = run("cdi", "list", "-o", "table")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(HavePrefix("SPEC "))
+		Expect(out).To(MatchRegexp(`claim1-uid-0000-01-01-0\s+/dev/vfio/40\s+-\n`))
+		Expect(out).To(MatchRegexp(`pod1\s+-\s+SRIOVNETWORK_PCI_ADDRESSES=0000:01:01.0\n`))
+	})
+
+	It("rejects an unsupported output", func() {
+		_, err := run("checkpoint", "show", "-o", "yaml")
+		Expect(err).To(MatchError(ContainSubstring(`unsupported output "yaml"`)))
+	})
+})
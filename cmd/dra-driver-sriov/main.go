@@ -7,6 +7,7 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/urfave/cli/v2"
 
@@ -15,6 +16,7 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 
 	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/cdi"
 	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/cni"
@@ -23,11 +25,13 @@ import (
 	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/devicestate"
 	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/driver"
 	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/flags"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host"
 	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/nri"
 	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/podmanager"
 	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
 
 	sriovdrav1alpha1 "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/sriovdra/v1alpha1"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/audit"
 )
 
 func main() {
@@ -44,8 +48,7 @@ func newApp() *cli.App {
 	cliFlags := []cli.Flag{
 		&cli.StringFlag{
 			Name:        "node-name",
-			Usage:       "The name of the node to be worked on.",
-			Required:    true,
+			Usage:       "The name of the node to be worked on, required to run the plugin.",
 			Destination: &flagsOptions.NodeName,
 			EnvVars:     []string{"NODE_NAME"},
 		},
@@ -84,6 +87,98 @@ func newApp() *cli.App {
 			Destination: &flagsOptions.DefaultInterfacePrefix,
 			EnvVars:     []string{"DEFAULT_INTERFACE_PREFIX"},
 		},
+		&cli.BoolFlag{
+			Name:        "reject-kernel-vf-host-network",
+			Usage:       "Reject at prepare time claims of host network pods for VFs using a kernel driver, by default only a warning is logged.",
+			Value:       false,
+			Destination: &flagsOptions.RejectKernelVfHostNetwork,
+			EnvVars:     []string{"REJECT_KERNEL_VF_HOST_NETWORK"},
+		},
+		&cli.StringFlag{
+			Name:        "resource-slice-partition",
+			Usage:       "How devices are split into ResourceSlice pools: 'node' for a single pool named after the node, 'pf' for one pool per physical function, 'resourceName' for one pool per resource name.",
+			Value:       driver.PartitionByNode,
+			Destination: &flagsOptions.ResourceSlicePartition,
+			EnvVars:     []string{"RESOURCE_SLICE_PARTITION"},
+		},
+		&cli.BoolFlag{
+			Name:        "pf-bandwidth-mode",
+			Usage:       "Publish PFs with consumable bandwidth (Gbps) and VF count capacity instead of their VFs. Each allocation share gets one of the VFs of the PF rate limited with max_tx_rate.",
+			Value:       false,
+			Destination: &flagsOptions.PFBandwidthMode,
+			EnvVars:     []string{"PF_BANDWIDTH_MODE"},
+		},
+		&cli.DurationFlag{
+			Name:        "link-attributes-refresh-interval",
+			Usage:       "Interval to refresh the PF link attributes (MTU, operational state, carrier, ...) in addition to the refresh on host link changes. When zero or negative, the attributes are only read at startup.",
+			Value:       time.Minute,
+			Destination: &flagsOptions.LinkAttributesRefreshInterval,
+			EnvVars:     []string{"LINK_ATTRIBUTES_REFRESH_INTERVAL"},
+		},
+		&cli.DurationFlag{
+			Name:        "device-health-check-interval",
+			Usage:       "Interval to check the health of the devices (PF link, PCIe AER errors, driver bind failures) and taint the unhealthy ones. When zero or negative, the health of the devices is not checked.",
+			Value:       30 * time.Second,
+			Destination: &flagsOptions.DeviceHealthCheckInterval,
+			EnvVars:     []string{"DEVICE_HEALTH_CHECK_INTERVAL"},
+		},
+		&cli.StringFlag{
+			Name:        "host-device-policy",
+			Usage:       "What to do with the devices used by the host system (default route, IP address, bond or bridge member, denylist): 'skip' to not publish them, 'taint' to publish them with a NoSchedule device taint.",
+			Value:       devicestate.HostDevicePolicySkip,
+			Destination: &flagsOptions.HostDevicePolicy,
+			EnvVars:     []string{"HOST_DEVICE_POLICY"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "host-device-denylist",
+			Usage:   "PCI addresses or interface names of devices reserved for the host system, in addition to the ones of the node annotation " + consts.AnnotationHostDevices + ".",
+			EnvVars: []string{"HOST_DEVICE_DENYLIST"},
+		},
+		&cli.StringFlag{
+			Name:        "ib-guid-pool",
+			Usage:       "Range of GUIDs assigned to the InfiniBand VFs without a GUID in their VfConfig, as <first GUID>-<last GUID>, e.g. 02:00:00:00:00:00:00:00-02:00:00:00:00:00:00:ff.",
+			Destination: &flagsOptions.IBGUIDPool,
+			EnvVars:     []string{"IB_GUID_POOL"},
+		},
+		&cli.BoolFlag{
+			Name:        "publish-sfs",
+			Usage:       "Publish the scalable functions (SFs) of the PFs as devices, in addition to the VFs.",
+			Value:       false,
+			Destination: &flagsOptions.PublishSFs,
+			EnvVars:     []string{"PUBLISH_SFS"},
+		},
+		&cli.IntFlag{
+			Name:        "sfs-per-pf",
+			Usage:       "Number of SFs published for every PF in switchdev mode, created through devlink when they are prepared and deleted when they are unprepared. Requires --publish-sfs.",
+			Value:       0,
+			Destination: &flagsOptions.SFsPerPF,
+			EnvVars:     []string{"SFS_PER_PF"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "vf-sanitize-steps",
+			Usage:   "Steps sanitizing the VFs after unprepare, before they are handed to the next pod: 'mac-vlan' resets the MAC address, VLAN, trust, spoof check and link state of the VF on the PF, 'flr' resets the VF with a function level reset, 'rebind' unbinds and binds its driver again and 'mtu' restores the MTU of its netdev. The VFs failing a step are tainted.",
+			EnvVars: []string{"VF_SANITIZE_STEPS"},
+		},
+		&cli.IntFlag{
+			Name:        "audit-log-max-size",
+			Usage:       "Size in MiB the audit log of the host mutations (prepare, unprepare, driver binds, module loads, CNI ADD/DEL and resource name changes) is rotated at, under the plugin data directory. When zero, the audit log is disabled.",
+			Value:       10,
+			Destination: &flagsOptions.AuditLogMaxSize,
+			EnvVars:     []string{"AUDIT_LOG_MAX_SIZE"},
+		},
+		&cli.IntFlag{
+			Name:        "audit-log-max-backups",
+			Usage:       "Number of rotated audit log files kept.",
+			Value:       5,
+			Destination: &flagsOptions.AuditLogMaxBackups,
+			EnvVars:     []string{"AUDIT_LOG_MAX_BACKUPS"},
+		},
+		&cli.StringFlag{
+			Name:        "rolling-update-uid",
+			Usage:       "Unique ID of this plugin instance, usually the pod UID, enables the handover to a new instance during a DaemonSet rolling update with surge.",
+			Destination: &flagsOptions.RollingUpdateUID,
+			EnvVars:     []string{"ROLLING_UPDATE_UID"},
+		},
 		&cli.StringFlag{
 			Name:        "namespace",
 			Usage:       "Namespace where the driver should watch for SriovResourceFilter resources.",
@@ -101,13 +196,41 @@ func newApp() *cli.App {
 		ArgsUsage:       " ",
 		HideHelpCommand: true,
 		Flags:           cliFlags,
+		Commands:        newCommands(flagsOptions),
 		Before: func(c *cli.Context) error {
-			if c.Args().Len() > 0 {
-				return fmt.Errorf("arguments not supported: %v", c.Args().Slice())
+			if err := driver.ValidatePartitionMode(flagsOptions.ResourceSlicePartition); err != nil {
+				return err
+			}
+			if err := devicestate.ValidateHostDevicePolicy(flagsOptions.HostDevicePolicy); err != nil {
+				return err
+			}
+			flagsOptions.HostDeviceDenylist = c.StringSlice("host-device-denylist")
+			flagsOptions.VFSanitizeSteps = c.StringSlice("vf-sanitize-steps")
+			if err := devicestate.ValidateSanitizeSteps(flagsOptions.VFSanitizeSteps); err != nil {
+				return err
+			}
+			if err := devicestate.ValidateGUIDPool(flagsOptions.IBGUIDPool); err != nil {
+				return err
+			}
+			if flagsOptions.SFsPerPF < 0 {
+				return fmt.Errorf("invalid sfs-per-pf %d, must not be negative", flagsOptions.SFsPerPF)
+			}
+			if flagsOptions.SFsPerPF > 0 && !flagsOptions.PublishSFs {
+				return fmt.Errorf("sfs-per-pf requires publish-sfs")
+			}
+			if flagsOptions.AuditLogMaxSize < 0 || flagsOptions.AuditLogMaxBackups < 0 {
+				return fmt.Errorf("invalid audit-log-max-size %d or audit-log-max-backups %d, must not be negative",
+					flagsOptions.AuditLogMaxSize, flagsOptions.AuditLogMaxBackups)
 			}
 			return flagsOptions.LoggingConfig.Apply()
 		},
 		Action: func(c *cli.Context) error {
+			if c.Args().Len() > 0 {
+				return fmt.Errorf("arguments not supported: %v", c.Args().Slice())
+			}
+			if flagsOptions.NodeName == "" {
+				return fmt.Errorf("required flag \"node-name\" not set")
+			}
 			ctx := c.Context
 			clientSets, err := flagsOptions.KubeClientConfig.NewClientSets()
 			if err != nil {
@@ -159,18 +282,40 @@ func RunPlugin(ctx context.Context, config *types.Config) error {
 		return fmt.Errorf("unable to create CDI handler: %v", err)
 	}
 
-	// create device state manager
-	deviceStateManager, err := devicestate.NewManager(config, cdi)
-	if err != nil {
-		return err
+	// record the host mutations in the audit log
+	if config.Flags.AuditLogMaxSize > 0 {
+		config.AuditLogger, err = audit.NewLogger(config.AuditLogPath(), int64(config.Flags.AuditLogMaxSize)*1024*1024, config.Flags.AuditLogMaxBackups)
+		if err != nil {
+			return err
+		}
+		defer config.AuditLogger.Close()
 	}
 
+	// the host system shared by the device state manager and the NRI plugin
+	hostHelpers := host.NewHost(host.WithAuditLogger(config.AuditLogger))
+
 	// create pod manager
 	podManager, err := podmanager.NewPodManager(config)
 	if err != nil {
 		return err
 	}
 
+	// create device state manager, restoring the devices prepared before a restart
+	deviceStateManager, err := devicestate.NewManager(config, hostHelpers, cdi, podManager.GetAllPreparedDevices())
+	if err != nil {
+		return err
+	}
+	if config.Flags.RollingUpdateUID != "" {
+		// the other instance may prepare claims while both run during a rolling update
+		deviceStateManager.SetPreparedDevicesLister(podManager.GetAllPreparedDevices)
+		// the background device changes of the other instance stop once this one takes over
+		activeInstance, err := devicestate.NewActiveInstance(config)
+		if err != nil {
+			return err
+		}
+		deviceStateManager.SetActiveInstance(activeInstance)
+	}
+
 	// start driver
 	dvr, err := driver.Start(ctx, config, deviceStateManager, podManager, cdi)
 	if err != nil {
@@ -180,6 +325,19 @@ func RunPlugin(ctx context.Context, config *types.Config) error {
 	// Set up the republish callback so the device state manager can trigger resource republishing
 	deviceStateManager.SetRepublishCallback(dvr.PublishResources)
 
+	// Keep the link attributes of the published devices up to date
+	if config.Flags.LinkAttributesRefreshInterval > 0 {
+		go deviceStateManager.WatchLinkAttributes(ctx, config.Flags.LinkAttributesRefreshInterval)
+	}
+
+	// Taint the devices that become unhealthy and clear the taints on recovery
+	if config.Flags.DeviceHealthCheckInterval > 0 {
+		go deviceStateManager.WatchDeviceHealth(ctx, config.Flags.DeviceHealthCheckInterval)
+	}
+
+	// Pre-bind the idle devices of the resources with pre-binding enabled to their driver
+	go deviceStateManager.WatchPreBind(ctx)
+
 	// create controller manager
 	restConfig, err := config.Flags.KubeClientConfig.NewClientSetConfig()
 	if err != nil {
@@ -200,16 +358,24 @@ func RunPlugin(ctx context.Context, config *types.Config) error {
 		},
 	}
 
-	mgr, err := ctrl.NewManager(restConfig, ctrl.Options{
+	mgrOpts := ctrl.Options{
 		Scheme: flags.Scheme,
 		Logger: logger,
 		Cache:  cacheOpts,
-	})
+	}
+	if config.Flags.RollingUpdateUID != "" {
+		// both instances run in the host network during a rolling update, the second one
+		// would fail to bind the metrics port
+		mgrOpts.Metrics = metricsserver.Options{BindAddress: "0"}
+	}
+	mgr, err := ctrl.NewManager(restConfig, mgrOpts)
 	if err != nil {
 		return fmt.Errorf("failed to create controller manager: %w", err)
 	}
 
-	// create and setup resource filter controller
+	// create and setup resource filter controller, it runs in both instances during a rolling
+	// update as the prepares need the default configs of the resources, the pre-binding it
+	// triggers only runs in the active instance
 	resourceFilterController := controller.NewSriovResourceFilterReconciler(config.K8sClient.Client, config.Flags.NodeName, config.Flags.Namespace, deviceStateManager)
 	if err := resourceFilterController.SetupWithManager(mgr); err != nil {
 		return fmt.Errorf("failed to setup resource filter controller: %w", err)
@@ -237,7 +403,7 @@ func RunPlugin(ctx context.Context, config *types.Config) error {
 	cniRuntime := cni.New(consts.DriverName, []string{"/opt/cni/bin"})
 
 	// register to NRI
-	nriPlugin, err := nri.NewNRIPlugin(config, podManager, cniRuntime)
+	nriPlugin, err := nri.NewNRIPlugin(config, hostHelpers, podManager, cniRuntime)
 	if err != nil {
 		return fmt.Errorf("failed to create NRI plugin: %w", err)
 	}
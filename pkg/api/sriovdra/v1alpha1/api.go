@@ -18,6 +18,8 @@ package v1alpha1
 
 import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	configapi "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/virtualfunction/v1alpha1"
 )
 
 //nolint:gochecknoinits // Required for Kubernetes scheme registration
@@ -44,6 +46,15 @@ type SriovResourceFilterSpec struct {
 type Config struct {
 	ResourceName    string           `json:"resourceName,omitempty"`
 	ResourceFilters []ResourceFilter `json:"resourceFilters,omitempty"`
+	// ExcludeFilters removes the devices matching any of the filters from the resource
+	ExcludeFilters []ResourceFilter `json:"excludeFilters,omitempty"`
+	// DefaultConfig is the VfConfig of the devices of the resource, the VfConfigs of the
+	// device class and of the claim override its fields
+	DefaultConfig *configapi.VfConfig `json:"defaultConfig,omitempty"`
+	// PreBind binds the idle devices of the resource to the driver of the default config
+	// in the background, the prepare of a claim then skips the driver binding and the
+	// unprepare leaves the device bound to it
+	PreBind bool `json:"preBind,omitempty"`
 }
 
 // ResourceFilter is a filter for a resource
@@ -55,6 +66,12 @@ type ResourceFilter struct {
 	RootDevices  []string `json:"rootDevices,omitempty"`
 	NumaNodes    []string `json:"numaNodes,omitempty"`
 	Drivers      []string `json:"drivers,omitempty"`
+	// VfIDs are VF IDs, e.g. "3", or inclusive ranges of VF IDs, e.g. "0-7"
+	VfIDs []string `json:"vfIDs,omitempty"`
+	// Expression is a CEL expression evaluated against the published device, as the CEL
+	// selectors of the device requests, e.g.
+	// device.attributes["sriovnetwork.k8snetworkplumbingwg.io"].vfID < 8
+	Expression string `json:"expression,omitempty"`
 }
 
 // +genclient
@@ -21,6 +21,7 @@
 package v1alpha1
 
 import (
+	virtualfunctionv1alpha1 "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/virtualfunction/v1alpha1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -34,6 +35,18 @@ func (in *Config) DeepCopyInto(out *Config) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.ExcludeFilters != nil {
+		in, out := &in.ExcludeFilters, &out.ExcludeFilters
+		*out = make([]ResourceFilter, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.DefaultConfig != nil {
+		in, out := &in.DefaultConfig, &out.DefaultConfig
+		*out = new(virtualfunctionv1alpha1.VfConfig)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Config.
@@ -84,6 +97,11 @@ func (in *ResourceFilter) DeepCopyInto(out *ResourceFilter) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.VfIDs != nil {
+		in, out := &in.VfIDs, &out.VfIDs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceFilter.
@@ -29,7 +29,13 @@ const (
 	GroupName = consts.GroupName
 	Version   = "v1alpha1"
 
-	VfConfigKind = "VfConfig"
+	VfConfigKind         = "VfConfig"
+	BondConfigKind       = "BondConfig"
+	DeviceStatusDataKind = "DeviceStatusData"
+
+	// Bonding modes supported by BondConfig
+	BondModeActiveBackup = "active-backup"
+	BondModeLACP         = "802.3ad"
 )
 
 // Decoder implements a decoder for objects in this API group.
@@ -46,6 +52,17 @@ type VfConfig struct {
 	IfName                string `json:"ifName,omitempty"`
 	NetAttachDefName      string `json:"netAttachDefName,omitempty"`
 	NetAttachDefNamespace string `json:"netAttachDefNamespace,omitempty"`
+	// RDMA exposes the RDMA device of the VF to the pod: its character devices are added
+	// to the containers and, in exclusive mode, the device is moved to the pod netns.
+	RDMA bool `json:"rdma,omitempty"`
+	// GUID is the node and port GUID set on an InfiniBand VF. When empty, a GUID is
+	// allocated from the GUID pool of the node.
+	GUID string `json:"guid,omitempty"`
+	// PKey is the InfiniBand partition key of the VF, e.g. 0x8001.
+	PKey string `json:"pkey,omitempty"`
+	// Promiscuous lets a VF bound to a DPDK driver enable the promiscuous and all-multicast
+	// modes, the Intel VFs are trusted for it unless the net attach def sets trust.
+	Promiscuous bool `json:"promiscuous,omitempty"`
 }
 
 // DefaultGpuConfig provides the default GPU configuration.
@@ -72,6 +89,105 @@ func (c *VfConfig) Override(other *VfConfig) {
 	if other.NetAttachDefName != "" {
 		c.NetAttachDefName = other.NetAttachDefName
 	}
+	if other.RDMA {
+		c.RDMA = true
+	}
+	if other.GUID != "" {
+		c.GUID = other.GUID
+	}
+	if other.PKey != "" {
+		c.PKey = other.PKey
+	}
+	if other.Promiscuous {
+		c.Promiscuous = true
+	}
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// BondConfig bonds the VFs allocated for the requests it is applied to inside the pod
+// network namespace. The bond is created by the bond CNI once the VFs are attached.
+type BondConfig struct {
+	metav1.TypeMeta `json:",inline"`
+	// IfName is the name of the bond interface in the pod, bond0 by default.
+	IfName string `json:"ifName,omitempty"`
+	// Mode is the bonding mode, active-backup (default) or 802.3ad (LACP).
+	Mode string `json:"mode,omitempty"`
+	// Miimon is the link monitoring interval in milliseconds, 100 by default.
+	Miimon int `json:"miimon,omitempty"`
+	// NetAttachDefName is the NetworkAttachmentDefinition with the bond CNI configuration.
+	NetAttachDefName string `json:"netAttachDefName,omitempty"`
+	// NetAttachDefNamespace is the namespace of the NetworkAttachmentDefinition,
+	// the namespace of the claim by default.
+	NetAttachDefNamespace string `json:"netAttachDefNamespace,omitempty"`
+}
+
+// Normalize sets the default values of the unset BondConfig fields.
+func (c *BondConfig) Normalize() {
+	if c.IfName == "" {
+		c.IfName = "bond0"
+	}
+	if c.Mode == "" {
+		c.Mode = BondModeActiveBackup
+	}
+	if c.Miimon == 0 {
+		c.Miimon = 100
+	}
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// DeviceStatusData is the driver specific data published in the
+// ResourceClaim status (AllocatedDeviceStatus.Data) for every prepared VF.
+type DeviceStatusData struct {
+	metav1.TypeMeta `json:",inline"`
+	// PciAddress is the PCI address of the VF.
+	PciAddress string `json:"pciAddress,omitempty"`
+	// PFName is the network interface name of the parent PF.
+	PFName string `json:"pfName,omitempty"`
+	// IfName is the interface name of the VF inside the pod.
+	IfName string `json:"ifName,omitempty"`
+	// HardwareAddress is the MAC address of the VF.
+	HardwareAddress string `json:"hardwareAddress,omitempty"`
+	// Vlan is the VLAN ID configured on the VF, 0 means no VLAN.
+	Vlan int `json:"vlan,omitempty"`
+	// Driver is the kernel driver the VF is bound to.
+	Driver string `json:"driver,omitempty"`
+	// CNIResult is the CNI 1.0.0 result returned by the CNI ADD call.
+	CNIResult *runtime.RawExtension `json:"cniResult,omitempty"`
+	// RDMADevice is the RDMA device of the VF exposed to the pod.
+	RDMADevice string `json:"rdmaDevice,omitempty"`
+	// AuxDevice is the auxiliary bus device of a scalable function.
+	AuxDevice string `json:"auxDevice,omitempty"`
+	// GUID is the node and port GUID of an InfiniBand VF.
+	GUID string `json:"guid,omitempty"`
+	// PKey is the partition key of an InfiniBand VF.
+	PKey string `json:"pkey,omitempty"`
+	// Bond is set when the VF is a member of a bond.
+	Bond *BondStatus `json:"bond,omitempty"`
+	// Config is the effective VfConfig the device was prepared with, the default config
+	// of its resource name overridden by the class and claim configs.
+	Config *VfConfig `json:"config,omitempty"`
+}
+
+// BondStatus describes the bond a VF is a member of.
+type BondStatus struct {
+	// IfName is the name of the bond interface in the pod.
+	IfName string `json:"ifName"`
+	// Mode is the bonding mode.
+	Mode string `json:"mode"`
+	// Members are the interface names of the VFs enslaved to the bond in the pod.
+	Members []string `json:"members"`
+}
+
+// NewDeviceStatusData returns an empty DeviceStatusData with its TypeMeta set.
+func NewDeviceStatusData() *DeviceStatusData {
+	return &DeviceStatusData{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: GroupName + "/" + Version,
+			Kind:       DeviceStatusDataKind,
+		},
+	}
 }
 
 // Normalize updates a VfConfig config with implied default values.
@@ -92,6 +208,8 @@ func init() {
 	}
 	scheme.AddKnownTypes(schemeGroupVersion,
 		&VfConfig{},
+		&BondConfig{},
+		&DeviceStatusData{},
 	)
 	metav1.AddToGroupVersion(scheme, schemeGroupVersion)
 
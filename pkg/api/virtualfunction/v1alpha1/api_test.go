@@ -20,6 +20,7 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 
 	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
 )
@@ -196,6 +197,27 @@ var _ = Describe("VfConfig", func() {
 				Expect(base.NetAttachDefName).To(Equal("net2"))
 			})
 
+			It("should enable RDMA when other enables it", func() {
+				base := &VfConfig{
+					NetAttachDefName: "net1",
+				}
+				base.Override(&VfConfig{RDMA: true})
+				Expect(base.RDMA).To(BeTrue())
+
+				// a config without RDMA doesn't disable it
+				base.Override(&VfConfig{IfName: "eth1"})
+				Expect(base.RDMA).To(BeTrue())
+			})
+
+			It("should enable the promiscuous mode when other enables it", func() {
+				base := &VfConfig{Driver: "vfio-pci"}
+				base.Override(&VfConfig{Promiscuous: true})
+				Expect(base.Promiscuous).To(BeTrue())
+
+				base.Override(&VfConfig{IfName: "eth1"})
+				Expect(base.Promiscuous).To(BeTrue())
+			})
+
 			It("should override multiple fields but not all", func() {
 				base := &VfConfig{
 					Driver:           "vfio-pci",
@@ -399,3 +421,43 @@ var _ = Describe("VfConfig", func() {
 		})
 	})
 })
+
+var _ = Describe("BondConfig", func() {
+	It("should set the defaults on Normalize", func() {
+		config := &BondConfig{NetAttachDefName: "bond-net"}
+		config.Normalize()
+		Expect(config.IfName).To(Equal("bond0"))
+		Expect(config.Mode).To(Equal(BondModeActiveBackup))
+		Expect(config.Miimon).To(Equal(100))
+		Expect(config.Validate()).To(Succeed())
+	})
+
+	It("should keep the values that are set", func() {
+		config := &BondConfig{IfName: "bond1", Mode: BondModeLACP, Miimon: 50, NetAttachDefName: "bond-net"}
+		config.Normalize()
+		Expect(config.IfName).To(Equal("bond1"))
+		Expect(config.Mode).To(Equal(BondModeLACP))
+		Expect(config.Miimon).To(Equal(50))
+	})
+
+	It("should reject an unsupported mode", func() {
+		config := &BondConfig{Mode: "balance-rr", NetAttachDefName: "bond-net"}
+		Expect(config.Validate()).To(MatchError(ContainSubstring("unsupported bond mode")))
+	})
+
+	It("should require a net attach def", func() {
+		config := &BondConfig{}
+		config.Normalize()
+		Expect(config.Validate()).To(MatchError(ContainSubstring("no net attach def name set")))
+	})
+
+	It("should be decoded by the Decoder", func() {
+		decoded, err := runtime.Decode(Decoder, []byte(`{"apiVersion":"sriovnetwork.k8snetworkplumbingwg.io/v1alpha1","kind":"BondConfig","mode":"802.3ad","netAttachDefName":"bond-net"}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(decoded).To(Equal(&BondConfig{
+			TypeMeta:         metav1.TypeMeta{APIVersion: GroupName + "/" + Version, Kind: BondConfigKind},
+			Mode:             BondModeLACP,
+			NetAttachDefName: "bond-net",
+		}))
+	})
+})
@@ -0,0 +1,36 @@
+package v1alpha1
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// ToRawExtension encodes the DeviceStatusData so it can be stored in
+// AllocatedDeviceStatus.Data.
+func (d *DeviceStatusData) ToRawExtension() (*runtime.RawExtension, error) {
+	raw, err := json.Marshal(d)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal device status data: %w", err)
+	}
+	return &runtime.RawExtension{Raw: raw}, nil
+}
+
+// DecodeDeviceStatusData decodes the Data field of an AllocatedDeviceStatus
+// written by this driver into a DeviceStatusData.
+func DecodeDeviceStatusData(data *runtime.RawExtension) (*DeviceStatusData, error) {
+	if data == nil || len(data.Raw) == 0 {
+		return nil, fmt.Errorf("no device status data set")
+	}
+
+	decoded, err := runtime.Decode(Decoder, data.Raw)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding device status data: %w", err)
+	}
+	statusData, ok := decoded.(*DeviceStatusData)
+	if !ok {
+		return nil, fmt.Errorf("decoded object is not a DeviceStatusData but %T", decoded)
+	}
+	return statusData, nil
+}
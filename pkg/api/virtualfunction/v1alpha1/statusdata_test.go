@@ -0,0 +1,74 @@
+package v1alpha1
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
+)
+
+var _ = Describe("DeviceStatusData", func() {
+	Describe("NewDeviceStatusData", func() {
+		It("should set correct TypeMeta", func() {
+			data := NewDeviceStatusData()
+			Expect(data.APIVersion).To(Equal(consts.GroupName + "/" + Version))
+			Expect(data.Kind).To(Equal(DeviceStatusDataKind))
+		})
+	})
+
+	Describe("Encode and decode", func() {
+		It("should round trip all fields", func() {
+			data := NewDeviceStatusData()
+			data.PciAddress = "0000:01:00.1"
+			data.PFName = "eth0"
+			data.IfName = "vfnet0"
+			data.HardwareAddress = "aa:bb:cc:dd:ee:ff"
+			data.Vlan = 100
+			data.Driver = "iavf"
+			data.CNIResult = &runtime.RawExtension{Raw: []byte(`{"cniVersion":"1.0.0"}`)}
+
+			raw, err := data.ToRawExtension()
+			Expect(err).NotTo(HaveOccurred())
+
+			decoded, err := DecodeDeviceStatusData(raw)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(decoded.PciAddress).To(Equal("0000:01:00.1"))
+			Expect(decoded.PFName).To(Equal("eth0"))
+			Expect(decoded.IfName).To(Equal("vfnet0"))
+			Expect(decoded.HardwareAddress).To(Equal("aa:bb:cc:dd:ee:ff"))
+			Expect(decoded.Vlan).To(Equal(100))
+			Expect(decoded.Driver).To(Equal("iavf"))
+			Expect(decoded.CNIResult).NotTo(BeNil())
+			Expect(string(decoded.CNIResult.Raw)).To(MatchJSON(`{"cniVersion":"1.0.0"}`))
+		})
+
+		It("should fail on empty data", func() {
+			_, err := DecodeDeviceStatusData(nil)
+			Expect(err).To(HaveOccurred())
+
+			_, err = DecodeDeviceStatusData(&runtime.RawExtension{})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should fail when data is of another kind", func() {
+			raw, err := runtime.Encode(Decoder.(runtime.Encoder), &VfConfig{
+				TypeMeta:         DefaultVfConfig().TypeMeta,
+				Driver:           "vfio-pci",
+				NetAttachDefName: "net1",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = DecodeDeviceStatusData(&runtime.RawExtension{Raw: raw})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("not a DeviceStatusData"))
+		})
+
+		It("should fail on unknown fields", func() {
+			raw := []byte(`{"apiVersion":"` + consts.GroupName + `/v1alpha1","kind":"DeviceStatusData","unknown":"x"}`)
+			_, err := DecodeDeviceStatusData(&runtime.RawExtension{Raw: raw})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
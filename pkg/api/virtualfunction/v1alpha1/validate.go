@@ -13,3 +13,19 @@ func (c *VfConfig) Validate() error {
 
 	return nil
 }
+
+// Validate ensures that BondConfig has a valid set of values.
+func (c *BondConfig) Validate() error {
+	if c.NetAttachDefName == "" {
+		return fmt.Errorf("no net attach def name set for bond %s", c.IfName)
+	}
+	switch c.Mode {
+	case BondModeActiveBackup, BondModeLACP:
+	default:
+		return fmt.Errorf("unsupported bond mode %q, must be %q or %q", c.Mode, BondModeActiveBackup, BondModeLACP)
+	}
+	if c.Miimon < 0 {
+		return fmt.Errorf("invalid miimon %d for bond %s", c.Miimon, c.IfName)
+	}
+	return nil
+}
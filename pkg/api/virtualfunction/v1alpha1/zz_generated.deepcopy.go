@@ -24,6 +24,89 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BondConfig) DeepCopyInto(out *BondConfig) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BondConfig.
+func (in *BondConfig) DeepCopy() *BondConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(BondConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *BondConfig) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BondStatus) DeepCopyInto(out *BondStatus) {
+	*out = *in
+	if in.Members != nil {
+		in, out := &in.Members, &out.Members
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BondStatus.
+func (in *BondStatus) DeepCopy() *BondStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(BondStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DeviceStatusData) DeepCopyInto(out *DeviceStatusData) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	if in.CNIResult != nil {
+		in, out := &in.CNIResult, &out.CNIResult
+		*out = new(runtime.RawExtension)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Bond != nil {
+		in, out := &in.Bond, &out.Bond
+		*out = new(BondStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Config != nil {
+		in, out := &in.Config, &out.Config
+		*out = new(VfConfig)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DeviceStatusData.
+func (in *DeviceStatusData) DeepCopy() *DeviceStatusData {
+	if in == nil {
+		return nil
+	}
+	out := new(DeviceStatusData)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *DeviceStatusData) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *VfConfig) DeepCopyInto(out *VfConfig) {
 	*out = *in
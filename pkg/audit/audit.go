@@ -0,0 +1,348 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"k8s.io/klog/v2"
+)
+
+// Operations recorded in the audit log
+const (
+	OperationPrepare      = "prepare"
+	OperationUnprepare    = "unprepare"
+	OperationBind         = "bind"
+	OperationUnbind       = "unbind"
+	OperationModuleLoad   = "module-load"
+	OperationCNIAdd       = "cni-add"
+	OperationCNIDel       = "cni-del"
+	OperationResourceName = "resource-name"
+)
+
+// Outcomes of the recorded operations
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Event is an entry of the audit log, one JSON object per line
+type Event struct {
+	Time       time.Time `json:"time"`
+	Operation  string    `json:"operation"`
+	ClaimUID   string    `json:"claimUID,omitempty"`
+	Claim      string    `json:"claim,omitempty"`
+	PodUID     string    `json:"podUID,omitempty"`
+	Device     string    `json:"device,omitempty"`
+	PciAddress string    `json:"pciAddress,omitempty"`
+	Driver     string    `json:"driver,omitempty"`
+	// Details are the operation specific values, like the original driver of a prepared device,
+	// the loaded module or the previous resource name of a device
+	Details map[string]string `json:"details,omitempty"`
+	// Config is the VfConfig a device was prepared with
+	Config  interface{} `json:"config,omitempty"`
+	Outcome string      `json:"outcome"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// Fields identify the claim and the pod a host operation is done for. The host operations done
+// outside of a claim, like the pre-binding, have empty fields.
+type Fields struct {
+	ClaimUID string
+	Claim    string
+	PodUID   string
+}
+
+// Event returns an event of the operation carrying the fields
+func (f Fields) Event(operation string) Event {
+	return Event{Operation: operation, ClaimUID: f.ClaimUID, Claim: f.Claim, PodUID: f.PodUID}
+}
+
+// Logger appends the events to a JSON lines file. The file is rotated once it reaches its
+// maximum size, the rotated files are suffixed with .1 (the most recent) to .<maxBackups>.
+// The instances of the plugin share the file during a rolling update, the writes and the
+// rotations are serialized by locking the file suffixed with .lock, and an instance reopens
+// the file rotated by the other one before writing. A nil Logger drops the events.
+type Logger struct {
+	mutex      sync.Mutex
+	path       string
+	lockPath   string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	closed     bool
+}
+
+// NewLogger opens the audit log at path for appending. The log is rotated when writing an event
+// would make it larger than maxSize bytes, 0 disables the rotation.
+func NewLogger(path string, maxSize int64, maxBackups int) (*Logger, error) {
+	if maxSize < 0 || maxBackups < 0 {
+		return nil, fmt.Errorf("invalid audit log rotation: max size %d and max backups %d must not be negative", maxSize, maxBackups)
+	}
+	l := &Logger{
+		path:       path,
+		lockPath:   path + ".lock",
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Record appends an event to the log with the current time and the outcome of err. Failing to
+// write the log doesn't fail the audited operation, the error is only logged.
+func (l *Logger) Record(event Event, err error) {
+	if l == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	event.Outcome = OutcomeSuccess
+	if err != nil {
+		event.Outcome = OutcomeFailure
+		event.Error = err.Error()
+	}
+	data, marshalErr := json.Marshal(event)
+	if marshalErr != nil {
+		klog.ErrorS(marshalErr, "Failed to encode audit event", "operation", event.Operation)
+		return
+	}
+	data = append(data, '\n')
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.closed {
+		return
+	}
+	unlock, lockErr := l.lock()
+	if lockErr != nil {
+		klog.ErrorS(lockErr, "Failed to lock audit log", "path", l.path)
+		return
+	}
+	defer unlock()
+	if reopenErr := l.reopenIfRotated(); reopenErr != nil {
+		klog.ErrorS(reopenErr, "Failed to reopen audit log rotated by another instance", "path", l.path)
+		return
+	}
+	if l.maxSize > 0 {
+		if size := l.size(); size > 0 && size+int64(len(data)) > l.maxSize {
+			if rotateErr := l.rotate(); rotateErr != nil {
+				klog.ErrorS(rotateErr, "Failed to rotate audit log", "path", l.path)
+			}
+		}
+	}
+	if l.file == nil {
+		return
+	}
+	if _, writeErr := l.file.Write(data); writeErr != nil {
+		klog.ErrorS(writeErr, "Failed to write audit event", "path", l.path, "operation", event.Operation)
+	}
+}
+
+// Close closes the audit log
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.closed = true
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+func (l *Logger) open() error {
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log %s: %w", l.path, err)
+	}
+	l.file = file
+	return nil
+}
+
+// lock locks the audit log against the other instance of the plugin and returns the function
+// unlocking it
+func (l *Logger) lock() (func(), error) {
+	file, err := os.OpenFile(l.lockPath, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := unix.Flock(int(file.Fd()), unix.LOCK_EX); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return func() {
+		// closing the file releases the lock
+		file.Close()
+	}, nil
+}
+
+// reopenIfRotated opens the log again if another instance rotated it since it was opened, or if
+// a previous rotation failed to open it. The lock must be held.
+func (l *Logger) reopenIfRotated() error {
+	if l.file == nil {
+		return l.open()
+	}
+	opened, err := l.file.Stat()
+	if err != nil {
+		return err
+	}
+	current, err := os.Stat(l.path)
+	if err == nil && os.SameFile(opened, current) {
+		return nil
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := l.file.Close(); err != nil {
+		klog.ErrorS(err, "Failed to close rotated audit log", "path", l.path)
+	}
+	l.file = nil
+	return l.open()
+}
+
+// size returns the size of the log, the other instance may have written to it. The lock must be
+// held.
+func (l *Logger) size() int64 {
+	info, err := l.file.Stat()
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// rotate shifts the rotated files by one, dropping the oldest, and starts a new log.
+// l.mutex and the lock must be held.
+func (l *Logger) rotate() error {
+	if l.file != nil {
+		if err := l.file.Close(); err != nil {
+			klog.ErrorS(err, "Failed to close audit log before rotation", "path", l.path)
+		}
+		l.file = nil
+	}
+	if l.maxBackups == 0 {
+		if err := os.Remove(l.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return l.open()
+	}
+	for i := l.maxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(backupPath(l.path, i), backupPath(l.path, i+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if err := os.Rename(l.path, backupPath(l.path, 1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return l.open()
+}
+
+func backupPath(path string, index int) string {
+	return fmt.Sprintf("%s.%d", path, index)
+}
+
+// Filter selects the events returned by Query, empty fields match any event
+type Filter struct {
+	ClaimUID   string
+	PodUID     string
+	PciAddress string
+	Operation  string
+	Since      time.Time
+}
+
+// Matches returns true if the event is selected by the filter
+func (f Filter) Matches(event Event) bool {
+	return (f.ClaimUID == "" || event.ClaimUID == f.ClaimUID) &&
+		(f.PodUID == "" || event.PodUID == f.PodUID) &&
+		(f.PciAddress == "" || event.PciAddress == f.PciAddress) &&
+		(f.Operation == "" || event.Operation == f.Operation) &&
+		(f.Since.IsZero() || !event.Time.Before(f.Since))
+}
+
+// Query returns the events of the audit log at path and of its rotated files matching the
+// filter, oldest first. Lines that can't be decoded, like one cut by a crash, are skipped.
+func Query(path string, filter Filter) ([]Event, error) {
+	files, err := logFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	events := []Event{}
+	for _, file := range files {
+		fileEvents, err := readEvents(file, filter)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, fileEvents...)
+	}
+	return events, nil
+}
+
+// logFiles returns the rotated files of the log, oldest first, followed by the log itself
+func logFiles(path string) ([]string, error) {
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return nil, err
+	}
+	indexes := map[string]int{}
+	files := []string{}
+	for _, match := range matches {
+		index, err := strconv.Atoi(strings.TrimPrefix(match, path+"."))
+		if err != nil || index < 1 {
+			continue
+		}
+		indexes[match] = index
+		files = append(files, match)
+	}
+	sort.Slice(files, func(i, j int) bool { return indexes[files[i]] > indexes[files[j]] })
+	if _, err := os.Stat(path); err == nil {
+		files = append(files, path)
+	} else if len(files) == 0 {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return files, nil
+}
+
+func readEvents(path string, filter Filter) ([]Event, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			// rotated while being read
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	defer file.Close()
+
+	events := []Event{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		event := Event{}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue
+		}
+		if filter.Matches(event) {
+			events = append(events, event)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log %s: %w", path, err)
+	}
+	return events, nil
+}
@@ -0,0 +1,146 @@
+package audit_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/audit"
+)
+
+var _ = Describe("Audit log", func() {
+	var (
+		path string
+	)
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "audit.log")
+	})
+
+	It("should append the events with their outcome", func() {
+		logger, err := audit.NewLogger(path, 0, 0)
+		Expect(err).NotTo(HaveOccurred())
+		logger.Record(audit.Event{Operation: audit.OperationPrepare, ClaimUID: "claim-1", PodUID: "pod-1", PciAddress: "0000:01:00.1", Driver: "vfio-pci"}, nil)
+		logger.Record(audit.Event{Operation: audit.OperationBind, PciAddress: "0000:01:00.2", Driver: "vfio-pci"}, fmt.Errorf("no such driver"))
+		Expect(logger.Close()).To(Succeed())
+
+		events, err := audit.Query(path, audit.Filter{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(HaveLen(2))
+		Expect(events[0].Operation).To(Equal(audit.OperationPrepare))
+		Expect(events[0].ClaimUID).To(Equal("claim-1"))
+		Expect(events[0].Outcome).To(Equal(audit.OutcomeSuccess))
+		Expect(events[0].Time).NotTo(BeZero())
+		Expect(events[1].Outcome).To(Equal(audit.OutcomeFailure))
+		Expect(events[1].Error).To(Equal("no such driver"))
+
+		// reopening appends to the existing log
+		logger, err = audit.NewLogger(path, 0, 0)
+		Expect(err).NotTo(HaveOccurred())
+		logger.Record(audit.Event{Operation: audit.OperationUnprepare, ClaimUID: "claim-1"}, nil)
+		Expect(logger.Close()).To(Succeed())
+		events, err = audit.Query(path, audit.Filter{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(HaveLen(3))
+	})
+
+	It("should rotate the log and keep the configured backups", func() {
+		logger, err := audit.NewLogger(path, 200, 2)
+		Expect(err).NotTo(HaveOccurred())
+		for i := 0; i < 10; i++ {
+			logger.Record(audit.Event{Operation: audit.OperationBind, PciAddress: fmt.Sprintf("0000:01:00.%d", i)}, nil)
+		}
+		Expect(logger.Close()).To(Succeed())
+
+		for _, file := range []string{path, path + ".1", path + ".2"} {
+			info, err := os.Stat(file)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Size()).To(BeNumerically("<=", 200))
+		}
+		Expect(path + ".3").NotTo(BeAnExistingFile())
+
+		events, err := audit.Query(path, audit.Filter{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(events)).To(BeNumerically("<", 10))
+		// the most recent events are kept, oldest first
+		Expect(events[len(events)-1].PciAddress).To(Equal("0000:01:00.9"))
+		for i := 1; i < len(events); i++ {
+			Expect(events[i].PciAddress > events[i-1].PciAddress).To(BeTrue())
+		}
+	})
+
+	It("should share the log and its rotation with the other instance", func() {
+		logger, err := audit.NewLogger(path, 1000, 10)
+		Expect(err).NotTo(HaveOccurred())
+		defer logger.Close()
+		other, err := audit.NewLogger(path, 1000, 10)
+		Expect(err).NotTo(HaveOccurred())
+		defer other.Close()
+
+		for i := 0; i < 20; i++ {
+			logger.Record(audit.Event{Operation: audit.OperationBind, PciAddress: fmt.Sprintf("0000:01:00.%d", i)}, nil)
+			other.Record(audit.Event{Operation: audit.OperationUnbind, PciAddress: fmt.Sprintf("0000:01:00.%d", i)}, nil)
+		}
+
+		// no event is lost or written to a file after its rotation
+		events, err := audit.Query(path, audit.Filter{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(HaveLen(40))
+		Expect(events[39].Operation).To(Equal(audit.OperationUnbind))
+		Expect(events[39].PciAddress).To(Equal("0000:01:00.19"))
+		files, err := filepath.Glob(path + "*")
+		Expect(err).NotTo(HaveOccurred())
+		for _, file := range files {
+			info, err := os.Stat(file)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Size()).To(BeNumerically("<=", 1000), file)
+		}
+	})
+
+	It("should filter the events", func() {
+		logger, err := audit.NewLogger(path, 0, 0)
+		Expect(err).NotTo(HaveOccurred())
+		old := time.Now().Add(-time.Hour).UTC()
+		logger.Record(audit.Event{Time: old, Operation: audit.OperationPrepare, ClaimUID: "claim-1", PodUID: "pod-1", PciAddress: "0000:01:00.1"}, nil)
+		logger.Record(audit.Event{Operation: audit.OperationCNIAdd, ClaimUID: "claim-1", PodUID: "pod-1", PciAddress: "0000:01:00.1"}, nil)
+		logger.Record(audit.Event{Operation: audit.OperationPrepare, ClaimUID: "claim-2", PodUID: "pod-2", PciAddress: "0000:01:00.2"}, nil)
+		Expect(logger.Close()).To(Succeed())
+		// a line cut by a crash is skipped
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = file.WriteString(`{"time":"2026-`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(file.Close()).To(Succeed())
+
+		events, err := audit.Query(path, audit.Filter{ClaimUID: "claim-1"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(HaveLen(2))
+
+		events, err = audit.Query(path, audit.Filter{Operation: audit.OperationPrepare})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(HaveLen(2))
+
+		events, err = audit.Query(path, audit.Filter{PciAddress: "0000:01:00.2", PodUID: "pod-2"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(HaveLen(1))
+
+		events, err = audit.Query(path, audit.Filter{Since: time.Now().Add(-time.Minute)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(HaveLen(2))
+	})
+
+	It("should fail to query a missing log", func() {
+		_, err := audit.Query(path, audit.Filter{})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should drop the events of a nil logger", func() {
+		var logger *audit.Logger
+		logger.Record(audit.Event{Operation: audit.OperationPrepare}, nil)
+		Expect(logger.Close()).To(Succeed())
+	})
+})
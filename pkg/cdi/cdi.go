@@ -22,7 +22,8 @@ const (
 )
 
 type Handler struct {
-	cache *cdiapi.Cache
+	cache       *cdiapi.Cache
+	cdiRootPath string
 }
 
 func NewHandler(cdiRootPath string) (*Handler, error) {
@@ -33,7 +34,8 @@ func NewHandler(cdiRootPath string) (*Handler, error) {
 		return nil, fmt.Errorf("unable to create a new CDI cache: %w", err)
 	}
 	handler := &Handler{
-		cache: cache,
+		cache:       cache,
+		cdiRootPath: cdiRootPath,
 	}
 
 	return handler, nil
@@ -81,7 +83,7 @@ func (cdi *Handler) CreateClaimSpecFile(preparedDevices types.PreparedDevices) e
 
 	for _, device := range preparedDevices {
 		cdiDevice := cdispec.Device{
-			Name:           fmt.Sprintf("%s-%s", claimUID, device.Device.DeviceName),
+			Name:           fmt.Sprintf("%s-%s", claimUID, device.CDIDeviceName()),
 			ContainerEdits: *device.ContainerEdits.ContainerEdits,
 		}
 
@@ -126,6 +128,20 @@ func (cdi *Handler) DeleteSpecFile(uid string) error {
 	return cdi.cache.RemoveSpec(specName)
 }
 
+// ListSpecs returns the specs of the driver under the CDI root. The specs are read with a
+// new cache since the auto refresh of the handler cache is asynchronous. The error reports
+// the specs that couldn't be loaded.
+func (cdi *Handler) ListSpecs() ([]*cdiapi.Spec, error) {
+	cache, err := cdiapi.NewCache(
+		cdiapi.WithSpecDirs(cdi.cdiRootPath),
+		cdiapi.WithAutoRefresh(false),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create a new CDI cache: %w", err)
+	}
+	return cache.GetVendorSpecs(cdiVendor), cache.Refresh()
+}
+
 func (cdi *Handler) GetClaimDevices(claimUID string, device string) string {
 	return cdiparser.QualifiedName(cdiVendor, cdiClass, fmt.Sprintf("%s-%s", claimUID, device))
 }
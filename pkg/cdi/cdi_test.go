@@ -234,6 +234,21 @@ var _ = Describe("CDI Handler", func() {
 		})
 	})
 
+	Context("ListSpecs", func() {
+		It("should list the specs of the driver", func() {
+			Expect(handler.ListSpecs()).To(BeEmpty())
+
+			err := handler.CreateGlobalPodSpecFile(podUID, []string{pciAddress1})
+			Expect(err).NotTo(HaveOccurred())
+
+			specs, err := handler.ListSpecs()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(specs).To(HaveLen(1))
+			Expect(specs[0].GetPath()).To(ContainSubstring(podUID))
+			Expect(specs[0].Devices).To(ConsistOf(HaveField("Name", podUID)))
+		})
+	})
+
 	Context("GetClaimDevices", func() {
 		It("should return correct qualified device name", func() {
 			result := handler.GetClaimDevices(claimUID, deviceName)
@@ -28,6 +28,19 @@ const (
 	GroupName                  = "sriovnetwork.k8snetworkplumbingwg.io"
 	DriverName                 = "sriovnetwork.k8snetworkplumbingwg.io"
 	DriverPluginCheckpointFile = "checkpoint.json"
+	DriverPluginAuditLogFile   = "audit.log"
+	// DriverPluginCheckpointLockFile is locked around the accesses to the checkpoint, shared
+	// by the instances of the plugin during a rolling update
+	DriverPluginCheckpointLockFile = "checkpoint.lock"
+	// DriverPluginPodLocksDirectory holds the files locked around the CNI ADD and DEL of a pod,
+	// so only one instance of the plugin attaches or detaches its networks
+	DriverPluginPodLocksDirectory = "pod-locks"
+	// DriverPluginActiveInstanceFile records the rolling update UID of the instance of the plugin
+	// running the background device changes
+	DriverPluginActiveInstanceFile = "active-instance"
+	// DriverPluginSanitizeFailuresFile records the VFs that failed to be sanitized, so they stay
+	// tainted across restarts
+	DriverPluginSanitizeFailuresFile = "sanitize-failures.json"
 
 	AttributePciAddress   = DriverName + "/pciAddress"
 	AttributePFName       = DriverName + "/PFName"
@@ -37,6 +50,28 @@ const (
 	AttributePFDeviceID   = DriverName + "/pfDeviceID"
 	AttributeVFID         = DriverName + "/vfID"
 	AttributeResourceName = DriverName + "/resourceName"
+	// AttributeDriver is the driver an idle device is pre-bound to by its resource
+	AttributeDriver = DriverName + "/driver"
+	// AttributeDeviceType is "vf" for virtual functions and "sf" for scalable functions
+	AttributeDeviceType = DriverName + "/deviceType"
+	AttributeSFNum      = DriverName + "/sfNum"
+	// AttributeRDMA is true for the devices exposing an RDMA device
+	AttributeRDMA = DriverName + "/rdma"
+	// Link properties of the PF, refreshed when they change on the host
+	AttributePFMtu             = DriverName + "/pfMtu"
+	AttributePFOperState       = DriverName + "/pfOperState"
+	AttributePFCarrier         = DriverName + "/pfCarrier"
+	AttributePFPermMac         = DriverName + "/pfPermMac"
+	AttributePFDriver          = DriverName + "/pfDriver"
+	AttributePFDriverVersion   = DriverName + "/pfDriverVersion"
+	AttributePFFirmwareVersion = DriverName + "/pfFirmwareVersion"
+	// AttributeLinkLayer is the link layer of the PF, "ethernet" or "infiniband"
+	AttributeLinkLayer = DriverName + "/linkLayer"
+	// AttributePFBoardID is the board ID of the PF: the PSID of NVIDIA/Mellanox PFs, the VPD
+	// part number of Broadcom PFs
+	AttributePFBoardID = DriverName + "/pfBoardID"
+	// AttributeDDPPackage is the Dynamic Device Personalization package loaded by Intel ice PFs
+	AttributeDDPPackage = DriverName + "/ddpPackage"
 	// Use upstream Kubernetes standard attribute prefix for numaNode
 	AttributeNumaNode = deviceattribute.StandardDeviceAttributePrefix + "numaNode"
 	// Use upstream Kubernetes standard attribute prefix for pciAddress
@@ -45,9 +80,40 @@ const (
 	// This provides more granular filtering than PCIeRoot
 	AttributeParentPciAddress = DriverName + "/parentPciAddress"
 
+	// Consumable capacities published for PFs in bandwidth mode
+	CapacityBandwidth = DriverName + "/bandwidth" // in Gbps
+	CapacityVFs       = DriverName + "/vfs"
+	// CapacityLinkSpeed is the PF link speed in bits per second, published for VFs
+	CapacityLinkSpeed = DriverName + "/linkSpeed"
+
+	// TaintHostDevice is set on the devices used by the host system
+	TaintHostDevice = DriverName + "/host-device"
+	// Taints set by the device health monitor
+	TaintLinkDown   = DriverName + "/link-down"
+	TaintPCIError   = DriverName + "/pci-error"
+	TaintBindFailed = DriverName + "/bind-failed"
+	// TaintSanitizeFailed is set on the VFs that failed to be sanitized after unprepare
+	TaintSanitizeFailed = DriverName + "/sanitize-failed"
+	// AnnotationHostDevices is a comma separated list of PCI addresses or interface
+	// names of the node reserved for the host system
+	AnnotationHostDevices = DriverName + "/host-devices"
+	// AnnotationDryRun set to "true" on a SriovResourceFilter reports the resource name
+	// changes of the filter on each matching node without applying them
+	AnnotationDryRun = DriverName + "/dry-run"
+
+	// Device types
+	DeviceTypeVF = "vf"
+	DeviceTypeSF = "sf"
+
+	// Link layers of the PFs
+	LinkLayerEthernet   = "ethernet"
+	LinkLayerInfiniBand = "infiniband"
+
 	// Network device constants
 	NetClass  = 0x02 // Network controller class
 	SysBusPci = "/sys/bus/pci/devices"
+	// RDMACharDevicesDir holds the uverbs, umad and rdma_cm character devices
+	RDMACharDevicesDir = "/dev/infiniband"
 )
 
 // Kubernetes standard attributes
@@ -63,3 +129,13 @@ var Backoff = wait.Backoff{
 	Steps:    5,                      // Maximum 5 attempts
 	Cap:      2 * time.Second,        // Maximum delay between attempts
 }
+
+// NRIReconnectBackoff is used to reconnect the NRI plugin after losing the connection to the
+// container runtime, long enough for the runtime to restart
+var NRIReconnectBackoff = wait.Backoff{
+	Duration: time.Second,
+	Factor:   2.0,
+	Jitter:   0.1,
+	Steps:    8,
+	Cap:      30 * time.Second,
+}
@@ -25,6 +25,10 @@ var _ = Describe("Consts", func() {
 			Expect(consts.DriverPluginCheckpointFile).To(Equal("checkpoint.json"))
 		})
 
+		It("should have correct audit log file name", func() {
+			Expect(consts.DriverPluginAuditLogFile).To(Equal("audit.log"))
+		})
+
 		It("should use upstream standard attribute prefix", func() {
 			// Verify we're using the upstream Kubernetes standard prefix
 			Expect(deviceattribute.StandardDeviceAttributePrefix).To(Equal("resource.kubernetes.io/"))
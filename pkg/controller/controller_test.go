@@ -88,6 +88,8 @@ var _ = BeforeSuite(func(ctx SpecContext) {
 	devState.EXPECT().UpdateDeviceResourceNames(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
 		func(_ context.Context, m map[string]string) error { applied = m; return nil },
 	)
+	devState.EXPECT().UpdateResourceConfigs(gomock.Any()).AnyTimes()
+	devState.EXPECT().UpdatePreBindDrivers(gomock.Any()).AnyTimes()
 
 	reconciler = controller.NewSriovResourceFilterReconciler(mgr.GetClient(), "test-node", "dra-sriov-driver", devState)
 	Expect(reconciler.SetupWithManager(mgr)).To(Succeed())
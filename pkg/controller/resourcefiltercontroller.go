@@ -18,8 +18,11 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
@@ -27,7 +30,9 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
+	dracel "k8s.io/dynamic-resource-allocation/cel"
 	"k8s.io/klog/v2"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -40,14 +45,46 @@ import (
 	resourceapi "k8s.io/api/resource/v1"
 
 	sriovdrav1alpha1 "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/sriovdra/v1alpha1"
+	configapi "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/virtualfunction/v1alpha1"
 	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
 	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/devicestate"
+	drasriovtypes "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
 )
 
 const (
 	resourceFilterSyncEventName = "resource-filter-sync"
+
+	// dryRunEventReason is the reason of the events reporting the changes of a dry-run filter
+	dryRunEventReason = "DryRun"
+	// maxDryRunEventChanges bounds the changes listed in a dry-run event, the full list is logged
+	maxDryRunEventChanges = 20
+	// noResourceName stands for a device without a resource name in the dry-run reports
+	noResourceName = "<none>"
+	// invalidFilterEventReason is the reason of the events reporting an invalid filter
+	invalidFilterEventReason = "InvalidFilter"
 )
 
+// errInvalidFilter is returned for a filter with invalid VF IDs or CEL expressions
+var errInvalidFilter = errors.New("invalid SriovResourceFilter")
+
+// ResourceNameChange is the change of the resource name of a device a dry-run filter would make
+type ResourceNameChange struct {
+	Device string `json:"device"`
+	From   string `json:"from,omitempty"`
+	To     string `json:"to,omitempty"`
+}
+
+func (c ResourceNameChange) String() string {
+	from, to := c.From, c.To
+	if from == "" {
+		from = noResourceName
+	}
+	if to == "" {
+		to = noResourceName
+	}
+	return fmt.Sprintf("%s (%s -> %s)", c.Device, from, to)
+}
+
 // SriovResourceFilterReconciler reconciles SriovResourceFilter objects
 type SriovResourceFilterReconciler struct {
 	client.Client
@@ -56,6 +93,7 @@ type SriovResourceFilterReconciler struct {
 	currentResourceFilter *sriovdrav1alpha1.SriovResourceFilter
 	log                   klog.Logger
 	deviceStateManager    devicestate.DeviceState
+	recorder              record.EventRecorder
 }
 
 // NewSriovResourceFilterReconciler creates a new SriovResourceFilterReconciler
@@ -92,11 +130,16 @@ func (r *SriovResourceFilterReconciler) Reconcile(ctx context.Context, req ctrl.
 		return ctrl.Result{}, err
 	}
 
-	// Find matching resource filters for this node
-	var matchingFilters []*sriovdrav1alpha1.SriovResourceFilter
+	// Find matching resource filters for this node, the dry-run filters are only reported
+	var matchingFilters, dryRunFilters []*sriovdrav1alpha1.SriovResourceFilter
 	for i := range resourceFilterList.Items {
 		filter := &resourceFilterList.Items[i]
-		if r.matchesNodeSelector(node.Labels, filter.Spec.NodeSelector) {
+		if !r.matchesNodeSelector(node.Labels, filter.Spec.NodeSelector) {
+			continue
+		}
+		if IsDryRun(filter) {
+			dryRunFilters = append(dryRunFilters, filter)
+		} else {
 			matchingFilters = append(matchingFilters, filter)
 		}
 	}
@@ -115,7 +158,11 @@ func (r *SriovResourceFilterReconciler) Reconcile(ctx context.Context, req ctrl.
 		r.log.Info("Found matching SriovResourceFilter for node", "nodeName", r.nodeName, "filter", matchingFilters[0].Name)
 		r.currentResourceFilter = matchingFilters[0]
 		// Apply resource filter to devices
-		if err := r.applyResourceFilterToDevices(ctx); err != nil {
+		if err := r.applyResourceFilterToDevices(ctx); errors.Is(err, errInvalidFilter) {
+			// The filter is fixed by an update, which triggers a reconcile
+			r.reportInvalidFilter(r.currentResourceFilter, err)
+			r.currentResourceFilter = nil
+		} else if err != nil {
 			r.log.Error(err, "Failed to apply resource filter to devices")
 			return ctrl.Result{}, err
 		}
@@ -132,9 +179,76 @@ func (r *SriovResourceFilterReconciler) Reconcile(ctx context.Context, req ctrl.
 		r.currentResourceFilter = nil
 	}
 
+	// Report the changes of the dry-run filters against the resource names now published
+	for _, filter := range dryRunFilters {
+		r.reportDryRun(filter)
+	}
+
 	return ctrl.Result{}, nil
 }
 
+// IsDryRun returns true if the filter has the dry-run annotation set to true
+func IsDryRun(filter *sriovdrav1alpha1.SriovResourceFilter) bool {
+	dryRun, _ := strconv.ParseBool(filter.Annotations[consts.AnnotationDryRun])
+	return dryRun
+}
+
+// reportDryRun logs the resource name changes the filter would make on the node and records
+// them in an event of the filter
+func (r *SriovResourceFilterReconciler) reportDryRun(filter *sriovdrav1alpha1.SriovResourceFilter) {
+	devices := r.deviceStateManager.GetAllocatableDevices()
+	deviceResourceMap, err := r.filterDevices(filter, devices)
+	if err != nil {
+		r.reportInvalidFilter(filter, err)
+		return
+	}
+	changes := ResourceNameChanges(devices, deviceResourceMap)
+	r.log.Info("Dry-run SriovResourceFilter not applied", "filter", filter.Name, "nodeName", r.nodeName, "changes", changes)
+	if r.recorder == nil {
+		return
+	}
+
+	if len(changes) == 0 {
+		r.recorder.Eventf(filter, corev1.EventTypeNormal, dryRunEventReason,
+			"Node %s: no resource name change", r.nodeName)
+		return
+	}
+	listed := make([]string, 0, min(len(changes), maxDryRunEventChanges))
+	for _, change := range changes[:cap(listed)] {
+		listed = append(listed, change.String())
+	}
+	if len(changes) > len(listed) {
+		listed = append(listed, fmt.Sprintf("and %d more", len(changes)-len(listed)))
+	}
+	r.recorder.Eventf(filter, corev1.EventTypeNormal, dryRunEventReason,
+		"Node %s: %d device(s) would change resource name: %s", r.nodeName, len(changes), strings.Join(listed, ", "))
+}
+
+// reportInvalidFilter logs the error of the filter and records it in an event of the filter
+func (r *SriovResourceFilterReconciler) reportInvalidFilter(filter *sriovdrav1alpha1.SriovResourceFilter, err error) {
+	r.log.Error(err, "Invalid SriovResourceFilter not applied", "filter", filter.Name, "nodeName", r.nodeName)
+	if r.recorder != nil {
+		r.recorder.Eventf(filter, corev1.EventTypeWarning, invalidFilterEventReason, "Node %s: %v", r.nodeName, err)
+	}
+}
+
+// ResourceNameChanges returns the changes, sorted by device name, between the resource names
+// of the devices and the resource names of the device resource map
+func ResourceNameChanges(devices drasriovtypes.AllocatableDevices, deviceResourceMap map[string]string) []ResourceNameChange {
+	var changes []ResourceNameChange
+	for deviceName, device := range devices {
+		current := ""
+		if attr, exists := device.Attributes[consts.AttributeResourceName]; exists && attr.StringValue != nil {
+			current = *attr.StringValue
+		}
+		if proposed := deviceResourceMap[deviceName]; proposed != current {
+			changes = append(changes, ResourceNameChange{Device: deviceName, From: current, To: proposed})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Device < changes[j].Device })
+	return changes
+}
+
 // GetCurrentResourceFilter returns the currently active SriovResourceFilter for the node
 func (r *SriovResourceFilterReconciler) GetCurrentResourceFilter() *sriovdrav1alpha1.SriovResourceFilter {
 	return r.currentResourceFilter
@@ -196,37 +310,100 @@ func (r *SriovResourceFilterReconciler) matchesNodeSelector(nodeLabels map[strin
 
 // applyResourceFilterToDevices applies the current resource filter to devices
 func (r *SriovResourceFilterReconciler) applyResourceFilterToDevices(ctx context.Context) error {
-	deviceResourceMap := r.getFilteredDeviceResourceMap()
-	return r.deviceStateManager.UpdateDeviceResourceNames(ctx, deviceResourceMap)
+	deviceResourceMap, err := r.getFilteredDeviceResourceMap()
+	if err != nil {
+		return err
+	}
+	r.deviceStateManager.UpdateResourceConfigs(r.getResourceConfigs())
+	if err := r.deviceStateManager.UpdateDeviceResourceNames(ctx, deviceResourceMap); err != nil {
+		return err
+	}
+	r.deviceStateManager.UpdatePreBindDrivers(r.getPreBindDrivers())
+	return nil
 }
 
-// getFilteredDeviceResourceMap returns a map of device name to resource name based on the current resource filter
-func (r *SriovResourceFilterReconciler) getFilteredDeviceResourceMap() map[string]string {
-	deviceResourceMap := make(map[string]string)
+// getResourceConfigs returns the default VfConfigs of the resource names of the current resource filter,
+// the first config of a resource name with a default config sets it
+func (r *SriovResourceFilterReconciler) getResourceConfigs() map[string]*configapi.VfConfig {
+	resourceConfigs := make(map[string]*configapi.VfConfig)
+	if r.currentResourceFilter == nil {
+		return resourceConfigs
+	}
+	for _, config := range r.currentResourceFilter.Spec.Configs {
+		if config.ResourceName == "" || config.DefaultConfig == nil {
+			continue
+		}
+		if _, exists := resourceConfigs[config.ResourceName]; !exists {
+			resourceConfigs[config.ResourceName] = config.DefaultConfig.DeepCopy()
+		}
+	}
+	return resourceConfigs
+}
+
+// getPreBindDrivers returns the driver the idle devices of the resource names of the current
+// resource filter are pre-bound to, the first config of a resource name sets it
+func (r *SriovResourceFilterReconciler) getPreBindDrivers() map[string]string {
+	preBindDrivers := make(map[string]string)
+	if r.currentResourceFilter == nil {
+		return preBindDrivers
+	}
+	seen := make(map[string]bool)
+	for _, config := range r.currentResourceFilter.Spec.Configs {
+		if config.ResourceName == "" || seen[config.ResourceName] {
+			continue
+		}
+		seen[config.ResourceName] = true
+		if config.PreBind && config.DefaultConfig != nil {
+			preBindDrivers[config.ResourceName] = config.DefaultConfig.Driver
+		}
+	}
+	return preBindDrivers
+}
 
+// getFilteredDeviceResourceMap returns a map of device name to resource name based on the current resource filter
+func (r *SriovResourceFilterReconciler) getFilteredDeviceResourceMap() (map[string]string, error) {
 	// If no resource filter is active, return empty map (clears resource names)
 	if r.currentResourceFilter == nil {
 		r.log.V(2).Info("No active resource filter, clearing all resource names")
-		return deviceResourceMap
+		return make(map[string]string), nil
 	}
 
 	// Get all allocatable devices from device state manager
-	allocatableDevices := r.deviceStateManager.GetAllocatableDevices()
+	return r.filterDevices(r.currentResourceFilter, r.deviceStateManager.GetAllocatableDevices())
+}
+
+// FilterDevices returns the resource name the configs of the filter assign to each device,
+// the devices not matched by any config are not in the map. The node selector of the filter
+// is not evaluated.
+func FilterDevices(filter *sriovdrav1alpha1.SriovResourceFilter, devices drasriovtypes.AllocatableDevices) (map[string]string, error) {
+	r := &SriovResourceFilterReconciler{log: klog.Background().WithName("SriovResourceFilter")}
+	return r.filterDevices(filter, devices)
+}
+
+// filterDevices returns a map of device name to resource name for the devices matched by the configs of the filter,
+// the error wraps errInvalidFilter when the filter is invalid
+func (r *SriovResourceFilterReconciler) filterDevices(filter *sriovdrav1alpha1.SriovResourceFilter, allocatableDevices drasriovtypes.AllocatableDevices) (map[string]string, error) {
+	expressions, err := compileFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w %s: %w", errInvalidFilter, filter.Name, err)
+	}
+
+	deviceResourceMap := make(map[string]string)
 
 	r.log.V(2).Info("Applying resource filter to devices",
-		"filterName", r.currentResourceFilter.Name,
-		"totalConfigs", len(r.currentResourceFilter.Spec.Configs),
+		"filterName", filter.Name,
+		"totalConfigs", len(filter.Spec.Configs),
 		"totalDevices", len(allocatableDevices))
 
 	// Iterate through each config and apply its resource filters to devices
-	for _, config := range r.currentResourceFilter.Spec.Configs {
+	for _, config := range filter.Spec.Configs {
 		if config.ResourceName == "" {
-			r.log.V(2).Info("Skipping config with empty resource name", "filterName", r.currentResourceFilter.Name)
+			r.log.V(2).Info("Skipping config with empty resource name", "filterName", filter.Name)
 			continue
 		}
 
 		r.log.V(3).Info("Processing config",
-			"filterName", r.currentResourceFilter.Name,
+			"filterName", filter.Name,
 			"resourceName", config.ResourceName,
 			"filtersCount", len(config.ResourceFilters))
 
@@ -237,34 +414,92 @@ func (r *SriovResourceFilterReconciler) getFilteredDeviceResourceMap() map[strin
 				continue
 			}
 
-			if r.deviceMatchesFilters(device, config.ResourceFilters) {
+			if r.deviceMatchesFilters(device, config.ResourceFilters, expressions) &&
+				!r.deviceMatchesAnyFilter(device, config.ExcludeFilters, expressions) {
 				deviceResourceMap[deviceName] = config.ResourceName
 				r.log.V(3).Info("Device matches config filter",
 					"deviceName", deviceName,
 					"resourceName", config.ResourceName,
-					"filterName", r.currentResourceFilter.Name)
+					"filterName", filter.Name)
 			}
 		}
 	}
 
 	r.log.Info("Resource filter applied",
-		"filterName", r.currentResourceFilter.Name,
+		"filterName", filter.Name,
 		"matchingDevices", len(deviceResourceMap),
 		"totalDevices", len(allocatableDevices))
 
-	return deviceResourceMap
+	return deviceResourceMap, nil
+}
+
+// compileFilter validates the VF IDs of the resource filters and the pre-binding of the configs
+// and compiles their CEL expressions, the compiled expressions are returned by expression
+func compileFilter(filter *sriovdrav1alpha1.SriovResourceFilter) (map[string]dracel.CompilationResult, error) {
+	expressions := make(map[string]dracel.CompilationResult)
+	var errs []error
+	compile := func(path string, resourceFilters []sriovdrav1alpha1.ResourceFilter) {
+		for j, resourceFilter := range resourceFilters {
+			for _, vfIDs := range resourceFilter.VfIDs {
+				if _, _, err := parseVfIDRange(vfIDs); err != nil {
+					errs = append(errs, fmt.Errorf("%s[%d].vfIDs: %w", path, j, err))
+				}
+			}
+			if resourceFilter.Expression == "" {
+				continue
+			}
+			if _, exists := expressions[resourceFilter.Expression]; exists {
+				continue
+			}
+			result := dracel.GetCompiler(dracel.Features{}).CompileCELExpression(resourceFilter.Expression, dracel.Options{})
+			if result.Error != nil {
+				errs = append(errs, fmt.Errorf("%s[%d].expression: %w", path, j, result.Error))
+				continue
+			}
+			expressions[resourceFilter.Expression] = result
+		}
+	}
+	for i, config := range filter.Spec.Configs {
+		compile(fmt.Sprintf("configs[%d].resourceFilters", i), config.ResourceFilters)
+		compile(fmt.Sprintf("configs[%d].excludeFilters", i), config.ExcludeFilters)
+		if config.PreBind && (config.DefaultConfig == nil || config.DefaultConfig.Driver == "" || config.DefaultConfig.Driver == "default") {
+			errs = append(errs, fmt.Errorf("configs[%d].preBind: requires a driver in the default config", i))
+		}
+	}
+	return expressions, errors.Join(errs...)
+}
+
+// parseVfIDRange parses a VF ID, e.g. "3", or an inclusive range of VF IDs, e.g. "0-7"
+func parseVfIDRange(vfIDs string) (int64, int64, error) {
+	first, last, isRange := strings.Cut(vfIDs, "-")
+	low, err := strconv.ParseInt(strings.TrimSpace(first), 10, 64)
+	if err != nil || low < 0 {
+		return 0, 0, fmt.Errorf("invalid VF ID %q", vfIDs)
+	}
+	if !isRange {
+		return low, low, nil
+	}
+	high, err := strconv.ParseInt(strings.TrimSpace(last), 10, 64)
+	if err != nil || high < low {
+		return 0, 0, fmt.Errorf("invalid VF ID range %q", vfIDs)
+	}
+	return low, high, nil
 }
 
 // deviceMatchesFilters checks if a device matches any of the provided resource filters
-func (r *SriovResourceFilterReconciler) deviceMatchesFilters(device resourceapi.Device, filters []sriovdrav1alpha1.ResourceFilter) bool {
+func (r *SriovResourceFilterReconciler) deviceMatchesFilters(device resourceapi.Device, filters []sriovdrav1alpha1.ResourceFilter, expressions map[string]dracel.CompilationResult) bool {
 	// If no filters are specified, match all devices
 	if len(filters) == 0 {
 		return true
 	}
+	return r.deviceMatchesAnyFilter(device, filters, expressions)
+}
 
+// deviceMatchesAnyFilter checks if a device matches any of the filters, no filter matches no device
+func (r *SriovResourceFilterReconciler) deviceMatchesAnyFilter(device resourceapi.Device, filters []sriovdrav1alpha1.ResourceFilter, expressions map[string]dracel.CompilationResult) bool {
 	// Device matches if it matches ANY of the filters (OR logic)
 	for _, filter := range filters {
-		if r.deviceMatchesFilter(device, filter) {
+		if r.deviceMatchesFilter(device, filter, expressions) {
 			return true
 		}
 	}
@@ -272,8 +507,9 @@ func (r *SriovResourceFilterReconciler) deviceMatchesFilters(device resourceapi.
 	return false
 }
 
-// deviceMatchesFilter checks if a device matches a specific resource filter
-func (r *SriovResourceFilterReconciler) deviceMatchesFilter(device resourceapi.Device, filter sriovdrav1alpha1.ResourceFilter) bool {
+// deviceMatchesFilter checks if a device matches a specific resource filter, the CEL expression of the filter
+// is looked up in the compiled expressions
+func (r *SriovResourceFilterReconciler) deviceMatchesFilter(device resourceapi.Device, filter sriovdrav1alpha1.ResourceFilter, expressions map[string]dracel.CompilationResult) bool {
 	// Check vendor IDs
 	if len(filter.Vendors) > 0 {
 		vendorAttr, exists := device.Attributes[consts.AttributeVendorID]
@@ -349,10 +585,51 @@ func (r *SriovResourceFilterReconciler) deviceMatchesFilter(device resourceapi.D
 		r.log.V(3).Info("Driver filtering not yet implemented", "deviceName", device.Name)
 	}
 
+	// Check VF IDs
+	if len(filter.VfIDs) > 0 {
+		vfIDAttr, exists := device.Attributes[consts.AttributeVFID]
+		if !exists || vfIDAttr.IntValue == nil {
+			return false
+		}
+		if !r.vfIDsContain(filter.VfIDs, *vfIDAttr.IntValue) {
+			return false
+		}
+	}
+
+	// Check the CEL expression last, it's the most expensive check
+	if filter.Expression != "" {
+		expression, compiled := expressions[filter.Expression]
+		if !compiled {
+			return false
+		}
+		matches, _, err := expression.DeviceMatches(context.Background(), dracel.Device{
+			Driver:     consts.DriverName,
+			Attributes: device.Attributes,
+			Capacity:   device.Capacity,
+		})
+		if err != nil {
+			r.log.V(2).Info("Failed to evaluate CEL expression", "deviceName", device.Name, "expression", filter.Expression, "error", err)
+			return false
+		}
+		if !matches {
+			return false
+		}
+	}
+
 	// All specified filters match
 	return true
 }
 
+// vfIDsContain checks if the VF ID is one of the VF IDs or in one of the VF ID ranges
+func (r *SriovResourceFilterReconciler) vfIDsContain(vfIDRanges []string, vfID int64) bool {
+	for _, vfIDs := range vfIDRanges {
+		if low, high, err := parseVfIDRange(vfIDs); err == nil && vfID >= low && vfID <= high {
+			return true
+		}
+	}
+	return false
+}
+
 // stringSliceContains checks if a slice contains a specific string
 func (r *SriovResourceFilterReconciler) stringSliceContains(slice []string, item string) bool {
 	for _, s := range slice {
@@ -365,6 +642,10 @@ func (r *SriovResourceFilterReconciler) stringSliceContains(slice []string, item
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *SriovResourceFilterReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.recorder == nil {
+		r.recorder = mgr.GetEventRecorderFor(consts.DriverName + "/" + r.nodeName)
+	}
+
 	qHandler := func(q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
 		q.AddAfter(reconcile.Request{NamespacedName: types.NamespacedName{
 			Namespace: r.namespace,
@@ -2,11 +2,20 @@ package controller
 
 import (
 	"context"
+	"fmt"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
 	sriovdrav1alpha1 "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/sriovdra/v1alpha1"
+	configapi "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/virtualfunction/v1alpha1"
 	sriovconsts "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
 	drasriovtypes "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
 	resourceapi "k8s.io/api/resource/v1"
@@ -14,13 +23,23 @@ import (
 
 // localFakeState implements devicestate.DeviceState with minimal logic for unit tests (same package access)
 type localFakeState struct {
-	alloc drasriovtypes.AllocatableDevices
+	alloc           drasriovtypes.AllocatableDevices
+	applied         []map[string]string
+	resourceConfigs map[string]*configapi.VfConfig
+	preBindDrivers  map[string]string
 }
 
 func (l *localFakeState) GetAllocatableDevices() drasriovtypes.AllocatableDevices { return l.alloc }
-func (l *localFakeState) UpdateDeviceResourceNames(_ context.Context, _ map[string]string) error {
+func (l *localFakeState) UpdateDeviceResourceNames(_ context.Context, m map[string]string) error {
+	l.applied = append(l.applied, m)
 	return nil
 }
+func (l *localFakeState) UpdateResourceConfigs(c map[string]*configapi.VfConfig) {
+	l.resourceConfigs = c
+}
+func (l *localFakeState) UpdatePreBindDrivers(d map[string]string) {
+	l.preBindDrivers = d
+}
 
 var _ = Describe("matchesNodeSelector", func() {
 	It("handles empty, subset, and mismatch correctly", func() {
@@ -65,7 +84,7 @@ var _ = Describe("deviceMatchesFilter", func() {
 			},
 		}
 
-		Expect(r.deviceMatchesFilter(d, sriovdrav1alpha1.ResourceFilter{})).To(BeTrue())
+		Expect(r.deviceMatchesFilter(d, sriovdrav1alpha1.ResourceFilter{}, nil)).To(BeTrue())
 
 		f := sriovdrav1alpha1.ResourceFilter{
 			Vendors:      []string{"8086"},
@@ -76,15 +95,15 @@ var _ = Describe("deviceMatchesFilter", func() {
 			RootDevices: []string{"0000:00:00.0"},
 			NumaNodes:   []string{"0"},
 		}
-		Expect(r.deviceMatchesFilter(d, f)).To(BeTrue())
+		Expect(r.deviceMatchesFilter(d, f, nil)).To(BeTrue())
 
-		Expect(r.deviceMatchesFilter(d, sriovdrav1alpha1.ResourceFilter{Vendors: []string{"1234"}})).To(BeFalse())
-		Expect(r.deviceMatchesFilter(d, sriovdrav1alpha1.ResourceFilter{Devices: []string{"9999"}})).To(BeFalse())
-		Expect(r.deviceMatchesFilter(d, sriovdrav1alpha1.ResourceFilter{PciAddresses: []string{"0000:00:00.2"}})).To(BeFalse())
-		Expect(r.deviceMatchesFilter(d, sriovdrav1alpha1.ResourceFilter{PfNames: []string{"eth9"}})).To(BeFalse())
+		Expect(r.deviceMatchesFilter(d, sriovdrav1alpha1.ResourceFilter{Vendors: []string{"1234"}}, nil)).To(BeFalse())
+		Expect(r.deviceMatchesFilter(d, sriovdrav1alpha1.ResourceFilter{Devices: []string{"9999"}}, nil)).To(BeFalse())
+		Expect(r.deviceMatchesFilter(d, sriovdrav1alpha1.ResourceFilter{PciAddresses: []string{"0000:00:00.2"}}, nil)).To(BeFalse())
+		Expect(r.deviceMatchesFilter(d, sriovdrav1alpha1.ResourceFilter{PfNames: []string{"eth9"}}, nil)).To(BeFalse())
 		// Test with a different parent PCI address
-		Expect(r.deviceMatchesFilter(d, sriovdrav1alpha1.ResourceFilter{RootDevices: []string{"0000:00:ff.f"}})).To(BeFalse())
-		Expect(r.deviceMatchesFilter(d, sriovdrav1alpha1.ResourceFilter{NumaNodes: []string{"2"}})).To(BeFalse())
+		Expect(r.deviceMatchesFilter(d, sriovdrav1alpha1.ResourceFilter{RootDevices: []string{"0000:00:ff.f"}}, nil)).To(BeFalse())
+		Expect(r.deviceMatchesFilter(d, sriovdrav1alpha1.ResourceFilter{NumaNodes: []string{"2"}}, nil)).To(BeFalse())
 	})
 })
 
@@ -110,7 +129,8 @@ var _ = Describe("getFilteredDeviceResourceMap", func() {
 		}
 		r := &SriovResourceFilterReconciler{deviceStateManager: &localFakeState{alloc: alloc}}
 
-		m := r.getFilteredDeviceResourceMap()
+		m, err := r.getFilteredDeviceResourceMap()
+		Expect(err).NotTo(HaveOccurred())
 		Expect(m).To(BeEmpty())
 
 		r.currentResourceFilter = &sriovdrav1alpha1.SriovResourceFilter{
@@ -122,9 +142,276 @@ var _ = Describe("getFilteredDeviceResourceMap", func() {
 				},
 			},
 		}
-		m = r.getFilteredDeviceResourceMap()
+		m, err = r.getFilteredDeviceResourceMap()
+		Expect(err).NotTo(HaveOccurred())
 		Expect(m).To(HaveLen(2))
 		Expect(m["devA"]).To(Equal("resA"))
 		Expect(m["devB"]).To(Equal("resA"))
 	})
 })
+
+var _ = Describe("FilterDevices", func() {
+	It("assigns resource names without a device state manager", func() {
+		vendor := "15b3"
+		alloc := drasriovtypes.AllocatableDevices{
+			"devA": resourceapi.Device{
+				Name:       "devA",
+				Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{sriovconsts.AttributeVendorID: {StringValue: &vendor}},
+			},
+			"devB": resourceapi.Device{Name: "devB"},
+		}
+		filter := &sriovdrav1alpha1.SriovResourceFilter{
+			Spec: sriovdrav1alpha1.SriovResourceFilterSpec{
+				Configs: []sriovdrav1alpha1.Config{
+					{ResourceName: "mlx", ResourceFilters: []sriovdrav1alpha1.ResourceFilter{{Vendors: []string{"15b3"}}}},
+				},
+			},
+		}
+		Expect(FilterDevices(filter, alloc)).To(Equal(map[string]string{"devA": "mlx"}))
+	})
+})
+
+var _ = Describe("ResourceNameChanges", func() {
+	It("returns the sorted changes of resource names", func() {
+		resA := "resA"
+		alloc := drasriovtypes.AllocatableDevices{
+			"devA": resourceapi.Device{Name: "devA", Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				sriovconsts.AttributeResourceName: {StringValue: &resA},
+			}},
+			"devB": resourceapi.Device{Name: "devB"},
+			"devC": resourceapi.Device{Name: "devC", Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				sriovconsts.AttributeResourceName: {StringValue: &resA},
+			}},
+		}
+		changes := ResourceNameChanges(alloc, map[string]string{"devA": "resB", "devB": "resB", "devC": "resA"})
+		Expect(changes).To(Equal([]ResourceNameChange{
+			{Device: "devA", From: "resA", To: "resB"},
+			{Device: "devB", To: "resB"},
+		}))
+		Expect(changes[1].String()).To(Equal("devB (<none> -> resB)"))
+		Expect(ResourceNameChanges(alloc, map[string]string{})).To(HaveLen(2))
+	})
+})
+
+var _ = Describe("dry-run filters", func() {
+	var (
+		state    *localFakeState
+		recorder *record.FakeRecorder
+		r        *SriovResourceFilterReconciler
+	)
+
+	newFilter := func(name, resourceName string, dryRun bool) *sriovdrav1alpha1.SriovResourceFilter {
+		filter := &sriovdrav1alpha1.SriovResourceFilter{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "dra-sriov-driver"},
+			Spec:       sriovdrav1alpha1.SriovResourceFilterSpec{Configs: []sriovdrav1alpha1.Config{{ResourceName: resourceName}}},
+		}
+		if dryRun {
+			filter.Annotations = map[string]string{sriovconsts.AnnotationDryRun: "true"}
+		}
+		return filter
+	}
+
+	reconcile := func(ctx context.Context, filters ...*sriovdrav1alpha1.SriovResourceFilter) {
+		scheme := runtime.NewScheme()
+		Expect(corev1.AddToScheme(scheme)).To(Succeed())
+		Expect(sriovdrav1alpha1.AddToScheme(scheme)).To(Succeed())
+		builder := fake.NewClientBuilder().WithScheme(scheme).
+			WithObjects(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+		for _, filter := range filters {
+			builder = builder.WithObjects(filter)
+		}
+		r = NewSriovResourceFilterReconciler(builder.Build(), "node1", "dra-sriov-driver", state)
+		r.recorder = recorder
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "dra-sriov-driver", Name: "sync"}})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		resA := "resA"
+		state = &localFakeState{alloc: drasriovtypes.AllocatableDevices{
+			"devA": resourceapi.Device{Name: "devA", Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				sriovconsts.AttributeResourceName: {StringValue: &resA},
+			}},
+			"devB": resourceapi.Device{Name: "devB"},
+		}}
+		recorder = record.NewFakeRecorder(10)
+	})
+
+	It("reports the changes of a dry-run filter without applying it", func(ctx SpecContext) {
+		reconcile(ctx, newFilter("dry", "resB", true))
+
+		Expect(r.HasResourceFilter()).To(BeFalse())
+		Expect(state.applied).To(ConsistOf(BeEmpty()))
+		Expect(recorder.Events).To(Receive(Equal(
+			"Normal DryRun Node node1: 2 device(s) would change resource name: devA (resA -> resB), devB (<none> -> resB)")))
+	})
+
+	It("applies the other filter and doesn't count the dry-run filter as a match", func(ctx SpecContext) {
+		reconcile(ctx, newFilter("active", "resA", false), newFilter("dry", "resA", true))
+
+		Expect(r.GetCurrentResourceFilter().Name).To(Equal("active"))
+		Expect(state.applied).To(ConsistOf(Equal(map[string]string{"devA": "resA", "devB": "resA"})))
+		// the devices of the fake state aren't updated when the filter is applied
+		Expect(recorder.Events).To(Receive(ContainSubstring("devB (<none> -> resA)")))
+	})
+
+	It("bounds the changes listed in the event", func(ctx SpecContext) {
+		for i := range maxDryRunEventChanges + 5 {
+			name := fmt.Sprintf("dev%02d", i)
+			state.alloc[name] = resourceapi.Device{Name: name}
+		}
+		reconcile(ctx, newFilter("dry", "resA", true))
+
+		Expect(recorder.Events).To(Receive(And(
+			ContainSubstring("26 device(s) would change"),
+			HaveSuffix("and 6 more"),
+		)))
+	})
+
+	It("reports no change", func(ctx SpecContext) {
+		delete(state.alloc, "devB")
+		reconcile(ctx, newFilter("dry", "resA", true))
+
+		Expect(recorder.Events).To(Receive(Equal("Normal DryRun Node node1: no resource name change")))
+	})
+})
+
+var _ = Describe("filter expressions", func() {
+	var alloc drasriovtypes.AllocatableDevices
+
+	BeforeEach(func() {
+		alloc = drasriovtypes.AllocatableDevices{}
+		for vfID := range int64(4) {
+			name := fmt.Sprintf("vf%d", vfID)
+			pci := fmt.Sprintf("0000:01:00.%d", vfID+1)
+			alloc[name] = resourceapi.Device{Name: name, Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				sriovconsts.AttributeVFID:       {IntValue: &vfID},
+				sriovconsts.AttributePciAddress: {StringValue: &pci},
+			}}
+		}
+		alloc["sf"] = resourceapi.Device{Name: "sf"}
+	})
+
+	newFilter := func(configs ...sriovdrav1alpha1.Config) *sriovdrav1alpha1.SriovResourceFilter {
+		return &sriovdrav1alpha1.SriovResourceFilter{
+			ObjectMeta: metav1.ObjectMeta{Name: "filter"},
+			Spec:       sriovdrav1alpha1.SriovResourceFilterSpec{Configs: configs},
+		}
+	}
+
+	It("matches VF IDs and VF ID ranges", func() {
+		Expect(FilterDevices(newFilter(sriovdrav1alpha1.Config{
+			ResourceName:    "res",
+			ResourceFilters: []sriovdrav1alpha1.ResourceFilter{{VfIDs: []string{"0", "2-3"}}},
+		}), alloc)).To(Equal(map[string]string{"vf0": "res", "vf2": "res", "vf3": "res"}))
+	})
+
+	It("excludes the devices matching the exclude filters", func() {
+		Expect(FilterDevices(newFilter(sriovdrav1alpha1.Config{
+			ResourceName:   "res",
+			ExcludeFilters: []sriovdrav1alpha1.ResourceFilter{{VfIDs: []string{"0"}}, {PciAddresses: []string{"0000:01:00.4"}}},
+		}), alloc)).To(Equal(map[string]string{"vf1": "res", "vf2": "res", "sf": "res"}))
+	})
+
+	It("matches the devices with a CEL expression", func() {
+		Expect(FilterDevices(newFilter(sriovdrav1alpha1.Config{
+			ResourceName: "res",
+			ResourceFilters: []sriovdrav1alpha1.ResourceFilter{{
+				Expression: `device.attributes["` + sriovconsts.DriverName + `"].vfID < 2 && device.attributes["` + sriovconsts.DriverName + `"].pciAddress >= "0000:01:00.2"`,
+			}},
+		}), alloc)).To(Equal(map[string]string{"vf1": "res"}))
+	})
+
+	It("doesn't match the devices the CEL expression fails to evaluate on", func() {
+		Expect(FilterDevices(newFilter(sriovdrav1alpha1.Config{
+			ResourceName:    "res",
+			ResourceFilters: []sriovdrav1alpha1.ResourceFilter{{Expression: `device.attributes["` + sriovconsts.DriverName + `"].vfID >= 3`}},
+		}), alloc)).To(Equal(map[string]string{"vf3": "res"}))
+	})
+
+	It("returns the errors of the invalid VF IDs and CEL expressions", func() {
+		_, err := FilterDevices(newFilter(
+			sriovdrav1alpha1.Config{ResourceName: "a", ResourceFilters: []sriovdrav1alpha1.ResourceFilter{{VfIDs: []string{"3-1"}}}},
+			sriovdrav1alpha1.Config{ResourceName: "b", ExcludeFilters: []sriovdrav1alpha1.ResourceFilter{{}, {Expression: "device.driver +"}}},
+		), alloc)
+		Expect(err).To(MatchError(errInvalidFilter))
+		Expect(err).To(MatchError(ContainSubstring(`configs[0].resourceFilters[0].vfIDs: invalid VF ID range "3-1"`)))
+		Expect(err).To(MatchError(ContainSubstring("configs[1].excludeFilters[1].expression:")))
+	})
+
+	It("reports an invalid filter without applying it", func(ctx SpecContext) {
+		scheme := runtime.NewScheme()
+		Expect(corev1.AddToScheme(scheme)).To(Succeed())
+		Expect(sriovdrav1alpha1.AddToScheme(scheme)).To(Succeed())
+		filter := newFilter(sriovdrav1alpha1.Config{ResourceName: "res", ResourceFilters: []sriovdrav1alpha1.ResourceFilter{{Expression: "1"}}})
+		filter.Namespace = "dra-sriov-driver"
+		c := fake.NewClientBuilder().WithScheme(scheme).
+			WithObjects(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}, filter).Build()
+		state := &localFakeState{alloc: alloc}
+		recorder := record.NewFakeRecorder(10)
+		r := NewSriovResourceFilterReconciler(c, "node1", "dra-sriov-driver", state)
+		r.recorder = recorder
+
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "dra-sriov-driver", Name: "sync"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.HasResourceFilter()).To(BeFalse())
+		Expect(state.applied).To(BeEmpty())
+		Expect(recorder.Events).To(Receive(HavePrefix("Warning InvalidFilter Node node1: invalid SriovResourceFilter filter: configs[0].resourceFilters[0].expression:")))
+	})
+})
+
+var _ = Describe("getResourceConfigs", func() {
+	It("returns the default config of the first config of each resource name", func(ctx SpecContext) {
+		state := &localFakeState{alloc: drasriovtypes.AllocatableDevices{}}
+		r := NewSriovResourceFilterReconciler(nil, "node1", "dra-sriov-driver", state)
+		Expect(r.getResourceConfigs()).To(BeEmpty())
+
+		r.currentResourceFilter = &sriovdrav1alpha1.SriovResourceFilter{
+			Spec: sriovdrav1alpha1.SriovResourceFilterSpec{Configs: []sriovdrav1alpha1.Config{
+				{ResourceName: "dpdk", DefaultConfig: &configapi.VfConfig{Driver: "vfio-pci", AddVhostMount: true}},
+				{ResourceName: "dpdk", DefaultConfig: &configapi.VfConfig{Driver: "igb_uio"}},
+				{ResourceName: "netdev"},
+				{DefaultConfig: &configapi.VfConfig{Driver: "vfio-pci"}},
+			}},
+		}
+		Expect(r.applyResourceFilterToDevices(ctx)).To(Succeed())
+		Expect(state.resourceConfigs).To(Equal(map[string]*configapi.VfConfig{
+			"dpdk": {Driver: "vfio-pci", AddVhostMount: true},
+		}))
+	})
+})
+
+var _ = Describe("getPreBindDrivers", func() {
+	It("returns the driver of the default config of the resource names with pre-binding", func(ctx SpecContext) {
+		state := &localFakeState{alloc: drasriovtypes.AllocatableDevices{}}
+		r := NewSriovResourceFilterReconciler(nil, "node1", "dra-sriov-driver", state)
+		Expect(r.getPreBindDrivers()).To(BeEmpty())
+
+		r.currentResourceFilter = &sriovdrav1alpha1.SriovResourceFilter{
+			Spec: sriovdrav1alpha1.SriovResourceFilterSpec{Configs: []sriovdrav1alpha1.Config{
+				{ResourceName: "dpdk", DefaultConfig: &configapi.VfConfig{Driver: "vfio-pci"}, PreBind: true},
+				{ResourceName: "dpdk", DefaultConfig: &configapi.VfConfig{Driver: "igb_uio"}, PreBind: true},
+				{ResourceName: "netdev", DefaultConfig: &configapi.VfConfig{Driver: "iavf"}},
+				{ResourceName: "netdev", DefaultConfig: &configapi.VfConfig{Driver: "vfio-pci"}, PreBind: true},
+			}},
+		}
+		Expect(r.applyResourceFilterToDevices(ctx)).To(Succeed())
+		Expect(state.preBindDrivers).To(Equal(map[string]string{"dpdk": "vfio-pci"}))
+	})
+
+	It("rejects the pre-binding of a resource without a driver in its default config", func() {
+		filter := &sriovdrav1alpha1.SriovResourceFilter{
+			ObjectMeta: metav1.ObjectMeta{Name: "filter"},
+			Spec: sriovdrav1alpha1.SriovResourceFilterSpec{Configs: []sriovdrav1alpha1.Config{
+				{ResourceName: "a", PreBind: true},
+				{ResourceName: "b", DefaultConfig: &configapi.VfConfig{Driver: "default"}, PreBind: true},
+				{ResourceName: "c", DefaultConfig: &configapi.VfConfig{Driver: "vfio-pci"}, PreBind: true},
+			}},
+		}
+		_, err := FilterDevices(filter, drasriovtypes.AllocatableDevices{})
+		Expect(err).To(MatchError(errInvalidFilter))
+		Expect(err).To(MatchError(ContainSubstring("configs[0].preBind: requires a driver in the default config")))
+		Expect(err).To(MatchError(ContainSubstring("configs[1].preBind:")))
+		Expect(err).NotTo(MatchError(ContainSubstring("configs[2]")))
+	})
+})
@@ -0,0 +1,99 @@
+package devicestate
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+	"k8s.io/klog/v2"
+
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
+	drasriovtypes "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
+)
+
+// ActiveInstance elects the instance of the plugin running the background loops that change the
+// devices, the pre-binding and the health check, while two instances run during a rolling
+// update. The newest instance takes over on start by writing its rolling update UID to the
+// active instance file, and the loops of the other one skip their runs from then on. The file
+// is locked during the runs, so the takeover waits for a run of the other instance.
+type ActiveInstance struct {
+	uid  string
+	path string
+}
+
+// NewActiveInstance makes the instance with the rolling update UID the active one
+func NewActiveInstance(config *drasriovtypes.Config) (*ActiveInstance, error) {
+	a := &ActiveInstance{
+		uid:  config.Flags.RollingUpdateUID,
+		path: filepath.Join(config.DriverPluginPath(), consts.DriverPluginActiveInstanceFile),
+	}
+	file, unlock, err := a.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if err := file.Truncate(0); err != nil {
+		return nil, fmt.Errorf("unable to take over active instance: %v", err)
+	}
+	if _, err := file.WriteAt([]byte(a.uid), 0); err != nil {
+		return nil, fmt.Errorf("unable to take over active instance: %v", err)
+	}
+	klog.Infof("Took over the background device changes as instance %s", a.uid)
+	return a, nil
+}
+
+// Lock locks the active instance file and returns the function unlocking it, and true if this
+// instance is still the active one. The lock is held during a run of a background loop.
+func (a *ActiveInstance) Lock() (func(), bool) {
+	file, unlock, err := a.lock()
+	if err != nil {
+		// the loops keep running, as before the rolling updates were supported
+		klog.ErrorS(err, "Failed to lock active instance")
+		return func() {}, true
+	}
+	data, err := io.ReadAll(io.NewSectionReader(file, 0, 1<<10))
+	if err != nil {
+		klog.ErrorS(err, "Failed to read active instance")
+		return unlock, true
+	}
+	return unlock, string(data) == a.uid
+}
+
+func (a *ActiveInstance) lock() (*os.File, func(), error) {
+	file, err := os.OpenFile(a.path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to open active instance file: %v", err)
+	}
+	if err := unix.Flock(int(file.Fd()), unix.LOCK_EX); err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("unable to lock active instance file: %v", err)
+	}
+	return file, func() {
+		// closing the file releases the lock
+		file.Close()
+	}, nil
+}
+
+// SetActiveInstance sets the election of the instance running the background loops changing the
+// devices during a rolling update, they always run without it
+func (s *Manager) SetActiveInstance(activeInstance *ActiveInstance) {
+	s.activeInstance = activeInstance
+}
+
+// runIfActive runs a run of a background loop changing the devices if this instance of the
+// plugin is the active one, holding the active instance lock
+func (s *Manager) runIfActive(logger klog.Logger, run func()) {
+	if s.activeInstance == nil {
+		run()
+		return
+	}
+	unlock, active := s.activeInstance.Lock()
+	defer unlock()
+	if !active {
+		logger.V(2).Info("Skipping the run, another instance of the plugin took over")
+		return
+	}
+	run()
+}
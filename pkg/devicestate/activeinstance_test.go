@@ -0,0 +1,69 @@
+package devicestate
+
+import (
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/klog/v2"
+
+	drasriovtypes "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
+)
+
+var _ = Describe("Active instance", func() {
+	var pluginsDir string
+
+	newActiveInstance := func(uid string) *ActiveInstance {
+		activeInstance, err := NewActiveInstance(&drasriovtypes.Config{Flags: &drasriovtypes.Flags{
+			KubeletPluginsDirectoryPath: pluginsDir,
+			RollingUpdateUID:            uid,
+		}})
+		Expect(err).NotTo(HaveOccurred())
+		return activeInstance
+	}
+
+	BeforeEach(func() {
+		pluginsDir = GinkgoT().TempDir()
+		config := drasriovtypes.Config{Flags: &drasriovtypes.Flags{KubeletPluginsDirectoryPath: pluginsDir}}
+		Expect(os.MkdirAll(config.DriverPluginPath(), 0750)).To(Succeed())
+	})
+
+	It("runs the background loops of the newest instance only", func() {
+		old := &Manager{activeInstance: newActiveInstance("old-uid")}
+		runs := 0
+		old.runIfActive(klog.Background(), func() { runs++ })
+		Expect(runs).To(Equal(1))
+
+		replacement := &Manager{activeInstance: newActiveInstance("new-uid")}
+		old.runIfActive(klog.Background(), func() { runs++ })
+		Expect(runs).To(Equal(1))
+		replacement.runIfActive(klog.Background(), func() { runs++ })
+		Expect(runs).To(Equal(2))
+	})
+
+	It("waits for the run of the other instance to take over", func() {
+		old := &Manager{activeInstance: newActiveInstance("old-uid")}
+		running := make(chan struct{})
+		finish := make(chan struct{})
+		go old.runIfActive(klog.Background(), func() {
+			close(running)
+			<-finish
+		})
+		<-running
+
+		tookOver := make(chan *ActiveInstance)
+		go func() {
+			defer GinkgoRecover()
+			tookOver <- newActiveInstance("new-uid")
+		}()
+		Consistently(tookOver, "200ms").ShouldNot(Receive())
+		close(finish)
+		Eventually(tookOver).Should(Receive())
+	})
+
+	It("always runs the background loops without a rolling update", func() {
+		runs := 0
+		(&Manager{}).runIfActive(klog.Background(), func() { runs++ })
+		Expect(runs).To(Equal(1))
+	})
+})
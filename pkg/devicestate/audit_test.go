@@ -0,0 +1,136 @@
+package devicestate
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+
+	netattdefv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	resourceapi "k8s.io/api/resource/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	configapi "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/virtualfunction/v1alpha1"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/audit"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/cdi"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/flags"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host/fakehost"
+	drasriovtypes "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
+)
+
+var _ = Describe("Audit log", func() {
+	var (
+		fakeHost  *fakehost.Host
+		s         *Manager
+		auditLog  *audit.Logger
+		auditPath string
+	)
+
+	claim := func() *resourceapi.ResourceClaim {
+		return newClaim("claim1", "0000-01-00-1", &configapi.VfConfig{NetAttachDefName: "sriov", Driver: "vfio-pci"})
+	}
+
+	events := func(filter audit.Filter) []audit.Event {
+		events, err := audit.Query(auditPath, filter)
+		Expect(err).NotTo(HaveOccurred())
+		return events
+	}
+
+	BeforeEach(func() {
+		fakeHost = newFakeHost(1, 9000)
+		cdiHandler, err := cdi.NewHandler(GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+		auditPath = filepath.Join(GinkgoT().TempDir(), "audit.log")
+		auditLog, err = audit.NewLogger(auditPath, 0, 0)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(auditLog.Close)
+		nad := &netattdefv1.NetworkAttachmentDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: "sriov", Namespace: "default"},
+			Spec:       netattdefv1.NetworkAttachmentDefinitionSpec{Config: `{"type":"sriov"}`},
+		}
+		s, err = NewManager(&drasriovtypes.Config{
+			Flags: &drasriovtypes.Flags{
+				NodeName:               "node1",
+				DefaultInterfacePrefix: "net",
+				HostDevicePolicy:       HostDevicePolicySkip,
+			},
+			K8sClient:   flags.ClientSets{Client: fake.NewClientBuilder().WithScheme(flags.Scheme).WithObjects(nad).Build()},
+			AuditLogger: auditLog,
+		}, fakeHost, cdiHandler, nil)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("records the prepared and unprepared devices of a claim", func(ctx SpecContext) {
+		ifNameIndex := 0
+		prepared, err := s.PrepareDevicesForClaim(ctx, &ifNameIndex, claim())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s.Unprepare("claim1", prepared)).To(Succeed())
+
+		recorded := events(audit.Filter{ClaimUID: "claim1"})
+		Expect(recorded).To(HaveLen(2))
+		Expect(recorded[0].Operation).To(Equal(audit.OperationPrepare))
+		Expect(recorded[0].PodUID).To(Equal("pod-claim1"))
+		Expect(recorded[0].Claim).To(Equal("default/claim1"))
+		Expect(recorded[0].PciAddress).To(Equal("0000:01:00.1"))
+		Expect(recorded[0].Driver).To(Equal("vfio-pci"))
+		Expect(recorded[0].Details).To(HaveKeyWithValue("originalDriver", "iavf"))
+		Expect(recorded[0].Config).To(HaveKeyWithValue("driver", "vfio-pci"))
+		Expect(recorded[0].Outcome).To(Equal(audit.OutcomeSuccess))
+		Expect(recorded[1].Operation).To(Equal(audit.OperationUnprepare))
+		Expect(recorded[1].Outcome).To(Equal(audit.OutcomeSuccess))
+	})
+
+	It("passes the claim and the pod to the host driver changes", func(ctx SpecContext) {
+		fields := audit.Fields{ClaimUID: "claim1", Claim: "default/claim1", PodUID: "pod-claim1"}
+		ifNameIndex := 0
+		prepared, err := s.PrepareDevicesForClaim(ctx, &ifNameIndex, claim())
+		Expect(err).NotTo(HaveOccurred())
+		vf, _ := fakeHost.VF("0000:01:00.1")
+		Expect(vf.Driver).To(Equal("vfio-pci"))
+		Expect(vf.AuditFields).To(Equal(fields))
+
+		Expect(s.Unprepare("claim1", prepared)).To(Succeed())
+		vf, _ = fakeHost.VF("0000:01:00.1")
+		Expect(vf.Driver).To(Equal("iavf"))
+		Expect(vf.AuditFields).To(Equal(fields))
+	})
+
+	It("records a failed prepare and unprepare", func(ctx SpecContext) {
+		fakeHost.BindDriverErr = errors.New("boom")
+		ifNameIndex := 0
+		_, err := s.PrepareDevicesForClaim(ctx, &ifNameIndex, claim())
+		Expect(err).To(HaveOccurred())
+
+		recorded := events(audit.Filter{Operation: audit.OperationPrepare})
+		Expect(recorded).To(HaveLen(1))
+		Expect(recorded[0].ClaimUID).To(Equal("claim1"))
+		Expect(recorded[0].PodUID).To(Equal("pod-claim1"))
+		Expect(recorded[0].Outcome).To(Equal(audit.OutcomeFailure))
+		Expect(recorded[0].Error).To(ContainSubstring("boom"))
+
+		fakeHost.BindDriverErr = nil
+		prepared, err := s.PrepareDevicesForClaim(ctx, &ifNameIndex, claim())
+		Expect(err).NotTo(HaveOccurred())
+		fakeHost.BindDriverErr = errors.New("boom")
+		Expect(s.Unprepare("claim1", prepared)).NotTo(Succeed())
+		recorded = events(audit.Filter{Operation: audit.OperationUnprepare})
+		Expect(recorded).To(HaveLen(1))
+		Expect(recorded[0].PciAddress).To(Equal("0000:01:00.1"))
+		Expect(recorded[0].Outcome).To(Equal(audit.OutcomeFailure))
+	})
+
+	It("records the resource name changes", func(ctx context.Context) {
+		Expect(s.UpdateDeviceResourceNames(ctx, map[string]string{"0000-01-00-1": "intel_sriov"})).To(Succeed())
+		Expect(s.UpdateDeviceResourceNames(ctx, map[string]string{"0000-01-00-1": "intel_sriov"})).To(Succeed())
+		Expect(s.UpdateDeviceResourceNames(ctx, map[string]string{})).To(Succeed())
+
+		recorded := events(audit.Filter{Operation: audit.OperationResourceName})
+		Expect(recorded).To(HaveLen(2))
+		Expect(recorded[0].Device).To(Equal("0000-01-00-1"))
+		Expect(recorded[0].PciAddress).To(Equal("0000:01:00.1"))
+		Expect(recorded[0].Details).To(Equal(map[string]string{"previousResourceName": "", "resourceName": "intel_sriov"}))
+		Expect(recorded[1].Details).To(Equal(map[string]string{"previousResourceName": "intel_sriov", "resourceName": ""}))
+	})
+})
@@ -0,0 +1,197 @@
+package devicestate
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/jaypipes/ghw/pkg/pci"
+	"github.com/jaypipes/pcidb"
+	netattdefv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	configapi "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/virtualfunction/v1alpha1"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/cdi"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/flags"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host"
+	mock_host "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host/mock"
+	drasriovtypes "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
+)
+
+var _ = Describe("PF bandwidth mode", func() {
+	var (
+		mockCtrl *gomock.Controller
+		mockHost *mock_host.MockInterface
+	)
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+		mockHost = mock_host.NewMockInterface(mockCtrl)
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+	})
+
+	vfList := []host.VFInfo{
+		{PciAddress: "0000:01:00.1", VFID: 0, DeviceID: "154c"},
+		{PciAddress: "0000:01:00.2", VFID: 1, DeviceID: "154c"},
+	}
+
+	Context("DiscoverBandwidthDevices", func() {
+		expectPF := func(address, netName string, speed int) {
+			mockHost.EXPECT().IsSriovVF(address).Return(false)
+			mockHost.EXPECT().TryGetInterfaceName(address).Return(netName)
+			mockHost.EXPECT().GetNicSriovMode(address).Return("legacy")
+			mockHost.EXPECT().GetNumaNode(address).Return("0", nil)
+			mockHost.EXPECT().GetPCIeRoot(address).Return("pci0000:00", nil)
+			mockHost.EXPECT().GetParentPciAddress(address).Return("0000:00:01.0", nil)
+			mockHost.EXPECT().GetRDMADevice(address).Return("", nil)
+			mockHost.EXPECT().GetLinkInfo(netName).Return(&host.LinkInfo{Speed: speed, MTU: 1500, OperState: "up", Carrier: true}, nil)
+		}
+
+		It("publishes PFs with a known link speed with consumable capacity", func() {
+			mockHost.EXPECT().PCI().Return(&pci.Info{
+				Devices: []*pci.Device{
+					{Address: "0000:01:00.0", Class: &pcidb.Class{ID: "02"}, Vendor: &pcidb.Vendor{ID: "8086"}, Product: &pcidb.Product{ID: "1572"}},
+					{Address: "0000:02:00.0", Class: &pcidb.Class{ID: "02"}, Vendor: &pcidb.Vendor{ID: "8086"}, Product: &pcidb.Product{ID: "1572"}},
+				},
+			}, nil)
+			expectPF("0000:01:00.0", "eth0", 25000)
+			expectPF("0000:02:00.0", "eth1", 0)
+			mockHost.EXPECT().GetVFList("0000:01:00.0").Return(vfList, nil)
+			mockHost.EXPECT().GetVFList("0000:02:00.0").Return([]host.VFInfo{{PciAddress: "0000:02:00.1", VFID: 0, DeviceID: "154c"}}, nil)
+
+			devices, sharedVFs, err := DiscoverBandwidthDevices(mockHost)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(devices).To(HaveLen(2))
+			Expect(devices).To(HaveKey("0000-02-00-1"))
+
+			pf := devices["0000-01-00-0"]
+			Expect(pf.AllowMultipleAllocations).To(Equal(ptr.To(true)))
+			Expect(pf.Attributes[consts.AttributePciAddress].StringValue).To(Equal(ptr.To("0000:01:00.0")))
+			Expect(pf.Attributes[consts.AttributePFName].StringValue).To(Equal(ptr.To("eth0")))
+			bandwidth := pf.Capacity[consts.CapacityBandwidth].Value
+			Expect(bandwidth.Cmp(resource.MustParse("25"))).To(Equal(0))
+			vfs := pf.Capacity[consts.CapacityVFs].Value
+			Expect(vfs.Value()).To(Equal(int64(2)))
+			// every capacity of a shared device is consumable, the link speed is only an attribute source
+			Expect(pf.Capacity).NotTo(HaveKey(resourceapi.QualifiedName(consts.CapacityLinkSpeed)))
+			Expect(pf.Attributes[consts.AttributePFOperState].StringValue).To(Equal(ptr.To("up")))
+
+			Expect(sharedVFs).To(HaveLen(1))
+			Expect(sharedVFs["0000-01-00-0"]).To(Equal(vfList))
+		})
+	})
+
+	Context("prepare and unprepare a share", func() {
+		var s *Manager
+
+		BeforeEach(func() {
+			cdiHandler, err := cdi.NewHandler(GinkgoT().TempDir())
+			Expect(err).NotTo(HaveOccurred())
+			nad := &netattdefv1.NetworkAttachmentDefinition{
+				ObjectMeta: metav1.ObjectMeta{Name: "sriov", Namespace: "default"},
+				Spec:       netattdefv1.NetworkAttachmentDefinitionSpec{Config: `{"type":"sriov","max_tx_rate":100}`},
+			}
+			s = &Manager{
+				host: mockHost,
+				k8sClient: flags.ClientSets{
+					Client: fake.NewClientBuilder().WithScheme(flags.Scheme).WithObjects(nad).Build(),
+				},
+				cdi:                    cdiHandler,
+				defaultInterfacePrefix: "net",
+				allocatable: drasriovtypes.AllocatableDevices{
+					"0000-01-00-0": {
+						Name: "0000-01-00-0",
+						Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+							consts.AttributePciAddress: {StringValue: ptr.To("0000:01:00.0")},
+							consts.AttributePFName:     {StringValue: ptr.To("eth0")},
+						},
+					},
+				},
+				sharedVFs:      SharedVFs{"0000-01-00-0": vfList},
+				sharedVFsInUse: map[string]k8stypes.UID{},
+			}
+		})
+
+		newClaim := func(uid string) *resourceapi.ResourceClaim {
+			return &resourceapi.ResourceClaim{
+				ObjectMeta: metav1.ObjectMeta{Name: uid, Namespace: "default", UID: k8stypes.UID(uid)},
+				Status: resourceapi.ResourceClaimStatus{
+					ReservedFor: []resourceapi.ResourceClaimConsumerReference{{Name: "pod", UID: "pod-uid"}},
+				},
+			}
+		}
+		newResult := func(shareID string) *resourceapi.DeviceRequestAllocationResult {
+			return &resourceapi.DeviceRequestAllocationResult{
+				Request:          "req",
+				Driver:           consts.DriverName,
+				Pool:             "node1/eth0",
+				Device:           "0000-01-00-0",
+				ShareID:          ptr.To(k8stypes.UID(shareID)),
+				ConsumedCapacity: map[resourceapi.QualifiedName]resource.Quantity{consts.CapacityBandwidth: resource.MustParse("2500m")},
+			}
+		}
+
+		It("assigns a free VF and enforces the bandwidth with max_tx_rate", func() {
+			config := &configapi.VfConfig{NetAttachDefName: "sriov"}
+			mockHost.EXPECT().BindDeviceDriver("0000:01:00.1", config, claimAuditFields(newClaim("claim1"))).Return("", nil)
+			mockHost.EXPECT().GetDriverByBusAndDevice("0000:01:00.1").Return("iavf", nil)
+			mockHost.EXPECT().SetVFLinkSettings("eth0", 0, &drasriovtypes.VFLinkSettings{MaxTxRate: ptr.To(2500)}).Return(nil)
+
+			ifNameIndex := 0
+			prepared, err := s.applyConfigOnDevice(context.Background(), &ifNameIndex, newClaim("claim1"), config, newResult("share1"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(prepared.PciAddress).To(Equal("0000:01:00.1"))
+			Expect(prepared.VFID).To(Equal(0))
+			Expect(prepared.ShareID).To(Equal("share1"))
+			Expect(prepared.MaxTxRate).To(Equal(2500))
+			Expect(prepared.Device.CDIDeviceIDs[0]).To(ContainSubstring("claim1-0000-01-00-0-share1"))
+
+			netConf := map[string]interface{}{}
+			Expect(json.Unmarshal([]byte(prepared.NetAttachDefConfig), &netConf)).To(Succeed())
+			Expect(netConf["max_tx_rate"]).To(BeEquivalentTo(2500))
+			Expect(netConf["deviceID"]).To(Equal("0000:01:00.1"))
+			Expect(s.sharedVFsInUse).To(HaveKeyWithValue("0000:01:00.1", k8stypes.UID("claim1")))
+
+			// reset the rate and free the VF on unprepare
+			mockHost.EXPECT().SetVFLinkSettings("eth0", 0, &drasriovtypes.VFLinkSettings{MaxTxRate: ptr.To(0)}).Return(nil)
+			Expect(s.unprepareDevices(drasriovtypes.PreparedDevices{prepared})).To(Succeed())
+			Expect(s.sharedVFsInUse).To(BeEmpty())
+		})
+
+		It("fails when all the VFs of the PF are in use", func() {
+			s.sharedVFsInUse["0000:01:00.1"] = "other"
+			s.sharedVFsInUse["0000:01:00.2"] = "other"
+
+			ifNameIndex := 0
+			_, err := s.applyConfigOnDevice(context.Background(), &ifNameIndex, newClaim("claim1"), &configapi.VfConfig{NetAttachDefName: "sriov"}, newResult("share1"))
+			Expect(err).To(MatchError(ContainSubstring("no free VF left")))
+		})
+
+		It("restores the VFs in use from the prepared devices and releases them per claim", func() {
+			prepared := &drasriovtypes.PreparedDevice{PciAddress: "0000:01:00.2"}
+			prepared.Device.DeviceName = "0000-01-00-0"
+			prepared.ClaimNamespacedName.UID = "claim1"
+			s.RestorePreparedDevices(drasriovtypes.PreparedDevices{prepared})
+			Expect(s.sharedVFsInUse).To(HaveKeyWithValue("0000:01:00.2", k8stypes.UID("claim1")))
+
+			vf, err := s.assignSharedVF("claim2", vfList)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(vf.PciAddress).To(Equal("0000:01:00.1"))
+
+			s.releaseSharedVFs("claim1")
+			Expect(s.sharedVFsInUse).To(HaveLen(1))
+			Expect(s.sharedVFsInUse).To(HaveKey("0000:01:00.1"))
+		})
+	})
+})
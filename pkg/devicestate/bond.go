@@ -0,0 +1,87 @@
+package devicestate
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/klog/v2"
+
+	configapi "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/virtualfunction/v1alpha1"
+	drasriovtypes "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
+)
+
+// prepareBonds sets on the prepared devices of the requests referenced by every bond config
+// the bond they are enslaved to. The bond is created by the NRI plugin with the bond CNI
+// once the member VFs are attached to the pod.
+func (s *Manager) prepareBonds(ctx context.Context, claim *resourceapi.ResourceClaim, bondConfigs []*drasriovtypes.OpaqueDeviceConfig, preparedDevices drasriovtypes.PreparedDevices) error {
+	logger := klog.FromContext(ctx).WithName("prepareBonds")
+
+	for _, bondConfig := range bondConfigs {
+		config := bondConfig.Config.(*configapi.BondConfig)
+
+		var members drasriovtypes.PreparedDevices
+		for _, preparedDevice := range preparedDevices {
+			if !slices.ContainsFunc(preparedDevice.Device.RequestNames, func(request string) bool {
+				return isBondRequest(bondConfig.Requests, request)
+			}) {
+				continue
+			}
+			if preparedDevice.Bond != nil {
+				return fmt.Errorf("device %s is already a member of bond %s", preparedDevice.Device.DeviceName, preparedDevice.Bond.IfName)
+			}
+			if preparedDevice.NetAttachDefConfig == "" || s.host.IsDpdkDriver(preparedDevice.Driver) {
+				return fmt.Errorf("device %s of bond %s must use a kernel driver and a net attach def", preparedDevice.Device.DeviceName, config.IfName)
+			}
+			members = append(members, preparedDevice)
+		}
+		if len(members) < 2 {
+			return fmt.Errorf("bond %s needs at least two devices, found %d for requests %v", config.IfName, len(members), bondConfig.Requests)
+		}
+
+		pfMembers := map[string]string{}
+		memberNames := []string{}
+		for _, member := range members {
+			if other, shared := pfMembers[member.PFName]; shared {
+				return fmt.Errorf("devices %s and %s of bond %s share PF %s, the bond doesn't survive a PF failure",
+					other, member.Device.DeviceName, config.IfName, member.PFName)
+			}
+			pfMembers[member.PFName] = member.Device.DeviceName
+			memberNames = append(memberNames, member.IfName)
+		}
+
+		namespace := claim.Namespace
+		if config.NetAttachDefNamespace != "" {
+			namespace = config.NetAttachDefNamespace
+		}
+		rawConfig, err := s.getNetAttachDefRawConfig(ctx, namespace, config.NetAttachDefName)
+		if err != nil {
+			return fmt.Errorf("error getting net attach def raw config for bond %s: %w", config.IfName, err)
+		}
+		netConf, err := drasriovtypes.BuildBondNetConf(rawConfig, config.Mode, config.Miimon, memberNames)
+		if err != nil {
+			return fmt.Errorf("error building bond-cni config for bond %s: %w", config.IfName, err)
+		}
+
+		bond := &drasriovtypes.PreparedBond{
+			IfName:             config.IfName,
+			Mode:               config.Mode,
+			Members:            memberNames,
+			NetAttachDefConfig: netConf,
+		}
+		for _, member := range members {
+			member.Bond = bond
+		}
+		logger.V(2).Info("Prepared bond", "claim", claim.UID, "bond", bond.IfName, "mode", bond.Mode, "members", memberNames)
+	}
+	return nil
+}
+
+// isBondRequest returns true if the request, or its parent request for a subrequest, is
+// one of the bond requests
+func isBondRequest(bondRequests []string, request string) bool {
+	parent, _, _ := strings.Cut(request, "/")
+	return slices.Contains(bondRequests, request) || slices.Contains(bondRequests, parent)
+}
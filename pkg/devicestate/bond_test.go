@@ -0,0 +1,188 @@
+package devicestate
+
+import (
+	"context"
+	"encoding/json"
+
+	netattdefv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+	resourceapi "k8s.io/api/resource/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	configapi "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/virtualfunction/v1alpha1"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/flags"
+	mock_host "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host/mock"
+	drasriovtypes "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
+)
+
+var _ = Describe("Bonds", func() {
+	encodeConfig := func(source resourceapi.AllocationConfigSource, requests []string, config runtime.Object) resourceapi.DeviceAllocationConfiguration {
+		encoded, err := runtime.Encode(configapi.Decoder.(runtime.Encoder), config)
+		Expect(err).NotTo(HaveOccurred())
+		return resourceapi.DeviceAllocationConfiguration{
+			Source:   source,
+			Requests: requests,
+			DeviceConfiguration: resourceapi.DeviceConfiguration{
+				Opaque: &resourceapi.OpaqueDeviceConfiguration{
+					Driver:     consts.DriverName,
+					Parameters: runtime.RawExtension{Raw: encoded},
+				},
+			},
+		}
+	}
+	bondTypeMeta := metav1.TypeMeta{APIVersion: "sriovnetwork.k8snetworkplumbingwg.io/v1alpha1", Kind: configapi.BondConfigKind}
+	vfTypeMeta := metav1.TypeMeta{APIVersion: "sriovnetwork.k8snetworkplumbingwg.io/v1alpha1", Kind: "VfConfig"}
+
+	Context("getBondConfigs", func() {
+		It("returns the normalized bond configs with the class configs first", func() {
+			configs := []resourceapi.DeviceAllocationConfiguration{
+				encodeConfig(resourceapi.AllocationConfigSourceClaim, []string{"vf-a"}, &configapi.VfConfig{TypeMeta: vfTypeMeta, NetAttachDefName: "net"}),
+				encodeConfig(resourceapi.AllocationConfigSourceClaim, []string{"vf-a", "vf-b"}, &configapi.BondConfig{TypeMeta: bondTypeMeta, IfName: "bond1", Mode: configapi.BondModeLACP, NetAttachDefName: "bond-claim"}),
+				encodeConfig(resourceapi.AllocationConfigSourceClass, []string{"vf-c", "vf-d"}, &configapi.BondConfig{TypeMeta: bondTypeMeta, NetAttachDefName: "bond-class"}),
+			}
+
+			bondConfigs, err := getBondConfigs(configapi.Decoder, configs)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bondConfigs).To(HaveLen(2))
+			Expect(bondConfigs[0].Requests).To(Equal([]string{"vf-c", "vf-d"}))
+			Expect(bondConfigs[0].Config).To(Equal(&configapi.BondConfig{TypeMeta: bondTypeMeta, IfName: "bond0", Mode: configapi.BondModeActiveBackup, Miimon: 100, NetAttachDefName: "bond-class"}))
+			Expect(bondConfigs[1].Requests).To(Equal([]string{"vf-a", "vf-b"}))
+			Expect(bondConfigs[1].Config.(*configapi.BondConfig).IfName).To(Equal("bond1"))
+
+			// the bond config is not a VF config of its requests
+			vfConfigs, err := getMapOfOpaqueDeviceConfigForDevice(configapi.Decoder, configs, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(vfConfigs).To(HaveLen(1))
+			Expect(vfConfigs).To(HaveKey("vf-a"))
+		})
+
+		It("fails when the bond references a single request", func() {
+			configs := []resourceapi.DeviceAllocationConfiguration{
+				encodeConfig(resourceapi.AllocationConfigSourceClaim, []string{"vf-a"}, &configapi.BondConfig{TypeMeta: bondTypeMeta, NetAttachDefName: "bond"}),
+			}
+			_, err := getBondConfigs(configapi.Decoder, configs)
+			Expect(err).To(MatchError(ContainSubstring("at least two requests")))
+		})
+
+		It("fails on an invalid bond config", func() {
+			configs := []resourceapi.DeviceAllocationConfiguration{
+				encodeConfig(resourceapi.AllocationConfigSourceClaim, []string{"vf-a", "vf-b"}, &configapi.BondConfig{TypeMeta: bondTypeMeta, Mode: "balance-rr", NetAttachDefName: "bond"}),
+			}
+			_, err := getBondConfigs(configapi.Decoder, configs)
+			Expect(err).To(MatchError(ContainSubstring("invalid bond config")))
+		})
+	})
+
+	Context("prepareBonds", func() {
+		var (
+			mockCtrl *gomock.Controller
+			mockHost *mock_host.MockInterface
+			s        *Manager
+			claim    *resourceapi.ResourceClaim
+		)
+
+		BeforeEach(func() {
+			mockCtrl = gomock.NewController(GinkgoT())
+			mockHost = mock_host.NewMockInterface(mockCtrl)
+			mockHost.EXPECT().IsDpdkDriver(gomock.Any()).Return(false).AnyTimes()
+
+			nad := &netattdefv1.NetworkAttachmentDefinition{
+				ObjectMeta: metav1.ObjectMeta{Name: "bond", Namespace: "default"},
+				Spec:       netattdefv1.NetworkAttachmentDefinitionSpec{Config: `{"type":"bond","ipam":{"type":"static"}}`},
+			}
+			s = &Manager{
+				host: mockHost,
+				k8sClient: flags.ClientSets{
+					Client: fake.NewClientBuilder().WithScheme(flags.Scheme).WithObjects(nad).Build(),
+				},
+			}
+			claim = &resourceapi.ResourceClaim{ObjectMeta: metav1.ObjectMeta{Name: "claim", Namespace: "default", UID: "claim-uid"}}
+		})
+
+		AfterEach(func() {
+			mockCtrl.Finish()
+		})
+
+		newMember := func(request, deviceName, ifName, pfName string) *drasriovtypes.PreparedDevice {
+			device := &drasriovtypes.PreparedDevice{IfName: ifName, PFName: pfName, NetAttachDefConfig: `{"type":"sriov"}`, Driver: "iavf"}
+			device.Device.RequestNames = []string{request}
+			device.Device.DeviceName = deviceName
+			return device
+		}
+		bondConfig := func(requests ...string) []*drasriovtypes.OpaqueDeviceConfig {
+			config := &configapi.BondConfig{NetAttachDefName: "bond"}
+			config.Normalize()
+			return []*drasriovtypes.OpaqueDeviceConfig{{Requests: requests, Config: config}}
+		}
+
+		It("sets the bond on its members", func() {
+			devices := drasriovtypes.PreparedDevices{
+				newMember("vf-a", "0000-01-00-1", "net1", "eth0"),
+				newMember("vf-b/sub", "0000-02-00-1", "net2", "eth1"),
+				newMember("other", "0000-03-00-1", "net3", "eth2"),
+			}
+			Expect(s.prepareBonds(context.Background(), claim, bondConfig("vf-a", "vf-b"), devices)).To(Succeed())
+
+			Expect(devices[0].Bond).NotTo(BeNil())
+			Expect(devices[1].Bond).To(BeIdenticalTo(devices[0].Bond))
+			Expect(devices[2].Bond).To(BeNil())
+			Expect(devices[0].Bond.IfName).To(Equal("bond0"))
+			Expect(devices[0].Bond.Mode).To(Equal(configapi.BondModeActiveBackup))
+			Expect(devices[0].Bond.Members).To(Equal([]string{"net1", "net2"}))
+
+			netConf := map[string]interface{}{}
+			Expect(json.Unmarshal([]byte(devices[0].Bond.NetAttachDefConfig), &netConf)).To(Succeed())
+			Expect(netConf["type"]).To(Equal("bond"))
+			Expect(netConf["links"]).To(HaveLen(2))
+		})
+
+		It("fails when less than two devices are members", func() {
+			devices := drasriovtypes.PreparedDevices{
+				newMember("vf-a", "0000-01-00-1", "net1", "eth0"),
+			}
+			Expect(s.prepareBonds(context.Background(), claim, bondConfig("vf-a", "vf-b"), devices)).To(MatchError(ContainSubstring("at least two devices")))
+		})
+
+		It("fails when a member has no net attach def", func() {
+			devices := drasriovtypes.PreparedDevices{
+				newMember("vf-a", "0000-01-00-1", "net1", "eth0"),
+				newMember("vf-b", "0000-02-00-1", "net2", "eth1"),
+			}
+			devices[1].NetAttachDefConfig = ""
+			Expect(s.prepareBonds(context.Background(), claim, bondConfig("vf-a", "vf-b"), devices)).To(MatchError(ContainSubstring("must use a kernel driver and a net attach def")))
+		})
+
+		It("fails when members share a PF", func() {
+			devices := drasriovtypes.PreparedDevices{
+				newMember("vf-a", "0000-01-00-1", "net1", "eth0"),
+				newMember("vf-b", "0000-01-00-2", "net2", "eth0"),
+			}
+			Expect(s.prepareBonds(context.Background(), claim, bondConfig("vf-a", "vf-b"), devices)).To(MatchError(ContainSubstring("share PF eth0")))
+			Expect(devices[0].Bond).To(BeNil())
+		})
+
+		It("fails when a device is a member of two bonds", func() {
+			devices := drasriovtypes.PreparedDevices{
+				newMember("vf-a", "0000-01-00-1", "net1", "eth0"),
+				newMember("vf-b", "0000-02-00-1", "net2", "eth1"),
+			}
+			bondConfigs := append(bondConfig("vf-a", "vf-b"), bondConfig("vf-b", "vf-a")...)
+			Expect(s.prepareBonds(context.Background(), claim, bondConfigs, devices)).To(MatchError(ContainSubstring("already a member of bond")))
+		})
+
+		It("fails when the bond net attach def is missing", func() {
+			devices := drasriovtypes.PreparedDevices{
+				newMember("vf-a", "0000-01-00-1", "net1", "eth0"),
+				newMember("vf-b", "0000-02-00-1", "net2", "eth1"),
+			}
+			configs := bondConfig("vf-a", "vf-b")
+			configs[0].Config.(*configapi.BondConfig).NetAttachDefName = "missing"
+			Expect(s.prepareBonds(context.Background(), claim, configs, devices)).To(MatchError(ContainSubstring("error getting net attach def raw config")))
+		})
+	})
+})
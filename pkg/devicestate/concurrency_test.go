@@ -0,0 +1,181 @@
+package devicestate
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	resourceapi "k8s.io/api/resource/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	configapi "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/virtualfunction/v1alpha1"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/audit"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/cdi"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/flags"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host"
+	drasriovtypes "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
+)
+
+// exclusiveHost counts the driver changes made on a VF while another one is in flight
+type exclusiveHost struct {
+	host.Interface
+	mutex      sync.Mutex
+	inFlight   map[string]bool
+	violations int
+}
+
+func (h *exclusiveHost) enter(pciAddress string) func() {
+	h.mutex.Lock()
+	if h.inFlight[pciAddress] {
+		h.violations++
+	}
+	h.inFlight[pciAddress] = true
+	h.mutex.Unlock()
+	// widen the window of an overlapping change
+	time.Sleep(100 * time.Microsecond)
+	return func() {
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		delete(h.inFlight, pciAddress)
+	}
+}
+
+func (h *exclusiveHost) BindDeviceDriver(pciAddress string, config *configapi.VfConfig, fields audit.Fields) (string, error) {
+	defer h.enter(pciAddress)()
+	return h.Interface.BindDeviceDriver(pciAddress, config, fields)
+}
+
+func (h *exclusiveHost) RestoreDeviceDriver(pciAddress, originalDriver string, fields audit.Fields) error {
+	defer h.enter(pciAddress)()
+	return h.Interface.RestoreDeviceDriver(pciAddress, originalDriver, fields)
+}
+
+func (h *exclusiveHost) BindDefaultDriver(pciAddress string) error {
+	defer h.enter(pciAddress)()
+	return h.Interface.BindDefaultDriver(pciAddress)
+}
+
+func (h *exclusiveHost) getViolations() int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.violations
+}
+
+var _ = Describe("Concurrent use", func() {
+	const iterations = 30
+
+	var (
+		exclusive *exclusiveHost
+		s         *Manager
+		devices   = []string{"0000-01-00-1", "0000-01-00-2", "0000-01-00-3"}
+	)
+
+	BeforeEach(func() {
+		fakeHost := newFakeHost(3, 1500)
+		exclusive = &exclusiveHost{Interface: fakeHost, inFlight: map[string]bool{}}
+		cdiHandler, err := cdi.NewHandler(GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+		s, err = NewManager(&drasriovtypes.Config{
+			Flags: &drasriovtypes.Flags{
+				NodeName:               "node1",
+				DefaultInterfacePrefix: "net",
+				HostDevicePolicy:       HostDevicePolicySkip,
+			},
+			K8sClient: flags.ClientSets{Client: fake.NewClientBuilder().WithScheme(flags.Scheme).Build()},
+		}, exclusive, cdiHandler, nil)
+		Expect(err).NotTo(HaveOccurred())
+		// publishing reads the snapshot while the devices are updated
+		s.SetRepublishCallback(func(context.Context) error {
+			for _, device := range s.GetAllocatableDevices() {
+				_ = stringAttribute(device, consts.AttributeResourceName)
+				_ = len(device.Taints)
+			}
+			return nil
+		})
+	})
+
+	It("serializes the changes of a device across all the entry points", func(ctx SpecContext) {
+		var wg sync.WaitGroup
+		run := func(worker func(i int)) {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				for i := range iterations {
+					worker(i)
+				}
+			}()
+		}
+
+		// two claims at a time prepare and unprepare each device
+		for w := range 2 * len(devices) {
+			run(func(i int) {
+				claim := newClaim(fmt.Sprintf("claim-%d-%d", w, i), devices[(w+i)%len(devices)], &configapi.VfConfig{Driver: "vfio-pci"})
+				ifNameIndex := 0
+				preparedDevices, err := s.PrepareDevicesForClaim(ctx, &ifNameIndex, claim)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(s.Unprepare(string(claim.UID), preparedDevices)).To(Succeed())
+			})
+		}
+		// the controller updates the resource names, default configs and pre-bind drivers
+		run(func(i int) {
+			resourceName := []string{"netdev", "dpdk"}[i%2]
+			deviceResourceMap := map[string]string{}
+			for _, device := range devices {
+				deviceResourceMap[device] = resourceName
+			}
+			Expect(s.UpdateDeviceResourceNames(ctx, deviceResourceMap)).To(Succeed())
+			s.UpdateResourceConfigs(map[string]*configapi.VfConfig{resourceName: {Driver: "vfio-pci"}})
+			s.UpdatePreBindDrivers(map[string]string{"dpdk": "vfio-pci"})
+		})
+		// the background loops
+		run(func(int) {
+			Expect(s.PreBindDevices(ctx)).To(Succeed())
+		})
+		run(func(int) {
+			Expect(s.CheckDeviceHealth(ctx)).To(Succeed())
+			Expect(s.RefreshLinkAttributes(ctx)).To(Succeed())
+		})
+		// the snapshots are owned by the readers until all the other entry points are done
+		done := make(chan struct{})
+		readerDone := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			defer close(readerDone)
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				snapshot := s.GetAllocatableDevices()
+				expected := drasriovtypes.AllocatableDevices{}
+				for deviceName, device := range snapshot {
+					expected[deviceName] = *device.DeepCopy()
+				}
+				time.Sleep(100 * time.Microsecond)
+				Expect(snapshot).To(Equal(expected))
+				for deviceName, device := range snapshot {
+					device.Attributes[consts.AttributeResourceName] = resourceapi.DeviceAttribute{StringValue: &deviceName}
+				}
+				device, found := s.GetAllocatedDeviceByDeviceName(devices[0])
+				Expect(found).To(BeTrue())
+				device.Taints = append(device.Taints, resourceapi.DeviceTaint{Key: "test"})
+			}
+		}()
+		wg.Wait()
+		close(done)
+		<-readerDone
+
+		Expect(exclusive.getViolations()).To(BeZero())
+		Expect(s.devicesInUse).To(BeEmpty())
+		for _, device := range s.GetAllocatableDevices() {
+			Expect(device.Taints).NotTo(ContainElement(HaveField("Key", "test")))
+			Expect(stringAttribute(device, consts.AttributeResourceName)).To(BeElementOf("netdev", "dpdk"))
+		}
+	})
+})
@@ -0,0 +1,55 @@
+package devicestate
+
+import (
+	"slices"
+	"sync"
+)
+
+// deviceLocks serializes the host changes on the devices, so two claims, or a claim and the
+// pre-binding, never change the same device at once. The zero value is ready to use.
+type deviceLocks struct {
+	mutex sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// get returns the lock of a device, created on first use
+func (l *deviceLocks) get(deviceName string) *sync.Mutex {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.locks == nil {
+		l.locks = map[string]*sync.Mutex{}
+	}
+	lock, exists := l.locks[deviceName]
+	if !exists {
+		lock = &sync.Mutex{}
+		l.locks[deviceName] = lock
+	}
+	return lock
+}
+
+// lock locks the devices in name order, so two callers locking overlapping devices can't
+// deadlock, and returns the function unlocking them
+func (l *deviceLocks) lock(deviceNames ...string) func() {
+	deviceNames = slices.Compact(slices.Sorted(slices.Values(deviceNames)))
+	locks := make([]*sync.Mutex, 0, len(deviceNames))
+	for _, deviceName := range deviceNames {
+		lock := l.get(deviceName)
+		lock.Lock()
+		locks = append(locks, lock)
+	}
+	return func() {
+		for i := len(locks) - 1; i >= 0; i-- {
+			locks[i].Unlock()
+		}
+	}
+}
+
+// tryLock locks a device if it isn't locked and returns the function unlocking it. It is used
+// by the background loops, which skip the devices being prepared until their next run.
+func (l *deviceLocks) tryLock(deviceName string) (func(), bool) {
+	lock := l.get(deviceName)
+	if !lock.TryLock() {
+		return nil, false
+	}
+	return lock.Unlock, true
+}
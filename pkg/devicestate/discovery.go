@@ -6,12 +6,14 @@ import (
 	"strings"
 
 	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/klog/v2"
 	"k8s.io/utils/ptr"
 
 	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
 	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host"
 	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/vendors"
 )
 
 type PFInfo struct {
@@ -24,16 +26,90 @@ type PFInfo struct {
 	NumaNode         string
 	PCIeRoot         string
 	ParentPciAddress string
+	Link             *host.LinkInfo
+	RDMA             bool // the PF exposes an RDMA device, so do its VFs bound to the kernel driver
+	// VendorAttributes are the attributes added by the vendor plugin of the PF
+	VendorAttributes map[resourceapi.QualifiedName]resourceapi.DeviceAttribute
 }
 
-func DiscoverSriovDevices() (types.AllocatableDevices, error) {
+// SharedVFs maps the name of a PF published with consumable bandwidth capacity
+// to the VFs that can be handed out for its allocation shares.
+type SharedVFs map[string][]host.VFInfo
+
+// DiscoverSriovDevices returns a device for every VF of the SR-IOV PFs on the host.
+func DiscoverSriovDevices(h host.Interface) (types.AllocatableDevices, error) {
+	resourceList, _, err := discoverDevices(h, false)
+	return resourceList, err
+}
+
+// DiscoverBandwidthDevices returns a device with consumable bandwidth and VF count
+// capacity for every SR-IOV PF on the host with a known link speed, together with the
+// VFs backing the allocation shares. VFs of PFs without a known link speed are returned
+// as regular devices.
+func DiscoverBandwidthDevices(h host.Interface) (types.AllocatableDevices, SharedVFs, error) {
+	return discoverDevices(h, true)
+}
+
+func discoverDevices(h host.Interface, bandwidthMode bool) (types.AllocatableDevices, SharedVFs, error) {
 	logger := klog.LoggerWithName(klog.Background(), "DiscoverSriovDevices")
-	pfList := []PFInfo{}
 	resourceList := types.AllocatableDevices{}
+	sharedVFs := SharedVFs{}
+
+	pfList, err := discoverPFs(logger, h)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	logger.Info("Processing SR-IOV PF devices", "pfCount", len(pfList))
+
+	for _, pfInfo := range pfList {
+		logger.V(1).Info("Getting VF list for PF", "pf", pfInfo.NetName, "address", pfInfo.Address)
+
+		vfList, err := h.GetVFList(pfInfo.Address)
+		if err != nil {
+			logger.Error(err, "Failed to get VF list for PF", "pf", pfInfo.NetName, "address", pfInfo.Address)
+			return nil, nil, fmt.Errorf("error getting VF list: %v", err)
+		}
+
+		logger.Info("Found VFs for PF", "pf", pfInfo.NetName, "vfCount", len(vfList))
+
+		if bandwidthMode && len(vfList) > 0 {
+			if pfInfo.Link != nil && pfInfo.Link.Speed > 0 {
+				device := newPFBandwidthDevice(pfInfo, len(vfList), pfInfo.Link.Speed)
+				logger.Info("Adding PF device with consumable bandwidth to resource list",
+					"deviceName", device.Name, "pf", pfInfo.NetName, "speedMbps", pfInfo.Link.Speed, "vfCount", len(vfList))
+				resourceList[device.Name] = device
+				sharedVFs[device.Name] = vfList
+				continue
+			}
+			logger.Error(nil, "Unknown link speed, publishing the VFs of the PF as devices", "pf", pfInfo.NetName)
+		}
+
+		for _, vfInfo := range vfList {
+			deviceName := deviceNameFromPciAddress(vfInfo.PciAddress)
+
+			logger.V(2).Info("Adding VF device to resource list",
+				"deviceName", deviceName,
+				"vfAddress", vfInfo.PciAddress,
+				"vfID", vfInfo.VFID,
+				"vfDeviceID", vfInfo.DeviceID,
+				"pfDeviceID", pfInfo.DeviceID,
+				"pf", pfInfo.NetName)
+
+			resourceList[deviceName] = newVFDevice(deviceName, pfInfo, vfInfo)
+		}
+	}
 
+	logger.Info("SR-IOV device discovery completed", "totalDevices", len(resourceList))
+	return resourceList, sharedVFs, nil
+}
+
+// discoverPFs returns the network PFs of the host
+func discoverPFs(logger klog.Logger, h host.Interface) ([]PFInfo, error) {
+	pfList := []PFInfo{}
 	logger.Info("Starting SR-IOV device discovery")
 
-	pci, err := host.GetHelpers().PCI()
+	pci, err := h.PCI()
 	if err != nil {
 		logger.Error(err, "Failed to get PCI info")
 		return nil, fmt.Errorf("error getting PCI info: %v", err)
@@ -61,41 +137,59 @@ func DiscoverSriovDevices() (types.AllocatableDevices, error) {
 			continue
 		}
 
-		// TODO: exclude devices used by host system
-		if host.GetHelpers().IsSriovVF(device.Address) {
+		if h.IsSriovVF(device.Address) {
 			logger.V(2).Info("Skipping VF device", "address", device.Address)
 			continue
 		}
 
-		pfNetName := host.GetHelpers().TryGetInterfaceName(device.Address)
+		pfNetName := h.TryGetInterfaceName(device.Address)
 		if pfNetName == "" {
 			logger.Error(nil, "Unable to get interface name for device, skipping", "address", device.Address)
 			continue
 		}
 
-		eswitchMode := host.GetHelpers().GetNicSriovMode(device.Address)
+		eswitchMode := h.GetNicSriovMode(device.Address)
 
 		// Get NUMA node information
-		numaNode, err := host.GetHelpers().GetNumaNode(device.Address)
+		numaNode, err := h.GetNumaNode(device.Address)
 		if err != nil {
 			logger.Error(err, "Failed to get NUMA node, using default", "address", device.Address)
 			numaNode = "0" // Default to node 0 if we can't determine it
 		}
 
 		// Get PCIe Root Complex information using upstream Kubernetes implementation
-		pcieRoot, err := host.GetHelpers().GetPCIeRoot(device.Address)
+		pcieRoot, err := h.GetPCIeRoot(device.Address)
 		if err != nil {
 			logger.Error(err, "Failed to get PCIe Root Complex", "address", device.Address)
 			pcieRoot = "" // Leave empty if we can't determine it
 		}
 
 		// Get immediate parent PCI address (e.g., bridge) for granular filtering
-		parentPciAddress, err := host.GetHelpers().GetParentPciAddress(device.Address)
+		parentPciAddress, err := h.GetParentPciAddress(device.Address)
 		if err != nil {
 			logger.Error(err, "Failed to get parent PCI address", "address", device.Address)
 			parentPciAddress = "" // Leave empty if we can't determine it
 		}
 
+		// Get the link properties published as attributes
+		linkInfo, err := h.GetLinkInfo(pfNetName)
+		if err != nil {
+			logger.Error(err, "Failed to get link info", "address", device.Address, "interface", pfNetName)
+			linkInfo = nil // Publish the device without link attributes
+		}
+
+		rdmaDevice, err := h.GetRDMADevice(device.Address)
+		if err != nil {
+			logger.Error(err, "Failed to get RDMA device", "address", device.Address)
+		}
+
+		vendorPlugin := vendors.Get(device.Vendor.ID)
+		vendorAttributes, err := vendorPlugin.PFAttributes(device.Address)
+		if err != nil {
+			logger.Error(err, "Failed to get vendor attributes", "address", device.Address, "vendor", vendorPlugin.Name())
+			vendorAttributes = nil // Publish the device without vendor attributes
+		}
+
 		logger.Info("Found SR-IOV PF device",
 			"address", device.Address,
 			"interface", pfNetName,
@@ -104,7 +198,8 @@ func DiscoverSriovDevices() (types.AllocatableDevices, error) {
 			"eswitchMode", eswitchMode,
 			"numaNode", numaNode,
 			"pcieRoot", pcieRoot,
-			"parentPciAddress", parentPciAddress)
+			"parentPciAddress", parentPciAddress,
+			"rdmaDevice", rdmaDevice)
 
 		pfList = append(pfList, PFInfo{
 			PciAddress:       device.Address,
@@ -116,85 +211,224 @@ func DiscoverSriovDevices() (types.AllocatableDevices, error) {
 			NumaNode:         numaNode,
 			PCIeRoot:         pcieRoot,
 			ParentPciAddress: parentPciAddress,
+			Link:             linkInfo,
+			RDMA:             rdmaDevice != "",
+			VendorAttributes: vendorAttributes,
 		})
 	}
 
-	logger.Info("Processing SR-IOV PF devices", "pfCount", len(pfList))
-
-	for _, pfInfo := range pfList {
-		logger.V(1).Info("Getting VF list for PF", "pf", pfInfo.NetName, "address", pfInfo.Address)
-
-		vfList, err := host.GetHelpers().GetVFList(pfInfo.Address)
-		if err != nil {
-			logger.Error(err, "Failed to get VF list for PF", "pf", pfInfo.NetName, "address", pfInfo.Address)
-			return nil, fmt.Errorf("error getting VF list: %v", err)
-		}
+	return pfList, nil
+}
 
-		logger.Info("Found VFs for PF", "pf", pfInfo.NetName, "vfCount", len(vfList))
+func deviceNameFromPciAddress(pciAddress string) string {
+	deviceName := strings.ReplaceAll(pciAddress, ":", "-")
+	return strings.ReplaceAll(deviceName, ".", "-")
+}
 
-		for _, vfInfo := range vfList {
-			deviceName := strings.ReplaceAll(vfInfo.PciAddress, ":", "-")
-			deviceName = strings.ReplaceAll(deviceName, ".", "-")
+func numaNodeValue(numaNode string) *int64 {
+	numaNodeInt, err := strconv.ParseInt(numaNode, 10, 64)
+	if err != nil {
+		// Default to -1 if parsing fails
+		return ptr.To(int64(-1))
+	}
+	return ptr.To(numaNodeInt)
+}
 
-			logger.V(2).Info("Adding VF device to resource list",
-				"deviceName", deviceName,
-				"vfAddress", vfInfo.PciAddress,
-				"vfID", vfInfo.VFID,
-				"vfDeviceID", vfInfo.DeviceID,
-				"pfDeviceID", pfInfo.DeviceID,
-				"pf", pfInfo.NetName)
+func newVFDevice(deviceName string, pfInfo PFInfo, vfInfo host.VFInfo) resourceapi.Device {
+	device := resourceapi.Device{
+		Name: deviceName,
+		Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+			consts.AttributeVendorID: {
+				StringValue: ptr.To(pfInfo.VendorID),
+			},
+			consts.AttributeDeviceID: {
+				StringValue: ptr.To(vfInfo.DeviceID),
+			},
+			consts.AttributePFDeviceID: {
+				StringValue: ptr.To(pfInfo.DeviceID),
+			},
+			consts.AttributePciAddress: {
+				StringValue: ptr.To(vfInfo.PciAddress),
+			},
+			consts.AttributePFName: {
+				StringValue: ptr.To(pfInfo.NetName),
+			},
+			consts.AttributeEswitchMode: {
+				StringValue: ptr.To(pfInfo.EswitchMode),
+			},
+			consts.AttributeVFID: {
+				IntValue: ptr.To(int64(vfInfo.VFID)),
+			},
+			consts.AttributeNumaNode: {
+				IntValue: numaNodeValue(pfInfo.NumaNode),
+			},
+			// PCIe Root Complex (upstream Kubernetes standard) - for topology-aware scheduling
+			consts.AttributePCIeRoot: {
+				StringValue: ptr.To(pfInfo.PCIeRoot),
+			},
+			// Immediate parent PCI address - for granular filtering
+			consts.AttributeParentPciAddress: {
+				StringValue: ptr.To(pfInfo.ParentPciAddress),
+			},
+			// Standard Kubernetes PCI address attribute
+			consts.AttributeStandardPciAddress: {
+				StringValue: ptr.To(vfInfo.PciAddress),
+			},
+			consts.AttributeDeviceType: {
+				StringValue: ptr.To(consts.DeviceTypeVF),
+			},
+			consts.AttributeRDMA: {
+				BoolValue: ptr.To(pfInfo.RDMA),
+			},
+		},
+	}
+	setLinkAttributes(&device, pfInfo.Link)
+	setVendorAttributes(&device, pfInfo.VendorAttributes)
+	return device
+}
 
-			resourceList[deviceName] = resourceapi.Device{
-				Name: deviceName,
-				Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
-					consts.AttributeVendorID: {
-						StringValue: ptr.To(pfInfo.VendorID),
-					},
-					consts.AttributeDeviceID: {
-						StringValue: ptr.To(vfInfo.DeviceID),
-					},
-					consts.AttributePFDeviceID: {
-						StringValue: ptr.To(pfInfo.DeviceID),
-					},
-					consts.AttributePciAddress: {
-						StringValue: ptr.To(vfInfo.PciAddress),
-					},
-					consts.AttributePFName: {
-						StringValue: ptr.To(pfInfo.NetName),
-					},
-					consts.AttributeEswitchMode: {
-						StringValue: ptr.To(pfInfo.EswitchMode),
-					},
-					consts.AttributeVFID: {
-						IntValue: ptr.To(int64(vfInfo.VFID)),
-					},
-					consts.AttributeNumaNode: {
-						IntValue: func() *int64 {
-							numaNodeInt, err := strconv.ParseInt(pfInfo.NumaNode, 10, 64)
-							if err != nil {
-								// Default to -1 if parsing fails
-								return ptr.To(int64(-1))
-							}
-							return ptr.To(numaNodeInt)
-						}(),
-					},
-					// PCIe Root Complex (upstream Kubernetes standard) - for topology-aware scheduling
-					consts.AttributePCIeRoot: {
-						StringValue: ptr.To(pfInfo.PCIeRoot),
-					},
-					// Immediate parent PCI address - for granular filtering
-					consts.AttributeParentPciAddress: {
-						StringValue: ptr.To(pfInfo.ParentPciAddress),
-					},
-					// Standard Kubernetes PCI address attribute
-					consts.AttributeStandardPciAddress: {
-						StringValue: ptr.To(vfInfo.PciAddress),
+// newPFBandwidthDevice returns a PF device that can be allocated multiple times. Each
+// allocation consumes one VF and a share of the link bandwidth, enforced with max_tx_rate.
+func newPFBandwidthDevice(pfInfo PFInfo, numVFs, speedMbps int) resourceapi.Device {
+	device := resourceapi.Device{
+		Name:                     deviceNameFromPciAddress(pfInfo.PciAddress),
+		AllowMultipleAllocations: ptr.To(true),
+		Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+			consts.AttributeVendorID: {
+				StringValue: ptr.To(pfInfo.VendorID),
+			},
+			consts.AttributePFDeviceID: {
+				StringValue: ptr.To(pfInfo.DeviceID),
+			},
+			consts.AttributePciAddress: {
+				StringValue: ptr.To(pfInfo.PciAddress),
+			},
+			consts.AttributePFName: {
+				StringValue: ptr.To(pfInfo.NetName),
+			},
+			consts.AttributeEswitchMode: {
+				StringValue: ptr.To(pfInfo.EswitchMode),
+			},
+			consts.AttributeNumaNode: {
+				IntValue: numaNodeValue(pfInfo.NumaNode),
+			},
+			consts.AttributePCIeRoot: {
+				StringValue: ptr.To(pfInfo.PCIeRoot),
+			},
+			consts.AttributeParentPciAddress: {
+				StringValue: ptr.To(pfInfo.ParentPciAddress),
+			},
+			consts.AttributeStandardPciAddress: {
+				StringValue: ptr.To(pfInfo.PciAddress),
+			},
+			consts.AttributeRDMA: {
+				BoolValue: ptr.To(pfInfo.RDMA),
+			},
+		},
+		Capacity: map[resourceapi.QualifiedName]resourceapi.DeviceCapacity{
+			consts.CapacityBandwidth: {
+				// the link speed is in Mbps, the capacity in Gbps
+				Value: *resource.NewMilliQuantity(int64(speedMbps), resource.DecimalSI),
+				RequestPolicy: &resourceapi.CapacityRequestPolicy{
+					Default: resource.NewQuantity(1, resource.DecimalSI),
+					ValidRange: &resourceapi.CapacityRequestPolicyRange{
+						Min: resource.NewMilliQuantity(100, resource.DecimalSI),
 					},
 				},
-			}
+			},
+			consts.CapacityVFs: {
+				Value: *resource.NewQuantity(int64(numVFs), resource.DecimalSI),
+				RequestPolicy: &resourceapi.CapacityRequestPolicy{
+					Default:     resource.NewQuantity(1, resource.DecimalSI),
+					ValidValues: []resource.Quantity{*resource.NewQuantity(1, resource.DecimalSI)},
+				},
+			},
+		},
+	}
+	setLinkAttributes(&device, pfInfo.Link)
+	setVendorAttributes(&device, pfInfo.VendorAttributes)
+	return device
+}
+
+// setVendorAttributes adds the attributes of the vendor plugin of the PF to a device
+func setVendorAttributes(device *resourceapi.Device, attributes map[resourceapi.QualifiedName]resourceapi.DeviceAttribute) {
+	if len(attributes) == 0 {
+		return
+	}
+	if device.Attributes == nil {
+		device.Attributes = map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{}
+	}
+	for name, value := range attributes {
+		device.Attributes[name] = value
+	}
+}
+
+// setLinkAttributes sets the link properties of the PF on a device. The link speed is
+// published as a capacity, except for PFs published with consumable bandwidth where
+// every capacity is consumed by the allocations.
+func setLinkAttributes(device *resourceapi.Device, link *host.LinkInfo) {
+	if link == nil {
+		return
+	}
+	if device.Attributes == nil {
+		device.Attributes = map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{}
+	}
+
+	device.Attributes[consts.AttributePFMtu] = resourceapi.DeviceAttribute{IntValue: ptr.To(int64(link.MTU))}
+	device.Attributes[consts.AttributePFOperState] = resourceapi.DeviceAttribute{StringValue: ptr.To(link.OperState)}
+	device.Attributes[consts.AttributePFCarrier] = resourceapi.DeviceAttribute{BoolValue: ptr.To(link.Carrier)}
+	for name, value := range map[resourceapi.QualifiedName]string{
+		consts.AttributePFPermMac:         link.PermAddress,
+		consts.AttributePFDriver:          link.Driver,
+		consts.AttributePFDriverVersion:   link.DriverVersion,
+		consts.AttributePFFirmwareVersion: link.FirmwareVersion,
+		consts.AttributeLinkLayer:         link.LinkLayer,
+	} {
+		if value == "" {
+			delete(device.Attributes, name)
+			continue
+		}
+		if len(value) > resourceapi.DeviceAttributeMaxValueLength {
+			value = value[:resourceapi.DeviceAttributeMaxValueLength]
 		}
+		device.Attributes[name] = resourceapi.DeviceAttribute{StringValue: ptr.To(value)}
 	}
 
-	logger.Info("SR-IOV device discovery completed", "totalDevices", len(resourceList))
-	return resourceList, nil
+	if ptr.Deref(device.AllowMultipleAllocations, false) {
+		// the bandwidth of a PF device follows the link speed, it is kept while the speed is unknown
+		if bandwidth, ok := device.Capacity[consts.CapacityBandwidth]; ok && link.Speed > 0 {
+			bandwidth.Value = *resource.NewMilliQuantity(int64(link.Speed), resource.DecimalSI)
+			device.Capacity[consts.CapacityBandwidth] = bandwidth
+		}
+		return
+	}
+	if link.Speed <= 0 {
+		delete(device.Capacity, consts.CapacityLinkSpeed)
+		return
+	}
+	if device.Capacity == nil {
+		device.Capacity = map[resourceapi.QualifiedName]resourceapi.DeviceCapacity{}
+	}
+	// the link speed is in Mbps, the capacity in bits per second
+	device.Capacity[consts.CapacityLinkSpeed] = resourceapi.DeviceCapacity{
+		Value: *resource.NewScaledQuantity(int64(link.Speed), resource.Mega),
+	}
+}
+
+// clearLinkAttributes removes the link attributes of a device whose PF link can't be read,
+// so claims don't select it on a stale state
+func clearLinkAttributes(device *resourceapi.Device) {
+	for _, name := range []resourceapi.QualifiedName{
+		consts.AttributePFMtu,
+		consts.AttributePFOperState,
+		consts.AttributePFCarrier,
+		consts.AttributePFPermMac,
+		consts.AttributePFDriver,
+		consts.AttributePFDriverVersion,
+		consts.AttributePFFirmwareVersion,
+		consts.AttributeLinkLayer,
+	} {
+		delete(device.Attributes, name)
+	}
+	delete(device.Capacity, consts.CapacityLinkSpeed)
 }
@@ -8,6 +8,7 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"go.uber.org/mock/gomock"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/utils/ptr"
 
 	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
@@ -17,9 +18,8 @@ import (
 
 var _ = Describe("DiscoverSriovDevices", func() {
 	var (
-		mockCtrl    *gomock.Controller
-		mockHost    *mock_host.MockInterface
-		origHelpers host.Interface
+		mockCtrl *gomock.Controller
+		mockHost *mock_host.MockInterface
 	)
 
 	BeforeEach(func() {
@@ -27,14 +27,10 @@ var _ = Describe("DiscoverSriovDevices", func() {
 		mockHost = mock_host.NewMockInterface(mockCtrl)
 		// Save original helpers and replace with mock
 		// Force initialization first so the sync.Once is triggered
-		_ = host.GetHelpers()
-		origHelpers = host.Helpers
-		host.Helpers = mockHost
 	})
 
 	AfterEach(func() {
 		// Restore original helpers
-		host.Helpers = origHelpers
 		mockCtrl.Finish()
 	})
 
@@ -77,9 +73,14 @@ var _ = Describe("DiscoverSriovDevices", func() {
 			mockHost.EXPECT().GetNumaNode("0000:01:00.0").Return("0", nil)
 			mockHost.EXPECT().GetPCIeRoot("0000:01:00.0").Return("pci0000:00", nil)
 			mockHost.EXPECT().GetParentPciAddress("0000:01:00.0").Return("0000:00:01.0", nil)
+			mockHost.EXPECT().GetRDMADevice("0000:01:00.0").Return("", nil)
+			mockHost.EXPECT().GetLinkInfo("eth0").Return(&host.LinkInfo{
+				Speed: 100000, MTU: 9000, OperState: "up", Carrier: true, PermAddress: "aa:bb:cc:dd:ee:ff",
+				Driver: "i40e", DriverVersion: "6.8.0", FirmwareVersion: "9.20 0x8000d95e 1.3353.0",
+			}, nil)
 			mockHost.EXPECT().GetVFList("0000:01:00.0").Return(vfList, nil)
 
-			devices, err := DiscoverSriovDevices()
+			devices, err := DiscoverSriovDevices(mockHost)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(devices).To(HaveLen(2))
 
@@ -97,6 +98,15 @@ var _ = Describe("DiscoverSriovDevices", func() {
 			Expect(dev1.Attributes[consts.AttributePCIeRoot].StringValue).To(Equal(ptr.To("pci0000:00")))
 			Expect(dev1.Attributes[consts.AttributeParentPciAddress].StringValue).To(Equal(ptr.To("0000:00:01.0")))
 			Expect(dev1.Attributes[consts.AttributeStandardPciAddress].StringValue).To(Equal(ptr.To("0000:01:00.1")))
+			Expect(dev1.Attributes[consts.AttributePFMtu].IntValue).To(Equal(ptr.To(int64(9000))))
+			Expect(dev1.Attributes[consts.AttributePFOperState].StringValue).To(Equal(ptr.To("up")))
+			Expect(dev1.Attributes[consts.AttributePFCarrier].BoolValue).To(Equal(ptr.To(true)))
+			Expect(dev1.Attributes[consts.AttributePFPermMac].StringValue).To(Equal(ptr.To("aa:bb:cc:dd:ee:ff")))
+			Expect(dev1.Attributes[consts.AttributePFDriver].StringValue).To(Equal(ptr.To("i40e")))
+			Expect(dev1.Attributes[consts.AttributePFDriverVersion].StringValue).To(Equal(ptr.To("6.8.0")))
+			Expect(dev1.Attributes[consts.AttributePFFirmwareVersion].StringValue).To(Equal(ptr.To("9.20 0x8000d95e 1.3353.0")))
+			linkSpeed := dev1.Capacity[consts.CapacityLinkSpeed].Value
+			Expect(linkSpeed.Cmp(resource.MustParse("100G"))).To(Equal(0))
 
 			// Check second VF
 			dev2 := devices["0000-01-00-2"]
@@ -139,6 +149,8 @@ var _ = Describe("DiscoverSriovDevices", func() {
 			mockHost.EXPECT().GetNumaNode("0000:01:00.0").Return("0", nil)
 			mockHost.EXPECT().GetPCIeRoot("0000:01:00.0").Return("pci0000:00", nil)
 			mockHost.EXPECT().GetParentPciAddress("0000:01:00.0").Return("0000:00:01.0", nil)
+			mockHost.EXPECT().GetRDMADevice("0000:01:00.0").Return("", nil)
+			mockHost.EXPECT().GetLinkInfo("eth0").Return(&host.LinkInfo{MTU: 1500, OperState: "down"}, nil)
 
 			// Second PF
 			mockHost.EXPECT().IsSriovVF("0000:02:00.0").Return(false)
@@ -147,11 +159,13 @@ var _ = Describe("DiscoverSriovDevices", func() {
 			mockHost.EXPECT().GetNumaNode("0000:02:00.0").Return("1", nil)
 			mockHost.EXPECT().GetPCIeRoot("0000:02:00.0").Return("pci0000:00", nil)
 			mockHost.EXPECT().GetParentPciAddress("0000:02:00.0").Return("0000:00:02.0", nil)
+			mockHost.EXPECT().GetRDMADevice("0000:02:00.0").Return("", nil)
+			mockHost.EXPECT().GetLinkInfo("eth1").Return(&host.LinkInfo{MTU: 1500, OperState: "down"}, nil)
 
 			mockHost.EXPECT().GetVFList("0000:01:00.0").Return(vfList1, nil)
 			mockHost.EXPECT().GetVFList("0000:02:00.0").Return(vfList2, nil)
 
-			devices, err := DiscoverSriovDevices()
+			devices, err := DiscoverSriovDevices(mockHost)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(devices).To(HaveLen(2))
 
@@ -197,9 +211,11 @@ var _ = Describe("DiscoverSriovDevices", func() {
 			mockHost.EXPECT().GetNumaNode("0000:01:00.0").Return("", fmt.Errorf("numa node not found"))
 			mockHost.EXPECT().GetPCIeRoot("0000:01:00.0").Return("", nil)
 			mockHost.EXPECT().GetParentPciAddress("0000:01:00.0").Return("", nil)
+			mockHost.EXPECT().GetRDMADevice("0000:01:00.0").Return("", nil)
+			mockHost.EXPECT().GetLinkInfo("eth0").Return(&host.LinkInfo{MTU: 1500, OperState: "down"}, nil)
 			mockHost.EXPECT().GetVFList("0000:01:00.0").Return(vfList, nil)
 
-			devices, err := DiscoverSriovDevices()
+			devices, err := DiscoverSriovDevices(mockHost)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(devices).To(HaveLen(1))
 
@@ -233,9 +249,11 @@ var _ = Describe("DiscoverSriovDevices", func() {
 			mockHost.EXPECT().GetNumaNode("0000:01:00.0").Return("0", nil)
 			mockHost.EXPECT().GetPCIeRoot("0000:01:00.0").Return("", nil)
 			mockHost.EXPECT().GetParentPciAddress("0000:01:00.0").Return("", fmt.Errorf("parent not found"))
+			mockHost.EXPECT().GetRDMADevice("0000:01:00.0").Return("", nil)
+			mockHost.EXPECT().GetLinkInfo("eth0").Return(&host.LinkInfo{MTU: 1500, OperState: "down"}, nil)
 			mockHost.EXPECT().GetVFList("0000:01:00.0").Return(vfList, nil)
 
-			devices, err := DiscoverSriovDevices()
+			devices, err := DiscoverSriovDevices(mockHost)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(devices).To(HaveLen(1))
 
@@ -269,7 +287,7 @@ var _ = Describe("DiscoverSriovDevices", func() {
 			mockHost.EXPECT().PCI().Return(pciInfo, nil)
 			// No other calls expected since devices are not network class
 
-			devices, err := DiscoverSriovDevices()
+			devices, err := DiscoverSriovDevices(mockHost)
 			// When all devices are filtered, function returns successfully with empty list
 			Expect(err).NotTo(HaveOccurred())
 			Expect(devices).To(HaveLen(0))
@@ -306,12 +324,14 @@ var _ = Describe("DiscoverSriovDevices", func() {
 			mockHost.EXPECT().GetNumaNode("0000:01:00.0").Return("0", nil)
 			mockHost.EXPECT().GetPCIeRoot("0000:01:00.0").Return("", nil)
 			mockHost.EXPECT().GetParentPciAddress("0000:01:00.0").Return("", nil)
+			mockHost.EXPECT().GetRDMADevice("0000:01:00.0").Return("", nil)
+			mockHost.EXPECT().GetLinkInfo("eth0").Return(&host.LinkInfo{MTU: 1500, OperState: "down"}, nil)
 			mockHost.EXPECT().GetVFList("0000:01:00.0").Return(vfList, nil)
 
 			// Second device (VF) - should be skipped
 			mockHost.EXPECT().IsSriovVF("0000:01:00.1").Return(true)
 
-			devices, err := DiscoverSriovDevices()
+			devices, err := DiscoverSriovDevices(mockHost)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(devices).To(HaveLen(1)) // Only the VF from the PF's list, not the PCI device itself
 		})
@@ -332,7 +352,7 @@ var _ = Describe("DiscoverSriovDevices", func() {
 			mockHost.EXPECT().IsSriovVF("0000:01:00.0").Return(false)
 			mockHost.EXPECT().TryGetInterfaceName("0000:01:00.0").Return("") // No interface name
 
-			devices, err := DiscoverSriovDevices()
+			devices, err := DiscoverSriovDevices(mockHost)
 			// Device is skipped, returns successfully with empty list
 			Expect(err).NotTo(HaveOccurred())
 			Expect(devices).To(HaveLen(0))
@@ -353,7 +373,7 @@ var _ = Describe("DiscoverSriovDevices", func() {
 			mockHost.EXPECT().PCI().Return(pciInfo, nil)
 			// No other calls since parsing fails
 
-			devices, err := DiscoverSriovDevices()
+			devices, err := DiscoverSriovDevices(mockHost)
 			// Device parsing fails, returns successfully with empty list
 			Expect(err).NotTo(HaveOccurred())
 			Expect(devices).To(HaveLen(0))
@@ -364,7 +384,7 @@ var _ = Describe("DiscoverSriovDevices", func() {
 		It("should return error when PCI() fails", func() {
 			mockHost.EXPECT().PCI().Return(nil, fmt.Errorf("failed to get PCI info"))
 
-			devices, err := DiscoverSriovDevices()
+			devices, err := DiscoverSriovDevices(mockHost)
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(ContainSubstring("error getting PCI info"))
 			Expect(devices).To(BeNil())
@@ -377,7 +397,7 @@ var _ = Describe("DiscoverSriovDevices", func() {
 
 			mockHost.EXPECT().PCI().Return(pciInfo, nil)
 
-			devices, err := DiscoverSriovDevices()
+			devices, err := DiscoverSriovDevices(mockHost)
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(Equal("could not retrieve PCI devices"))
 			Expect(devices).To(BeNil())
@@ -402,9 +422,11 @@ var _ = Describe("DiscoverSriovDevices", func() {
 			mockHost.EXPECT().GetNumaNode("0000:01:00.0").Return("0", nil)
 			mockHost.EXPECT().GetPCIeRoot("0000:01:00.0").Return("", nil)
 			mockHost.EXPECT().GetParentPciAddress("0000:01:00.0").Return("", nil)
+			mockHost.EXPECT().GetRDMADevice("0000:01:00.0").Return("", nil)
+			mockHost.EXPECT().GetLinkInfo("eth0").Return(&host.LinkInfo{MTU: 1500, OperState: "down"}, nil)
 			mockHost.EXPECT().GetVFList("0000:01:00.0").Return(nil, fmt.Errorf("failed to get VF list"))
 
-			devices, err := DiscoverSriovDevices()
+			devices, err := DiscoverSriovDevices(mockHost)
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(ContainSubstring("error getting VF list"))
 			Expect(devices).To(BeNil())
@@ -435,9 +457,11 @@ var _ = Describe("DiscoverSriovDevices", func() {
 			mockHost.EXPECT().GetNumaNode("0000:01:00.0").Return("0", nil)
 			mockHost.EXPECT().GetPCIeRoot("0000:01:00.0").Return("", nil)
 			mockHost.EXPECT().GetParentPciAddress("0000:01:00.0").Return("", nil)
+			mockHost.EXPECT().GetRDMADevice("0000:01:00.0").Return("", nil)
+			mockHost.EXPECT().GetLinkInfo("eth0").Return(&host.LinkInfo{MTU: 1500, OperState: "down"}, nil)
 			mockHost.EXPECT().GetVFList("0000:01:00.0").Return(vfList, nil)
 
-			devices, err := DiscoverSriovDevices()
+			devices, err := DiscoverSriovDevices(mockHost)
 			Expect(err).NotTo(HaveOccurred())
 
 			// Colons and dots should be replaced with dashes
@@ -466,9 +490,11 @@ var _ = Describe("DiscoverSriovDevices", func() {
 			mockHost.EXPECT().GetNumaNode("0000:01:00.0").Return("0", nil)
 			mockHost.EXPECT().GetPCIeRoot("0000:01:00.0").Return("", nil)
 			mockHost.EXPECT().GetParentPciAddress("0000:01:00.0").Return("", nil)
+			mockHost.EXPECT().GetRDMADevice("0000:01:00.0").Return("", nil)
+			mockHost.EXPECT().GetLinkInfo("eth0").Return(&host.LinkInfo{MTU: 1500, OperState: "down"}, nil)
 			mockHost.EXPECT().GetVFList("0000:01:00.0").Return([]host.VFInfo{}, nil) // Empty list
 
-			devices, err := DiscoverSriovDevices()
+			devices, err := DiscoverSriovDevices(mockHost)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(devices).To(HaveLen(0))
 		})
@@ -0,0 +1,72 @@
+package devicestate
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	configapi "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/virtualfunction/v1alpha1"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/cdi"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/flags"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host/fakehost"
+	drasriovtypes "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
+)
+
+var _ = Describe("Manager with a fake host", func() {
+	var (
+		fakeHost *fakehost.Host
+		s        *Manager
+	)
+
+	BeforeEach(func() {
+		fakeHost = newFakeHost(2, 1500)
+		cdiHandler, err := cdi.NewHandler(GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+		s, err = NewManager(&drasriovtypes.Config{
+			Flags: &drasriovtypes.Flags{
+				NodeName:               "node1",
+				DefaultInterfacePrefix: "net",
+				HostDevicePolicy:       HostDevicePolicySkip,
+			},
+			K8sClient: flags.ClientSets{Client: fake.NewClientBuilder().WithScheme(flags.Scheme).Build()},
+		}, fakeHost, cdiHandler, nil)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("discovers the VFs of the fake host", func() {
+		Expect(s.GetAllocatableDevices()).To(HaveLen(2))
+		Expect(s.GetAllocatableDevices()).To(HaveKey("0000-01-00-1"))
+		Expect(s.GetAllocatableDevices()).To(HaveKey("0000-01-00-2"))
+	})
+
+	It("binds a VF to vfio-pci on prepare and restores its driver on unprepare", func() {
+		claim := newClaim("claim1", "0000-01-00-2", &configapi.VfConfig{Driver: "vfio-pci"})
+
+		ifNameIndex := 0
+		prepared, err := s.PrepareDevicesForClaim(context.Background(), &ifNameIndex, claim)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(prepared).To(HaveLen(1))
+		Expect(prepared[0].OriginalDriver).To(Equal("iavf"))
+		Expect(prepared[0].ContainerEdits.DeviceNodes).To(ContainElement(HaveField("Path", "/dev/vfio/43")))
+
+		vf, _ := fakeHost.VF("0000:01:00.2")
+		Expect(vf.Driver).To(Equal("vfio-pci"))
+		Expect(fakeHost.LoadedKernelModules()).To(ContainElement("vfio_pci"))
+
+		Expect(s.Unprepare(string(claim.UID), prepared)).To(Succeed())
+		vf, _ = fakeHost.VF("0000:01:00.2")
+		Expect(vf.Driver).To(Equal("iavf"))
+	})
+
+	It("fails the prepare when the VF can't be bound", func() {
+		fakeHost.BindDriverErr = errors.New("boom")
+		claim := newClaim("claim1", "0000-01-00-1", &configapi.VfConfig{Driver: "vfio-pci"})
+
+		ifNameIndex := 0
+		_, err := s.PrepareDevicesForClaim(context.Background(), &ifNameIndex, claim)
+		Expect(err).To(MatchError(ContainSubstring("failed to bind device 0000:01:00.1")))
+	})
+})
@@ -0,0 +1,71 @@
+package devicestate
+
+import (
+	"fmt"
+
+	. "github.com/onsi/gomega"
+	resourceapi "k8s.io/api/resource/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+
+	configapi "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/virtualfunction/v1alpha1"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host/fakehost"
+)
+
+// newClaim returns a claim named uid in the default namespace, reserved for the pod "pod-<uid>"
+// and allocated the device with the VfConfig
+func newClaim(uid, device string, vfConfig *configapi.VfConfig) *resourceapi.ResourceClaim {
+	vfConfig.TypeMeta = metav1.TypeMeta{APIVersion: configapi.GroupName + "/" + configapi.Version, Kind: configapi.VfConfigKind}
+	encoded, err := runtime.Encode(configapi.Decoder.(runtime.Encoder), vfConfig)
+	Expect(err).NotTo(HaveOccurred())
+	return &resourceapi.ResourceClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: uid, Namespace: "default", UID: k8stypes.UID(uid)},
+		Status: resourceapi.ResourceClaimStatus{
+			ReservedFor: []resourceapi.ResourceClaimConsumerReference{{Name: "pod", UID: k8stypes.UID("pod-" + uid)}},
+			Allocation: &resourceapi.AllocationResult{
+				Devices: resourceapi.DeviceAllocationResult{
+					Results: []resourceapi.DeviceRequestAllocationResult{
+						{Request: "req", Driver: consts.DriverName, Pool: "node1", Device: device},
+					},
+					Config: []resourceapi.DeviceAllocationConfiguration{{
+						Source:   resourceapi.AllocationConfigSourceClaim,
+						Requests: []string{"req"},
+						DeviceConfiguration: resourceapi.DeviceConfiguration{
+							Opaque: &resourceapi.OpaqueDeviceConfiguration{
+								Driver:     consts.DriverName,
+								Parameters: runtime.RawExtension{Raw: encoded},
+							},
+						},
+					}},
+				},
+			},
+		},
+	}
+}
+
+// newFakeHost returns a fake host with the Intel PF 0000:01:00.0 (eth0) and its numVFs iavf VFs
+// 0000:01:00.1 (eth0v0, IOMMU group 42), 0000:01:00.2 (eth0v1, IOMMU group 43) and so on
+func newFakeHost(numVFs, mtu int) *fakehost.Host {
+	pf := fakehost.PF{
+		PciAddress: "0000:01:00.0",
+		NetName:    "eth0",
+		VendorID:   "8086",
+		DeviceID:   "159b",
+		Driver:     "ice",
+		Link:       host.LinkInfo{Speed: 25000, MTU: mtu, OperState: "up", Carrier: true},
+	}
+	for i := range numVFs {
+		pf.VFs = append(pf.VFs, fakehost.VF{
+			PciAddress: fmt.Sprintf("0000:01:00.%d", i+1),
+			VFID:       i,
+			DeviceID:   "1889",
+			NetName:    fmt.Sprintf("eth0v%d", i),
+			Driver:     "iavf",
+			IOMMUGroup: fmt.Sprintf("%d", 42+i),
+		})
+	}
+	return fakehost.New(pf)
+}
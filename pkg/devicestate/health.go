@@ -0,0 +1,309 @@
+package devicestate
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	resourceapi "k8s.io/api/resource/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host"
+)
+
+// healthTaintKeys are the taints owned by the health monitor, other taints are left untouched
+var healthTaintKeys = sets.New(consts.TaintLinkDown, consts.TaintPCIError, consts.TaintBindFailed, consts.TaintSanitizeFailed)
+
+// CheckDeviceHealth taints the devices whose PF lost its link, that reported new PCIe AER
+// errors since the previous check, that failed to bind to a driver or that failed to be
+// sanitized, and removes the taints of the devices that recovered. The resources are republished if any taint changed.
+func (s *Manager) CheckDeviceHealth(ctx context.Context) error {
+	logger := klog.FromContext(ctx).WithName("CheckDeviceHealth")
+
+	s.retrySanitizeFailures(logger)
+
+	// the host is read without holding the mutex, the taints are computed and merged under it
+	s.mutex.Lock()
+	targets := make(map[string]healthTarget, len(s.allocatable))
+	for deviceName, device := range s.allocatable {
+		targets[deviceName] = healthTarget{
+			pfName:     stringAttribute(device, consts.AttributePFName),
+			pciAddress: stringAttribute(device, consts.AttributePciAddress),
+		}
+	}
+	bindFailures := sets.KeySet(s.bindFailures)
+	s.mutex.Unlock()
+
+	states := s.readDeviceHealth(logger, targets, bindFailures)
+
+	s.mutex.Lock()
+	if s.aerCounters == nil {
+		s.aerCounters = map[string]host.AERCounters{}
+	}
+	if s.fatalPCIErrors == nil {
+		s.fatalPCIErrors = sets.New[string]()
+	}
+	changesMade := false
+	for deviceName, state := range states {
+		device, exists := s.allocatable[deviceName]
+		if !exists {
+			continue
+		}
+		taints := s.deviceHealthTaints(logger, deviceName, device, state)
+		merged := mergeHealthTaints(device.Taints, taints, metav1.Now())
+		if apiequality.Semantic.DeepEqual(merged, device.Taints) {
+			continue
+		}
+		logger.Info("Device health changed", "deviceName", deviceName, "taints", taints)
+		device.Taints = merged
+		s.allocatable[deviceName] = device
+		changesMade = true
+	}
+	s.mutex.Unlock()
+
+	if !changesMade {
+		return nil
+	}
+	s.notifyHealthSubscribers()
+	if republishCallback := s.getRepublishCallback(); republishCallback != nil {
+		if err := republishCallback(ctx); err != nil {
+			return fmt.Errorf("failed to republish resources: %w", err)
+		}
+	}
+	return nil
+}
+
+// healthTarget identifies the PF and the PCI device a health check reads for a device
+type healthTarget struct {
+	pfName     string
+	pciAddress string
+}
+
+// deviceHealth is the state of the host read by a health check for a device
+type deviceHealth struct {
+	// link is the link of the PF, nil if it can't be read
+	link *host.LinkInfo
+	// aerCounters are the PCIe AER counters of the device, nil if they can't be read
+	aerCounters *host.AERCounters
+	// driver is the driver of a device that failed to bind, empty if it is still unbound
+	driver string
+}
+
+// readDeviceHealth reads the state of the host of the devices, the link info of the PFs is
+// read once. s.mutex must not be held.
+func (s *Manager) readDeviceHealth(logger klog.Logger, targets map[string]healthTarget, bindFailures sets.Set[string]) map[string]deviceHealth {
+	links := map[string]*host.LinkInfo{}
+	states := make(map[string]deviceHealth, len(targets))
+	for deviceName, target := range targets {
+		state := deviceHealth{}
+		if target.pfName != "" {
+			link, cached := links[target.pfName]
+			if !cached {
+				var err error
+				if link, err = s.host.GetLinkInfo(target.pfName); err != nil {
+					logger.V(2).Info("Failed to get link info", "pf", target.pfName, "error", err.Error())
+					link = nil
+				}
+				links[target.pfName] = link
+			}
+			state.link = link
+		}
+		if target.pciAddress != "" {
+			if counters, err := s.host.GetAERCounters(target.pciAddress); err == nil {
+				state.aerCounters = counters
+			}
+			if bindFailures.Has(deviceName) {
+				if driver, err := s.host.GetDriverByBusAndDevice(target.pciAddress); err == nil {
+					state.driver = driver
+				}
+			}
+		}
+		states[deviceName] = state
+	}
+	return states
+}
+
+// IsDeviceHealthy returns false if the device has any taint set by the health monitor
+func IsDeviceHealthy(device resourceapi.Device) bool {
+	for _, taint := range device.Taints {
+		if healthTaintKeys.Has(taint.Key) {
+			return false
+		}
+	}
+	return true
+}
+
+// SubscribeHealthUpdates returns a channel notified every time the health of a device
+// changes, and a function to cancel the subscription.
+func (s *Manager) SubscribeHealthUpdates() (<-chan struct{}, func()) {
+	updates := make(chan struct{}, 1)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.healthSubscribers == nil {
+		s.healthSubscribers = map[chan struct{}]struct{}{}
+	}
+	s.healthSubscribers[updates] = struct{}{}
+	return updates, func() {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		delete(s.healthSubscribers, updates)
+	}
+}
+
+// notifyHealthSubscribers wakes up the subscribers without waiting for the ones that were
+// already notified.
+func (s *Manager) notifyHealthSubscribers() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for updates := range s.healthSubscribers {
+		select {
+		case updates <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// WatchDeviceHealth checks the health and the host usage of the devices every interval until
+// the context is done. During a rolling update only the active instance checks them, as the
+// check sanitizes them.
+func (s *Manager) WatchDeviceHealth(ctx context.Context, interval time.Duration) {
+	logger := klog.FromContext(ctx).WithName("WatchDeviceHealth")
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.runIfActive(logger, func() {
+				if err := s.CheckDeviceHealth(ctx); err != nil {
+					logger.Error(err, "Failed to check device health")
+				}
+				if err := s.RefreshHostDevices(ctx); err != nil {
+					logger.Error(err, "Failed to refresh the host usage of the devices")
+				}
+			})
+		}
+	}
+}
+
+// deviceHealthTaints returns the health taints a device should have from the state of the
+// host read for it. s.mutex must be held.
+func (s *Manager) deviceHealthTaints(logger klog.Logger, deviceName string, device resourceapi.Device, state deviceHealth) []resourceapi.DeviceTaint {
+	taints := []resourceapi.DeviceTaint{}
+
+	if link := state.link; link != nil && (!link.Carrier || link.OperState == "down") {
+		taints = append(taints, resourceapi.DeviceTaint{
+			Key:    consts.TaintLinkDown,
+			Value:  stringAttribute(device, consts.AttributePFName),
+			Effect: resourceapi.DeviceTaintEffectNoSchedule,
+		})
+	}
+
+	pciAddress := stringAttribute(device, consts.AttributePciAddress)
+	if pciAddress == "" {
+		return taints
+	}
+
+	// AER counters only grow until the device is removed, a device is unhealthy while new
+	// non fatal errors are reported, and after a fatal error until it is reset
+	newNonFatal := false
+	if counters := state.aerCounters; counters != nil {
+		previous, seen := s.aerCounters[pciAddress]
+		s.aerCounters[pciAddress] = *counters
+		switch {
+		case !seen:
+		case counters.Fatal < previous.Fatal:
+			logger.Info("AER counters of device reset", "deviceName", deviceName)
+			s.fatalPCIErrors.Delete(pciAddress)
+		case counters.Fatal > previous.Fatal:
+			s.fatalPCIErrors.Insert(pciAddress)
+		}
+		newNonFatal = seen && counters.NonFatal > previous.NonFatal
+	}
+	switch {
+	case s.fatalPCIErrors.Has(pciAddress):
+		taints = append(taints, resourceapi.DeviceTaint{
+			Key:    consts.TaintPCIError,
+			Value:  "fatal",
+			Effect: resourceapi.DeviceTaintEffectNoExecute,
+		})
+	case newNonFatal:
+		taints = append(taints, resourceapi.DeviceTaint{
+			Key:    consts.TaintPCIError,
+			Value:  "nonFatal",
+			Effect: resourceapi.DeviceTaintEffectNoSchedule,
+		})
+	}
+
+	// a device that failed to bind recovers once it is bound to a driver again
+	if bindErr, failed := s.bindFailures[deviceName]; failed {
+		if state.driver != "" {
+			logger.Info("Device bound to a driver again", "deviceName", deviceName, "driver", state.driver)
+			delete(s.bindFailures, deviceName)
+		} else {
+			logger.V(2).Info("Device still not bound after a bind failure", "deviceName", deviceName, "bindError", bindErr)
+			taints = append(taints, resourceapi.DeviceTaint{
+				Key:    consts.TaintBindFailed,
+				Effect: resourceapi.DeviceTaintEffectNoSchedule,
+			})
+		}
+	}
+
+	// a device that failed to be sanitized recovers once the sanitization succeeds
+	if s.hasSanitizeFailure(deviceName) {
+		taints = append(taints, sanitizeFailedTaint())
+	}
+
+	return taints
+}
+
+// clearFatalPCIError forgets the fatal AER error of a device that was reset or rebound, its
+// taint is removed by the next health check
+func (s *Manager) clearFatalPCIError(pciAddress string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.fatalPCIErrors.Delete(pciAddress)
+}
+
+// recordBindFailure remembers that binding a device failed so it gets tainted by the next
+// health check, a successful bind clears it.
+func (s *Manager) recordBindFailure(deviceName string, bindErr error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if bindErr == nil {
+		delete(s.bindFailures, deviceName)
+		return
+	}
+	if s.bindFailures == nil {
+		s.bindFailures = map[string]string{}
+	}
+	s.bindFailures[deviceName] = bindErr.Error()
+}
+
+// mergeHealthTaints replaces the health taints of a device, keeping its other taints and the
+// time a health taint was first added.
+func mergeHealthTaints(current, health []resourceapi.DeviceTaint, now metav1.Time) []resourceapi.DeviceTaint {
+	var merged []resourceapi.DeviceTaint
+	for _, taint := range current {
+		if !healthTaintKeys.Has(taint.Key) {
+			merged = append(merged, taint)
+		}
+	}
+	for _, taint := range health {
+		taint.TimeAdded = &now
+		for _, existing := range current {
+			if existing.Key == taint.Key && existing.Value == taint.Value && existing.Effect == taint.Effect {
+				taint.TimeAdded = existing.TimeAdded
+				break
+			}
+		}
+		merged = append(merged, taint)
+	}
+	return merged
+}
@@ -0,0 +1,209 @@
+package devicestate
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host"
+	mock_host "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host/mock"
+	drasriovtypes "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
+)
+
+var _ = Describe("Device health", func() {
+	var (
+		mockCtrl    *gomock.Controller
+		mockHost    *mock_host.MockInterface
+		s           *Manager
+		republished int
+	)
+
+	hostTaint := resourceapi.DeviceTaint{Key: consts.TaintHostDevice, Value: "inUse", Effect: resourceapi.DeviceTaintEffectNoSchedule}
+	upLink := &host.LinkInfo{MTU: 1500, OperState: "up", Carrier: true}
+	downLink := &host.LinkInfo{MTU: 1500, OperState: "down"}
+
+	taintKeys := func(deviceName string) []string {
+		keys := []string{}
+		for _, taint := range s.allocatable[deviceName].Taints {
+			keys = append(keys, taint.Key)
+		}
+		return keys
+	}
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+		mockHost = mock_host.NewMockInterface(mockCtrl)
+
+		republished = 0
+		s = &Manager{
+			host: mockHost,
+			allocatable: drasriovtypes.AllocatableDevices{
+				"0000-01-00-1": {
+					Name: "0000-01-00-1",
+					Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+						consts.AttributePciAddress: {StringValue: ptr.To("0000:01:00.1")},
+						consts.AttributePFName:     {StringValue: ptr.To("eth0")},
+					},
+					Taints: []resourceapi.DeviceTaint{hostTaint},
+				},
+			},
+			republishCallback: func(context.Context) error {
+				republished++
+				return nil
+			},
+		}
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+	})
+
+	It("taints the devices of a PF without link and clears the taint on recovery", func() {
+		mockHost.EXPECT().GetAERCounters("0000:01:00.1").Return(nil, fmt.Errorf("no AER")).Times(3)
+
+		mockHost.EXPECT().GetLinkInfo("eth0").Return(downLink, nil)
+		Expect(s.CheckDeviceHealth(context.Background())).To(Succeed())
+		Expect(republished).To(Equal(1))
+		Expect(taintKeys("0000-01-00-1")).To(Equal([]string{consts.TaintHostDevice, consts.TaintLinkDown}))
+		timeAdded := s.allocatable["0000-01-00-1"].Taints[1].TimeAdded
+		Expect(timeAdded).NotTo(BeNil())
+
+		// nothing changed, the taint keeps the time it was added
+		mockHost.EXPECT().GetLinkInfo("eth0").Return(downLink, nil)
+		Expect(s.CheckDeviceHealth(context.Background())).To(Succeed())
+		Expect(republished).To(Equal(1))
+		Expect(s.allocatable["0000-01-00-1"].Taints[1].TimeAdded).To(Equal(timeAdded))
+
+		mockHost.EXPECT().GetLinkInfo("eth0").Return(upLink, nil)
+		Expect(s.CheckDeviceHealth(context.Background())).To(Succeed())
+		Expect(republished).To(Equal(2))
+		Expect(s.allocatable["0000-01-00-1"].Taints).To(Equal([]resourceapi.DeviceTaint{hostTaint}))
+	})
+
+	It("taints the devices reporting new non fatal AER errors until no new error is reported", func() {
+		mockHost.EXPECT().GetLinkInfo("eth0").Return(upLink, nil).AnyTimes()
+		gomock.InOrder(
+			mockHost.EXPECT().GetAERCounters("0000:01:00.1").Return(&host.AERCounters{Fatal: 0, NonFatal: 2}, nil),
+			mockHost.EXPECT().GetAERCounters("0000:01:00.1").Return(&host.AERCounters{Fatal: 0, NonFatal: 3}, nil),
+			mockHost.EXPECT().GetAERCounters("0000:01:00.1").Return(&host.AERCounters{Fatal: 0, NonFatal: 3}, nil),
+		)
+
+		// the first check only records the counters
+		Expect(s.CheckDeviceHealth(context.Background())).To(Succeed())
+		Expect(republished).To(Equal(0))
+
+		Expect(s.CheckDeviceHealth(context.Background())).To(Succeed())
+		Expect(republished).To(Equal(1))
+		taint := s.allocatable["0000-01-00-1"].Taints[1]
+		Expect(taint.Key).To(Equal(consts.TaintPCIError))
+		Expect(taint.Value).To(Equal("nonFatal"))
+		Expect(taint.Effect).To(Equal(resourceapi.DeviceTaintEffectNoSchedule))
+
+		Expect(s.CheckDeviceHealth(context.Background())).To(Succeed())
+		Expect(republished).To(Equal(2))
+		Expect(taintKeys("0000-01-00-1")).To(Equal([]string{consts.TaintHostDevice}))
+	})
+
+	It("keeps the fatal AER error taint until the device is reset", func() {
+		mockHost.EXPECT().GetLinkInfo("eth0").Return(upLink, nil).AnyTimes()
+		gomock.InOrder(
+			mockHost.EXPECT().GetAERCounters("0000:01:00.1").Return(&host.AERCounters{Fatal: 0, NonFatal: 2}, nil),
+			mockHost.EXPECT().GetAERCounters("0000:01:00.1").Return(&host.AERCounters{Fatal: 1, NonFatal: 2}, nil).Times(2),
+			// the counters start over once the device is removed and added again
+			mockHost.EXPECT().GetAERCounters("0000:01:00.1").Return(&host.AERCounters{}, nil),
+		)
+
+		Expect(s.CheckDeviceHealth(context.Background())).To(Succeed())
+		Expect(s.CheckDeviceHealth(context.Background())).To(Succeed())
+		taint := s.allocatable["0000-01-00-1"].Taints[1]
+		Expect(taint.Key).To(Equal(consts.TaintPCIError))
+		Expect(taint.Value).To(Equal("fatal"))
+		Expect(taint.Effect).To(Equal(resourceapi.DeviceTaintEffectNoExecute))
+
+		// no new error is reported
+		Expect(s.CheckDeviceHealth(context.Background())).To(Succeed())
+		Expect(taintKeys("0000-01-00-1")).To(Equal([]string{consts.TaintHostDevice, consts.TaintPCIError}))
+		Expect(republished).To(Equal(1))
+
+		Expect(s.CheckDeviceHealth(context.Background())).To(Succeed())
+		Expect(taintKeys("0000-01-00-1")).To(Equal([]string{consts.TaintHostDevice}))
+		Expect(republished).To(Equal(2))
+	})
+
+	It("clears the fatal AER error taint once the device is reset by the sanitization", func() {
+		mockHost.EXPECT().GetLinkInfo("eth0").Return(upLink, nil).AnyTimes()
+		gomock.InOrder(
+			mockHost.EXPECT().GetAERCounters("0000:01:00.1").Return(&host.AERCounters{}, nil),
+			mockHost.EXPECT().GetAERCounters("0000:01:00.1").Return(&host.AERCounters{Fatal: 1}, nil).Times(2),
+		)
+		Expect(s.CheckDeviceHealth(context.Background())).To(Succeed())
+		Expect(s.CheckDeviceHealth(context.Background())).To(Succeed())
+		Expect(taintKeys("0000-01-00-1")).To(Equal([]string{consts.TaintHostDevice, consts.TaintPCIError}))
+
+		s.sanitizeSteps = []string{SanitizeStepFLR}
+		mockHost.EXPECT().ResetDevice("0000:01:00.1").Return(nil)
+		Expect(s.sanitizeDevice(klog.Background(), &drasriovtypes.PreparedDevice{PciAddress: "0000:01:00.1"})).To(Succeed())
+
+		Expect(s.CheckDeviceHealth(context.Background())).To(Succeed())
+		Expect(taintKeys("0000-01-00-1")).To(Equal([]string{consts.TaintHostDevice}))
+	})
+
+	It("notifies the health subscribers when the health of a device changes", func() {
+		mockHost.EXPECT().GetAERCounters("0000:01:00.1").Return(nil, fmt.Errorf("no AER")).AnyTimes()
+		updates, unsubscribe := s.SubscribeHealthUpdates()
+
+		mockHost.EXPECT().GetLinkInfo("eth0").Return(upLink, nil)
+		Expect(s.CheckDeviceHealth(context.Background())).To(Succeed())
+		Expect(updates).NotTo(Receive())
+		Expect(IsDeviceHealthy(s.allocatable["0000-01-00-1"])).To(BeTrue())
+
+		mockHost.EXPECT().GetLinkInfo("eth0").Return(downLink, nil)
+		Expect(s.CheckDeviceHealth(context.Background())).To(Succeed())
+		Expect(updates).To(Receive())
+		Expect(IsDeviceHealthy(s.allocatable["0000-01-00-1"])).To(BeFalse())
+
+		unsubscribe()
+		Expect(s.healthSubscribers).To(BeEmpty())
+	})
+
+	It("taints a device that failed to bind until it is bound to a driver again", func() {
+		mockHost.EXPECT().GetLinkInfo("eth0").Return(upLink, nil).AnyTimes()
+		mockHost.EXPECT().GetAERCounters("0000:01:00.1").Return(nil, fmt.Errorf("no AER")).AnyTimes()
+
+		s.recordBindFailure("0000-01-00-1", fmt.Errorf("failed to bind vfio-pci"))
+		mockHost.EXPECT().GetDriverByBusAndDevice("0000:01:00.1").Return("", nil)
+		Expect(s.CheckDeviceHealth(context.Background())).To(Succeed())
+		Expect(taintKeys("0000-01-00-1")).To(Equal([]string{consts.TaintHostDevice, consts.TaintBindFailed}))
+
+		mockHost.EXPECT().GetDriverByBusAndDevice("0000:01:00.1").Return("iavf", nil)
+		Expect(s.CheckDeviceHealth(context.Background())).To(Succeed())
+		Expect(taintKeys("0000-01-00-1")).To(Equal([]string{consts.TaintHostDevice}))
+		Expect(s.bindFailures).To(BeEmpty())
+		Expect(republished).To(Equal(2))
+	})
+
+	It("does not hold the mutex while reading the host", func() {
+		// the host reads block if the check holds the mutex
+		mockHost.EXPECT().GetLinkInfo("eth0").DoAndReturn(func(string) (*host.LinkInfo, error) {
+			s.GetAllocatableDevices()
+			return downLink, nil
+		})
+		mockHost.EXPECT().GetAERCounters("0000:01:00.1").DoAndReturn(func(string) (*host.AERCounters, error) {
+			s.GetAllocatableDevices()
+			return &host.AERCounters{}, nil
+		})
+		done := make(chan error)
+		go func() {
+			done <- s.CheckDeviceHealth(context.Background())
+		}()
+		Eventually(done).Should(Receive(BeNil()))
+		Expect(taintKeys("0000-01-00-1")).To(Equal([]string{consts.TaintHostDevice, consts.TaintLinkDown}))
+	})
+})
@@ -0,0 +1,304 @@
+package devicestate
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	resourceapi "k8s.io/api/resource/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host"
+	drasriovtypes "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
+)
+
+// Policies for the devices used by the host system
+const (
+	// HostDevicePolicySkip does not publish the devices used by the host
+	HostDevicePolicySkip = "skip"
+	// HostDevicePolicyTaint publishes the devices used by the host with a NoSchedule taint
+	HostDevicePolicyTaint = "taint"
+)
+
+const hostUsageDenylist = "denylist"
+
+// ValidateHostDevicePolicy returns an error if the policy is not supported
+func ValidateHostDevicePolicy(policy string) error {
+	switch policy {
+	case HostDevicePolicySkip, HostDevicePolicyTaint:
+		return nil
+	default:
+		return fmt.Errorf("invalid host device policy %q, must be one of %q or %q", policy, HostDevicePolicySkip, HostDevicePolicyTaint)
+	}
+}
+
+// hostDeviceDenylist returns the PCI addresses and interface names reserved for the host
+// by the flag and the annotation of the node.
+func hostDeviceDenylist(config *drasriovtypes.Config) sets.Set[string] {
+	logger := klog.LoggerWithName(klog.Background(), "hostDeviceDenylist")
+	denylist := sets.New[string]()
+	for _, entry := range config.Flags.HostDeviceDenylist {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			denylist.Insert(entry)
+		}
+	}
+
+	if config.K8sClient.Interface == nil {
+		return denylist
+	}
+	node, err := config.K8sClient.CoreV1().Nodes().Get(context.Background(), config.Flags.NodeName, metav1.GetOptions{})
+	if err != nil {
+		logger.Error(err, "Failed to get node, ignoring the host devices annotation", "node", config.Flags.NodeName)
+		return denylist
+	}
+	for _, entry := range strings.Split(node.Annotations[consts.AnnotationHostDevices], ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			denylist.Insert(entry)
+		}
+	}
+	return denylist
+}
+
+// excludeHostDevices removes or taints, depending on the policy, the devices used by the
+// host system, the removed ones are returned. The VFs used by the host are never handed out
+// to the shares of PF devices. The devices prepared by the claims of the checkpoint, whose PCI
+// addresses are in prepared, are not checked: their netdev may be used by a host network pod.
+func excludeHostDevices(h host.Interface, devices drasriovtypes.AllocatableDevices, sharedVFs SharedVFs, policy string, denylist, prepared sets.Set[string]) drasriovtypes.AllocatableDevices {
+	logger := klog.LoggerWithName(klog.Background(), "excludeHostDevices")
+	hostDevices := drasriovtypes.AllocatableDevices{}
+
+	for deviceName, device := range devices {
+		if vfs, shared := sharedVFs[deviceName]; shared {
+			freeVFs := []host.VFInfo{}
+			for _, vf := range vfs {
+				if prepared.Has(vf.PciAddress) {
+					freeVFs = append(freeVFs, vf)
+					continue
+				}
+				if reason := hostUsage(logger, h, vf.PciAddress, denylist); reason != "" {
+					logger.Info("Not using VF used by the host for PF shares", "pf", deviceName, "vfAddress", vf.PciAddress, "reason", reason)
+					continue
+				}
+				freeVFs = append(freeVFs, vf)
+			}
+			if len(freeVFs) == len(vfs) {
+				continue
+			}
+			if len(freeVFs) == 0 {
+				logger.Info("Skipping PF device without VFs free from host usage", "deviceName", deviceName)
+				delete(devices, deviceName)
+				delete(sharedVFs, deviceName)
+				continue
+			}
+			sharedVFs[deviceName] = freeVFs
+			vfsCapacity := device.Capacity[consts.CapacityVFs]
+			vfsCapacity.Value = *resource.NewQuantity(int64(len(freeVFs)), resource.DecimalSI)
+			device.Capacity[consts.CapacityVFs] = vfsCapacity
+			continue
+		}
+
+		pciAddress := stringAttribute(device, consts.AttributePciAddress)
+		if prepared.Has(pciAddress) {
+			logger.V(2).Info("Not checking the host usage of a prepared device", "deviceName", deviceName)
+			continue
+		}
+		reason := hostUsage(logger, h, pciAddress, denylist)
+		if reason == "" {
+			continue
+		}
+		if policy == HostDevicePolicyTaint {
+			logger.Info("Tainting device used by the host", "deviceName", deviceName, "reason", reason)
+			device.Taints = append(device.Taints, hostDeviceTaint(reason))
+			devices[deviceName] = device
+			continue
+		}
+		logger.Info("Skipping device used by the host", "deviceName", deviceName, "reason", reason)
+		hostDevices[deviceName] = device
+		delete(devices, deviceName)
+	}
+	return hostDevices
+}
+
+// RefreshHostDevices checks again the host usage of the devices that are not in use, the host
+// may have started or stopped using them since the start of the plugin. Depending on the
+// policy the devices the host started using are tainted or withdrawn, and the ones it stopped
+// using untainted or published again. The VFs of PF shares used by the host are not handed out.
+// The resources are republished if any device changed.
+func (s *Manager) RefreshHostDevices(ctx context.Context) error {
+	if s.hostDevicePolicy == "" {
+		return nil
+	}
+	logger := klog.FromContext(ctx).WithName("RefreshHostDevices")
+
+	// the host is read without holding the mutex, the devices prepared meanwhile are skipped
+	// when the changes are applied under it
+	s.mutex.Lock()
+	targets := map[string]string{}
+	for deviceName, device := range s.allocatable {
+		if _, isSF := s.sfDevices[deviceName]; isSF {
+			continue
+		}
+		if _, shared := s.sharedVFs[deviceName]; shared || s.deviceInUse(deviceName) {
+			continue
+		}
+		targets[deviceName] = stringAttribute(device, consts.AttributePciAddress)
+	}
+	for deviceName, device := range s.hostDevices {
+		targets[deviceName] = stringAttribute(device, consts.AttributePciAddress)
+	}
+	var sharedVFTargets []string
+	for _, vfs := range s.sharedVFs {
+		for _, vf := range vfs {
+			if _, inUse := s.sharedVFsInUse[vf.PciAddress]; !inUse {
+				sharedVFTargets = append(sharedVFTargets, vf.PciAddress)
+			}
+		}
+	}
+	s.mutex.Unlock()
+
+	reasons := make(map[string]string, len(targets))
+	for deviceName, pciAddress := range targets {
+		reasons[deviceName] = hostUsage(logger, s.host, pciAddress, s.hostDeviceDenylist)
+	}
+	hostUsedVFs := sets.New[string]()
+	for _, pciAddress := range sharedVFTargets {
+		if reason := hostUsage(logger, s.host, pciAddress, s.hostDeviceDenylist); reason != "" {
+			hostUsedVFs.Insert(pciAddress)
+		}
+	}
+
+	s.mutex.Lock()
+	changesMade := false
+	for deviceName, reason := range reasons {
+		if s.deviceInUse(deviceName) {
+			continue
+		}
+		if s.updateHostDevice(logger, deviceName, reason) {
+			changesMade = true
+		}
+	}
+	for deviceName, vfs := range s.sharedVFs {
+		current, exists := s.allocatable[deviceName]
+		if !exists {
+			continue
+		}
+		freeVFs := 0
+		for _, vf := range vfs {
+			if !hostUsedVFs.Has(vf.PciAddress) {
+				freeVFs++
+			}
+		}
+		vfsCapacity, ok := current.Capacity[consts.CapacityVFs]
+		if !ok || vfsCapacity.Value.Value() == int64(freeVFs) {
+			continue
+		}
+		logger.Info("VFs of PF shares used by the host changed", "deviceName", deviceName, "freeVFs", freeVFs)
+		device := current.DeepCopy()
+		vfsCapacity.Value = *resource.NewQuantity(int64(freeVFs), resource.DecimalSI)
+		device.Capacity[consts.CapacityVFs] = vfsCapacity
+		s.allocatable[deviceName] = *device
+		changesMade = true
+	}
+	s.hostUsedVFs = hostUsedVFs
+	s.mutex.Unlock()
+
+	if !changesMade {
+		return nil
+	}
+	if republishCallback := s.getRepublishCallback(); republishCallback != nil {
+		if err := republishCallback(ctx); err != nil {
+			return fmt.Errorf("failed to republish resources: %w", err)
+		}
+	}
+	return nil
+}
+
+// updateHostDevice taints or withdraws a device the host uses, for an empty reason it
+// untaints or publishes it again. It returns true if the device changed, s.mutex must be held.
+func (s *Manager) updateHostDevice(logger klog.Logger, deviceName, reason string) bool {
+	if s.hostDevicePolicy == HostDevicePolicySkip {
+		if device, withdrawn := s.hostDevices[deviceName]; withdrawn {
+			if reason != "" {
+				return false
+			}
+			logger.Info("Publishing device no longer used by the host", "deviceName", deviceName)
+			s.allocatable[deviceName] = device
+			delete(s.hostDevices, deviceName)
+			return true
+		}
+		device, exists := s.allocatable[deviceName]
+		if !exists || reason == "" {
+			return false
+		}
+		logger.Info("Withdrawing device used by the host", "deviceName", deviceName, "reason", reason)
+		if s.hostDevices == nil {
+			s.hostDevices = drasriovtypes.AllocatableDevices{}
+		}
+		s.hostDevices[deviceName] = device
+		delete(s.allocatable, deviceName)
+		return true
+	}
+
+	current, exists := s.allocatable[deviceName]
+	if !exists {
+		return false
+	}
+	device := current.DeepCopy()
+	device.Taints = slices.DeleteFunc(device.Taints, func(taint resourceapi.DeviceTaint) bool {
+		return taint.Key == consts.TaintHostDevice
+	})
+	if reason != "" {
+		device.Taints = append(device.Taints, hostDeviceTaint(reason))
+	}
+	if apiequality.Semantic.DeepEqual(device.Taints, current.Taints) {
+		return false
+	}
+	logger.Info("Host usage of device changed", "deviceName", deviceName, "reason", reason)
+	s.allocatable[deviceName] = *device
+	return true
+}
+
+// hostUsage returns why the device is used by the host, or an empty string if it is not
+func hostUsage(logger klog.Logger, h host.Interface, pciAddress string, denylist sets.Set[string]) string {
+	if pciAddress == "" {
+		return ""
+	}
+	if denylist.Has(pciAddress) {
+		return hostUsageDenylist
+	}
+	ifName := h.TryGetInterfaceName(pciAddress)
+	if ifName == "" {
+		// devices bound to a userspace driver have no netdev used by the host
+		return ""
+	}
+	if denylist.Has(ifName) {
+		return hostUsageDenylist
+	}
+	reason, err := h.GetHostUsage(ifName)
+	if err != nil {
+		logger.Error(err, "Failed to check host usage of device", "address", pciAddress, "interface", ifName)
+		return ""
+	}
+	if reason != "" {
+		return fmt.Sprintf("interface %s has %s", ifName, reason)
+	}
+	return ""
+}
+
+func hostDeviceTaint(reason string) resourceapi.DeviceTaint {
+	value := "inUse"
+	if reason == hostUsageDenylist {
+		value = hostUsageDenylist
+	}
+	return resourceapi.DeviceTaint{
+		Key:    consts.TaintHostDevice,
+		Value:  value,
+		Effect: resourceapi.DeviceTaintEffectNoSchedule,
+	}
+}
@@ -0,0 +1,217 @@
+package devicestate
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/utils/ptr"
+
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host"
+	mock_host "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host/mock"
+	drasriovtypes "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
+)
+
+var _ = Describe("Host devices", func() {
+	var (
+		mockCtrl *gomock.Controller
+		mockHost *mock_host.MockInterface
+		devices  drasriovtypes.AllocatableDevices
+	)
+
+	newDevice := func(name, pciAddress string) resourceapi.Device {
+		return resourceapi.Device{
+			Name: name,
+			Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				consts.AttributePciAddress: {StringValue: ptr.To(pciAddress)},
+			},
+		}
+	}
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+		mockHost = mock_host.NewMockInterface(mockCtrl)
+
+		devices = drasriovtypes.AllocatableDevices{
+			"0000-01-00-1": newDevice("0000-01-00-1", "0000:01:00.1"),
+			"0000-01-00-2": newDevice("0000-01-00-2", "0000:01:00.2"),
+			"0000-01-00-3": newDevice("0000-01-00-3", "0000:01:00.3"),
+			"0000-01-00-4": newDevice("0000-01-00-4", "0000:01:00.4"),
+		}
+		mockHost.EXPECT().TryGetInterfaceName("0000:01:00.1").Return("eth0v0").AnyTimes()
+		mockHost.EXPECT().TryGetInterfaceName("0000:01:00.2").Return("eth0v1").AnyTimes()
+		mockHost.EXPECT().TryGetInterfaceName("0000:01:00.4").Return("").AnyTimes()
+		mockHost.EXPECT().GetHostUsage("eth0v0").Return("default route", nil).AnyTimes()
+		mockHost.EXPECT().GetHostUsage("eth0v1").Return("", nil).AnyTimes()
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+	})
+
+	It("validates the policy", func() {
+		Expect(ValidateHostDevicePolicy(HostDevicePolicySkip)).To(Succeed())
+		Expect(ValidateHostDevicePolicy(HostDevicePolicyTaint)).To(Succeed())
+		Expect(ValidateHostDevicePolicy("drop")).To(HaveOccurred())
+	})
+
+	It("skips the devices used by the host or in the denylist", func() {
+		excludeHostDevices(mockHost, devices, SharedVFs{}, HostDevicePolicySkip, sets.New("0000:01:00.3"), sets.New[string]())
+		Expect(devices).To(HaveLen(2))
+		Expect(devices).To(HaveKey("0000-01-00-2"))
+		Expect(devices).To(HaveKey("0000-01-00-4"))
+	})
+
+	It("matches the denylist by interface name", func() {
+		mockHost.EXPECT().TryGetInterfaceName("0000:01:00.3").Return("eth0v2")
+		mockHost.EXPECT().GetHostUsage("eth0v2").Return("", fmt.Errorf("link not found"))
+		excludeHostDevices(mockHost, devices, SharedVFs{}, HostDevicePolicySkip, sets.New("eth0v1"), sets.New[string]())
+		Expect(devices).To(HaveLen(2))
+		Expect(devices).To(HaveKey("0000-01-00-3"))
+		Expect(devices).To(HaveKey("0000-01-00-4"))
+	})
+
+	It("taints the devices used by the host", func() {
+		excludeHostDevices(mockHost, devices, SharedVFs{}, HostDevicePolicyTaint, sets.New("0000:01:00.3"), sets.New[string]())
+		Expect(devices).To(HaveLen(4))
+		Expect(devices["0000-01-00-1"].Taints).To(ConsistOf(resourceapi.DeviceTaint{
+			Key: consts.TaintHostDevice, Value: "inUse", Effect: resourceapi.DeviceTaintEffectNoSchedule,
+		}))
+		Expect(devices["0000-01-00-3"].Taints).To(ConsistOf(resourceapi.DeviceTaint{
+			Key: consts.TaintHostDevice, Value: "denylist", Effect: resourceapi.DeviceTaintEffectNoSchedule,
+		}))
+		Expect(devices["0000-01-00-2"].Taints).To(BeEmpty())
+		Expect(devices["0000-01-00-4"].Taints).To(BeEmpty())
+	})
+
+	It("does not check the devices prepared before a restart", func() {
+		// the VF of a host network pod has the IP of the pod
+		mockHost.EXPECT().TryGetInterfaceName("0000:01:00.3").Return("")
+		excludeHostDevices(mockHost, devices, SharedVFs{}, HostDevicePolicySkip, sets.New[string](), sets.New("0000:01:00.1"))
+		Expect(devices).To(HaveLen(4))
+		Expect(devices["0000-01-00-1"].Taints).To(BeEmpty())
+
+		pf := newDevice("0000-01-00-0", "0000:01:00.0")
+		pf.Capacity = map[resourceapi.QualifiedName]resourceapi.DeviceCapacity{
+			consts.CapacityVFs: {Value: resource.MustParse("2")},
+		}
+		devices = drasriovtypes.AllocatableDevices{pf.Name: pf}
+		sharedVFs := SharedVFs{pf.Name: {
+			{PciAddress: "0000:01:00.1", VFID: 0},
+			{PciAddress: "0000:01:00.2", VFID: 1},
+		}}
+		excludeHostDevices(mockHost, devices, sharedVFs, HostDevicePolicySkip, sets.New[string](), sets.New("0000:01:00.1"))
+		Expect(sharedVFs[pf.Name]).To(HaveLen(2))
+	})
+
+	It("does not hand out VFs used by the host to PF shares", func() {
+		pf := newDevice("0000-01-00-0", "0000:01:00.0")
+		pf.Capacity = map[resourceapi.QualifiedName]resourceapi.DeviceCapacity{
+			consts.CapacityVFs: {Value: resource.MustParse("2")},
+		}
+		devices = drasriovtypes.AllocatableDevices{pf.Name: pf}
+		sharedVFs := SharedVFs{pf.Name: {
+			{PciAddress: "0000:01:00.1", VFID: 0},
+			{PciAddress: "0000:01:00.2", VFID: 1},
+		}}
+
+		excludeHostDevices(mockHost, devices, sharedVFs, HostDevicePolicyTaint, sets.New[string](), sets.New[string]())
+		Expect(sharedVFs[pf.Name]).To(Equal([]host.VFInfo{{PciAddress: "0000:01:00.2", VFID: 1}}))
+		vfs := devices[pf.Name].Capacity[consts.CapacityVFs].Value
+		Expect(vfs.Value()).To(Equal(int64(1)))
+		Expect(devices[pf.Name].Taints).To(BeEmpty())
+	})
+
+	Context("RefreshHostDevices", func() {
+		var (
+			s           *Manager
+			republished int
+		)
+
+		BeforeEach(func() {
+			republished = 0
+			s = &Manager{
+				host:               mockHost,
+				allocatable:        devices,
+				hostDeviceDenylist: sets.New[string](),
+				devicesInUse:       map[string]k8stypes.UID{},
+				republishCallback: func(context.Context) error {
+					republished++
+					return nil
+				},
+			}
+			delete(devices, "0000-01-00-3")
+		})
+
+		It("taints and untaints the devices the host started or stopped using", func(ctx SpecContext) {
+			s.hostDevicePolicy = HostDevicePolicyTaint
+			device := devices["0000-01-00-2"]
+			device.Taints = []resourceapi.DeviceTaint{hostDeviceTaint("interface eth0v1 has default route")}
+			devices["0000-01-00-2"] = device
+
+			Expect(s.RefreshHostDevices(ctx)).To(Succeed())
+			Expect(s.allocatable["0000-01-00-1"].Taints).To(ConsistOf(resourceapi.DeviceTaint{
+				Key: consts.TaintHostDevice, Value: "inUse", Effect: resourceapi.DeviceTaintEffectNoSchedule,
+			}))
+			Expect(s.allocatable["0000-01-00-2"].Taints).To(BeEmpty())
+			Expect(republished).To(Equal(1))
+
+			Expect(s.RefreshHostDevices(ctx)).To(Succeed())
+			Expect(republished).To(Equal(1))
+		})
+
+		It("withdraws and publishes again the devices with the skip policy", func(ctx SpecContext) {
+			s.hostDevicePolicy = HostDevicePolicySkip
+			s.hostDevices = drasriovtypes.AllocatableDevices{"0000-01-00-2": devices["0000-01-00-2"]}
+			delete(devices, "0000-01-00-2")
+
+			Expect(s.RefreshHostDevices(ctx)).To(Succeed())
+			Expect(s.allocatable).To(HaveKey("0000-01-00-2"))
+			Expect(s.allocatable).To(HaveKey("0000-01-00-4"))
+			Expect(s.allocatable).NotTo(HaveKey("0000-01-00-1"))
+			Expect(s.hostDevices).To(HaveKey("0000-01-00-1"))
+			Expect(republished).To(Equal(1))
+		})
+
+		It("does not check the devices in use", func(ctx SpecContext) {
+			s.hostDevicePolicy = HostDevicePolicySkip
+			s.devicesInUse["0000-01-00-1"] = "claim1"
+
+			Expect(s.RefreshHostDevices(ctx)).To(Succeed())
+			Expect(s.allocatable).To(HaveKey("0000-01-00-1"))
+			Expect(republished).To(BeZero())
+		})
+
+		It("does not hand out the VFs of PF shares the host started using", func(ctx SpecContext) {
+			s.hostDevicePolicy = HostDevicePolicyTaint
+			pf := newDevice("0000-01-00-0", "0000:01:00.0")
+			pf.Capacity = map[resourceapi.QualifiedName]resourceapi.DeviceCapacity{
+				consts.CapacityVFs: {Value: resource.MustParse("2")},
+			}
+			s.allocatable = drasriovtypes.AllocatableDevices{pf.Name: pf}
+			s.sharedVFs = SharedVFs{pf.Name: {
+				{PciAddress: "0000:01:00.1", VFID: 0},
+				{PciAddress: "0000:01:00.2", VFID: 1},
+			}}
+			s.sharedVFsInUse = map[string]k8stypes.UID{}
+
+			Expect(s.RefreshHostDevices(ctx)).To(Succeed())
+			vfs := s.allocatable[pf.Name].Capacity[consts.CapacityVFs].Value
+			Expect(vfs.Value()).To(Equal(int64(1)))
+			Expect(s.allocatable[pf.Name].Taints).To(BeEmpty())
+
+			vf, err := s.assignSharedVF("claim1", s.sharedVFs[pf.Name])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(vf.PciAddress).To(Equal("0000:01:00.2"))
+			_, err = s.assignSharedVF("claim2", s.sharedVFs[pf.Name])
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,78 @@
+package devicestate
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	resourceapi "k8s.io/api/resource/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	configapi "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/virtualfunction/v1alpha1"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/flags"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host/fakehost"
+)
+
+var _ = Describe("Manager", func() {
+	Context("validateHostNetworkPod", func() {
+		newClaim := func() *resourceapi.ResourceClaim {
+			return &resourceapi.ResourceClaim{
+				ObjectMeta: metav1.ObjectMeta{Name: "claim", Namespace: "default"},
+				Status: resourceapi.ResourceClaimStatus{
+					ReservedFor: []resourceapi.ResourceClaimConsumerReference{{Name: "pod", UID: "pod-uid"}},
+					Allocation: &resourceapi.AllocationResult{
+						Devices: resourceapi.DeviceAllocationResult{
+							Results: []resourceapi.DeviceRequestAllocationResult{
+								{Request: "req", Driver: consts.DriverName, Pool: "node", Device: "dev1"},
+							},
+						},
+					},
+				},
+			}
+		}
+
+		newManager := func(hostNetwork bool) *Manager {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "default"},
+				Spec:       corev1.PodSpec{HostNetwork: hostNetwork},
+			}
+			return &Manager{
+				host: fakehost.New(),
+				k8sClient: flags.ClientSets{
+					Client: fake.NewClientBuilder().WithScheme(flags.Scheme).WithObjects(pod).Build(),
+				},
+				rejectKernelVfHostNetwork: true,
+			}
+		}
+
+		It("accepts kernel driver VFs for pods with their own network namespace", func() {
+			s := newManager(false)
+			err := s.validateHostNetworkPod(context.Background(), newClaim(), map[string]*configapi.VfConfig{"req": {Driver: ""}})
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("accepts DPDK driver VFs for host network pods", func() {
+			s := newManager(true)
+			err := s.validateHostNetworkPod(context.Background(), newClaim(), map[string]*configapi.VfConfig{"req": {Driver: "vfio-pci"}})
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("rejects kernel driver VFs for host network pods", func() {
+			s := newManager(true)
+			err := s.validateHostNetworkPod(context.Background(), newClaim(), map[string]*configapi.VfConfig{"req": {Driver: "default"}})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("can't be used by host network pod"))
+		})
+
+		It("returns an error when the pod can't be found", func() {
+			s := newManager(true)
+			claim := newClaim()
+			claim.Status.ReservedFor[0].Name = "missing"
+			err := s.validateHostNetworkPod(context.Background(), claim, map[string]*configapi.VfConfig{"req": {Driver: "vfio-pci"}})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
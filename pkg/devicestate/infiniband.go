@@ -0,0 +1,205 @@
+package devicestate
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	resourceapi "k8s.io/api/resource/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	configapi "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/virtualfunction/v1alpha1"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/audit"
+	drasriovtypes "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
+)
+
+// zeroGUID is set on the InfiniBand VFs when their GUID is released
+const zeroGUID = "00:00:00:00:00:00:00:00"
+
+// GUIDPool hands out the InfiniBand GUIDs of a range to the VFs of the prepared claims, it is
+// safe for concurrent use
+type GUIDPool struct {
+	start uint64
+	end   uint64
+	mutex sync.Mutex
+	inUse map[uint64]k8stypes.UID // GUID to claim UID
+}
+
+// NewGUIDPool returns a pool for a GUID range in the "<first GUID>-<last GUID>" format,
+// or nil when the range is empty.
+func NewGUIDPool(guidRange string) (*GUIDPool, error) {
+	if guidRange == "" {
+		return nil, nil
+	}
+	first, last, found := strings.Cut(guidRange, "-")
+	if !found {
+		return nil, fmt.Errorf("invalid GUID pool %q, must be <first GUID>-<last GUID>", guidRange)
+	}
+	start, err := parseGUID(first)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseGUID(last)
+	if err != nil {
+		return nil, err
+	}
+	if start == 0 || start > end {
+		return nil, fmt.Errorf("invalid GUID pool %q, the first GUID must be non zero and lower than the last one", guidRange)
+	}
+	return &GUIDPool{start: start, end: end, inUse: map[uint64]k8stypes.UID{}}, nil
+}
+
+// ValidateGUIDPool returns an error if the GUID range is not valid
+func ValidateGUIDPool(guidRange string) error {
+	_, err := NewGUIDPool(guidRange)
+	return err
+}
+
+// Allocate returns a free GUID of the pool for a claim
+func (p *GUIDPool) Allocate(claimUID k8stypes.UID) (string, error) {
+	if p == nil {
+		return "", fmt.Errorf("no GUID set and no GUID pool configured")
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for guid := p.start; guid <= p.end && guid != 0; guid++ {
+		if _, inUse := p.inUse[guid]; !inUse {
+			p.inUse[guid] = claimUID
+			return formatGUID(guid), nil
+		}
+	}
+	return "", fmt.Errorf("no free GUID left in the GUID pool")
+}
+
+// Reserve marks a GUID of the pool as used by a claim. GUIDs outside of the pool are not
+// tracked.
+func (p *GUIDPool) Reserve(guid string, claimUID k8stypes.UID) error {
+	value, err := parseGUID(guid)
+	if err != nil {
+		return err
+	}
+	if p == nil || value < p.start || value > p.end {
+		return nil
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if owner, inUse := p.inUse[value]; inUse && owner != claimUID {
+		return fmt.Errorf("GUID %s is already used by claim %s", guid, owner)
+	}
+	p.inUse[value] = claimUID
+	return nil
+}
+
+// ReleaseGUID frees a GUID of the pool if it is used by the claim, the other GUIDs of the
+// claim stay in use
+func (p *GUIDPool) ReleaseGUID(guid string, claimUID k8stypes.UID) {
+	if p == nil {
+		return
+	}
+	value, err := parseGUID(guid)
+	if err != nil {
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.inUse[value] == claimUID {
+		delete(p.inUse, value)
+	}
+}
+
+// Release frees the GUIDs of a claim
+func (p *GUIDPool) Release(claimUID k8stypes.UID) {
+	if p == nil {
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for guid, uid := range p.inUse {
+		if uid == claimUID {
+			delete(p.inUse, guid)
+		}
+	}
+}
+
+// Replace marks only the GUIDs of the map as used, by the claim UID. GUIDs outside of the pool
+// are not tracked, the invalid ones are skipped and returned in the error.
+func (p *GUIDPool) Replace(guids map[string]k8stypes.UID) error {
+	if p == nil {
+		return nil
+	}
+	inUse := map[uint64]k8stypes.UID{}
+	var errs []error
+	for guid, claimUID := range guids {
+		value, err := parseGUID(guid)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if value >= p.start && value <= p.end {
+			inUse[value] = claimUID
+		}
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.inUse = inUse
+	return errors.Join(errs...)
+}
+
+// prepareInfiniBand sets the GUID, from the config or allocated from the pool, on an
+// InfiniBand VF and validates its partition key
+func (s *Manager) prepareInfiniBand(claim *resourceapi.ResourceClaim, pciAddress, pfName string, vfID int, config *configapi.VfConfig) (string, error) {
+	if config.PKey != "" {
+		if _, err := strconv.ParseUint(config.PKey, 0, 16); err != nil {
+			return "", fmt.Errorf("invalid pkey %q, must be a 16 bits number", config.PKey)
+		}
+	}
+
+	guid := config.GUID
+	if guid == "" {
+		var err error
+		if guid, err = s.guidPool.Allocate(claim.UID); err != nil {
+			return "", err
+		}
+	} else if err := s.guidPool.Reserve(guid, claim.UID); err != nil {
+		return "", err
+	}
+
+	if err := s.host.SetVFGUID(pciAddress, pfName, vfID, guid, claimAuditFields(claim)); err != nil {
+		return "", err
+	}
+	return guid, nil
+}
+
+// releaseInfiniBand resets the GUID of an InfiniBand VF
+func (s *Manager) releaseInfiniBand(logger klog.Logger, preparedDevice *drasriovtypes.PreparedDevice) {
+	if preparedDevice.GUID == "" {
+		return
+	}
+	s.resetGUID(logger, preparedDevice.PciAddress, preparedDevice.PFName, preparedDevice.VFID, preparedDevice.GUID, preparedDevice.AuditFields())
+}
+
+// resetGUID resets the GUID set on an InfiniBand VF
+func (s *Manager) resetGUID(logger klog.Logger, pciAddress, pfName string, vfID int, guid string, fields audit.Fields) {
+	if err := s.host.SetVFGUID(pciAddress, pfName, vfID, zeroGUID, fields); err != nil {
+		logger.Error(err, "Failed to reset GUID for device", "device", pciAddress, "guid", guid)
+	}
+}
+
+func parseGUID(guid string) (uint64, error) {
+	hwAddr, err := net.ParseMAC(guid)
+	if err != nil || len(hwAddr) != 8 {
+		return 0, fmt.Errorf("invalid GUID %q, must be 8 bytes like 02:00:00:00:00:00:00:01", guid)
+	}
+	return binary.BigEndian.Uint64(hwAddr), nil
+}
+
+func formatGUID(guid uint64) string {
+	hwAddr := make(net.HardwareAddr, 8)
+	binary.BigEndian.PutUint64(hwAddr, guid)
+	return hwAddr.String()
+}
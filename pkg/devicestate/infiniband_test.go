@@ -0,0 +1,290 @@
+package devicestate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	netattdefv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+	resourceapi "k8s.io/api/resource/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	configapi "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/virtualfunction/v1alpha1"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/cdi"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/flags"
+	mock_host "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host/mock"
+	drasriovtypes "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
+)
+
+var _ = Describe("InfiniBand", func() {
+	Context("GUIDPool", func() {
+		It("returns no pool for an empty range", func() {
+			pool, err := NewGUIDPool("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pool).To(BeNil())
+			_, err = pool.Allocate("claim1")
+			Expect(err).To(MatchError(ContainSubstring("no GUID pool configured")))
+		})
+
+		It("rejects invalid ranges", func() {
+			Expect(ValidateGUIDPool("02:00:00:00:00:00:00:01")).To(HaveOccurred())
+			Expect(ValidateGUIDPool("02:00:00:00:00:00:00:02-02:00:00:00:00:00:00:01")).To(HaveOccurred())
+			Expect(ValidateGUIDPool("aa:bb:cc:dd:ee:ff-02:00:00:00:00:00:00:01")).To(HaveOccurred())
+			Expect(ValidateGUIDPool("02:00:00:00:00:00:00:01-02:00:00:00:00:00:00:02")).To(Succeed())
+		})
+
+		It("allocates, reserves and releases GUIDs per claim", func() {
+			pool, err := NewGUIDPool("02:00:00:00:00:00:00:fe-02:00:00:00:00:00:01:00")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(pool.Reserve("02:00:00:00:00:00:00:fe", "claim1")).To(Succeed())
+			Expect(pool.Reserve("02:00:00:00:00:00:00:fe", "claim2")).To(MatchError(ContainSubstring("already used by claim claim1")))
+			// GUIDs outside of the pool are not tracked
+			Expect(pool.Reserve("04:00:00:00:00:00:00:01", "claim2")).To(Succeed())
+
+			Expect(pool.Allocate("claim2")).To(Equal("02:00:00:00:00:00:00:ff"))
+			Expect(pool.Allocate("claim2")).To(Equal("02:00:00:00:00:00:01:00"))
+			_, err = pool.Allocate("claim3")
+			Expect(err).To(MatchError(ContainSubstring("no free GUID left")))
+
+			pool.Release("claim2")
+			Expect(pool.Allocate("claim3")).To(Equal("02:00:00:00:00:00:00:ff"))
+		})
+
+		It("releases a single GUID of a claim", func() {
+			pool, err := NewGUIDPool("02:00:00:00:00:00:00:01-02:00:00:00:00:00:00:02")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pool.Allocate("claim1")).To(Equal("02:00:00:00:00:00:00:01"))
+			Expect(pool.Allocate("claim1")).To(Equal("02:00:00:00:00:00:00:02"))
+
+			// a GUID of another claim is kept
+			pool.ReleaseGUID("02:00:00:00:00:00:00:01", "claim2")
+			pool.ReleaseGUID("02:00:00:00:00:00:00:02", "claim1")
+			Expect(pool.inUse).To(Equal(map[uint64]k8stypes.UID{0x0200000000000001: "claim1"}))
+		})
+
+		It("replaces the GUIDs in use", func() {
+			pool, err := NewGUIDPool("02:00:00:00:00:00:00:01-02:00:00:00:00:00:00:02")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pool.Reserve("02:00:00:00:00:00:00:01", "claim1")).To(Succeed())
+
+			Expect(pool.Replace(map[string]k8stypes.UID{
+				"02:00:00:00:00:00:00:02": "claim2",
+				"04:00:00:00:00:00:00:01": "claim3",
+				"invalid":                 "claim4",
+			})).To(MatchError(ContainSubstring("invalid")))
+			Expect(pool.Allocate("claim5")).To(Equal("02:00:00:00:00:00:00:01"))
+			_, err = pool.Allocate("claim5")
+			Expect(err).To(MatchError(ContainSubstring("no free GUID left")))
+		})
+	})
+
+	Context("prepare and unprepare", func() {
+		var (
+			mockCtrl *gomock.Controller
+			mockHost *mock_host.MockInterface
+			s        *Manager
+			claim    *resourceapi.ResourceClaim
+			result   *resourceapi.DeviceRequestAllocationResult
+		)
+
+		BeforeEach(func() {
+			mockCtrl = gomock.NewController(GinkgoT())
+			mockHost = mock_host.NewMockInterface(mockCtrl)
+
+			cdiHandler, err := cdi.NewHandler(GinkgoT().TempDir())
+			Expect(err).NotTo(HaveOccurred())
+			nad := &netattdefv1.NetworkAttachmentDefinition{
+				ObjectMeta: metav1.ObjectMeta{Name: "ib", Namespace: "default"},
+				Spec:       netattdefv1.NetworkAttachmentDefinitionSpec{Config: `{"type":"ib-sriov"}`},
+			}
+			guidPool, err := NewGUIDPool("02:00:00:00:00:00:00:01-02:00:00:00:00:00:00:02")
+			Expect(err).NotTo(HaveOccurred())
+			s = &Manager{
+				host: mockHost,
+				k8sClient: flags.ClientSets{
+					Client: fake.NewClientBuilder().WithScheme(flags.Scheme).WithObjects(nad).Build(),
+				},
+				cdi:                    cdiHandler,
+				defaultInterfacePrefix: "net",
+				allocatable: drasriovtypes.AllocatableDevices{
+					"0000-01-00-1": {
+						Name: "0000-01-00-1",
+						Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+							consts.AttributePciAddress: {StringValue: ptr.To("0000:01:00.1")},
+							consts.AttributePFName:     {StringValue: ptr.To("ib0")},
+							consts.AttributeVFID:       {IntValue: ptr.To(int64(0))},
+							consts.AttributeLinkLayer:  {StringValue: ptr.To(consts.LinkLayerInfiniBand)},
+						},
+					},
+					"0000-02-00-1": {
+						Name: "0000-02-00-1",
+						Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+							consts.AttributePciAddress: {StringValue: ptr.To("0000:02:00.1")},
+							consts.AttributePFName:     {StringValue: ptr.To("eth0")},
+							consts.AttributeLinkLayer:  {StringValue: ptr.To(consts.LinkLayerEthernet)},
+						},
+					},
+				},
+				guidPool: guidPool,
+			}
+			claim = &resourceapi.ResourceClaim{
+				ObjectMeta: metav1.ObjectMeta{Name: "claim1", Namespace: "default", UID: "claim1"},
+				Status: resourceapi.ResourceClaimStatus{
+					ReservedFor: []resourceapi.ResourceClaimConsumerReference{{Name: "pod", UID: "pod-uid"}},
+				},
+			}
+			result = &resourceapi.DeviceRequestAllocationResult{Request: "req", Driver: consts.DriverName, Pool: "node1", Device: "0000-01-00-1"}
+		})
+
+		AfterEach(func() {
+			mockCtrl.Finish()
+		})
+
+		It("sets a GUID of the pool and the pkey, and releases the GUID on unprepare", func() {
+			config := &configapi.VfConfig{NetAttachDefName: "ib", PKey: "0x8001"}
+			mockHost.EXPECT().SetVFGUID("0000:01:00.1", "ib0", 0, "02:00:00:00:00:00:00:01", claimAuditFields(claim)).Return(nil)
+			mockHost.EXPECT().BindDeviceDriver("0000:01:00.1", config, claimAuditFields(claim)).Return("", nil)
+			mockHost.EXPECT().GetDriverByBusAndDevice("0000:01:00.1").Return("mlx5_core", nil)
+
+			ifNameIndex := 0
+			prepared, err := s.applyConfigOnDevice(context.Background(), &ifNameIndex, claim, config, result)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(prepared.GUID).To(Equal("02:00:00:00:00:00:00:01"))
+			Expect(prepared.PKey).To(Equal("0x8001"))
+			Expect(prepared.NewDeviceStatusData().GUID).To(Equal("02:00:00:00:00:00:00:01"))
+
+			netConf := map[string]interface{}{}
+			Expect(json.Unmarshal([]byte(prepared.NetAttachDefConfig), &netConf)).To(Succeed())
+			Expect(netConf["pkey"]).To(Equal("0x8001"))
+			Expect(netConf["runtimeConfig"]).To(HaveKeyWithValue("infinibandGUID", "02:00:00:00:00:00:00:01"))
+
+			mockHost.EXPECT().SetVFGUID("0000:01:00.1", "ib0", 0, zeroGUID, prepared.AuditFields()).Return(nil)
+			Expect(s.unprepareDevices(drasriovtypes.PreparedDevices{prepared})).To(Succeed())
+			Expect(s.guidPool.inUse).To(BeEmpty())
+		})
+
+		It("keeps the GUIDs of the other devices of the claim reserved until they are unprepared", func() {
+			Expect(s.guidPool.Reserve("02:00:00:00:00:00:00:01", "claim1")).To(Succeed())
+			Expect(s.guidPool.Reserve("02:00:00:00:00:00:00:02", "claim1")).To(Succeed())
+			first := &drasriovtypes.PreparedDevice{PciAddress: "0000:01:00.1", PFName: "ib0", Config: &configapi.VfConfig{}, GUID: "02:00:00:00:00:00:00:01"}
+			first.ClaimNamespacedName.UID = "claim1"
+			second := &drasriovtypes.PreparedDevice{PciAddress: "0000:01:00.2", PFName: "ib0", VFID: 1, Config: &configapi.VfConfig{}, GUID: "02:00:00:00:00:00:00:02"}
+			second.ClaimNamespacedName.UID = "claim1"
+
+			mockHost.EXPECT().SetVFGUID("0000:01:00.1", "ib0", 0, zeroGUID, first.AuditFields()).Return(nil)
+			Expect(s.unprepareDevices(drasriovtypes.PreparedDevices{first})).To(Succeed())
+			Expect(s.guidPool.Allocate("claim2")).To(Equal("02:00:00:00:00:00:00:01"))
+
+			mockHost.EXPECT().SetVFGUID("0000:01:00.2", "ib0", 1, zeroGUID, second.AuditFields()).Return(nil)
+			Expect(s.unprepareDevices(drasriovtypes.PreparedDevices{second})).To(Succeed())
+			Expect(s.guidPool.inUse).To(HaveLen(1))
+		})
+
+		It("uses the GUID of the config", func() {
+			config := &configapi.VfConfig{NetAttachDefName: "ib", GUID: "02:00:00:00:00:00:00:02"}
+			mockHost.EXPECT().SetVFGUID("0000:01:00.1", "ib0", 0, "02:00:00:00:00:00:00:02", claimAuditFields(claim)).Return(nil)
+			mockHost.EXPECT().BindDeviceDriver("0000:01:00.1", config, claimAuditFields(claim)).Return("", nil)
+			mockHost.EXPECT().GetDriverByBusAndDevice("0000:01:00.1").Return("mlx5_core", nil)
+
+			ifNameIndex := 0
+			prepared, err := s.applyConfigOnDevice(context.Background(), &ifNameIndex, claim, config, result)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(prepared.GUID).To(Equal("02:00:00:00:00:00:00:02"))
+			Expect(s.guidPool.inUse).To(HaveKeyWithValue(uint64(0x0200000000000002), k8stypes.UID("claim1")))
+		})
+
+		It("resets the GUID of a device failing to prepare", func() {
+			config := &configapi.VfConfig{NetAttachDefName: "ib", Driver: "mlx5_core"}
+			mockHost.EXPECT().SetVFGUID("0000:01:00.1", "ib0", 0, "02:00:00:00:00:00:00:01", claimAuditFields(claim)).Return(nil)
+			mockHost.EXPECT().BindDeviceDriver("0000:01:00.1", config, claimAuditFields(claim)).Return("", errors.New("bind failed"))
+			mockHost.EXPECT().SetVFGUID("0000:01:00.1", "ib0", 0, zeroGUID, claimAuditFields(claim)).Return(nil)
+
+			ifNameIndex := 0
+			_, err := s.applyConfigOnDevice(context.Background(), &ifNameIndex, claim, config, result)
+			Expect(err).To(MatchError(ContainSubstring("bind failed")))
+		})
+
+		It("resets the GUIDs of the devices prepared before a later device fails", func() {
+			claim.Status.Allocation = &resourceapi.AllocationResult{Devices: resourceapi.DeviceAllocationResult{
+				Results: []resourceapi.DeviceRequestAllocationResult{*result, {Request: "other", Driver: consts.DriverName, Pool: "node1", Device: "0000-02-00-1"}},
+			}}
+			config := &configapi.VfConfig{NetAttachDefName: "ib"}
+			mockHost.EXPECT().SetVFGUID("0000:01:00.1", "ib0", 0, "02:00:00:00:00:00:00:01", claimAuditFields(claim)).Return(nil)
+			mockHost.EXPECT().BindDeviceDriver("0000:01:00.1", config, claimAuditFields(claim)).Return("", nil)
+			mockHost.EXPECT().GetDriverByBusAndDevice("0000:01:00.1").Return("mlx5_core", nil)
+			mockHost.EXPECT().SetVFGUID("0000:01:00.1", "ib0", 0, zeroGUID, gomock.Any()).Return(nil)
+
+			ifNameIndex := 0
+			_, err := s.prepareDevices(context.Background(), &ifNameIndex, claim, map[string]*configapi.VfConfig{"req": config}, nil)
+			Expect(err).To(MatchError(ContainSubstring("config not found for request: other")))
+		})
+
+		It("rejects an invalid pkey", func() {
+			config := &configapi.VfConfig{NetAttachDefName: "ib", PKey: "0x18001"}
+
+			ifNameIndex := 0
+			_, err := s.applyConfigOnDevice(context.Background(), &ifNameIndex, claim, config, result)
+			Expect(err).To(MatchError(ContainSubstring("invalid pkey")))
+		})
+
+		It("rejects a GUID for an Ethernet device", func() {
+			config := &configapi.VfConfig{NetAttachDefName: "ib", GUID: "02:00:00:00:00:00:00:02"}
+			result.Device = "0000-02-00-1"
+
+			ifNameIndex := 0
+			_, err := s.applyConfigOnDevice(context.Background(), &ifNameIndex, claim, config, result)
+			Expect(err).To(MatchError(ContainSubstring("only supported for InfiniBand devices")))
+		})
+
+		It("restores the GUIDs of the prepared devices", func() {
+			prepared := &drasriovtypes.PreparedDevice{PciAddress: "0000:01:00.1", GUID: "02:00:00:00:00:00:00:01"}
+			prepared.ClaimNamespacedName.UID = "claim1"
+			s.RestorePreparedDevices(drasriovtypes.PreparedDevices{prepared})
+
+			Expect(s.guidPool.Allocate("claim2")).To(Equal("02:00:00:00:00:00:00:02"))
+		})
+
+		It("frees the GUIDs of the claims unprepared by the other instance on sync", func() {
+			prepared := &drasriovtypes.PreparedDevice{PciAddress: "0000:01:00.1", GUID: "02:00:00:00:00:00:00:01"}
+			prepared.Device.DeviceName = "0000-01-00-1"
+			prepared.ClaimNamespacedName.UID = "claim1"
+			s.RestorePreparedDevices(drasriovtypes.PreparedDevices{prepared})
+			Expect(s.checkpointDevicesInUse).To(HaveKey("0000-01-00-1"))
+
+			s.SyncPreparedDevices(drasriovtypes.PreparedDevices{})
+			Expect(s.checkpointDevicesInUse).To(BeEmpty())
+			Expect(s.guidPool.Allocate("claim2")).To(Equal("02:00:00:00:00:00:00:01"))
+		})
+
+		It("keeps the GUIDs and devices in use reserved while syncing", func() {
+			prepared := &drasriovtypes.PreparedDevice{PciAddress: "0000:01:00.1", GUID: "02:00:00:00:00:00:00:01"}
+			prepared.Device.DeviceName = "0000-01-00-1"
+			prepared.ClaimNamespacedName.UID = "claim1"
+			s.RestorePreparedDevices(drasriovtypes.PreparedDevices{prepared})
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for range 100 {
+					s.SyncPreparedDevices(drasriovtypes.PreparedDevices{prepared})
+				}
+			}()
+			for range 100 {
+				Expect(s.guidPool.Allocate("claim2")).To(Equal("02:00:00:00:00:00:00:02"))
+				s.guidPool.Release("claim2")
+				s.mutex.Lock()
+				Expect(s.canPreBind("0000-01-00-1")).To(BeFalse())
+				s.mutex.Unlock()
+			}
+			<-done
+		})
+	})
+})
@@ -3,6 +3,7 @@ package devicestate
 import (
 	"context"
 
+	configapi "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/virtualfunction/v1alpha1"
 	drasriovtypes "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
 )
 
@@ -12,6 +13,8 @@ import (
 type DeviceState interface {
 	GetAllocatableDevices() drasriovtypes.AllocatableDevices
 	UpdateDeviceResourceNames(ctx context.Context, deviceResourceMap map[string]string) error
+	UpdateResourceConfigs(resourceConfigs map[string]*configapi.VfConfig)
+	UpdatePreBindDrivers(preBindDrivers map[string]string)
 }
 
 var _ DeviceState = (*Manager)(nil)
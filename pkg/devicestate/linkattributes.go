@@ -0,0 +1,130 @@
+package devicestate
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	resourceapi "k8s.io/api/resource/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/klog/v2"
+
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host"
+)
+
+// RefreshLinkAttributes reads the link properties of the PFs again and republishes the
+// resources if the attributes of any device changed. The link attributes of the devices
+// of a PF whose link can't be read are removed.
+func (s *Manager) RefreshLinkAttributes(ctx context.Context, pfNames ...string) error {
+	logger := klog.FromContext(ctx).WithName("RefreshLinkAttributes")
+
+	s.mutex.Lock()
+	devicesByPF := map[string][]string{}
+	for deviceName, device := range s.allocatable {
+		if pfName := stringAttribute(device, consts.AttributePFName); pfName != "" {
+			devicesByPF[pfName] = append(devicesByPF[pfName], deviceName)
+		}
+	}
+	s.mutex.Unlock()
+	if len(pfNames) == 0 {
+		for pfName := range devicesByPF {
+			pfNames = append(pfNames, pfName)
+		}
+	}
+
+	// the links are read without holding the mutex, a nil link marks an unreadable one
+	links := map[string]*host.LinkInfo{}
+	for _, pfName := range pfNames {
+		if _, ok := devicesByPF[pfName]; !ok {
+			continue
+		}
+		link, err := s.host.GetLinkInfo(pfName)
+		if err != nil {
+			logger.Error(err, "Failed to get link info, removing the link attributes", "pf", pfName)
+			link = nil
+		}
+		links[pfName] = link
+	}
+
+	changesMade := false
+	s.mutex.Lock()
+	for pfName, link := range links {
+		for _, deviceName := range devicesByPF[pfName] {
+			current, exists := s.allocatable[deviceName]
+			if !exists {
+				continue
+			}
+			device := current.DeepCopy()
+			if link != nil {
+				setLinkAttributes(device, link)
+			} else {
+				clearLinkAttributes(device)
+			}
+			if apiequality.Semantic.DeepEqual(*device, current) {
+				continue
+			}
+			s.allocatable[deviceName] = *device
+			changesMade = true
+			logger.V(3).Info("Updated link attributes for device", "deviceName", deviceName, "pf", pfName, "link", link)
+		}
+	}
+	s.mutex.Unlock()
+
+	if !changesMade {
+		return nil
+	}
+	logger.Info("Device link attributes updated")
+	if republishCallback := s.getRepublishCallback(); republishCallback != nil {
+		if err := republishCallback(ctx); err != nil {
+			return fmt.Errorf("failed to republish resources: %w", err)
+		}
+	}
+	return nil
+}
+
+// WatchLinkAttributes refreshes the link attributes when the host reports a change on a
+// PF link and every interval, until the context is done. The host usage of the devices is
+// checked again on every link change, e.g. a VF netdev enslaved to a bond of the host.
+func (s *Manager) WatchLinkAttributes(ctx context.Context, interval time.Duration) {
+	logger := klog.FromContext(ctx).WithName("WatchLinkAttributes")
+
+	linkUpdates, err := s.host.SubscribeLinkUpdates(ctx)
+	if err != nil {
+		logger.Error(err, "Failed to subscribe to link updates, relying on the periodic refresh only")
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		var pfNames []string
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case linkName, ok := <-linkUpdates:
+			if !ok {
+				linkUpdates = nil
+				continue
+			}
+			pfNames = []string{linkName}
+		}
+		if err := s.RefreshLinkAttributes(ctx, pfNames...); err != nil {
+			logger.Error(err, "Failed to refresh link attributes")
+		}
+		if pfNames == nil {
+			continue
+		}
+		if err := s.RefreshHostDevices(ctx); err != nil {
+			logger.Error(err, "Failed to refresh the host usage of the devices")
+		}
+	}
+}
+
+func stringAttribute(device resourceapi.Device, name resourceapi.QualifiedName) string {
+	attr, ok := device.Attributes[name]
+	if !ok || attr.StringValue == nil {
+		return ""
+	}
+	return *attr.StringValue
+}
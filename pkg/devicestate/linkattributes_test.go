@@ -0,0 +1,145 @@
+package devicestate
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/utils/ptr"
+
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host"
+	mock_host "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host/mock"
+	drasriovtypes "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
+)
+
+var _ = Describe("Link attributes", func() {
+	var (
+		mockCtrl *gomock.Controller
+		mockHost *mock_host.MockInterface
+	)
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+		mockHost = mock_host.NewMockInterface(mockCtrl)
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+	})
+
+	Context("setLinkAttributes", func() {
+		It("removes the optional attributes that are not known anymore", func() {
+			device := resourceapi.Device{Name: "0000-01-00-1"}
+			setLinkAttributes(&device, &host.LinkInfo{Speed: 25000, MTU: 1500, OperState: "up", Carrier: true, Driver: "ice"})
+			Expect(device.Attributes[consts.AttributePFDriver].StringValue).To(Equal(ptr.To("ice")))
+			Expect(device.Capacity).To(HaveKey(resourceapi.QualifiedName(consts.CapacityLinkSpeed)))
+
+			setLinkAttributes(&device, &host.LinkInfo{MTU: 1500, OperState: "down"})
+			Expect(device.Attributes).NotTo(HaveKey(resourceapi.QualifiedName(consts.AttributePFDriver)))
+			Expect(device.Attributes[consts.AttributePFCarrier].BoolValue).To(Equal(ptr.To(false)))
+			Expect(device.Capacity).NotTo(HaveKey(resourceapi.QualifiedName(consts.CapacityLinkSpeed)))
+		})
+
+		It("does not add the link speed capacity to devices allowing multiple allocations", func() {
+			device := resourceapi.Device{Name: "0000-01-00-0", AllowMultipleAllocations: ptr.To(true)}
+			setLinkAttributes(&device, &host.LinkInfo{Speed: 25000, MTU: 1500, OperState: "up", Carrier: true})
+			Expect(device.Capacity).NotTo(HaveKey(resourceapi.QualifiedName(consts.CapacityLinkSpeed)))
+			Expect(device.Attributes[consts.AttributePFMtu].IntValue).To(Equal(ptr.To(int64(1500))))
+		})
+	})
+
+	Context("setVendorAttributes", func() {
+		It("adds the vendor attributes to the device attributes", func() {
+			device := resourceapi.Device{Name: "0000-01-00-1"}
+			setVendorAttributes(&device, nil)
+			Expect(device.Attributes).To(BeNil())
+
+			setVendorAttributes(&device, map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				consts.AttributePFBoardID: {StringValue: ptr.To("MT_0000000222")},
+			})
+			Expect(device.Attributes[consts.AttributePFBoardID].StringValue).To(Equal(ptr.To("MT_0000000222")))
+		})
+	})
+
+	Context("RefreshLinkAttributes", func() {
+		var (
+			s           *Manager
+			republished int
+		)
+
+		BeforeEach(func() {
+			republished = 0
+			link := &host.LinkInfo{MTU: 1500, OperState: "up", Carrier: true}
+			device := resourceapi.Device{
+				Name: "0000-01-00-1",
+				Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+					consts.AttributePFName: {StringValue: ptr.To("eth0")},
+				},
+			}
+			setLinkAttributes(&device, link)
+			s = &Manager{
+				host:        mockHost,
+				allocatable: drasriovtypes.AllocatableDevices{device.Name: device},
+				republishCallback: func(context.Context) error {
+					republished++
+					return nil
+				},
+			}
+		})
+
+		It("does not republish when nothing changed", func() {
+			mockHost.EXPECT().GetLinkInfo("eth0").Return(&host.LinkInfo{MTU: 1500, OperState: "up", Carrier: true}, nil)
+			Expect(s.RefreshLinkAttributes(context.Background())).To(Succeed())
+			Expect(republished).To(Equal(0))
+		})
+
+		It("updates the attributes and republishes when the link changed", func() {
+			mockHost.EXPECT().GetLinkInfo("eth0").Return(&host.LinkInfo{MTU: 9000, OperState: "down"}, nil)
+			Expect(s.RefreshLinkAttributes(context.Background(), "eth0")).To(Succeed())
+			Expect(republished).To(Equal(1))
+			device := s.allocatable["0000-01-00-1"]
+			Expect(device.Attributes[consts.AttributePFMtu].IntValue).To(Equal(ptr.To(int64(9000))))
+			Expect(device.Attributes[consts.AttributePFOperState].StringValue).To(Equal(ptr.To("down")))
+		})
+
+		It("removes the link attributes when the link can't be read", func() {
+			mockHost.EXPECT().GetLinkInfo("eth0").Return(nil, fmt.Errorf("link not found"))
+			Expect(s.RefreshLinkAttributes(context.Background(), "eth0")).To(Succeed())
+			Expect(republished).To(Equal(1))
+			device := s.allocatable["0000-01-00-1"]
+			Expect(device.Attributes).To(HaveKey(resourceapi.QualifiedName(consts.AttributePFName)))
+			Expect(device.Attributes).NotTo(HaveKey(resourceapi.QualifiedName(consts.AttributePFMtu)))
+			Expect(device.Attributes).NotTo(HaveKey(resourceapi.QualifiedName(consts.AttributePFOperState)))
+			Expect(device.Attributes).NotTo(HaveKey(resourceapi.QualifiedName(consts.AttributePFCarrier)))
+		})
+
+		It("recomputes the bandwidth of PF devices from the new link speed", func() {
+			pfDevice := newPFBandwidthDevice(PFInfo{PciAddress: "0000:02:00.0", NetName: "eth1"}, 4, 25000)
+			setLinkAttributes(&pfDevice, &host.LinkInfo{Speed: 25000, MTU: 1500, OperState: "up", Carrier: true})
+			s.allocatable[pfDevice.Name] = pfDevice
+
+			mockHost.EXPECT().GetLinkInfo("eth1").Return(&host.LinkInfo{Speed: 10000, MTU: 1500, OperState: "up", Carrier: true}, nil)
+			Expect(s.RefreshLinkAttributes(context.Background(), "eth1")).To(Succeed())
+			Expect(republished).To(Equal(1))
+			bandwidth := s.allocatable[pfDevice.Name].Capacity[consts.CapacityBandwidth]
+			Expect(bandwidth.Value.Cmp(resource.MustParse("10"))).To(BeZero())
+			Expect(bandwidth.RequestPolicy).To(Equal(pfDevice.Capacity[consts.CapacityBandwidth].RequestPolicy))
+
+			// the bandwidth is kept while the speed is unknown
+			mockHost.EXPECT().GetLinkInfo("eth1").Return(&host.LinkInfo{Speed: -1, MTU: 1500, OperState: "down"}, nil)
+			Expect(s.RefreshLinkAttributes(context.Background(), "eth1")).To(Succeed())
+			bandwidth = s.allocatable[pfDevice.Name].Capacity[consts.CapacityBandwidth]
+			Expect(bandwidth.Value.Cmp(resource.MustParse("10"))).To(BeZero())
+		})
+
+		It("ignores links that do not back any device", func() {
+			Expect(s.RefreshLinkAttributes(context.Background(), "eth5")).To(Succeed())
+			Expect(republished).To(Equal(0))
+		})
+	})
+})
@@ -13,6 +13,7 @@ import (
 	context "context"
 	reflect "reflect"
 
+	v1alpha1 "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/virtualfunction/v1alpha1"
 	types "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
 	gomock "go.uber.org/mock/gomock"
 )
@@ -68,3 +69,27 @@ func (mr *MockDeviceStateMockRecorder) UpdateDeviceResourceNames(ctx, deviceReso
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateDeviceResourceNames", reflect.TypeOf((*MockDeviceState)(nil).UpdateDeviceResourceNames), ctx, deviceResourceMap)
 }
+
+// UpdatePreBindDrivers mocks base method.
+func (m *MockDeviceState) UpdatePreBindDrivers(preBindDrivers map[string]string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "UpdatePreBindDrivers", preBindDrivers)
+}
+
+// UpdatePreBindDrivers indicates an expected call of UpdatePreBindDrivers.
+func (mr *MockDeviceStateMockRecorder) UpdatePreBindDrivers(preBindDrivers any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePreBindDrivers", reflect.TypeOf((*MockDeviceState)(nil).UpdatePreBindDrivers), preBindDrivers)
+}
+
+// UpdateResourceConfigs mocks base method.
+func (m *MockDeviceState) UpdateResourceConfigs(resourceConfigs map[string]*v1alpha1.VfConfig) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "UpdateResourceConfigs", resourceConfigs)
+}
+
+// UpdateResourceConfigs indicates an expected call of UpdateResourceConfigs.
+func (mr *MockDeviceStateMockRecorder) UpdateResourceConfigs(resourceConfigs any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateResourceConfigs", reflect.TypeOf((*MockDeviceState)(nil).UpdateResourceConfigs), resourceConfigs)
+}
@@ -0,0 +1,257 @@
+package devicestate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	resourceapi "k8s.io/api/resource/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	configapi "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/virtualfunction/v1alpha1"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/audit"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
+	drasriovtypes "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
+)
+
+// preBindRetryInterval is the interval the devices that failed to be pre-bound are retried at
+const preBindRetryInterval = time.Minute
+
+// UpdatePreBindDrivers sets the driver the idle devices of each resource name are pre-bound to
+// and triggers the pre-binding in the background
+func (s *Manager) UpdatePreBindDrivers(preBindDrivers map[string]string) {
+	s.mutex.Lock()
+	s.preBindDrivers = preBindDrivers
+	s.mutex.Unlock()
+
+	select {
+	case s.preBindTrigger <- struct{}{}:
+	default:
+	}
+}
+
+// SetPreparedDevicesLister sets the function listing the prepared devices of all the instances
+// of the plugin, the devices prepared by the other instance during a rolling update are not
+// pre-bound
+func (s *Manager) SetPreparedDevicesLister(lister func() drasriovtypes.PreparedDevices) {
+	s.preparedDevicesLister = lister
+}
+
+// PreBindDevices binds the idle devices of the resources with a pre-bind driver to it and
+// publishes the driver as an attribute. The devices pre-bound before whose resource has no
+// pre-bind driver anymore are bound back to their default driver. The resources are
+// republished if the driver of any device changed.
+func (s *Manager) PreBindDevices(ctx context.Context) error {
+	logger := klog.FromContext(ctx).WithName("PreBindDevices")
+
+	// the devices of the checkpoint are listed again, the other instance may have prepared or
+	// unprepared claims. A claim being prepared by this one isn't listed yet and stays reserved.
+	if s.preparedDevicesLister != nil {
+		devicesInUse, _, _ := s.preparedDevicesInUse(s.preparedDevicesLister())
+		s.mutex.Lock()
+		s.checkpointDevicesInUse = devicesInUse
+		s.mutex.Unlock()
+	}
+
+	// the candidates are collected under the mutex, and bound holding only their device lock
+	s.mutex.Lock()
+	if s.preBound == nil {
+		s.preBound = map[string]string{}
+	}
+	if s.bindFailures == nil {
+		s.bindFailures = map[string]string{}
+	}
+	var candidates []string
+	for deviceName, device := range s.allocatable {
+		_, preBound := s.preBound[deviceName]
+		if s.canPreBind(deviceName) && (preBound || s.preBindDrivers[stringAttribute(device, consts.AttributeResourceName)] != "") {
+			candidates = append(candidates, deviceName)
+		}
+	}
+	s.mutex.Unlock()
+	slices.Sort(candidates)
+
+	var errs []error
+	changesMade := false
+	for _, deviceName := range candidates {
+		// a device being prepared or unprepared is picked up by the next run
+		unlock, locked := s.deviceLocks.tryLock(deviceName)
+		if !locked {
+			continue
+		}
+		changed, err := s.preBindDevice(logger, deviceName)
+		unlock()
+		if err != nil {
+			errs = append(errs, err)
+		}
+		changesMade = changesMade || changed
+	}
+
+	if republishCallback := s.getRepublishCallback(); changesMade && republishCallback != nil {
+		if err := republishCallback(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to republish resources: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// preBindDevice binds an idle device to the pre-bind driver of its resource, or back to its
+// default driver when its resource has no pre-bind driver anymore, and returns true if its
+// driver attribute changed. The device lock must be held, s.mutex is only taken to read and
+// update the state around the host changes.
+func (s *Manager) preBindDevice(logger klog.Logger, deviceName string) (bool, error) {
+	s.mutex.Lock()
+	device, exists := s.allocatable[deviceName]
+	// the device may have been claimed since the candidates were collected
+	if !exists || !s.canPreBind(deviceName) {
+		s.mutex.Unlock()
+		return false, nil
+	}
+	pciAddress := stringAttribute(device, consts.AttributePciAddress)
+	driver := s.preBindDrivers[stringAttribute(device, consts.AttributeResourceName)]
+	_, preBound := s.preBound[deviceName]
+	s.mutex.Unlock()
+
+	switch {
+	case driver != "":
+		_, err := s.host.BindDeviceDriver(pciAddress, &configapi.VfConfig{Driver: driver}, audit.Fields{})
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		if err != nil {
+			s.bindFailures[deviceName] = err.Error()
+			return false, fmt.Errorf("failed to pre-bind device %s to driver %s: %w", pciAddress, driver, err)
+		}
+		delete(s.bindFailures, deviceName)
+		s.preBound[deviceName] = driver
+		if !s.setDriverAttribute(deviceName, driver) {
+			return false, nil
+		}
+		logger.V(2).Info("Pre-bound device", "deviceName", deviceName, "driver", driver)
+	case preBound:
+		if err := s.host.BindDefaultDriver(pciAddress); err != nil {
+			return false, fmt.Errorf("failed to bind device %s back to its default driver: %w", pciAddress, err)
+		}
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		delete(s.preBound, deviceName)
+		s.setDriverAttribute(deviceName, "")
+		logger.V(2).Info("Bound device back to its default driver", "deviceName", deviceName)
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// setDriverAttribute sets the driver attribute of a device, or removes it when driver is
+// empty, and returns true if it changed. s.mutex must be held.
+func (s *Manager) setDriverAttribute(deviceName, driver string) bool {
+	device, exists := s.allocatable[deviceName]
+	if !exists || stringAttribute(device, consts.AttributeDriver) == driver {
+		return false
+	}
+	device.Attributes = maps.Clone(device.Attributes)
+	if driver == "" {
+		delete(device.Attributes, consts.AttributeDriver)
+	} else {
+		if device.Attributes == nil {
+			device.Attributes = map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{}
+		}
+		device.Attributes[consts.AttributeDriver] = resourceapi.DeviceAttribute{StringValue: &driver}
+	}
+	s.allocatable[deviceName] = device
+	return true
+}
+
+// WatchPreBind pre-binds the idle devices every time the pre-bind drivers are updated, and
+// every preBindRetryInterval to retry the failures and to pick up released devices, until the
+// context is done. During a rolling update only the active instance pre-binds the devices.
+func (s *Manager) WatchPreBind(ctx context.Context) {
+	logger := klog.FromContext(ctx).WithName("WatchPreBind")
+
+	ticker := time.NewTicker(preBindRetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.preBindTrigger:
+		}
+		s.runIfActive(logger, func() {
+			if err := s.PreBindDevices(ctx); err != nil {
+				logger.Error(err, "Failed to pre-bind devices")
+			}
+		})
+	}
+}
+
+// canPreBind returns true for the VFs that are not shares of a PF device and are not used by a
+// claim, s.mutex must be held
+func (s *Manager) canPreBind(deviceName string) bool {
+	if _, shared := s.sharedVFs[deviceName]; shared {
+		return false
+	}
+	if _, isSF := s.sfDevices[deviceName]; isSF {
+		return false
+	}
+	return !s.deviceInUse(deviceName)
+}
+
+// deviceInUse returns true if the device is used by a claim prepared by this instance or
+// recorded in the checkpoint, s.mutex must be held
+func (s *Manager) deviceInUse(deviceName string) bool {
+	_, inUse := s.devicesInUse[deviceName]
+	_, inCheckpoint := s.checkpointDevicesInUse[deviceName]
+	return inUse || inCheckpoint
+}
+
+// reserveDevice excludes a device from the pre-binding while it is used by a claim and returns
+// the driver it is pre-bound to, if any
+func (s *Manager) reserveDevice(claimUID k8stypes.UID, deviceName string) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.devicesInUse == nil {
+		s.devicesInUse = map[string]k8stypes.UID{}
+	}
+	s.devicesInUse[deviceName] = claimUID
+	return s.preBound[deviceName]
+}
+
+// isBoundTo returns true if the device is bound to the driver, a failed prepare may have bound
+// a pre-bound device to another driver
+func (s *Manager) isBoundTo(pciAddress, driver string) bool {
+	currentDriver, err := s.host.GetDriverByBusAndDevice(pciAddress)
+	return err == nil && currentDriver == driver
+}
+
+// releaseDevices makes the devices used by a claim available to the pre-binding again
+func (s *Manager) releaseDevices(claimUID k8stypes.UID) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, devicesInUse := range []map[string]k8stypes.UID{s.devicesInUse, s.checkpointDevicesInUse} {
+		for deviceName, uid := range devicesInUse {
+			if uid == claimUID {
+				delete(devicesInUse, deviceName)
+			}
+		}
+	}
+}
+
+// releaseDevice makes a device available to the pre-binding again
+func (s *Manager) releaseDevice(deviceName string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.devicesInUse, deviceName)
+	delete(s.checkpointDevicesInUse, deviceName)
+}
+
+// preBindDriver returns the driver the device is pre-bound to by its resource, if any
+func (s *Manager) preBindDriver(deviceName string) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.preBindDrivers[stringAttribute(s.allocatable[deviceName], consts.AttributeResourceName)]
+}
@@ -0,0 +1,188 @@
+package devicestate
+
+import (
+	"context"
+	"errors"
+
+	netattdefv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	resourceapi "k8s.io/api/resource/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	configapi "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/virtualfunction/v1alpha1"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/audit"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/cdi"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/flags"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host/fakehost"
+	drasriovtypes "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
+)
+
+// stateReadingHost reads the devices of the manager while a driver is bound, it blocks if the
+// manager holds its mutex during the binding
+type stateReadingHost struct {
+	host.Interface
+	s     *Manager
+	reads int
+}
+
+func (h *stateReadingHost) BindDeviceDriver(pciAddress string, config *configapi.VfConfig, fields audit.Fields) (string, error) {
+	h.s.GetAllocatableDevices()
+	h.reads++
+	return h.Interface.BindDeviceDriver(pciAddress, config, fields)
+}
+
+var _ = Describe("Pre-binding", func() {
+	var (
+		fakeHost    *fakehost.Host
+		s           *Manager
+		republished int
+	)
+
+	vfDriver := func(pciAddress string) string {
+		vf, _ := fakeHost.VF(pciAddress)
+		return vf.Driver
+	}
+
+	BeforeEach(func(ctx SpecContext) {
+		fakeHost = newFakeHost(2, 1500)
+		cdiHandler, err := cdi.NewHandler(GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+		s, err = NewManager(&drasriovtypes.Config{
+			Flags: &drasriovtypes.Flags{
+				NodeName:               "node1",
+				DefaultInterfacePrefix: "net",
+				HostDevicePolicy:       HostDevicePolicySkip,
+			},
+			K8sClient: flags.ClientSets{Client: fake.NewClientBuilder().WithScheme(flags.Scheme).Build()},
+		}, fakeHost, cdiHandler, nil)
+		Expect(err).NotTo(HaveOccurred())
+		republished = 0
+		s.SetRepublishCallback(func(context.Context) error {
+			republished++
+			return nil
+		})
+
+		Expect(s.UpdateDeviceResourceNames(ctx, map[string]string{"0000-01-00-1": "netdev", "0000-01-00-2": "dpdk"})).To(Succeed())
+		s.UpdatePreBindDrivers(map[string]string{"dpdk": "vfio-pci"})
+		republished = 0
+	})
+
+	It("binds the idle devices of the resource to its driver and publishes it", func(ctx SpecContext) {
+		Expect(s.PreBindDevices(ctx)).To(Succeed())
+		Expect(vfDriver("0000:01:00.2")).To(Equal("vfio-pci"))
+		Expect(vfDriver("0000:01:00.1")).To(Equal("iavf"))
+		Expect(stringAttribute(s.allocatable["0000-01-00-2"], consts.AttributeDriver)).To(Equal("vfio-pci"))
+		Expect(s.allocatable["0000-01-00-1"].Attributes).NotTo(HaveKey(resourceapi.QualifiedName(consts.AttributeDriver)))
+		Expect(republished).To(Equal(1))
+
+		// nothing changed
+		Expect(s.PreBindDevices(ctx)).To(Succeed())
+		Expect(republished).To(Equal(1))
+	})
+
+	It("does not hold the mutex while binding the devices", func(ctx SpecContext) {
+		stateReading := &stateReadingHost{Interface: fakeHost, s: s}
+		s.host = stateReading
+		done := make(chan error)
+		go func() {
+			done <- s.PreBindDevices(ctx)
+		}()
+		Eventually(done).Should(Receive(BeNil()))
+		Expect(stateReading.reads).To(Equal(1))
+		Expect(stringAttribute(s.GetAllocatableDevices()["0000-01-00-2"], consts.AttributeDriver)).To(Equal("vfio-pci"))
+	})
+
+	It("skips the binding on prepare and leaves the device bound on unprepare", func(ctx SpecContext) {
+		Expect(s.PreBindDevices(ctx)).To(Succeed())
+
+		// the prepare would fail if it tried to bind the device
+		fakeHost.BindDriverErr = errors.New("boom")
+		claim := newClaim("claim1", "0000-01-00-2", &configapi.VfConfig{Driver: "vfio-pci"})
+		ifNameIndex := 0
+		prepared, err := s.PrepareDevicesForClaim(ctx, &ifNameIndex, claim)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(prepared[0].OriginalDriver).To(Equal("vfio-pci"))
+		Expect(prepared[0].Driver).To(Equal("vfio-pci"))
+		fakeHost.BindDriverErr = nil
+
+		Expect(s.Unprepare(string(claim.UID), prepared)).To(Succeed())
+		Expect(vfDriver("0000:01:00.2")).To(Equal("vfio-pci"))
+	})
+
+	It("binds a device prepared with another driver back to the driver of the resource on unprepare", func(ctx SpecContext) {
+		Expect(s.PreBindDevices(ctx)).To(Succeed())
+
+		claim := newClaim("claim1", "0000-01-00-2", &configapi.VfConfig{Driver: "default", NetAttachDefName: "sriov"})
+		Expect(s.k8sClient.Create(ctx, &netattdefv1.NetworkAttachmentDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: "sriov", Namespace: "default"},
+			Spec:       netattdefv1.NetworkAttachmentDefinitionSpec{Config: `{"type":"sriov"}`},
+		})).To(Succeed())
+		ifNameIndex := 0
+		prepared, err := s.PrepareDevicesForClaim(ctx, &ifNameIndex, claim)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(vfDriver("0000:01:00.2")).To(Equal("iavf"))
+
+		// the device in use is not pre-bound
+		Expect(s.PreBindDevices(ctx)).To(Succeed())
+		Expect(vfDriver("0000:01:00.2")).To(Equal("iavf"))
+
+		Expect(s.Unprepare(string(claim.UID), prepared)).To(Succeed())
+		Expect(vfDriver("0000:01:00.2")).To(Equal("vfio-pci"))
+	})
+
+	It("binds the devices back to their default driver when the pre-binding is removed", func(ctx SpecContext) {
+		Expect(s.PreBindDevices(ctx)).To(Succeed())
+
+		s.UpdatePreBindDrivers(map[string]string{})
+		Expect(s.PreBindDevices(ctx)).To(Succeed())
+		Expect(vfDriver("0000:01:00.2")).To(Equal("iavf"))
+		Expect(s.allocatable["0000-01-00-2"].Attributes).NotTo(HaveKey(resourceapi.QualifiedName(consts.AttributeDriver)))
+		Expect(republished).To(Equal(2))
+	})
+
+	It("records the devices that failed to be pre-bound", func(ctx SpecContext) {
+		fakeHost.BindDriverErr = errors.New("boom")
+		Expect(s.PreBindDevices(ctx)).To(MatchError(ContainSubstring("failed to pre-bind device 0000:01:00.2 to driver vfio-pci")))
+		Expect(s.bindFailures).To(HaveKey("0000-01-00-2"))
+		Expect(republished).To(BeZero())
+
+		fakeHost.BindDriverErr = nil
+		Expect(s.PreBindDevices(ctx)).To(Succeed())
+		Expect(s.bindFailures).NotTo(HaveKey("0000-01-00-2"))
+	})
+
+	It("skips the devices prepared by the other instance during a rolling update", func(ctx SpecContext) {
+		prepared := &drasriovtypes.PreparedDevice{PciAddress: "0000:01:00.2"}
+		prepared.Device.DeviceName = "0000-01-00-2"
+		prepared.ClaimNamespacedName.UID = "claim1"
+		s.SetPreparedDevicesLister(func() drasriovtypes.PreparedDevices {
+			return drasriovtypes.PreparedDevices{prepared}
+		})
+
+		Expect(s.PreBindDevices(ctx)).To(Succeed())
+		Expect(vfDriver("0000:01:00.2")).To(Equal("iavf"))
+		Expect(s.checkpointDevicesInUse).To(HaveKey("0000-01-00-2"))
+	})
+
+	It("pre-binds the devices once unprepared by the other instance", func(ctx SpecContext) {
+		prepared := &drasriovtypes.PreparedDevice{PciAddress: "0000:01:00.2"}
+		prepared.Device.DeviceName = "0000-01-00-2"
+		prepared.ClaimNamespacedName.UID = "claim1"
+		preparedDevices := drasriovtypes.PreparedDevices{prepared}
+		s.SetPreparedDevicesLister(func() drasriovtypes.PreparedDevices {
+			return preparedDevices
+		})
+
+		Expect(s.PreBindDevices(ctx)).To(Succeed())
+		Expect(vfDriver("0000:01:00.2")).To(Equal("iavf"))
+
+		preparedDevices = nil
+		Expect(s.PreBindDevices(ctx)).To(Succeed())
+		Expect(vfDriver("0000:01:00.2")).To(Equal("vfio-pci"))
+		Expect(s.checkpointDevicesInUse).To(BeEmpty())
+	})
+})
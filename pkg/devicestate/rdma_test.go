@@ -0,0 +1,118 @@
+package devicestate
+
+import (
+	"context"
+	"errors"
+
+	netattdefv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+	resourceapi "k8s.io/api/resource/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	cdispec "tags.cncf.io/container-device-interface/specs-go"
+
+	configapi "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/virtualfunction/v1alpha1"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/cdi"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/flags"
+	mock_host "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host/mock"
+	drasriovtypes "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
+)
+
+var _ = Describe("RDMA devices", func() {
+	var (
+		mockCtrl *gomock.Controller
+		mockHost *mock_host.MockInterface
+		s        *Manager
+		claim    *resourceapi.ResourceClaim
+		result   *resourceapi.DeviceRequestAllocationResult
+		config   *configapi.VfConfig
+	)
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+		mockHost = mock_host.NewMockInterface(mockCtrl)
+
+		cdiHandler, err := cdi.NewHandler(GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+		nad := &netattdefv1.NetworkAttachmentDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: "sriov", Namespace: "default"},
+			Spec:       netattdefv1.NetworkAttachmentDefinitionSpec{Config: `{"type":"sriov"}`},
+		}
+		s = &Manager{
+			host: mockHost,
+			k8sClient: flags.ClientSets{
+				Client: fake.NewClientBuilder().WithScheme(flags.Scheme).WithObjects(nad).Build(),
+			},
+			cdi:                    cdiHandler,
+			defaultInterfacePrefix: "net",
+			allocatable: drasriovtypes.AllocatableDevices{
+				"0000-01-00-1": {
+					Name: "0000-01-00-1",
+					Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+						consts.AttributePciAddress: {StringValue: ptr.To("0000:01:00.1")},
+						consts.AttributePFName:     {StringValue: ptr.To("eth0")},
+						consts.AttributeRDMA:       {BoolValue: ptr.To(true)},
+					},
+				},
+			},
+		}
+		claim = &resourceapi.ResourceClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "claim1", Namespace: "default", UID: "claim1"},
+			Status: resourceapi.ResourceClaimStatus{
+				ReservedFor: []resourceapi.ResourceClaimConsumerReference{{Name: "pod", UID: "pod-uid"}},
+			},
+		}
+		result = &resourceapi.DeviceRequestAllocationResult{Request: "req", Driver: consts.DriverName, Pool: "node1", Device: "0000-01-00-1"}
+		config = &configapi.VfConfig{NetAttachDefName: "sriov", RDMA: true}
+
+		mockHost.EXPECT().BindDeviceDriver("0000:01:00.1", config, claimAuditFields(claim)).Return("", nil)
+		mockHost.EXPECT().GetDriverByBusAndDevice("0000:01:00.1").Return("mlx5_core", nil)
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+	})
+
+	It("adds the RDMA character devices and env vars to the container edits", func() {
+		mockHost.EXPECT().GetRDMADevice("0000:01:00.1").Return("mlx5_2", nil)
+		mockHost.EXPECT().GetRDMACharDevices("0000:01:00.1").Return([]string{"/dev/infiniband/uverbs2", "/dev/infiniband/umad2", "/dev/infiniband/rdma_cm"}, nil)
+
+		ifNameIndex := 0
+		prepared, err := s.applyConfigOnDevice(context.Background(), &ifNameIndex, claim, config, result)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(prepared.RDMADevice).To(Equal("mlx5_2"))
+		Expect(prepared.NewDeviceStatusData().RDMADevice).To(Equal("mlx5_2"))
+
+		edits := prepared.ContainerEdits.ContainerEdits
+		Expect(edits.DeviceNodes).To(ConsistOf(
+			&cdispec.DeviceNode{Path: "/dev/infiniband/uverbs2", HostPath: "/dev/infiniband/uverbs2", Type: "c"},
+			&cdispec.DeviceNode{Path: "/dev/infiniband/umad2", HostPath: "/dev/infiniband/umad2", Type: "c"},
+			&cdispec.DeviceNode{Path: "/dev/infiniband/rdma_cm", HostPath: "/dev/infiniband/rdma_cm", Type: "c"},
+		))
+		Expect(edits.Env).To(ContainElements(
+			"SRIOVNETWORK_0000_01_00_1_RDMA_DEVICE=mlx5_2",
+			"SRIOVNETWORK_0000_01_00_1_RDMA_CHAR_DEVICES=/dev/infiniband/uverbs2,/dev/infiniband/umad2,/dev/infiniband/rdma_cm",
+		))
+	})
+
+	It("fails when the VF has no RDMA device", func() {
+		mockHost.EXPECT().GetRDMADevice("0000:01:00.1").Return("", nil)
+
+		ifNameIndex := 0
+		_, err := s.applyConfigOnDevice(context.Background(), &ifNameIndex, claim, config, result)
+		Expect(err).To(MatchError(ContainSubstring("has no RDMA device")))
+	})
+
+	It("fails when the RDMA character devices can't be found", func() {
+		mockHost.EXPECT().GetRDMADevice("0000:01:00.1").Return("mlx5_2", nil)
+		mockHost.EXPECT().GetRDMACharDevices("0000:01:00.1").Return(nil, errors.New("no uverbs"))
+
+		ifNameIndex := 0
+		_, err := s.applyConfigOnDevice(context.Background(), &ifNameIndex, claim, config, result)
+		Expect(err).To(MatchError(ContainSubstring("error getting RDMA character devices")))
+	})
+})
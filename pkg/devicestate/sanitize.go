@@ -0,0 +1,313 @@
+package devicestate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+
+	resourceapi "k8s.io/api/resource/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
+	drasriovtypes "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
+)
+
+// Steps sanitizing the VFs after unprepare
+const (
+	// SanitizeStepMACVLAN resets the MAC address, VLAN, trust, spoof check and link state of
+	// the VF on the PF
+	SanitizeStepMACVLAN = "mac-vlan"
+	// SanitizeStepFLR resets the VF with a function level reset
+	SanitizeStepFLR = "flr"
+	// SanitizeStepRebind unbinds the VF from its driver and binds it again
+	SanitizeStepRebind = "rebind"
+	// SanitizeStepMTU restores the MTU the VF netdev had before prepare
+	SanitizeStepMTU = "mtu"
+)
+
+// sanitizeSteps are the supported sanitization steps in the order they run
+var sanitizeSteps = []string{SanitizeStepMACVLAN, SanitizeStepFLR, SanitizeStepRebind, SanitizeStepMTU}
+
+// zeroMAC clears the administrative MAC address of a VF
+const zeroMAC = "00:00:00:00:00:00"
+
+// ValidateSanitizeSteps returns an error if a sanitization step is not supported
+func ValidateSanitizeSteps(steps []string) error {
+	for _, step := range steps {
+		if !slices.Contains(sanitizeSteps, step) {
+			return fmt.Errorf("invalid VF sanitize step %q, must be one of %q", step, sanitizeSteps)
+		}
+	}
+	return nil
+}
+
+// sanitizeDevice clears the state a pod left on a VF with the enabled sanitization steps. All
+// the steps run, the errors of the failed ones are returned.
+func (s *Manager) sanitizeDevice(logger klog.Logger, preparedDevice *drasriovtypes.PreparedDevice) error {
+	var errs []error
+	for _, step := range sanitizeSteps {
+		if !slices.Contains(s.sanitizeSteps, step) {
+			continue
+		}
+		var err error
+		switch step {
+		case SanitizeStepMACVLAN:
+			err = s.resetVFLinkSettings(preparedDevice)
+		case SanitizeStepFLR:
+			err = s.host.ResetDevice(preparedDevice.PciAddress)
+		case SanitizeStepRebind:
+			err = s.rebindDevice(preparedDevice)
+		case SanitizeStepMTU:
+			err = s.restoreMTU(preparedDevice)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", step, err))
+			continue
+		}
+		if step == SanitizeStepFLR || step == SanitizeStepRebind {
+			s.clearFatalPCIError(preparedDevice.PciAddress)
+		}
+		logger.V(3).Info("Sanitized device", "device", preparedDevice.PciAddress, "step", step)
+	}
+	return errors.Join(errs...)
+}
+
+// resetVFLinkSettings resets the settings of a VF applied through its PF to the defaults of a
+// new VF. InfiniBand VFs have no MAC address nor VLAN, their GUID is reset on unprepare.
+func (s *Manager) resetVFLinkSettings(preparedDevice *drasriovtypes.PreparedDevice) error {
+	if preparedDevice.PFName == "" || preparedDevice.GUID != "" {
+		return nil
+	}
+	return s.host.SetVFLinkSettings(preparedDevice.PFName, preparedDevice.VFID, &drasriovtypes.VFLinkSettings{
+		MAC:       zeroMAC,
+		Vlan:      ptr.To(0),
+		VlanQoS:   ptr.To(0),
+		Trust:     "off",
+		SpoofChk:  "on",
+		LinkState: "auto",
+	})
+}
+
+// rebindDevice unbinds a device from its driver and binds it again, so the driver starts from
+// a clean state
+func (s *Manager) rebindDevice(preparedDevice *drasriovtypes.PreparedDevice) error {
+	driver, err := s.host.GetDriverByBusAndDevice(preparedDevice.PciAddress)
+	if err != nil || driver == "" {
+		return err
+	}
+	if err := s.host.UnbindDriverByBusAndDevice(preparedDevice.PciAddress, preparedDevice.AuditFields()); err != nil {
+		return err
+	}
+	return s.host.BindDriverByBusAndDevice(preparedDevice.PciAddress, driver, preparedDevice.AuditFields())
+}
+
+// restoreMTU sets the MTU of the VF netdev back to the one recorded on prepare, VFs without
+// netdev are skipped
+func (s *Manager) restoreMTU(preparedDevice *drasriovtypes.PreparedDevice) error {
+	if preparedDevice.OriginalMTU == 0 {
+		return nil
+	}
+	ifName := s.host.TryGetInterfaceName(preparedDevice.PciAddress)
+	if ifName == "" {
+		return nil
+	}
+	if link, err := s.host.GetLinkInfo(ifName); err == nil && link.MTU == preparedDevice.OriginalMTU {
+		return nil
+	}
+	return s.host.SetLinkMTU(ifName, preparedDevice.OriginalMTU)
+}
+
+// netdevMTU returns the MTU of the netdev of a VF to restore it after unprepare, 0 if the MTU
+// step is disabled or the VF has no netdev
+func (s *Manager) netdevMTU(pciAddress string) int {
+	if !slices.Contains(s.sanitizeSteps, SanitizeStepMTU) {
+		return 0
+	}
+	ifName := s.host.TryGetInterfaceName(pciAddress)
+	if ifName == "" {
+		return 0
+	}
+	link, err := s.host.GetLinkInfo(ifName)
+	if err != nil {
+		return 0
+	}
+	return link.MTU
+}
+
+// recordSanitizeFailure taints a VF that failed to be sanitized right away so it isn't handed
+// to another pod, the health check retries the sanitization and clears the taint once it succeeds
+func (s *Manager) recordSanitizeFailure(ctx context.Context, preparedDevice *drasriovtypes.PreparedDevice) {
+	logger := klog.FromContext(ctx).WithName("recordSanitizeFailure")
+
+	s.mutex.Lock()
+	if s.sanitizeFailures == nil {
+		s.sanitizeFailures = map[string]*drasriovtypes.PreparedDevice{}
+	}
+	s.sanitizeFailures[preparedDevice.PciAddress] = preparedDevice
+	changesMade := false
+	deviceName := preparedDevice.Device.DeviceName
+	if device, exists := s.allocatable[deviceName]; exists {
+		taints := []resourceapi.DeviceTaint{sanitizeFailedTaint()}
+		for _, taint := range device.Taints {
+			if healthTaintKeys.Has(taint.Key) && taint.Key != consts.TaintSanitizeFailed {
+				taints = append(taints, taint)
+			}
+		}
+		merged := mergeHealthTaints(device.Taints, taints, metav1.Now())
+		if !apiequality.Semantic.DeepEqual(merged, device.Taints) {
+			device.Taints = merged
+			s.allocatable[deviceName] = device
+			changesMade = true
+		}
+	}
+	s.mutex.Unlock()
+
+	if err := s.saveSanitizeFailures(); err != nil {
+		logger.Error(err, "Failed to save the sanitize failures, the device is not tainted after a restart", "deviceName", deviceName)
+	}
+	if !changesMade {
+		return
+	}
+	s.notifyHealthSubscribers()
+	if republishCallback := s.getRepublishCallback(); republishCallback != nil {
+		if err := republishCallback(ctx); err != nil {
+			logger.Error(err, "Failed to republish resources after tainting a device", "deviceName", deviceName)
+		}
+	}
+}
+
+// retrySanitizeFailures sanitizes again the VFs that failed to be sanitized and are not in use
+// or being prepared, the VFs sanitized successfully are forgotten. s.mutex must not be held.
+func (s *Manager) retrySanitizeFailures(logger klog.Logger) {
+	s.mutex.Lock()
+	failures := maps.Clone(s.sanitizeFailures)
+	s.mutex.Unlock()
+
+	recovered := false
+	for _, pciAddress := range slices.Sorted(maps.Keys(failures)) {
+		preparedDevice := failures[pciAddress]
+		deviceName := preparedDevice.Device.DeviceName
+		// a device being prepared or unprepared is retried by the next check
+		unlock, locked := s.deviceLocks.tryLock(deviceName)
+		if !locked {
+			continue
+		}
+		if !s.canRetrySanitize(pciAddress, deviceName) {
+			unlock()
+			continue
+		}
+		err := s.sanitizeDevice(logger, preparedDevice)
+		unlock()
+		if err != nil {
+			logger.V(2).Info("Device still fails to be sanitized", "deviceName", deviceName, "device", pciAddress, "error", err.Error())
+			continue
+		}
+		logger.Info("Device sanitized after a failure", "deviceName", deviceName, "device", pciAddress)
+		s.mutex.Lock()
+		delete(s.sanitizeFailures, pciAddress)
+		s.mutex.Unlock()
+		recovered = true
+	}
+
+	if !recovered {
+		return
+	}
+	if err := s.saveSanitizeFailures(); err != nil {
+		logger.Error(err, "Failed to save the sanitize failures")
+	}
+}
+
+// canRetrySanitize returns true if the VF still fails to be sanitized and wasn't handed to a
+// claim since, a VF in use is sanitized again on its unprepare
+func (s *Manager) canRetrySanitize(pciAddress, deviceName string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, failed := s.sanitizeFailures[pciAddress]; !failed {
+		return false
+	}
+	_, sharedVFInUse := s.sharedVFsInUse[pciAddress]
+	return !sharedVFInUse && !s.deviceInUse(deviceName)
+}
+
+// hasSanitizeFailure returns true if any VF of the device failed to be sanitized, s.mutex must
+// be held
+func (s *Manager) hasSanitizeFailure(deviceName string) bool {
+	for _, preparedDevice := range s.sanitizeFailures {
+		if preparedDevice.Device.DeviceName == deviceName {
+			return true
+		}
+	}
+	return false
+}
+
+// saveSanitizeFailures writes the VFs that failed to be sanitized to the sanitize failures
+// file, it is replaced so a crash never leaves it truncated
+func (s *Manager) saveSanitizeFailures() error {
+	if s.sanitizeFailuresPath == "" {
+		return nil
+	}
+	s.sanitizeFailuresFileMutex.Lock()
+	defer s.sanitizeFailuresFileMutex.Unlock()
+
+	s.mutex.Lock()
+	data, err := json.Marshal(s.sanitizeFailures)
+	s.mutex.Unlock()
+	if err != nil {
+		return fmt.Errorf("unable to encode the sanitize failures: %w", err)
+	}
+	tmpPath := s.sanitizeFailuresPath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("unable to write the sanitize failures: %w", err)
+	}
+	if err := os.Rename(tmpPath, s.sanitizeFailuresPath); err != nil {
+		return fmt.Errorf("unable to write the sanitize failures: %w", err)
+	}
+	return nil
+}
+
+// loadSanitizeFailures reads the VFs that failed to be sanitized before a restart
+func loadSanitizeFailures(path string) (map[string]*drasriovtypes.PreparedDevice, error) {
+	failures := map[string]*drasriovtypes.PreparedDevice{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return failures, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the sanitize failures: %w", err)
+	}
+	if err := json.Unmarshal(data, &failures); err != nil {
+		return nil, fmt.Errorf("unable to decode the sanitize failures %s: %w", path, err)
+	}
+	if failures == nil {
+		failures = map[string]*drasriovtypes.PreparedDevice{}
+	}
+	return failures, nil
+}
+
+// taintSanitizeFailures taints the devices whose VFs failed to be sanitized
+func taintSanitizeFailures(allocatable drasriovtypes.AllocatableDevices, failures map[string]*drasriovtypes.PreparedDevice) {
+	now := metav1.Now()
+	for _, preparedDevice := range failures {
+		deviceName := preparedDevice.Device.DeviceName
+		device, exists := allocatable[deviceName]
+		if !exists {
+			continue
+		}
+		device.Taints = mergeHealthTaints(device.Taints, []resourceapi.DeviceTaint{sanitizeFailedTaint()}, now)
+		allocatable[deviceName] = device
+	}
+}
+
+func sanitizeFailedTaint() resourceapi.DeviceTaint {
+	return resourceapi.DeviceTaint{
+		Key:    consts.TaintSanitizeFailed,
+		Effect: resourceapi.DeviceTaintEffectNoSchedule,
+	}
+}
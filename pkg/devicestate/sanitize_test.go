@@ -0,0 +1,163 @@
+package devicestate
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	netattdefv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	resourceapi "k8s.io/api/resource/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	configapi "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/virtualfunction/v1alpha1"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/cdi"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/flags"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host/fakehost"
+	drasriovtypes "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
+)
+
+var _ = Describe("VF sanitization", func() {
+	var (
+		fakeHost    *fakehost.Host
+		config      *drasriovtypes.Config
+		cdiHandler  *cdi.Handler
+		s           *Manager
+		republished int
+	)
+
+	claim := func() *resourceapi.ResourceClaim {
+		return newClaim("claim1", "0000-01-00-1", &configapi.VfConfig{NetAttachDefName: "sriov"})
+	}
+
+	// runPod prepares the claim and leaves the state of a tenant on the VF
+	runPod := func(ctx context.Context) drasriovtypes.PreparedDevices {
+		ifNameIndex := 0
+		prepared, err := s.PrepareDevicesForClaim(ctx, &ifNameIndex, claim())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(prepared[0].OriginalMTU).To(Equal(1500))
+
+		Expect(fakeHost.SetLinkMTU("eth0v0", 9000)).To(Succeed())
+		Expect(fakeHost.SetVFLinkSettings("eth0", 0, &drasriovtypes.VFLinkSettings{
+			MAC: "02:00:00:00:00:01", Vlan: ptr.To(100), Trust: "on", SpoofChk: "off",
+		})).To(Succeed())
+		return prepared
+	}
+
+	taintKeys := func() []string {
+		keys := []string{}
+		for _, taint := range s.allocatable["0000-01-00-1"].Taints {
+			keys = append(keys, taint.Key)
+		}
+		return keys
+	}
+
+	BeforeEach(func() {
+		fakeHost = newFakeHost(1, 9000)
+		var err error
+		cdiHandler, err = cdi.NewHandler(GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+		nad := &netattdefv1.NetworkAttachmentDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: "sriov", Namespace: "default"},
+			Spec:       netattdefv1.NetworkAttachmentDefinitionSpec{Config: `{"type":"sriov"}`},
+		}
+		config = &drasriovtypes.Config{
+			Flags: &drasriovtypes.Flags{
+				NodeName:                    "node1",
+				DefaultInterfacePrefix:      "net",
+				HostDevicePolicy:            HostDevicePolicySkip,
+				VFSanitizeSteps:             []string{SanitizeStepFLR, SanitizeStepMACVLAN, SanitizeStepMTU, SanitizeStepRebind},
+				KubeletPluginsDirectoryPath: GinkgoT().TempDir(),
+			},
+			K8sClient: flags.ClientSets{Client: fake.NewClientBuilder().WithScheme(flags.Scheme).WithObjects(nad).Build()},
+		}
+		Expect(os.MkdirAll(config.DriverPluginPath(), 0750)).To(Succeed())
+		s, err = NewManager(config, fakeHost, cdiHandler, nil)
+		Expect(err).NotTo(HaveOccurred())
+		republished = 0
+		s.SetRepublishCallback(func(context.Context) error {
+			republished++
+			return nil
+		})
+	})
+
+	It("clears the state left by the pod after unprepare", func(ctx SpecContext) {
+		prepared := runPod(ctx)
+		Expect(s.Unprepare("claim1", prepared)).To(Succeed())
+
+		vf, _ := fakeHost.VF("0000:01:00.1")
+		Expect(vf.Resets).To(Equal(1))
+		Expect(vf.MTU).To(Equal(1500))
+		Expect(vf.Driver).To(Equal("iavf"))
+		Expect(vf.MAC).To(Equal("00:00:00:00:00:00"))
+		Expect(vf.Settings.Vlan).To(HaveValue(BeZero()))
+		Expect(vf.Settings.Trust).To(Equal("off"))
+		Expect(vf.Settings.SpoofChk).To(Equal("on"))
+		Expect(taintKeys()).To(BeEmpty())
+		Expect(republished).To(BeZero())
+	})
+
+	It("taints the VF that fails to be sanitized until a retry succeeds", func(ctx SpecContext) {
+		prepared := runPod(ctx)
+		fakeHost.ResetErr = errors.New("boom")
+		Expect(s.Unprepare("claim1", prepared)).To(Succeed())
+
+		// the other steps still ran
+		vf, _ := fakeHost.VF("0000:01:00.1")
+		Expect(vf.MTU).To(Equal(1500))
+		Expect(taintKeys()).To(Equal([]string{consts.TaintSanitizeFailed}))
+		Expect(republished).To(Equal(1))
+
+		Expect(s.CheckDeviceHealth(ctx)).To(Succeed())
+		Expect(taintKeys()).To(Equal([]string{consts.TaintSanitizeFailed}))
+		Expect(republished).To(Equal(1))
+
+		fakeHost.ResetErr = nil
+		Expect(s.CheckDeviceHealth(ctx)).To(Succeed())
+		Expect(taintKeys()).To(BeEmpty())
+		Expect(republished).To(Equal(2))
+		vf, _ = fakeHost.VF("0000:01:00.1")
+		Expect(vf.Resets).To(Equal(1))
+	})
+
+	It("keeps the VF that failed to be sanitized tainted after a restart", func(ctx SpecContext) {
+		prepared := runPod(ctx)
+		fakeHost.ResetErr = errors.New("boom")
+		Expect(s.Unprepare("claim1", prepared)).To(Succeed())
+		Expect(config.SanitizeFailuresPath()).To(BeAnExistingFile())
+
+		// the restarted plugin publishes the VF tainted and sanitizes it again
+		var err error
+		s, err = NewManager(config, fakeHost, cdiHandler, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(taintKeys()).To(Equal([]string{consts.TaintSanitizeFailed}))
+		Expect(s.sanitizeFailures).To(HaveKey("0000:01:00.1"))
+
+		fakeHost.ResetErr = nil
+		Expect(s.CheckDeviceHealth(ctx)).To(Succeed())
+		Expect(taintKeys()).To(BeEmpty())
+		vf, _ := fakeHost.VF("0000:01:00.1")
+		Expect(vf.Resets).To(Equal(1))
+
+		// the VF stays untainted after another restart
+		s, err = NewManager(config, fakeHost, cdiHandler, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(taintKeys()).To(BeEmpty())
+	})
+
+	It("fails to start on a corrupted sanitize failures file", func() {
+		Expect(os.WriteFile(config.SanitizeFailuresPath(), []byte("{"), 0600)).To(Succeed())
+		_, err := NewManager(config, fakeHost, cdiHandler, nil)
+		Expect(err).To(MatchError(ContainSubstring("unable to decode the sanitize failures")))
+	})
+
+	It("validates the sanitization steps", func() {
+		Expect(ValidateSanitizeSteps(nil)).To(Succeed())
+		Expect(ValidateSanitizeSteps([]string{SanitizeStepFLR, SanitizeStepMTU})).To(Succeed())
+		Expect(ValidateSanitizeSteps([]string{"flr", "wipe"})).To(MatchError(ContainSubstring(`invalid VF sanitize step "wipe"`)))
+	})
+})
@@ -0,0 +1,252 @@
+package devicestate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	resourceapi "k8s.io/api/resource/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+	"k8s.io/klog/v2"
+	drapbv1 "k8s.io/kubelet/pkg/apis/dra/v1beta1"
+	"k8s.io/utils/ptr"
+	cdiapi "tags.cncf.io/container-device-interface/pkg/cdi"
+	cdispec "tags.cncf.io/container-device-interface/specs-go"
+
+	configapi "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/virtualfunction/v1alpha1"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
+)
+
+// sfNumBase is the first SF number of the SFs created on demand
+const sfNumBase = 1000
+
+// SFDevice is a scalable function of a PF published as a device. It either exists on the
+// host or is created through devlink when it is prepared.
+type SFDevice struct {
+	PFPciAddress string
+	PFName       string
+	SFNum        int
+}
+
+// SFDevices maps the device names of the published SFs to their PF and SF number
+type SFDevices map[string]SFDevice
+
+// DiscoverSFDevices returns the SFs of the PFs as devices: the SFs that exist on the host
+// and, for PFs in switchdev mode, sfsPerPF SFs created on demand.
+func DiscoverSFDevices(h host.Interface, sfsPerPF int) (types.AllocatableDevices, SFDevices, error) {
+	logger := klog.LoggerWithName(klog.Background(), "DiscoverSFDevices")
+	resourceList := types.AllocatableDevices{}
+	sfDevices := SFDevices{}
+
+	pfList, err := discoverPFs(logger, h)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, pfInfo := range pfList {
+		sfList, err := h.GetSFList(pfInfo.Address)
+		if err != nil {
+			logger.Error(err, "Failed to get SF list for PF", "pf", pfInfo.NetName, "address", pfInfo.Address)
+			return nil, nil, fmt.Errorf("error getting SF list: %v", err)
+		}
+		sfNums := map[int]bool{}
+		for _, sf := range sfList {
+			sfNums[sf.SFNum] = true
+		}
+		if pfInfo.EswitchMode == "switchdev" {
+			for i := 0; i < sfsPerPF; i++ {
+				sfNums[sfNumBase+i] = true
+			}
+		}
+
+		for sfNum := range sfNums {
+			device := newSFDevice(pfInfo, sfNum)
+			logger.V(2).Info("Adding SF device to resource list", "deviceName", device.Name, "pf", pfInfo.NetName, "sfNum", sfNum)
+			resourceList[device.Name] = device
+			sfDevices[device.Name] = SFDevice{PFPciAddress: pfInfo.Address, PFName: pfInfo.NetName, SFNum: sfNum}
+		}
+		logger.Info("Found SFs for PF", "pf", pfInfo.NetName, "existing", len(sfList), "sfCount", len(sfNums))
+	}
+
+	return resourceList, sfDevices, nil
+}
+
+func newSFDevice(pfInfo PFInfo, sfNum int) resourceapi.Device {
+	device := resourceapi.Device{
+		Name: fmt.Sprintf("%s-sf-%d", deviceNameFromPciAddress(pfInfo.PciAddress), sfNum),
+		Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+			consts.AttributeVendorID: {
+				StringValue: ptr.To(pfInfo.VendorID),
+			},
+			consts.AttributePFDeviceID: {
+				StringValue: ptr.To(pfInfo.DeviceID),
+			},
+			// SFs share the PCI function of their PF
+			consts.AttributePciAddress: {
+				StringValue: ptr.To(pfInfo.PciAddress),
+			},
+			consts.AttributePFName: {
+				StringValue: ptr.To(pfInfo.NetName),
+			},
+			consts.AttributeEswitchMode: {
+				StringValue: ptr.To(pfInfo.EswitchMode),
+			},
+			consts.AttributeNumaNode: {
+				IntValue: numaNodeValue(pfInfo.NumaNode),
+			},
+			consts.AttributePCIeRoot: {
+				StringValue: ptr.To(pfInfo.PCIeRoot),
+			},
+			consts.AttributeParentPciAddress: {
+				StringValue: ptr.To(pfInfo.ParentPciAddress),
+			},
+			consts.AttributeDeviceType: {
+				StringValue: ptr.To(consts.DeviceTypeSF),
+			},
+			consts.AttributeSFNum: {
+				IntValue: ptr.To(int64(sfNum)),
+			},
+		},
+	}
+	setLinkAttributes(&device, pfInfo.Link)
+	setVendorAttributes(&device, pfInfo.VendorAttributes)
+	return device
+}
+
+// applyConfigOnSF prepares a scalable function: it is created if it doesn't exist yet and
+// its netdev is moved to the pod by the CNI of the net attach def, e.g. host-device.
+func (s *Manager) applyConfigOnSF(ctx context.Context, ifNameIndex *int, claim *resourceapi.ResourceClaim, config *configapi.VfConfig, result *resourceapi.DeviceRequestAllocationResult, sfDevice SFDevice) (*types.PreparedDevice, error) {
+	logger := klog.FromContext(ctx).WithName("applyConfigOnSF")
+
+	if config.Driver != "" || config.RDMA || config.GUID != "" || config.PKey != "" || config.AddVhostMount || config.Promiscuous {
+		return nil, fmt.Errorf("device %s is a scalable function, only the interface name and the net attach def can be configured", result.Device)
+	}
+	if config.NetAttachDefName == "" {
+		return nil, fmt.Errorf("no net attach def name set for scalable function %s", result.Device)
+	}
+
+	netAttachDefNamespace := claim.GetNamespace()
+	if config.NetAttachDefNamespace != "" {
+		netAttachDefNamespace = config.NetAttachDefNamespace
+	}
+	netAttachDefRawConfig, err := s.getNetAttachDefRawConfig(ctx, netAttachDefNamespace, config.NetAttachDefName)
+	if err != nil {
+		return nil, fmt.Errorf("error getting net attach def raw config: %w", err)
+	}
+
+	preparedSF, err := s.getOrCreateSF(result.Device, sfDevice)
+	if err != nil {
+		return nil, fmt.Errorf("error preparing scalable function %s: %w", result.Device, err)
+	}
+	netAttachDefRawConfig, err = types.SetDeviceInNetConf(netAttachDefRawConfig, preparedSF.NetName)
+	if err != nil {
+		if preparedSF.Created {
+			if err := s.deleteSF(result.Device, sfDevice.PFPciAddress, preparedSF.PortIndex); err != nil {
+				logger.Error(err, "Failed to delete scalable function", "device", result.Device)
+			}
+		}
+		return nil, fmt.Errorf("error setting device in net attach def config: %w", err)
+	}
+	logger.V(2).Info("Prepared scalable function", "device", result.Device, "auxDevice", preparedSF.AuxDevice, "netName", preparedSF.NetName, "created", preparedSF.Created)
+
+	edits := &cdispec.ContainerEdits{
+		Env: []string{
+			fmt.Sprintf("SRIOVNETWORK_SF_DEVICE_%s=%s", strings.ReplaceAll(result.Device, "-", "_"), preparedSF.AuxDevice),
+			fmt.Sprintf("SRIOVNETWORK_NET_ATTACH_DEF_NAME=%s", config.NetAttachDefName),
+		},
+	}
+
+	ifName := config.IfName
+	if ifName == "" {
+		ifName = fmt.Sprintf("%s%d", s.defaultInterfacePrefix, *ifNameIndex)
+		*ifNameIndex++
+	}
+
+	preparedDevice := &types.PreparedDevice{
+		ClaimNamespacedName: kubeletplugin.NamespacedObject{
+			NamespacedName: k8stypes.NamespacedName{
+				Name:      claim.Name,
+				Namespace: claim.Namespace,
+			},
+			UID: claim.UID,
+		},
+		Device: drapbv1.Device{
+			RequestNames: []string{result.Request},
+			PoolName:     result.Pool,
+			DeviceName:   result.Device,
+		},
+		ContainerEdits:     &cdiapi.ContainerEdits{ContainerEdits: edits},
+		NetAttachDefConfig: netAttachDefRawConfig,
+		IfName:             ifName,
+		PciAddress:         sfDevice.PFPciAddress,
+		PFName:             sfDevice.PFName,
+		PodUID:             string(claim.Status.ReservedFor[0].UID),
+		Config:             config,
+		SF:                 preparedSF,
+	}
+	preparedDevice.Device.CDIDeviceIDs = []string{
+		s.cdi.GetClaimDevices(string(claim.UID), preparedDevice.CDIDeviceName()),
+		s.cdi.GetPodSpecName(string(claim.Status.ReservedFor[0].UID)),
+	}
+	return preparedDevice, nil
+}
+
+// getOrCreateSF returns the SF if it exists on the host, or creates it. An SF created by an
+// earlier prepare and not deleted yet, e.g. when the rollback of a failed prepare failed, is
+// still reported as created so it is deleted on unprepare.
+func (s *Manager) getOrCreateSF(deviceName string, sfDevice SFDevice) (*types.PreparedSF, error) {
+	sfs, err := s.host.GetSFList(sfDevice.PFPciAddress)
+	if err != nil {
+		return nil, err
+	}
+	for _, sf := range sfs {
+		if sf.SFNum != sfDevice.SFNum {
+			continue
+		}
+		if sf.NetName == "" {
+			return nil, fmt.Errorf("SF %d of %s has no netdev, it must be active", sf.SFNum, sfDevice.PFPciAddress)
+		}
+		s.mutex.Lock()
+		portIndex, created := s.createdSFs[deviceName]
+		s.mutex.Unlock()
+		return &types.PreparedSF{AuxDevice: sf.AuxDevice, SFNum: sf.SFNum, NetName: sf.NetName, PortIndex: portIndex, Created: created}, nil
+	}
+
+	sf, err := s.host.CreateSF(sfDevice.PFPciAddress, sfDevice.SFNum)
+	if err != nil {
+		return nil, err
+	}
+	s.mutex.Lock()
+	if s.createdSFs == nil {
+		s.createdSFs = map[string]uint32{}
+	}
+	s.createdSFs[deviceName] = sf.PortIndex
+	s.mutex.Unlock()
+	return &types.PreparedSF{AuxDevice: sf.AuxDevice, SFNum: sf.SFNum, NetName: sf.NetName, PortIndex: sf.PortIndex, Created: true}, nil
+}
+
+// releaseSF deletes the SFs created when they were prepared
+func (s *Manager) releaseSF(logger klog.Logger, preparedDevice *types.PreparedDevice) error {
+	if !preparedDevice.SF.Created {
+		return nil
+	}
+	if err := s.deleteSF(preparedDevice.Device.DeviceName, preparedDevice.PciAddress, preparedDevice.SF.PortIndex); err != nil {
+		return fmt.Errorf("failed to delete scalable function %s: %w", preparedDevice.Device.DeviceName, err)
+	}
+	logger.V(2).Info("Deleted scalable function", "device", preparedDevice.Device.DeviceName, "auxDevice", preparedDevice.SF.AuxDevice)
+	return nil
+}
+
+// deleteSF deletes an SF created on prepare and forgets it once deleted
+func (s *Manager) deleteSF(deviceName, pfPciAddress string, portIndex uint32) error {
+	if err := s.host.DeleteSF(pfPciAddress, portIndex); err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	delete(s.createdSFs, deviceName)
+	s.mutex.Unlock()
+	return nil
+}
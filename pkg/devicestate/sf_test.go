@@ -0,0 +1,219 @@
+package devicestate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/jaypipes/ghw/pkg/pci"
+	"github.com/jaypipes/pcidb"
+	netattdefv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+	resourceapi "k8s.io/api/resource/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	configapi "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/virtualfunction/v1alpha1"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/cdi"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/flags"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host"
+	mock_host "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host/mock"
+	drasriovtypes "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
+)
+
+var _ = Describe("Scalable functions", func() {
+	var (
+		mockCtrl *gomock.Controller
+		mockHost *mock_host.MockInterface
+	)
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+		mockHost = mock_host.NewMockInterface(mockCtrl)
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+	})
+
+	Context("DiscoverSFDevices", func() {
+		expectPF := func(address, netName, eswitchMode string) {
+			mockHost.EXPECT().IsSriovVF(address).Return(false)
+			mockHost.EXPECT().TryGetInterfaceName(address).Return(netName)
+			mockHost.EXPECT().GetNicSriovMode(address).Return(eswitchMode)
+			mockHost.EXPECT().GetNumaNode(address).Return("0", nil)
+			mockHost.EXPECT().GetPCIeRoot(address).Return("pci0000:00", nil)
+			mockHost.EXPECT().GetParentPciAddress(address).Return("0000:00:01.0", nil)
+			mockHost.EXPECT().GetRDMADevice(address).Return("", nil)
+			mockHost.EXPECT().GetLinkInfo(netName).Return(&host.LinkInfo{Speed: 25000, MTU: 1500, OperState: "up", Carrier: true}, nil)
+		}
+
+		BeforeEach(func() {
+			mockHost.EXPECT().PCI().Return(&pci.Info{
+				Devices: []*pci.Device{
+					{Address: "0000:01:00.0", Class: &pcidb.Class{ID: "02"}, Vendor: &pcidb.Vendor{ID: "15b3"}, Product: &pcidb.Product{ID: "101d"}},
+					{Address: "0000:02:00.0", Class: &pcidb.Class{ID: "02"}, Vendor: &pcidb.Vendor{ID: "15b3"}, Product: &pcidb.Product{ID: "101d"}},
+				},
+			}, nil)
+			expectPF("0000:01:00.0", "eth0", "switchdev")
+			expectPF("0000:02:00.0", "eth1", "legacy")
+		})
+
+		It("publishes the existing SFs and the SFs created on demand for switchdev PFs", func() {
+			mockHost.EXPECT().GetSFList("0000:01:00.0").Return([]host.SFInfo{{AuxDevice: "mlx5_core.sf.2", SFNum: 1, NetName: "enp1s0f0s1"}}, nil)
+			mockHost.EXPECT().GetSFList("0000:02:00.0").Return(nil, nil)
+
+			devices, sfDevices, err := DiscoverSFDevices(mockHost, 2)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(devices).To(HaveLen(3))
+			Expect(devices).To(HaveKey("0000-01-00-0-sf-1"))
+			Expect(devices).To(HaveKey("0000-01-00-0-sf-1000"))
+			Expect(devices).To(HaveKey("0000-01-00-0-sf-1001"))
+			Expect(sfDevices["0000-01-00-0-sf-1000"]).To(Equal(SFDevice{PFPciAddress: "0000:01:00.0", PFName: "eth0", SFNum: 1000}))
+
+			sf := devices["0000-01-00-0-sf-1"]
+			Expect(sf.Attributes[consts.AttributeDeviceType].StringValue).To(Equal(ptr.To(consts.DeviceTypeSF)))
+			Expect(sf.Attributes[consts.AttributeSFNum].IntValue).To(Equal(ptr.To(int64(1))))
+			Expect(sf.Attributes[consts.AttributePciAddress].StringValue).To(Equal(ptr.To("0000:01:00.0")))
+			Expect(sf.Attributes[consts.AttributePFName].StringValue).To(Equal(ptr.To("eth0")))
+		})
+
+		It("fails when the SFs of a PF can't be listed", func() {
+			mockHost.EXPECT().GetSFList("0000:01:00.0").Return(nil, errors.New("boom"))
+
+			_, _, err := DiscoverSFDevices(mockHost, 0)
+			Expect(err).To(MatchError(ContainSubstring("error getting SF list")))
+		})
+	})
+
+	Context("prepare and unprepare", func() {
+		var (
+			s      *Manager
+			claim  *resourceapi.ResourceClaim
+			result *resourceapi.DeviceRequestAllocationResult
+		)
+
+		BeforeEach(func() {
+			cdiHandler, err := cdi.NewHandler(GinkgoT().TempDir())
+			Expect(err).NotTo(HaveOccurred())
+			nad := &netattdefv1.NetworkAttachmentDefinition{
+				ObjectMeta: metav1.ObjectMeta{Name: "sf", Namespace: "default"},
+				Spec:       netattdefv1.NetworkAttachmentDefinitionSpec{Config: `{"type":"host-device"}`},
+			}
+			s = &Manager{
+				host: mockHost,
+				k8sClient: flags.ClientSets{
+					Client: fake.NewClientBuilder().WithScheme(flags.Scheme).WithObjects(nad).Build(),
+				},
+				cdi:                    cdiHandler,
+				defaultInterfacePrefix: "net",
+				allocatable: drasriovtypes.AllocatableDevices{
+					"0000-01-00-0-sf-1":    {Name: "0000-01-00-0-sf-1"},
+					"0000-01-00-0-sf-1000": {Name: "0000-01-00-0-sf-1000"},
+				},
+				sfDevices: SFDevices{
+					"0000-01-00-0-sf-1":    {PFPciAddress: "0000:01:00.0", PFName: "eth0", SFNum: 1},
+					"0000-01-00-0-sf-1000": {PFPciAddress: "0000:01:00.0", PFName: "eth0", SFNum: 1000},
+				},
+			}
+			claim = &resourceapi.ResourceClaim{
+				ObjectMeta: metav1.ObjectMeta{Name: "claim1", Namespace: "default", UID: "claim1"},
+				Status: resourceapi.ResourceClaimStatus{
+					ReservedFor: []resourceapi.ResourceClaimConsumerReference{{Name: "pod", UID: "pod-uid"}},
+				},
+			}
+			result = &resourceapi.DeviceRequestAllocationResult{Request: "req", Driver: consts.DriverName, Pool: "node1", Device: "0000-01-00-0-sf-1"}
+		})
+
+		It("prepares an existing SF and keeps it on unprepare", func() {
+			mockHost.EXPECT().GetSFList("0000:01:00.0").Return([]host.SFInfo{{AuxDevice: "mlx5_core.sf.2", SFNum: 1, NetName: "enp1s0f0s1"}}, nil)
+
+			ifNameIndex := 0
+			prepared, err := s.applyConfigOnDevice(context.Background(), &ifNameIndex, claim, &configapi.VfConfig{NetAttachDefName: "sf"}, result)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(prepared.SF).To(Equal(&drasriovtypes.PreparedSF{AuxDevice: "mlx5_core.sf.2", SFNum: 1, NetName: "enp1s0f0s1"}))
+			Expect(prepared.IfName).To(Equal("net0"))
+			Expect(prepared.PciAddress).To(Equal("0000:01:00.0"))
+			Expect(prepared.ContainerEdits.Env).To(ContainElement("SRIOVNETWORK_SF_DEVICE_0000_01_00_0_sf_1=mlx5_core.sf.2"))
+			Expect(prepared.NewDeviceStatusData().AuxDevice).To(Equal("mlx5_core.sf.2"))
+
+			netConf := map[string]interface{}{}
+			Expect(json.Unmarshal([]byte(prepared.NetAttachDefConfig), &netConf)).To(Succeed())
+			Expect(netConf["device"]).To(Equal("enp1s0f0s1"))
+
+			Expect(s.unprepareDevices(drasriovtypes.PreparedDevices{prepared})).To(Succeed())
+		})
+
+		It("creates a missing SF and deletes it on unprepare", func() {
+			result.Device = "0000-01-00-0-sf-1000"
+			mockHost.EXPECT().GetSFList("0000:01:00.0").Return(nil, nil)
+			mockHost.EXPECT().CreateSF("0000:01:00.0", 1000).Return(&host.SFInfo{AuxDevice: "mlx5_core.sf.3", SFNum: 1000, NetName: "enp1s0f0s1000", PortIndex: 32768}, nil)
+
+			ifNameIndex := 0
+			prepared, err := s.applyConfigOnDevice(context.Background(), &ifNameIndex, claim, &configapi.VfConfig{NetAttachDefName: "sf", IfName: "sf0"}, result)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(prepared.SF.Created).To(BeTrue())
+			Expect(prepared.SF.PortIndex).To(Equal(uint32(32768)))
+			Expect(prepared.IfName).To(Equal("sf0"))
+
+			mockHost.EXPECT().DeleteSF("0000:01:00.0", uint32(32768)).Return(nil)
+			Expect(s.unprepareDevices(drasriovtypes.PreparedDevices{prepared})).To(Succeed())
+		})
+
+		It("deletes the SFs created for the claim when a later device fails", func() {
+			claim.Status.Allocation = &resourceapi.AllocationResult{Devices: resourceapi.DeviceAllocationResult{
+				Results: []resourceapi.DeviceRequestAllocationResult{
+					{Request: "sf", Driver: consts.DriverName, Pool: "node1", Device: "0000-01-00-0-sf-1000"},
+					{Request: "other", Driver: consts.DriverName, Pool: "node1", Device: "0000-01-00-0-sf-1"},
+				},
+			}}
+			resultsConfig := map[string]*configapi.VfConfig{"sf": {NetAttachDefName: "sf"}}
+			mockHost.EXPECT().GetSFList("0000:01:00.0").Return(nil, nil)
+			mockHost.EXPECT().CreateSF("0000:01:00.0", 1000).Return(&host.SFInfo{AuxDevice: "mlx5_core.sf.3", SFNum: 1000, NetName: "enp1s0f0s1000", PortIndex: 32768}, nil)
+			mockHost.EXPECT().DeleteSF("0000:01:00.0", uint32(32768)).Return(nil)
+
+			ifNameIndex := 0
+			_, err := s.prepareDevices(context.Background(), &ifNameIndex, claim, resultsConfig, nil)
+			Expect(err).To(MatchError(ContainSubstring("config not found for request: other")))
+			Expect(s.createdSFs).To(BeEmpty())
+		})
+
+		It("deletes an SF created by a failed prepare on the unprepare of the retry", func() {
+			result.Device = "0000-01-00-0-sf-1000"
+			claim.Status.Allocation = &resourceapi.AllocationResult{Devices: resourceapi.DeviceAllocationResult{
+				Results: []resourceapi.DeviceRequestAllocationResult{*result, {Request: "other", Driver: consts.DriverName, Pool: "node1", Device: "0000-01-00-0-sf-1"}},
+			}}
+			resultsConfig := map[string]*configapi.VfConfig{"req": {NetAttachDefName: "sf"}}
+			mockHost.EXPECT().GetSFList("0000:01:00.0").Return(nil, nil)
+			mockHost.EXPECT().CreateSF("0000:01:00.0", 1000).Return(&host.SFInfo{AuxDevice: "mlx5_core.sf.3", SFNum: 1000, NetName: "enp1s0f0s1000", PortIndex: 32768}, nil)
+			mockHost.EXPECT().DeleteSF("0000:01:00.0", uint32(32768)).Return(errors.New("busy"))
+
+			ifNameIndex := 0
+			_, err := s.prepareDevices(context.Background(), &ifNameIndex, claim, resultsConfig, nil)
+			Expect(err).To(HaveOccurred())
+
+			mockHost.EXPECT().GetSFList("0000:01:00.0").Return([]host.SFInfo{{AuxDevice: "mlx5_core.sf.3", SFNum: 1000, NetName: "enp1s0f0s1000"}}, nil)
+			prepared, err := s.applyConfigOnDevice(context.Background(), &ifNameIndex, claim, &configapi.VfConfig{NetAttachDefName: "sf"}, result)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(prepared.SF.Created).To(BeTrue())
+			Expect(prepared.SF.PortIndex).To(Equal(uint32(32768)))
+
+			mockHost.EXPECT().DeleteSF("0000:01:00.0", uint32(32768)).Return(nil)
+			Expect(s.unprepareDevices(drasriovtypes.PreparedDevices{prepared})).To(Succeed())
+			Expect(s.createdSFs).To(BeEmpty())
+		})
+
+		It("rejects VF only settings and a missing net attach def", func() {
+			ifNameIndex := 0
+			_, err := s.applyConfigOnDevice(context.Background(), &ifNameIndex, claim, &configapi.VfConfig{NetAttachDefName: "sf", Driver: "vfio-pci"}, result)
+			Expect(err).To(MatchError(ContainSubstring("is a scalable function")))
+
+			_, err = s.applyConfigOnDevice(context.Background(), &ifNameIndex, claim, &configapi.VfConfig{}, result)
+			Expect(err).To(MatchError(ContainSubstring("no net attach def name set")))
+		})
+	})
+})
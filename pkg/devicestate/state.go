@@ -2,75 +2,355 @@ package devicestate
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"maps"
 	"strings"
+	"sync"
 
 	configapi "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/virtualfunction/v1alpha1"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/audit"
 	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/cdi"
 	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
 	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/flags"
 	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host"
 	drasriovtypes "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/vendors"
 	netattdefv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	corev1 "k8s.io/api/core/v1"
 	resourceapi "k8s.io/api/resource/v1"
-	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/api/resource"
 	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/dynamic-resource-allocation/kubeletplugin"
 	"k8s.io/klog/v2"
 	drapbv1 "k8s.io/kubelet/pkg/apis/dra/v1beta1"
+	"k8s.io/utils/ptr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	cdiapi "tags.cncf.io/container-device-interface/pkg/cdi"
 	cdispec "tags.cncf.io/container-device-interface/specs-go"
 )
 
+// Manager tracks the devices of the node and prepares them for the claims. It is safe for
+// concurrent use by the kubelet plugin, the controller and the background loops.
 type Manager struct {
-	k8sClient              flags.ClientSets
-	cdi                    *cdi.Handler
-	defaultInterfacePrefix string
-	allocatable            drasriovtypes.AllocatableDevices
-	republishCallback      func(context.Context) error
+	k8sClient                 flags.ClientSets
+	host                      host.Interface
+	cdi                       *cdi.Handler
+	defaultInterfacePrefix    string
+	rejectKernelVfHostNetwork bool
+	allocatable               drasriovtypes.AllocatableDevices
+	sharedVFs                 SharedVFs
+	sharedVFsInUse            map[string]k8stypes.UID // VF PCI address to claim UID
+	republishCallback         func(context.Context) error
+	// mutex guards the allocatable devices, updated by the controller and the background
+	// checks while the kubelet plugin reads them, and the devices in use
+	mutex sync.Mutex
+	// deviceLocks serializes the prepare and unprepare of the claims using the same device
+	deviceLocks  deviceLocks
+	aerCounters  map[string]host.AERCounters // PCI address to last seen AER counters
+	bindFailures map[string]string           // device name to bind error
+	// fatalPCIErrors are the PCI addresses of the devices that reported a fatal AER error
+	// since they were last reset
+	fatalPCIErrors sets.Set[string]
+	// healthSubscribers are notified when the health of a device changes
+	healthSubscribers map[chan struct{}]struct{}
+	// guidPool hands out the GUIDs of InfiniBand VFs, nil when no pool is configured
+	guidPool *GUIDPool
+	// sfDevices are the published scalable functions, createdSFs the devlink port index of
+	// the SFs created on prepare and not deleted yet by device name, guarded by mutex
+	sfDevices  SFDevices
+	createdSFs map[string]uint32
+	// hostDevicePolicy and hostDeviceDenylist exclude the devices used by the host system,
+	// hostDevices are the devices withdrawn by the skip policy and hostUsedVFs the VFs of PF
+	// shares used by the host since the start of the plugin, guarded by mutex
+	hostDevicePolicy   string
+	hostDeviceDenylist sets.Set[string]
+	hostDevices        drasriovtypes.AllocatableDevices
+	hostUsedVFs        sets.Set[string]
+	// resourceConfigs are the default VfConfigs of the resource names of the resource filter
+	resourceConfigs map[string]*configapi.VfConfig
+	// preBindDrivers are the drivers the idle devices of the resource names are pre-bound to,
+	// preBound the driver of the devices pre-bound, devicesInUse the claim UID of the devices
+	// prepared by this instance and checkpointDevicesInUse the claim UID of the devices of the
+	// checkpoint, prepared by any instance, which are all excluded from the pre-binding. The
+	// devices of the checkpoint are replaced on every sync with it. Guarded by mutex.
+	preBindDrivers         map[string]string
+	preBound               map[string]string
+	devicesInUse           map[string]k8stypes.UID
+	checkpointDevicesInUse map[string]k8stypes.UID
+	// preBindTrigger wakes up WatchPreBind when the pre-bind drivers change
+	preBindTrigger chan struct{}
+	// sanitizeSteps are the steps sanitizing the VFs after unprepare, sanitizeFailures the
+	// VFs that failed them by PCI address, guarded by mutex. The failures are saved to
+	// sanitizeFailuresPath, sanitizeFailuresFileMutex orders the writes.
+	sanitizeSteps             []string
+	sanitizeFailures          map[string]*drasriovtypes.PreparedDevice
+	sanitizeFailuresPath      string
+	sanitizeFailuresFileMutex sync.Mutex
+	// auditLog records the prepared and unprepared devices and the resource name changes
+	auditLog *audit.Logger
+	// preparedDevicesLister lists the prepared devices of all the instances of the plugin
+	// during a rolling update, nil otherwise
+	preparedDevicesLister func() drasriovtypes.PreparedDevices
+	// activeInstance elects the instance running the background device changes during a
+	// rolling update, nil otherwise
+	activeInstance *ActiveInstance
 }
 
-func NewManager(config *drasriovtypes.Config, cdi *cdi.Handler) (*Manager, error) {
-	allocatable, err := DiscoverSriovDevices()
+// NewManager discovers the devices of the node and restores the state of the devices prepared
+// by the claims of the checkpoint, which are excluded from the host usage check.
+func NewManager(config *drasriovtypes.Config, h host.Interface, cdi *cdi.Handler, preparedDevices drasriovtypes.PreparedDevices) (*Manager, error) {
+	var allocatable drasriovtypes.AllocatableDevices
+	sharedVFs := SharedVFs{}
+	var err error
+	if config.Flags.PFBandwidthMode {
+		allocatable, sharedVFs, err = DiscoverBandwidthDevices(h)
+	} else {
+		allocatable, err = DiscoverSriovDevices(h)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("error enumerating all possible devices: %v", err)
 	}
+	prepared := sets.New[string]()
+	for _, preparedDevice := range preparedDevices {
+		prepared.Insert(preparedDevice.PciAddress)
+	}
+	denylist := hostDeviceDenylist(config)
+	hostDevices := excludeHostDevices(h, allocatable, sharedVFs, config.Flags.HostDevicePolicy, denylist, prepared)
+
+	sfDevices := SFDevices{}
+	if config.Flags.PublishSFs {
+		var sfAllocatable drasriovtypes.AllocatableDevices
+		sfAllocatable, sfDevices, err = DiscoverSFDevices(h, config.Flags.SFsPerPF)
+		if err != nil {
+			return nil, fmt.Errorf("error enumerating scalable functions: %v", err)
+		}
+		for name, device := range sfAllocatable {
+			allocatable[name] = device
+		}
+	}
+
+	guidPool, err := NewGUIDPool(config.Flags.IBGUIDPool)
+	if err != nil {
+		return nil, err
+	}
+
+	// the VFs that failed to be sanitized before a restart stay tainted until the health check
+	// sanitizes them
+	sanitizeFailures, err := loadSanitizeFailures(config.SanitizeFailuresPath())
+	if err != nil {
+		return nil, err
+	}
+	taintSanitizeFailures(allocatable, sanitizeFailures)
 
 	state := &Manager{
-		k8sClient:              config.K8sClient,
-		defaultInterfacePrefix: config.Flags.DefaultInterfacePrefix,
-		cdi:                    cdi,
-		allocatable:            allocatable,
+		k8sClient:                 config.K8sClient,
+		host:                      h,
+		defaultInterfacePrefix:    config.Flags.DefaultInterfacePrefix,
+		rejectKernelVfHostNetwork: config.Flags.RejectKernelVfHostNetwork,
+		cdi:                       cdi,
+		allocatable:               allocatable,
+		sharedVFs:                 sharedVFs,
+		sharedVFsInUse:            map[string]k8stypes.UID{},
+		aerCounters:               map[string]host.AERCounters{},
+		fatalPCIErrors:            sets.New[string](),
+		bindFailures:              map[string]string{},
+		guidPool:                  guidPool,
+		sfDevices:                 sfDevices,
+		hostDevicePolicy:          config.Flags.HostDevicePolicy,
+		hostDeviceDenylist:        denylist,
+		hostDevices:               hostDevices,
+		hostUsedVFs:               sets.New[string](),
+		preBound:                  map[string]string{},
+		devicesInUse:              map[string]k8stypes.UID{},
+		checkpointDevicesInUse:    map[string]k8stypes.UID{},
+		preBindTrigger:            make(chan struct{}, 1),
+		sanitizeSteps:             config.Flags.VFSanitizeSteps,
+		sanitizeFailures:          sanitizeFailures,
+		sanitizeFailuresPath:      config.SanitizeFailuresPath(),
+		auditLog:                  config.AuditLogger,
 	}
+	state.RestorePreparedDevices(preparedDevices)
 
 	return state, nil
 }
 
-// GetAllocatableDevices returns the allocatable devices
+// RestorePreparedDevices marks the VFs handed out to shares of PF devices and the GUIDs
+// set on InfiniBand VFs by previously prepared claims as in use, so they are not picked
+// again after a restart. The other prepared devices are excluded from the pre-binding.
+func (s *Manager) RestorePreparedDevices(preparedDevices drasriovtypes.PreparedDevices) {
+	devicesInUse, sharedVFsInUse, guids := s.preparedDevicesInUse(preparedDevices)
+	s.mutex.Lock()
+	if s.sharedVFsInUse == nil {
+		s.sharedVFsInUse = map[string]k8stypes.UID{}
+	}
+	s.checkpointDevicesInUse = devicesInUse
+	maps.Copy(s.sharedVFsInUse, sharedVFsInUse)
+	s.mutex.Unlock()
+	for guid, claimUID := range guids {
+		if err := s.guidPool.Reserve(guid, claimUID); err != nil {
+			klog.ErrorS(err, "Failed to restore GUID of prepared device", "guid", guid)
+		}
+	}
+}
+
+// SyncPreparedDevices replaces the VFs, devices and GUIDs of the checkpoint marked as in use
+// with the ones of the prepared devices, the other instance of the plugin may have prepared or
+// unprepared claims during a rolling update. The new reservations are swapped in at once, so no
+// VF or GUID in use is handed out meanwhile. It must not run concurrently with a prepare or
+// unprepare.
+func (s *Manager) SyncPreparedDevices(preparedDevices drasriovtypes.PreparedDevices) {
+	devicesInUse, sharedVFsInUse, guids := s.preparedDevicesInUse(preparedDevices)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.checkpointDevicesInUse = devicesInUse
+	s.sharedVFsInUse = sharedVFsInUse
+	if err := s.guidPool.Replace(guids); err != nil {
+		klog.ErrorS(err, "Failed to restore GUIDs of prepared devices")
+	}
+}
+
+// preparedDevicesInUse returns the devices excluded from the pre-binding, the VFs handed out to
+// shares of PF devices and the GUIDs of the prepared devices, by claim UID
+func (s *Manager) preparedDevicesInUse(preparedDevices drasriovtypes.PreparedDevices) (map[string]k8stypes.UID, map[string]k8stypes.UID, map[string]k8stypes.UID) {
+	devicesInUse := map[string]k8stypes.UID{}
+	sharedVFsInUse := map[string]k8stypes.UID{}
+	guids := map[string]k8stypes.UID{}
+	for _, preparedDevice := range preparedDevices {
+		claimUID := preparedDevice.ClaimNamespacedName.UID
+		if _, shared := s.sharedVFs[preparedDevice.Device.DeviceName]; shared {
+			sharedVFsInUse[preparedDevice.PciAddress] = claimUID
+		} else if preparedDevice.SF == nil {
+			devicesInUse[preparedDevice.Device.DeviceName] = claimUID
+		}
+		if preparedDevice.GUID != "" {
+			guids[preparedDevice.GUID] = claimUID
+		}
+	}
+	return devicesInUse, sharedVFsInUse, guids
+}
+
+// assignSharedVF picks a free VF for an allocation share of a PF device
+func (s *Manager) assignSharedVF(claimUID k8stypes.UID, vfs []host.VFInfo) (host.VFInfo, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, vf := range vfs {
+		if _, inUse := s.sharedVFsInUse[vf.PciAddress]; !inUse && !s.hostUsedVFs.Has(vf.PciAddress) {
+			s.sharedVFsInUse[vf.PciAddress] = claimUID
+			return vf, nil
+		}
+	}
+	return host.VFInfo{}, fmt.Errorf("no free VF left")
+}
+
+// releaseSharedVFs frees the VFs assigned to the shares of a claim
+func (s *Manager) releaseSharedVFs(claimUID k8stypes.UID) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for pciAddress, uid := range s.sharedVFsInUse {
+		if uid == claimUID {
+			delete(s.sharedVFsInUse, pciAddress)
+		}
+	}
+}
+
+// GetAllocatableDevices returns a snapshot of the allocatable devices, the caller owns it and
+// doesn't see the later updates
 func (s *Manager) GetAllocatableDevices() drasriovtypes.AllocatableDevices {
-	return s.allocatable
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	devices := make(drasriovtypes.AllocatableDevices, len(s.allocatable))
+	for deviceName, device := range s.allocatable {
+		devices[deviceName] = *device.DeepCopy()
+	}
+	return devices
 }
 
+// GetAllocatedDeviceByDeviceName returns a copy of an allocatable device
 func (s *Manager) GetAllocatedDeviceByDeviceName(deviceName string) (resourceapi.Device, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 	device, exist := s.allocatable[deviceName]
-	return device, exist
+	if !exist {
+		return device, false
+	}
+	return *device.DeepCopy(), true
+}
+
+// getRepublishCallback returns the callback republishing the resources, nil if not set yet
+func (s *Manager) getRepublishCallback() func(context.Context) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.republishCallback
 }
 
 // PrepareDevicesForClaim prepares the devices for a given claim
 // It will return the prepared devices for the claim
 func (s *Manager) PrepareDevicesForClaim(ctx context.Context, ifNameIndex *int, claim *resourceapi.ResourceClaim) (drasriovtypes.PreparedDevices, error) {
+	var deviceNames []string
+	if claim.Status.Allocation != nil {
+		for _, result := range claim.Status.Allocation.Devices.Results {
+			if result.Driver == consts.DriverName {
+				deviceNames = append(deviceNames, result.Device)
+			}
+		}
+	}
+	unlock := s.deviceLocks.lock(deviceNames...)
+	preparedDevices, err := s.prepareDevicesForClaim(ctx, ifNameIndex, claim)
+	unlock()
+	if err != nil {
+		s.auditLog.Record(claimAuditFields(claim).Event(audit.OperationPrepare), err)
+		return nil, err
+	}
+	for _, preparedDevice := range preparedDevices {
+		s.auditLog.Record(preparedDevice.AuditEvent(audit.OperationPrepare), nil)
+	}
+	return preparedDevices, nil
+}
+
+// claimAuditFields returns the claim and its pod, recorded with the host operations done to
+// prepare it
+func claimAuditFields(claim *resourceapi.ResourceClaim) audit.Fields {
+	fields := audit.Fields{ClaimUID: string(claim.UID), Claim: claim.Namespace + "/" + claim.Name}
+	if len(claim.Status.ReservedFor) > 0 {
+		fields.PodUID = string(claim.Status.ReservedFor[0].UID)
+	}
+	return fields
+}
+
+func (s *Manager) prepareDevicesForClaim(ctx context.Context, ifNameIndex *int, claim *resourceapi.ResourceClaim) (drasriovtypes.PreparedDevices, error) {
 	logger := klog.FromContext(ctx).WithName("PrepareDevicesForClaim")
 
-	resultsConfig, err := getMapOfOpaqueDeviceConfigForDevice(configapi.Decoder, claim.Status.Allocation.Devices.Config)
+	defaultConfigs, err := s.getResourceDefaultConfigs(claim)
+	if err != nil {
+		logger.Error(err, "failed to get the default configs of the resources", "claim", claim.UID)
+		return nil, fmt.Errorf("error getting default configs: %v", err)
+	}
+
+	resultsConfig, err := getMapOfOpaqueDeviceConfigForDevice(configapi.Decoder, claim.Status.Allocation.Devices.Config, defaultConfigs)
 	if err != nil {
 		logger.Error(err, "failed to create map of opaque device config for device", "claim", *claim)
 		return nil, fmt.Errorf("error creating map of opaque device config for device: %v", err)
 	}
 
-	preparedDevices, err := s.prepareDevices(ctx, ifNameIndex, claim, resultsConfig)
+	bondConfigs, err := getBondConfigs(configapi.Decoder, claim.Status.Allocation.Devices.Config)
 	if err != nil {
+		logger.Error(err, "failed to get bond configs", "claim", claim.UID)
+		return nil, fmt.Errorf("error getting bond configs: %v", err)
+	}
+
+	if s.rejectKernelVfHostNetwork {
+		if err := s.validateHostNetworkPod(ctx, claim, resultsConfig); err != nil {
+			logger.Error(err, "Prepare rejected", "claim", claim.UID)
+			return nil, err
+		}
+	}
+
+	preparedDevices, err := s.prepareDevices(ctx, ifNameIndex, claim, resultsConfig, bondConfigs)
+	if err != nil {
+		s.releaseSharedVFs(claim.UID)
+		s.releaseDevices(claim.UID)
+		s.guidPool.Release(claim.UID)
 		logger.Error(err, "Prepare failed", "claim", *claim)
 		return nil, fmt.Errorf("prepare failed: %v", err)
 	}
@@ -80,15 +360,48 @@ func (s *Manager) PrepareDevicesForClaim(ctx context.Context, ifNameIndex *int,
 	}
 
 	if err = s.cdi.CreateClaimSpecFile(preparedDevices); err != nil {
+		s.rollbackDevices(logger, preparedDevices)
+		s.releaseSharedVFs(claim.UID)
+		s.releaseDevices(claim.UID)
+		s.guidPool.Release(claim.UID)
 		return nil, fmt.Errorf("unable to create CDI spec file for claim: %v", err)
 	}
 
 	return preparedDevices, nil
 }
 
+// validateHostNetworkPod rejects claims that request a VF with a kernel driver for a host network pod.
+// Such a VF netdev is never moved into a pod network namespace and stays visible on the host.
+func (s *Manager) validateHostNetworkPod(ctx context.Context, claim *resourceapi.ResourceClaim, resultsConfig map[string]*configapi.VfConfig) error {
+	podRef := claim.Status.ReservedFor[0]
+	pod := &corev1.Pod{}
+	if err := s.k8sClient.Get(ctx, client.ObjectKey{Name: podRef.Name, Namespace: claim.Namespace}, pod); err != nil {
+		return fmt.Errorf("error getting pod %s/%s: %w", claim.Namespace, podRef.Name, err)
+	}
+	if !pod.Spec.HostNetwork {
+		return nil
+	}
+
+	for _, result := range claim.Status.Allocation.Devices.Results {
+		if result.Driver != consts.DriverName {
+			continue
+		}
+		config, ok := resultsConfig[result.Request]
+		if !ok {
+			continue
+		}
+		if !s.host.IsDpdkDriver(config.Driver) {
+			return fmt.Errorf("device %s for request %s uses a kernel driver and can't be used by host network pod %s/%s",
+				result.Device, result.Request, claim.Namespace, podRef.Name)
+		}
+	}
+	return nil
+}
+
 func (s *Manager) prepareDevices(ctx context.Context, ifNameIndex *int,
 	claim *resourceapi.ResourceClaim,
-	resultsConfig map[string]*configapi.VfConfig) (drasriovtypes.PreparedDevices, error) {
+	resultsConfig map[string]*configapi.VfConfig,
+	bondConfigs []*drasriovtypes.OpaqueDeviceConfig) (drasriovtypes.PreparedDevices, error) {
 	logger := klog.FromContext(ctx).WithName("prepareDevices")
 	preparedDevices := drasriovtypes.PreparedDevices{}
 	for _, result := range claim.Status.Allocation.Devices.Results {
@@ -98,6 +411,7 @@ func (s *Manager) prepareDevices(ctx context.Context, ifNameIndex *int,
 
 		config, ok := resultsConfig[result.Request]
 		if !ok {
+			s.rollbackDevices(logger, preparedDevices)
 			return nil, fmt.Errorf("config not found for request: %s", result.Request)
 		}
 
@@ -107,22 +421,36 @@ func (s *Manager) prepareDevices(ctx context.Context, ifNameIndex *int,
 		preparedDevice, err := s.applyConfigOnDevice(ctx, ifNameIndex, claim, config, &result)
 		if err != nil {
 			logger.Error(err, "error applying config on device", "config", config, "result", result)
+			s.rollbackDevices(logger, preparedDevices)
 			return nil, fmt.Errorf("error applying config on device: %v", err)
 		}
+		preparedDevices = append(preparedDevices, preparedDevice)
+	}
 
-		rawConfig, err := json.Marshal(config)
+	if err := s.prepareBonds(ctx, claim, bondConfigs, preparedDevices); err != nil {
+		logger.Error(err, "error preparing bonds", "claim", claim.UID)
+		s.rollbackDevices(logger, preparedDevices)
+		return nil, fmt.Errorf("error preparing bonds: %v", err)
+	}
+
+	for _, preparedDevice := range preparedDevices {
+		statusData, err := preparedDevice.NewDeviceStatusData().ToRawExtension()
 		if err != nil {
-			logger.Error(err, "error marshalling config", "config", config)
-			rawConfig = []byte("{}")
-		}
-		// Add applied config to device
-		claim.Status.Devices = append(claim.Status.Devices, resourceapi.AllocatedDeviceStatus{
-			Device: result.Device,
-			Pool:   result.Pool,
-			Driver: result.Driver,
-			Data:   &runtime.RawExtension{Raw: rawConfig},
-		})
-		preparedDevices = append(preparedDevices, preparedDevice)
+			logger.Error(err, "error encoding device status data", "device", preparedDevice.Device.DeviceName)
+			s.rollbackDevices(logger, preparedDevices)
+			return nil, fmt.Errorf("error encoding device status data: %v", err)
+		}
+		// Add the device status data to the claim
+		deviceStatus := resourceapi.AllocatedDeviceStatus{
+			Device: preparedDevice.Device.DeviceName,
+			Pool:   preparedDevice.Device.PoolName,
+			Driver: consts.DriverName,
+			Data:   statusData,
+		}
+		if preparedDevice.ShareID != "" {
+			deviceStatus.ShareID = ptr.To(preparedDevice.ShareID)
+		}
+		claim.Status.Devices = append(claim.Status.Devices, deviceStatus)
 	}
 
 	logger.V(3).Info("Prepared devices", "preparedDevices", preparedDevices)
@@ -132,42 +460,147 @@ func (s *Manager) prepareDevices(ctx context.Context, ifNameIndex *int,
 func (s *Manager) applyConfigOnDevice(ctx context.Context, ifNameIndex *int, claim *resourceapi.ResourceClaim, config *configapi.VfConfig, result *resourceapi.DeviceRequestAllocationResult) (*drasriovtypes.PreparedDevice, error) {
 	logger := klog.FromContext(ctx).WithName("applyConfigOnDevice")
 	logger.V(3).Info("Applying config on device", "config", config, "result", result)
-	deviceInfo, exist := s.allocatable[result.Device]
+	deviceInfo, exist := s.GetAllocatedDeviceByDeviceName(result.Device)
 	if !exist {
 		return nil, fmt.Errorf("device %s not found in allocatable devices", result.Device)
 	}
+	if sfDevice, isSF := s.sfDevices[result.Device]; isSF {
+		return s.applyConfigOnSF(ctx, ifNameIndex, claim, config, result, sfDevice)
+	}
 
 	netAttachDefNamespace := claim.GetNamespace()
 	if config.NetAttachDefNamespace != "" {
 		netAttachDefNamespace = config.NetAttachDefNamespace
 	}
 
-	netAttachDefRawConfig, err := s.getNetAttachDefRawConfig(ctx, netAttachDefNamespace, config.NetAttachDefName)
-	if err != nil {
-		return nil, fmt.Errorf("error getting net attach def raw config: %w", err)
-	}
-	// add to sriov-cni compatible netconf the deviceID (PCI address)
 	pciAddress := *deviceInfo.Attributes[consts.AttributePciAddress].StringValue
-	netAttachDefRawConfig, err = drasriovtypes.AddDeviceIDToNetConf(netAttachDefRawConfig, pciAddress)
-	if err != nil {
-		return nil, fmt.Errorf("error converting net attach def config to sriov-cni format: %w", err)
+	pfName := ""
+	if pfAttr, ok := deviceInfo.Attributes[consts.AttributePFName]; ok && pfAttr.StringValue != nil {
+		pfName = *pfAttr.StringValue
+	}
+	vfID := 0
+	if vfIDAttr, ok := deviceInfo.Attributes[consts.AttributeVFID]; ok && vfIDAttr.IntValue != nil {
+		vfID = int(*vfIDAttr.IntValue)
+	}
+
+	// A PF published with consumable capacity hands out one of its VFs for every allocation
+	// share, the bandwidth share is enforced with the VF max_tx_rate
+	shareID := ""
+	maxTxRate := 0
+	if vfs, shared := s.sharedVFs[result.Device]; shared {
+		vf, err := s.assignSharedVF(claim.UID, vfs)
+		if err != nil {
+			return nil, fmt.Errorf("error assigning a VF for device %s: %w", result.Device, err)
+		}
+		pciAddress = vf.PciAddress
+		vfID = vf.VFID
+		if result.ShareID != nil {
+			shareID = string(*result.ShareID)
+		}
+		if bandwidth, ok := result.ConsumedCapacity[consts.CapacityBandwidth]; ok {
+			// the bandwidth is in Gbps and max_tx_rate in Mbps
+			maxTxRate = int(bandwidth.ScaledValue(resource.Milli))
+		}
+		logger.V(2).Info("Assigned VF to device share", "device", result.Device, "shareID", shareID, "vf", pciAddress, "maxTxRate", maxTxRate)
 	}
-	// Bind device to driver if specified in config
-	originalDriver, err := host.GetHelpers().BindDeviceDriver(pciAddress, config)
+
+	// A net attach def is optional for DPDK only devices, the CNI is skipped for them
+	// and only the VF link settings are applied from the host
+	var err error
+	netAttachDefRawConfig := ""
+	if config.NetAttachDefName != "" {
+		netAttachDefRawConfig, err = s.getNetAttachDefRawConfig(ctx, netAttachDefNamespace, config.NetAttachDefName)
+		if err != nil {
+			return nil, fmt.Errorf("error getting net attach def raw config: %w", err)
+		}
+		// add to sriov-cni compatible netconf the deviceID (PCI address)
+		netAttachDefRawConfig, err = drasriovtypes.AddDeviceIDToNetConf(netAttachDefRawConfig, pciAddress)
+		if err != nil {
+			return nil, fmt.Errorf("error converting net attach def config to sriov-cni format: %w", err)
+		}
+		// make sure the CNI doesn't override the rate enforcing the bandwidth share
+		if maxTxRate > 0 {
+			netAttachDefRawConfig, err = drasriovtypes.SetMaxTxRateInNetConf(netAttachDefRawConfig, maxTxRate)
+			if err != nil {
+				return nil, fmt.Errorf("error setting max tx rate in net attach def config: %w", err)
+			}
+		}
+	} else if !s.host.IsDpdkDriver(config.Driver) {
+		return nil, fmt.Errorf("no net attach def name set for device %s using a kernel driver", result.Device)
+	}
+	// InfiniBand VFs need a GUID before they can be used, it is set before binding the
+	// driver and the partition key is handed over to the CNI
+	guid := ""
+	prepared := false
+	if stringAttribute(deviceInfo, consts.AttributeLinkLayer) == consts.LinkLayerInfiniBand {
+		guid, err = s.prepareInfiniBand(claim, pciAddress, pfName, vfID, config)
+		if err != nil {
+			return nil, fmt.Errorf("error preparing InfiniBand device %s: %w", pciAddress, err)
+		}
+		// the GUID is reset if a later step fails, its claim releases it from the pool
+		defer func() {
+			if !prepared {
+				s.resetGUID(logger, pciAddress, pfName, vfID, guid, claimAuditFields(claim))
+			}
+		}()
+		if netAttachDefRawConfig != "" {
+			netAttachDefRawConfig, err = drasriovtypes.SetInfiniBandInNetConf(netAttachDefRawConfig, guid, config.PKey)
+			if err != nil {
+				return nil, fmt.Errorf("error setting GUID and pkey in net attach def config: %w", err)
+			}
+		}
+		logger.V(2).Info("Set GUID on InfiniBand device", "device", pciAddress, "guid", guid, "pkey", config.PKey)
+	} else if config.GUID != "" || config.PKey != "" {
+		return nil, fmt.Errorf("GUID and pkey are only supported for InfiniBand devices, device %s is not", result.Device)
+	}
+
+	// Remember the MTU of the VF netdev to restore it after unprepare
+	originalMTU := s.netdevMTU(pciAddress)
+
+	// Bind device to driver if specified in config, a device pre-bound to the driver by its
+	// resource is left as is
+	_, shared := s.sharedVFs[result.Device]
+	preBound := false
+	if !shared {
+		preBoundDriver := s.reserveDevice(claim.UID, result.Device)
+		preBound = preBoundDriver != "" && preBoundDriver == config.Driver && s.isBoundTo(pciAddress, preBoundDriver)
+	}
+	var originalDriver string
+	if preBound {
+		originalDriver = config.Driver
+		logger.V(2).Info("Device is pre-bound to the driver, skipping the binding", "device", pciAddress, "driver", config.Driver)
+	} else {
+		originalDriver, err = s.host.BindDeviceDriver(pciAddress, config, claimAuditFields(claim))
+		if !shared {
+			s.recordBindFailure(result.Device, err)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error binding device %s to driver: %w", pciAddress, err)
+		}
+	}
+
+	// Get the driver the device ended up bound to so we can report it in the claim status
+	boundDriver, err := s.host.GetDriverByBusAndDevice(pciAddress)
 	if err != nil {
-		return nil, fmt.Errorf("error binding device %s to driver: %w", pciAddress, err)
+		return nil, fmt.Errorf("error getting driver for device %s: %w", pciAddress, err)
+	}
+
+	if maxTxRate > 0 {
+		if err := s.host.SetVFLinkSettings(pfName, vfID, &drasriovtypes.VFLinkSettings{MaxTxRate: &maxTxRate}); err != nil {
+			return nil, fmt.Errorf("error setting max tx rate for device %s: %w", pciAddress, err)
+		}
 	}
 
 	// Ensure that the kernel module are loaded if the user request vhost mounts
 	if config.AddVhostMount {
-		if err := host.GetHelpers().EnsureVhostModulesLoaded(); err != nil {
+		if err := s.host.EnsureVhostModulesLoaded(claimAuditFields(claim)); err != nil {
 			return nil, fmt.Errorf("failed to ensure vhost modules are loaded: %w", err)
 		}
 	}
 
 	// create environment variables
 	envs := []string{
-		fmt.Sprintf("SRIOVNETWORK_VF_DEVICE_%s=%s", strings.ReplaceAll(result.Device, "-", "_"), *deviceInfo.Attributes[consts.AttributePciAddress].StringValue),
+		fmt.Sprintf("SRIOVNETWORK_VF_DEVICE_%s=%s", strings.ReplaceAll(deviceNameFromPciAddress(pciAddress), "-", "_"), pciAddress),
 		fmt.Sprintf("SRIOVNETWORK_NET_ATTACH_DEF_NAME=%s", config.NetAttachDefName),
 	}
 
@@ -176,7 +609,7 @@ func (s *Manager) applyConfigOnDevice(ctx context.Context, ifNameIndex *int, cla
 
 	// If device is bound to vfio-pci, add VFIO device nodes
 	if config.Driver == "vfio-pci" {
-		devFileHost, devFileContainer, err := host.GetHelpers().GetVFIODeviceFile(pciAddress)
+		devFileHost, devFileContainer, err := s.host.GetVFIODeviceFile(pciAddress)
 		if err != nil {
 			return nil, fmt.Errorf("error getting VFIO device file for device %s: %w", pciAddress, err)
 		}
@@ -196,10 +629,39 @@ func (s *Manager) applyConfigOnDevice(ctx context.Context, ifNameIndex *int, cla
 			Type:     "c", // character device
 		})
 
-		envs = append(envs, fmt.Sprintf("SRIOVNETWORK_%s_VFIO_DEVICE=%s", strings.ReplaceAll(result.Device, "-", "_"), devFileContainer))
+		envs = append(envs, fmt.Sprintf("SRIOVNETWORK_%s_VFIO_DEVICE=%s", strings.ReplaceAll(deviceNameFromPciAddress(pciAddress), "-", "_"), devFileContainer))
 		logger.V(2).Info("Added VFIO device nodes for device", "device", pciAddress, "hostPath", devFileHost, "containerPath", devFileContainer)
 	}
 
+	// Expose the RDMA device of the VF with its character devices
+	rdmaDevice := ""
+	if config.RDMA {
+		rdmaDevice, err = s.host.GetRDMADevice(pciAddress)
+		if err != nil {
+			return nil, fmt.Errorf("error getting RDMA device for device %s: %w", pciAddress, err)
+		}
+		if rdmaDevice == "" {
+			return nil, fmt.Errorf("RDMA requested but device %s bound to %s has no RDMA device", pciAddress, boundDriver)
+		}
+		charDevices, err := s.host.GetRDMACharDevices(pciAddress)
+		if err != nil {
+			return nil, fmt.Errorf("error getting RDMA character devices for device %s: %w", pciAddress, err)
+		}
+		for _, charDevice := range charDevices {
+			deviceNodes = append(deviceNodes, &cdispec.DeviceNode{
+				Path:     charDevice,
+				HostPath: charDevice,
+				Type:     "c", // character device
+			})
+		}
+		envPrefix := fmt.Sprintf("SRIOVNETWORK_%s", strings.ReplaceAll(deviceNameFromPciAddress(pciAddress), "-", "_"))
+		envs = append(envs,
+			fmt.Sprintf("%s_RDMA_DEVICE=%s", envPrefix, rdmaDevice),
+			fmt.Sprintf("%s_RDMA_CHAR_DEVICES=%s", envPrefix, strings.Join(charDevices, ",")),
+		)
+		logger.V(2).Info("Added RDMA device nodes for device", "device", pciAddress, "rdmaDevice", rdmaDevice, "charDevices", charDevices)
+	}
+
 	// if addVhostMount is true, we add a volume mount for the vhost device
 	if config.AddVhostMount {
 		deviceNodes = append(deviceNodes, &cdispec.DeviceNode{
@@ -239,17 +701,36 @@ func (s *Manager) applyConfigOnDevice(ctx context.Context, ifNameIndex *int, cla
 			RequestNames: []string{result.Request},
 			PoolName:     result.Pool,
 			DeviceName:   result.Device,
-			CDIDeviceIDs: []string{s.cdi.GetClaimDevices(string(claim.UID), result.Device), s.cdi.GetPodSpecName(string(claim.Status.ReservedFor[0].UID))},
 		},
 		ContainerEdits:     &cdiapi.ContainerEdits{ContainerEdits: edits},
 		NetAttachDefConfig: netAttachDefRawConfig,
 		IfName:             ifName,
 		PciAddress:         pciAddress,
+		PFName:             pfName,
+		VFID:               vfID,
 		PodUID:             string(claim.Status.ReservedFor[0].UID),
 		Config:             config,
 		OriginalDriver:     originalDriver,
+		Driver:             boundDriver,
+		ShareID:            shareID,
+		MaxTxRate:          maxTxRate,
+		RDMADevice:         rdmaDevice,
+		GUID:               guid,
+		PKey:               config.PKey,
+		VendorID:           stringAttribute(deviceInfo, consts.AttributeVendorID),
+		OriginalMTU:        originalMTU,
+	}
+	preparedDevice.Device.CDIDeviceIDs = []string{
+		s.cdi.GetClaimDevices(string(claim.UID), preparedDevice.CDIDeviceName()),
+		s.cdi.GetPodSpecName(string(claim.Status.ReservedFor[0].UID)),
+	}
+
+	// Apply the NIC specific behaviors of the vendor
+	if err := vendors.Get(preparedDevice.VendorID).PrepareDevice(ctx, s.host, preparedDevice); err != nil {
+		return nil, fmt.Errorf("error preparing device %s: %w", pciAddress, err)
 	}
 
+	prepared = true
 	return preparedDevice, nil
 }
 
@@ -267,11 +748,18 @@ func (s *Manager) getNetAttachDefRawConfig(ctx context.Context, namespace string
 }
 
 func (s *Manager) Unprepare(claimUID string, preparedDevices drasriovtypes.PreparedDevices) error {
-	if err := s.unprepareDevices(preparedDevices); err != nil {
+	deviceNames := make([]string, 0, len(preparedDevices))
+	for _, preparedDevice := range preparedDevices {
+		deviceNames = append(deviceNames, preparedDevice.Device.DeviceName)
+	}
+	unlock := s.deviceLocks.lock(deviceNames...)
+	err := s.unprepareDevices(preparedDevices)
+	unlock()
+	if err != nil {
 		return fmt.Errorf("unprepare failed: %v", err)
 	}
 
-	err := s.cdi.DeleteSpecFile(claimUID)
+	err = s.cdi.DeleteSpecFile(claimUID)
 	if err != nil {
 		return fmt.Errorf("unable to delete CDI spec file for PodUID: %v", err)
 	}
@@ -288,18 +776,79 @@ func (s *Manager) Unprepare(claimUID string, preparedDevices drasriovtypes.Prepa
 func (s *Manager) unprepareDevices(preparedDevices drasriovtypes.PreparedDevices) error {
 	logger := klog.FromContext(context.Background()).WithName("unprepareDevices")
 	for _, preparedDevice := range preparedDevices {
-		// Restore original driver if a driver change was made
-		if preparedDevice.Config.Driver != "" {
-			if err := host.GetHelpers().RestoreDeviceDriver(preparedDevice.PciAddress, preparedDevice.OriginalDriver); err != nil {
-				klog.Error(err, "Failed to restore original driver for device", "device", preparedDevice.PciAddress, "originalDriver", preparedDevice.OriginalDriver)
-				return fmt.Errorf("failed to restore original driver for device %s: %w", preparedDevice.PciAddress, err)
-			}
-			logger.V(2).Info("Successfully restored original driver for device", "device", preparedDevice.PciAddress, "originalDriver", preparedDevice.OriginalDriver)
+		err := s.unprepareDevice(logger, preparedDevice)
+		s.auditLog.Record(preparedDevice.AuditEvent(audit.OperationUnprepare), err)
+		if err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
+// rollbackDevices reverts the devices already prepared for a claim whose prepare failed, the
+// SFs created for them are deleted and their drivers and settings restored
+func (s *Manager) rollbackDevices(logger klog.Logger, preparedDevices drasriovtypes.PreparedDevices) {
+	for _, preparedDevice := range preparedDevices {
+		if err := s.unprepareDevice(logger, preparedDevice); err != nil {
+			logger.Error(err, "Failed to roll back prepared device", "device", preparedDevice.Device.DeviceName)
+		}
+	}
+}
+
+// unprepareDevice reverts the driver configuration for a prepared device
+func (s *Manager) unprepareDevice(logger klog.Logger, preparedDevice *drasriovtypes.PreparedDevice) error {
+	if preparedDevice.SF != nil {
+		return s.releaseSF(logger, preparedDevice)
+	}
+
+	// Remove the rate enforcing the bandwidth share and free the VF
+	if preparedDevice.MaxTxRate > 0 {
+		noRate := 0
+		if err := s.host.SetVFLinkSettings(preparedDevice.PFName, preparedDevice.VFID, &drasriovtypes.VFLinkSettings{MaxTxRate: &noRate}); err != nil {
+			logger.Error(err, "Failed to reset max tx rate for device", "device", preparedDevice.PciAddress)
+		}
+	}
+	s.mutex.Lock()
+	delete(s.sharedVFsInUse, preparedDevice.PciAddress)
+	s.mutex.Unlock()
+
+	// Revert the NIC specific behaviors of the vendor
+	vendorPlugin := vendors.Get(preparedDevice.VendorID)
+	if err := vendorPlugin.UnprepareDevice(context.Background(), s.host, preparedDevice); err != nil {
+		logger.Error(err, "Failed to unprepare device with vendor plugin", "device", preparedDevice.PciAddress, "vendor", vendorPlugin.Name())
+	}
+
+	// Reset the GUID of InfiniBand VFs and free it, the GUIDs of the other devices of the
+	// claim stay in use until they are unprepared
+	s.releaseInfiniBand(logger, preparedDevice)
+	s.guidPool.ReleaseGUID(preparedDevice.GUID, preparedDevice.ClaimNamespacedName.UID)
+
+	// Leave the device bound to the driver of its pre-bind resource, or restore the
+	// original driver if a driver change was made
+	_, shared := s.sharedVFs[preparedDevice.Device.DeviceName]
+	if preBindDriver := s.preBindDriver(preparedDevice.Device.DeviceName); preBindDriver != "" && !shared {
+		if err := s.host.BindDriverByBusAndDevice(preparedDevice.PciAddress, preBindDriver, preparedDevice.AuditFields()); err != nil {
+			return fmt.Errorf("failed to bind device %s back to its pre-bind driver %s: %w", preparedDevice.PciAddress, preBindDriver, err)
+		}
+		logger.V(2).Info("Left device bound to its pre-bind driver", "device", preparedDevice.PciAddress, "driver", preBindDriver)
+	} else if preparedDevice.Config.Driver != "" {
+		if err := s.host.RestoreDeviceDriver(preparedDevice.PciAddress, preparedDevice.OriginalDriver, preparedDevice.AuditFields()); err != nil {
+			klog.Error(err, "Failed to restore original driver for device", "device", preparedDevice.PciAddress, "originalDriver", preparedDevice.OriginalDriver)
+			return fmt.Errorf("failed to restore original driver for device %s: %w", preparedDevice.PciAddress, err)
+		}
+		logger.V(2).Info("Successfully restored original driver for device", "device", preparedDevice.PciAddress, "originalDriver", preparedDevice.OriginalDriver)
+	}
+
+	// Clear the state the pod left on the VF, a VF that fails it is tainted instead of
+	// being handed to the next pod
+	if err := s.sanitizeDevice(logger, preparedDevice); err != nil {
+		logger.Error(err, "Failed to sanitize device", "device", preparedDevice.PciAddress)
+		s.recordSanitizeFailure(context.Background(), preparedDevice)
+	}
+	s.releaseDevice(preparedDevice.Device.DeviceName)
+	return nil
+}
+
 // UpdateDeviceResourceNames updates the resource names for devices and triggers a republish
 // deviceResourceMap is a map of device name to resource name. Empty resource name removes the attribute.
 func (s *Manager) UpdateDeviceResourceNames(ctx context.Context, deviceResourceMap map[string]string) error {
@@ -309,6 +858,7 @@ func (s *Manager) UpdateDeviceResourceNames(ctx context.Context, deviceResourceM
 	// Track if any changes were made
 	changesMade := false
 
+	s.mutex.Lock()
 	// Update allocatable devices with resource names
 	for deviceName, resourceName := range deviceResourceMap {
 		if device, exists := s.allocatable[deviceName]; exists {
@@ -322,16 +872,19 @@ func (s *Manager) UpdateDeviceResourceNames(ctx context.Context, deviceResourceM
 				// Check if attribute already exists with the same value
 				if existingAttr, exists := device.Attributes[consts.AttributeResourceName]; !exists ||
 					existingAttr.StringValue == nil || *existingAttr.StringValue != resourceName {
+					previousResourceName := stringAttribute(device, consts.AttributeResourceName)
 					device.Attributes[consts.AttributeResourceName] = resourceapi.DeviceAttribute{
 						StringValue: &resourceName,
 					}
 					s.allocatable[deviceName] = device
 					changesMade = true
+					s.recordResourceNameChange(device, previousResourceName, resourceName)
 					logger.V(3).Info("Set resource name for device", "deviceName", deviceName, "resourceName", resourceName)
 				}
 			} else {
 				// Remove resource name attribute if it exists
 				if _, exists := device.Attributes[consts.AttributeResourceName]; exists {
+					s.recordResourceNameChange(device, stringAttribute(device, consts.AttributeResourceName), "")
 					delete(device.Attributes, consts.AttributeResourceName)
 					s.allocatable[deviceName] = device
 					changesMade = true
@@ -347,6 +900,7 @@ func (s *Manager) UpdateDeviceResourceNames(ctx context.Context, deviceResourceM
 	for deviceName, device := range s.allocatable {
 		if _, inMap := deviceResourceMap[deviceName]; !inMap {
 			if _, exists := device.Attributes[consts.AttributeResourceName]; exists {
+				s.recordResourceNameChange(device, stringAttribute(device, consts.AttributeResourceName), "")
 				delete(device.Attributes, consts.AttributeResourceName)
 				s.allocatable[deviceName] = device
 				changesMade = true
@@ -355,12 +909,16 @@ func (s *Manager) UpdateDeviceResourceNames(ctx context.Context, deviceResourceM
 		}
 	}
 
+	totalDevices := len(s.allocatable)
+	republishCallback := s.republishCallback
+	s.mutex.Unlock()
+
 	if changesMade {
-		logger.Info("Device resource names updated", "totalDevices", len(s.allocatable), "filteredDevices", len(deviceResourceMap))
+		logger.Info("Device resource names updated", "totalDevices", totalDevices, "filteredDevices", len(deviceResourceMap))
 
 		// Trigger resource republishing if callback is available
-		if s.republishCallback != nil {
-			if err := s.republishCallback(ctx); err != nil {
+		if republishCallback != nil {
+			if err := republishCallback(ctx); err != nil {
 				logger.Error(err, "Failed to republish resources after updating resource names")
 				return fmt.Errorf("failed to republish resources: %w", err)
 			}
@@ -375,7 +933,62 @@ func (s *Manager) UpdateDeviceResourceNames(ctx context.Context, deviceResourceM
 	return nil
 }
 
+// recordResourceNameChange records the change of the resource name of a device in the audit log
+func (s *Manager) recordResourceNameChange(device resourceapi.Device, previousResourceName, resourceName string) {
+	s.auditLog.Record(audit.Event{
+		Operation:  audit.OperationResourceName,
+		Device:     device.Name,
+		PciAddress: stringAttribute(device, consts.AttributePciAddress),
+		Details: map[string]string{
+			"previousResourceName": previousResourceName,
+			"resourceName":         resourceName,
+		},
+	}, nil)
+}
+
+// UpdateResourceConfigs sets the default VfConfigs of the resource names, they apply to the
+// claims prepared from now on
+func (s *Manager) UpdateResourceConfigs(resourceConfigs map[string]*configapi.VfConfig) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.resourceConfigs = resourceConfigs
+}
+
+// getResourceDefaultConfigs returns the default VfConfig of the resource name of the devices
+// allocated for each request of the claim. The devices of a request must not have different
+// default configs.
+func (s *Manager) getResourceDefaultConfigs(claim *resourceapi.ResourceClaim) (map[string]*configapi.VfConfig, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	defaultConfigs := make(map[string]*configapi.VfConfig)
+	resourceNames := make(map[string]string)
+	for _, result := range claim.Status.Allocation.Devices.Results {
+		if result.Driver != consts.DriverName {
+			continue
+		}
+		resourceName := ""
+		if attr, ok := s.allocatable[result.Device].Attributes[consts.AttributeResourceName]; ok && attr.StringValue != nil {
+			resourceName = *attr.StringValue
+		}
+		defaultConfig := s.resourceConfigs[resourceName]
+		if previous, seen := resourceNames[result.Request]; seen {
+			if defaultConfigs[result.Request] != defaultConfig {
+				return nil, fmt.Errorf("devices of request %s have the different default configs of resources %q and %q",
+					result.Request, previous, resourceName)
+			}
+			continue
+		}
+		resourceNames[result.Request] = resourceName
+		if defaultConfig != nil {
+			defaultConfigs[result.Request] = defaultConfig
+		}
+	}
+	return defaultConfigs, nil
+}
+
 // SetRepublishCallback sets the callback function to trigger resource republishing
 func (s *Manager) SetRepublishCallback(callback func(context.Context) error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 	s.republishCallback = callback
 }
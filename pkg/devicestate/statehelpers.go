@@ -9,6 +9,7 @@ import (
 
 	configapi "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/virtualfunction/v1alpha1"
 	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
+	drasriovtypes "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
 )
 
 // GetOpaqueDeviceConfigs returns an ordered list of the configs contained in possibleConfigs for this driver.
@@ -22,9 +23,14 @@ import (
 // All of the configs relevant to the driver from the list of possibleConfigs
 // will be returned in order of precedence (from lowest to highest). If no
 // configs are found, nil is returned.
+//
+// The default configs of the resource names of the devices, by request, have
+// a lower precedence than the configs of the device class. All their fields
+// are kept, including the ones the other configs don't override.
 func getMapOfOpaqueDeviceConfigForDevice(
 	decoder runtime.Decoder,
 	possibleConfigs []resourceapi.DeviceAllocationConfiguration,
+	defaultConfigs map[string]*configapi.VfConfig,
 ) (map[string]*configapi.VfConfig, error) {
 	// Collect all configs in order of reverse precedence.
 	var classConfigs []resourceapi.DeviceAllocationConfiguration
@@ -46,6 +52,11 @@ func getMapOfOpaqueDeviceConfigForDevice(
 
 	// Decode all configs that are relevant for the driver.
 	resultConfigs := make(map[string]*configapi.VfConfig)
+	for request, defaultConfig := range defaultConfigs {
+		resultConfig := defaultConfig.DeepCopy()
+		resultConfig.TypeMeta = configapi.DefaultVfConfig().TypeMeta
+		resultConfigs[request] = resultConfig
+	}
 
 	for _, config := range candidateConfigs {
 		// If this is nil, the driver doesn't support some future API extension
@@ -66,6 +77,10 @@ func getMapOfOpaqueDeviceConfigForDevice(
 		if err != nil {
 			return nil, fmt.Errorf("error decoding config parameters: %w", err)
 		}
+		// bond configs apply to a group of requests and are handled by getBondConfigs
+		if _, isBond := decodedConfig.(*configapi.BondConfig); isBond {
+			continue
+		}
 		vfConfig, ok := decodedConfig.(*configapi.VfConfig)
 		if !ok {
 			return nil, fmt.Errorf("decoded config is not a VfConfig")
@@ -85,3 +100,41 @@ func getMapOfOpaqueDeviceConfigForDevice(
 	}
 	return resultConfigs, nil
 }
+
+// getBondConfigs returns the bond configs of the driver with the requests whose devices
+// are enslaved to each bond. Bond configs coming from the claim are returned after the
+// ones coming from the device class.
+func getBondConfigs(
+	decoder runtime.Decoder,
+	possibleConfigs []resourceapi.DeviceAllocationConfiguration,
+) ([]*drasriovtypes.OpaqueDeviceConfig, error) {
+	var classConfigs, claimConfigs []*drasriovtypes.OpaqueDeviceConfig
+	for _, config := range possibleConfigs {
+		if config.DeviceConfiguration.Opaque == nil || config.DeviceConfiguration.Opaque.Driver != consts.DriverName {
+			continue
+		}
+		decodedConfig, err := runtime.Decode(decoder, config.DeviceConfiguration.Opaque.Parameters.Raw)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding config parameters: %w", err)
+		}
+		bondConfig, ok := decodedConfig.(*configapi.BondConfig)
+		if !ok {
+			continue
+		}
+		bondConfig.Normalize()
+		if err := bondConfig.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid bond config: %w", err)
+		}
+		if len(config.Requests) < 2 {
+			return nil, fmt.Errorf("bond %s must reference at least two requests", bondConfig.IfName)
+		}
+
+		opaqueConfig := &drasriovtypes.OpaqueDeviceConfig{Requests: config.Requests, Config: bondConfig}
+		if config.Source == resourceapi.AllocationConfigSourceClass {
+			classConfigs = append(classConfigs, opaqueConfig)
+		} else {
+			claimConfigs = append(claimConfigs, opaqueConfig)
+		}
+	}
+	return append(classConfigs, claimConfigs...), nil
+}
@@ -46,7 +46,7 @@ var _ = Describe("getMapOfOpaqueDeviceConfigForDevice", func() {
 				},
 			}
 
-			result, err := getMapOfOpaqueDeviceConfigForDevice(decoder, configs)
+			result, err := getMapOfOpaqueDeviceConfigForDevice(decoder, configs, nil)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(result).To(HaveLen(1))
 			Expect(result["request1"]).NotTo(BeNil())
@@ -81,7 +81,7 @@ var _ = Describe("getMapOfOpaqueDeviceConfigForDevice", func() {
 				},
 			}
 
-			result, err := getMapOfOpaqueDeviceConfigForDevice(decoder, configs)
+			result, err := getMapOfOpaqueDeviceConfigForDevice(decoder, configs, nil)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(result).To(HaveLen(1))
 			Expect(result["request1"].Driver).To(Equal("netdevice"))
@@ -114,7 +114,7 @@ var _ = Describe("getMapOfOpaqueDeviceConfigForDevice", func() {
 				},
 			}
 
-			result, err := getMapOfOpaqueDeviceConfigForDevice(decoder, configs)
+			result, err := getMapOfOpaqueDeviceConfigForDevice(decoder, configs, nil)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(result).To(HaveLen(3))
 			Expect(result["request1"].NetAttachDefName).To(Equal("shared-net"))
@@ -175,7 +175,7 @@ var _ = Describe("getMapOfOpaqueDeviceConfigForDevice", func() {
 				},
 			}
 
-			result, err := getMapOfOpaqueDeviceConfigForDevice(decoder, configs)
+			result, err := getMapOfOpaqueDeviceConfigForDevice(decoder, configs, nil)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(result).To(HaveLen(1))
 			// Claim config should override class config
@@ -234,7 +234,7 @@ var _ = Describe("getMapOfOpaqueDeviceConfigForDevice", func() {
 				},
 			}
 
-			result, err := getMapOfOpaqueDeviceConfigForDevice(decoder, configs)
+			result, err := getMapOfOpaqueDeviceConfigForDevice(decoder, configs, nil)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(result).To(HaveLen(1))
 			// Later config overrides driver
@@ -293,7 +293,7 @@ var _ = Describe("getMapOfOpaqueDeviceConfigForDevice", func() {
 				},
 			}
 
-			result, err := getMapOfOpaqueDeviceConfigForDevice(decoder, configs)
+			result, err := getMapOfOpaqueDeviceConfigForDevice(decoder, configs, nil)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(result).To(HaveLen(1))
 			// Overridden field
@@ -302,6 +302,38 @@ var _ = Describe("getMapOfOpaqueDeviceConfigForDevice", func() {
 			Expect(result["request1"].Driver).To(Equal("vfio-pci"))
 			Expect(result["request1"].IfName).To(Equal("eth0"))
 		})
+
+		It("should merge the default configs of the resources below class and claim configs", func() {
+			classConfig := &configapi.VfConfig{
+				TypeMeta:         metav1.TypeMeta{APIVersion: "sriovnetwork.k8snetworkplumbingwg.io/v1alpha1", Kind: "VfConfig"},
+				NetAttachDefName: "class-net",
+			}
+			encoded, err := runtime.Encode(configapi.Decoder.(runtime.Encoder), classConfig)
+			Expect(err).NotTo(HaveOccurred())
+			configs := []resourceapi.DeviceAllocationConfiguration{{
+				Source:   resourceapi.AllocationConfigSourceClass,
+				Requests: []string{"request1"},
+				DeviceConfiguration: resourceapi.DeviceConfiguration{Opaque: &resourceapi.OpaqueDeviceConfiguration{
+					Driver:     consts.DriverName,
+					Parameters: runtime.RawExtension{Raw: encoded},
+				}},
+			}}
+			defaultConfigs := map[string]*configapi.VfConfig{
+				"request1": {Driver: "vfio-pci", AddVhostMount: true, NetAttachDefName: "default-net"},
+				"request2": {Driver: "vfio-pci"},
+			}
+
+			result, err := getMapOfOpaqueDeviceConfigForDevice(decoder, configs, defaultConfigs)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(HaveLen(2))
+			Expect(result["request1"].Driver).To(Equal("vfio-pci"))
+			Expect(result["request1"].AddVhostMount).To(BeTrue())
+			Expect(result["request1"].NetAttachDefName).To(Equal("class-net"))
+			Expect(result["request2"].Driver).To(Equal("vfio-pci"))
+			Expect(result["request2"].Kind).To(Equal(configapi.VfConfigKind))
+			// the default configs aren't modified
+			Expect(defaultConfigs["request1"].NetAttachDefName).To(Equal("default-net"))
+		})
 	})
 
 	Context("Driver Filtering", func() {
@@ -344,7 +376,7 @@ var _ = Describe("getMapOfOpaqueDeviceConfigForDevice", func() {
 				},
 			}
 
-			result, err := getMapOfOpaqueDeviceConfigForDevice(decoder, configs)
+			result, err := getMapOfOpaqueDeviceConfigForDevice(decoder, configs, nil)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(result).To(HaveLen(1))
 			Expect(result["request1"].Driver).To(Equal("vfio-pci"))
@@ -401,7 +433,7 @@ var _ = Describe("getMapOfOpaqueDeviceConfigForDevice", func() {
 				},
 			}
 
-			result, err := getMapOfOpaqueDeviceConfigForDevice(decoder, configs)
+			result, err := getMapOfOpaqueDeviceConfigForDevice(decoder, configs, nil)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(result).To(HaveLen(1))
 			Expect(result).To(HaveKey("request3"))
@@ -438,7 +470,7 @@ var _ = Describe("getMapOfOpaqueDeviceConfigForDevice", func() {
 				},
 			}
 
-			_, err = getMapOfOpaqueDeviceConfigForDevice(decoder, configs)
+			_, err = getMapOfOpaqueDeviceConfigForDevice(decoder, configs, nil)
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(ContainSubstring("invalid config source"))
 		})
@@ -454,7 +486,7 @@ var _ = Describe("getMapOfOpaqueDeviceConfigForDevice", func() {
 				},
 			}
 
-			_, err := getMapOfOpaqueDeviceConfigForDevice(decoder, configs)
+			_, err := getMapOfOpaqueDeviceConfigForDevice(decoder, configs, nil)
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(ContainSubstring("only opaque parameters are supported"))
 		})
@@ -475,7 +507,7 @@ var _ = Describe("getMapOfOpaqueDeviceConfigForDevice", func() {
 				},
 			}
 
-			_, err := getMapOfOpaqueDeviceConfigForDevice(decoder, configs)
+			_, err := getMapOfOpaqueDeviceConfigForDevice(decoder, configs, nil)
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(ContainSubstring("error decoding config parameters"))
 		})
@@ -496,7 +528,7 @@ var _ = Describe("getMapOfOpaqueDeviceConfigForDevice", func() {
 				},
 			}
 
-			_, err := getMapOfOpaqueDeviceConfigForDevice(decoder, configs)
+			_, err := getMapOfOpaqueDeviceConfigForDevice(decoder, configs, nil)
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(Equal("no configs constructed for driver"))
 		})
@@ -526,7 +558,7 @@ var _ = Describe("getMapOfOpaqueDeviceConfigForDevice", func() {
 				},
 			}
 
-			_, err := getMapOfOpaqueDeviceConfigForDevice(decoder, configs)
+			_, err := getMapOfOpaqueDeviceConfigForDevice(decoder, configs, nil)
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(ContainSubstring("error decoding config parameters"))
 		})
@@ -536,7 +568,7 @@ var _ = Describe("getMapOfOpaqueDeviceConfigForDevice", func() {
 		It("should handle empty configs list", func() {
 			configs := []resourceapi.DeviceAllocationConfiguration{}
 
-			_, err := getMapOfOpaqueDeviceConfigForDevice(decoder, configs)
+			_, err := getMapOfOpaqueDeviceConfigForDevice(decoder, configs, nil)
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(Equal("no configs constructed for driver"))
 		})
@@ -568,7 +600,7 @@ var _ = Describe("getMapOfOpaqueDeviceConfigForDevice", func() {
 				},
 			}
 
-			_, err = getMapOfOpaqueDeviceConfigForDevice(decoder, configs)
+			_, err = getMapOfOpaqueDeviceConfigForDevice(decoder, configs, nil)
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(Equal("no configs constructed for driver"))
 		})
@@ -634,7 +666,7 @@ var _ = Describe("getMapOfOpaqueDeviceConfigForDevice", func() {
 				},
 			}
 
-			result, err := getMapOfOpaqueDeviceConfigForDevice(decoder, configs)
+			result, err := getMapOfOpaqueDeviceConfigForDevice(decoder, configs, nil)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(result).To(HaveLen(3))
 
@@ -23,6 +23,7 @@ func (d *Driver) PrepareResourceClaims(ctx context.Context, claims []*resourceap
 	}
 	logger := klog.FromContext(ctx).WithName("PrepareResourceClaims")
 	logger.V(3).Info("claims", "claims", claims)
+	d.syncPreparedDevices()
 
 	// we share this between all the claims so we can enumerate network interfaces
 	ifNameIndex := 0
@@ -45,12 +46,8 @@ func (d *Driver) PrepareResourceClaims(ctx context.Context, claims []*resourceap
 	// create a global spec file for the pod level environment variables
 	pciAddresses := []string{}
 	for _, preparedDevice := range preparedDevices {
-		device, exist := d.deviceStateManager.GetAllocatedDeviceByDeviceName(preparedDevice.Device.DeviceName)
-		if !exist {
-			logger.Error(fmt.Errorf("device not found for device name %s", preparedDevice.Device.DeviceName), "Error preparing devices for claim")
-			return result, fmt.Errorf("device not found for device name %s", preparedDevice.Device.DeviceName)
-		}
-		pciAddresses = append(pciAddresses, *device.Attributes[consts.AttributePciAddress].StringValue)
+		// use the address from the prepared device as a PF share is backed by one of its VFs
+		pciAddresses = append(pciAddresses, preparedDevice.PciAddress)
 	}
 
 	err := d.cdi.CreateGlobalPodSpecFile(string(claims[0].Status.ReservedFor[0].UID), pciAddresses)
@@ -88,7 +85,13 @@ func (d *Driver) prepareResourceClaim(ctx context.Context, ifNameIndex *int, cla
 	podUID := claim.Status.ReservedFor[0].UID
 
 	// check if the pod claim is already prepared and return the prepared devices
-	preparedDevices, isAlreadyPrepared := d.podManager.Get(podUID, claim.UID)
+	preparedDevices, isAlreadyPrepared, err := d.podManager.Get(podUID, claim.UID)
+	if err != nil {
+		logger.Error(err, "Error getting prepared devices for claim from pod manager", "claim", claim.UID)
+		return kubeletplugin.PrepareResult{
+			Err: fmt.Errorf("error getting prepared devices for claim %v from pod manager: %w", claim.UID, err),
+		}
+	}
 	if isAlreadyPrepared {
 		var prepared []kubeletplugin.Device
 		for _, preparedDevice := range preparedDevices {
@@ -103,7 +106,7 @@ func (d *Driver) prepareResourceClaim(ctx context.Context, ifNameIndex *int, cla
 	}
 
 	// if the pod claim is not prepared, prepare the devices for the claim
-	preparedDevices, err := d.deviceStateManager.PrepareDevicesForClaim(ctx, ifNameIndex, claim)
+	preparedDevices, err = d.deviceStateManager.PrepareDevicesForClaim(ctx, ifNameIndex, claim)
 	if err != nil {
 		logger.Error(err, "Error preparing devices for claim", "claim", claim.UID)
 		return kubeletplugin.PrepareResult{
@@ -171,6 +174,7 @@ func (d *Driver) UnprepareResourceClaims(ctx context.Context, claims []kubeletpl
 	logger.V(1).Info("UnprepareResourceClaims is called", "number of claims", len(claims))
 	logger.V(3).Info("claims", "claims", claims)
 	result := make(map[k8stypes.UID]error)
+	d.syncPreparedDevices()
 
 	for _, claim := range claims {
 		result[claim.UID] = d.unprepareResourceClaim(ctx, claim)
@@ -203,6 +207,18 @@ func (d *Driver) unprepareResourceClaim(ctx context.Context, claim kubeletplugin
 	return nil
 }
 
+// syncPreparedDevices updates the devices in use with the claims prepared and unprepared by the
+// other instance of the plugin during a rolling update. The kubelet plugin helper serializes the
+// prepare and unprepare calls of both instances with a file lock, see kubeletplugin.Serialize,
+// so none of them is preparing a claim meanwhile. The background loops see either the old or
+// the new devices in use.
+func (d *Driver) syncPreparedDevices() {
+	if d.config == nil || d.config.Flags == nil || d.config.Flags.RollingUpdateUID == "" {
+		return
+	}
+	d.deviceStateManager.SyncPreparedDevices(d.podManager.GetAllPreparedDevices())
+}
+
 func (d *Driver) HandleError(ctx context.Context, err error, msg string) {
 	utilruntime.HandleErrorWithContext(ctx, err, msg)
 	if !errors.Is(err, kubeletplugin.ErrRecoverable) && d.cancelCtx != nil {
@@ -19,15 +19,15 @@ package driver
 import (
 	"context"
 	"fmt"
-	"maps"
 	"os"
 	"path"
 
-	resourceapi "k8s.io/api/resource/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
 	coreclientset "k8s.io/client-go/kubernetes"
 	"k8s.io/dynamic-resource-allocation/kubeletplugin"
 	"k8s.io/dynamic-resource-allocation/resourceslice"
 	"k8s.io/klog/v2"
+	drahealthv1alpha1 "k8s.io/kubelet/pkg/apis/dra-health/v1alpha1"
 
 	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/cdi"
 	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
@@ -37,6 +37,8 @@ import (
 )
 
 type Driver struct {
+	drahealthv1alpha1.UnimplementedDRAResourceHealthServer
+
 	client             coreclientset.Interface
 	helper             *kubeletplugin.Helper
 	deviceStateManager *devicestate.Manager
@@ -59,15 +61,22 @@ func Start(ctx context.Context, config *sriovdratype.Config, deviceStateManager
 		cdi:                cdi,
 	}
 
-	helper, err := kubeletplugin.Start(
-		ctx,
-		driver,
+	options := []kubeletplugin.Option{
 		kubeletplugin.KubeClient(config.K8sClient.Interface),
 		kubeletplugin.NodeName(config.Flags.NodeName),
 		kubeletplugin.DriverName(consts.DriverName),
 		kubeletplugin.RegistrarDirectoryPath(config.Flags.KubeletRegistrarDirectoryPath),
 		kubeletplugin.PluginDataDirectoryPath(config.DriverPluginPath()),
-	)
+		// the prepare and unprepare calls of both instances are serialized through a file lock
+		// in the plugin data directory during a rolling update
+		kubeletplugin.Serialize(true),
+	}
+	if config.Flags.RollingUpdateUID != "" {
+		// the kubelet keeps using the old instance until the new one is registered
+		options = append(options, kubeletplugin.RollingUpdate(k8stypes.UID(config.Flags.RollingUpdateUID)))
+	}
+
+	helper, err := kubeletplugin.Start(ctx, driver, options...)
 	if err != nil {
 		klog.FromContext(ctx).Error(err, "Failed to start DRA kubelet plugin")
 		return nil, err
@@ -95,11 +104,11 @@ func (d *Driver) Shutdown(logger klog.Logger) error {
 
 	// remove the socket files
 	// TODO: this is not needed after https://github.com/kubernetes/kubernetes/pull/133934 is merged
-	err := os.Remove(path.Join(d.config.Flags.KubeletRegistrarDirectoryPath, consts.DriverName+"-reg.sock"))
+	err := os.Remove(registrationSocketPath(d.config))
 	if err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("error removing socket file: %w", err)
 	}
-	err = os.Remove(path.Join(d.config.DriverPluginPath(), "dra.sock"))
+	err = os.Remove(pluginSocketPath(d.config))
 	if err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("error removing socket file: %w", err)
 	}
@@ -107,22 +116,30 @@ func (d *Driver) Shutdown(logger klog.Logger) error {
 	return nil
 }
 
-// PublishResources publishes the devices to the DRA resoruce slice
-func (d *Driver) PublishResources(ctx context.Context) error {
-	devices := make([]resourceapi.Device, 0, len(d.deviceStateManager.GetAllocatableDevices()))
-	for device := range maps.Values(d.deviceStateManager.GetAllocatableDevices()) {
-		devices = append(devices, device)
+// registrationSocketPath returns the path of the kubelet plugin registration socket, which
+// includes the rolling update UID when enabled
+func registrationSocketPath(config *sriovdratype.Config) string {
+	return path.Join(config.Flags.KubeletRegistrarDirectoryPath, consts.DriverName+socketUIDSuffix(config)+"-reg.sock")
+}
+
+// pluginSocketPath returns the path of the DRA gRPC socket, which includes the rolling update
+// UID when enabled
+func pluginSocketPath(config *sriovdratype.Config) string {
+	return path.Join(config.DriverPluginPath(), "dra"+socketUIDSuffix(config)+".sock")
+}
+
+func socketUIDSuffix(config *sriovdratype.Config) string {
+	if config.Flags.RollingUpdateUID == "" {
+		return ""
 	}
+	return "-" + config.Flags.RollingUpdateUID
+}
+
+// PublishResources publishes the devices to the DRA resource slices, split into pools
+// according to the configured partition mode
+func (d *Driver) PublishResources(ctx context.Context) error {
 	resources := resourceslice.DriverResources{
-		Pools: map[string]resourceslice.Pool{
-			d.config.Flags.NodeName: {
-				Slices: []resourceslice.Slice{
-					{
-						Devices: devices,
-					},
-				},
-			},
-		},
+		Pools: buildPools(d.config.Flags.NodeName, d.config.Flags.ResourceSlicePartition, d.deviceStateManager.GetAllocatableDevices()),
 	}
 
 	if err := d.helper.PublishResources(ctx, resources); err != nil {
@@ -85,4 +85,17 @@ var _ = Describe("Driver", func() {
 			Expect(called).To(BeFalse())
 		})
 	})
+
+	Context("socket paths", func() {
+		It("uses the default names without rolling update", func() {
+			cfg := &types.Config{Flags: &types.Flags{KubeletRegistrarDirectoryPath: "/reg", KubeletPluginsDirectoryPath: "/plugins"}}
+			Expect(registrationSocketPath(cfg)).To(Equal("/reg/sriovnetwork.k8snetworkplumbingwg.io-reg.sock"))
+			Expect(pluginSocketPath(cfg)).To(Equal("/plugins/sriovnetwork.k8snetworkplumbingwg.io/dra.sock"))
+		})
+		It("includes the rolling update UID", func() {
+			cfg := &types.Config{Flags: &types.Flags{KubeletRegistrarDirectoryPath: "/reg", KubeletPluginsDirectoryPath: "/plugins", RollingUpdateUID: "uid1"}}
+			Expect(registrationSocketPath(cfg)).To(Equal("/reg/sriovnetwork.k8snetworkplumbingwg.io-uid1-reg.sock"))
+			Expect(pluginSocketPath(cfg)).To(Equal("/plugins/sriovnetwork.k8snetworkplumbingwg.io/dra-uid1.sock"))
+		})
+	})
 })
@@ -21,7 +21,6 @@ import (
 	"fmt"
 	"net"
 	"net/url"
-	"path"
 	"strconv"
 	"sync"
 
@@ -34,8 +33,6 @@ import (
 	"k8s.io/klog/v2"
 	drapb "k8s.io/kubelet/pkg/apis/dra/v1beta1"
 	registerapi "k8s.io/kubelet/pkg/apis/pluginregistration/v1"
-
-	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
 )
 
 type Healthcheck struct {
@@ -64,9 +61,7 @@ func startHealthcheck(ctx context.Context, config *types.Config) (*Healthcheck,
 
 	regSockPath := (&url.URL{
 		Scheme: "unix",
-		// TODO: this needs to adapt when seamless upgrades
-		// are enabled and the filename includes a uid.
-		Path: path.Join(config.Flags.KubeletRegistrarDirectoryPath, consts.DriverName+"-reg.sock"),
+		Path:   registrationSocketPath(config),
 	}).String()
 	log.Info("connecting to registration socket", "path", regSockPath)
 	regConn, err := grpc.NewClient(
@@ -79,7 +74,7 @@ func startHealthcheck(ctx context.Context, config *types.Config) (*Healthcheck,
 
 	draSockPath := (&url.URL{
 		Scheme: "unix",
-		Path:   path.Join(config.DriverPluginPath(), "dra.sock"),
+		Path:   pluginSocketPath(config),
 	}).String()
 	log.Info("connecting to DRA socket", "path", draSockPath)
 	draConn, err := grpc.NewClient(
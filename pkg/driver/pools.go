@@ -0,0 +1,120 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package driver
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/dynamic-resource-allocation/resourceslice"
+
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
+	sriovdratype "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
+)
+
+// Supported values for the resource-slice-partition flag.
+const (
+	// PartitionByNode publishes all the devices in a single pool named after the node.
+	PartitionByNode = "node"
+	// PartitionByPF publishes one pool per physical function.
+	PartitionByPF = "pf"
+	// PartitionByResourceName publishes one pool per resource name set by the SriovResourceFilter.
+	PartitionByResourceName = "resourceName"
+)
+
+var invalidPoolNameChars = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+// ValidatePartitionMode returns an error if mode is not a supported resource slice partition mode.
+func ValidatePartitionMode(mode string) error {
+	switch mode {
+	case PartitionByNode, PartitionByPF, PartitionByResourceName:
+		return nil
+	}
+	return fmt.Errorf("unsupported resource slice partition %q, must be one of %q, %q or %q",
+		mode, PartitionByNode, PartitionByPF, PartitionByResourceName)
+}
+
+// buildPools splits the allocatable devices into pools according to the partition mode.
+// Pool names are derived from the node name and the partition key so they stay stable
+// across restarts, and the devices of each pool are sorted and chunked into slices of at
+// most ResourceSliceMaxDevices so that the resourceslice controller only has to update
+// the slices whose content changed.
+func buildPools(nodeName, mode string, devices sriovdratype.AllocatableDevices) map[string]resourceslice.Pool {
+	poolDevices := map[string][]resourceapi.Device{}
+	for _, device := range devices {
+		name := poolName(nodeName, mode, device)
+		poolDevices[name] = append(poolDevices[name], device)
+	}
+
+	// Always publish the node pool, even when empty, to show that the driver is running
+	if len(poolDevices) == 0 {
+		poolDevices[nodeName] = nil
+	}
+
+	pools := make(map[string]resourceslice.Pool, len(poolDevices))
+	for name, devices := range poolDevices {
+		slices.SortFunc(devices, func(a, b resourceapi.Device) int {
+			return strings.Compare(a.Name, b.Name)
+		})
+		pools[name] = resourceslice.Pool{Slices: chunkDevices(devices)}
+	}
+	return pools
+}
+
+// poolName returns the name of the pool the device belongs to.
+func poolName(nodeName, mode string, device resourceapi.Device) string {
+	var key string
+	switch mode {
+	case PartitionByPF:
+		key = stringAttribute(device, consts.AttributePFName)
+	case PartitionByResourceName:
+		key = stringAttribute(device, consts.AttributeResourceName)
+	}
+
+	key = strings.Trim(invalidPoolNameChars.ReplaceAllString(strings.ToLower(key), "-"), "-.")
+	if key == "" {
+		return nodeName
+	}
+	// Pool names are DNS subdomains separated by slashes
+	name := nodeName + "/" + key
+	if len(name) > resourceapi.PoolNameMaxLength {
+		name = strings.TrimRight(name[:resourceapi.PoolNameMaxLength], "-.")
+	}
+	return name
+}
+
+func chunkDevices(devices []resourceapi.Device) []resourceslice.Slice {
+	if len(devices) == 0 {
+		return []resourceslice.Slice{{Devices: []resourceapi.Device{}}}
+	}
+	chunks := make([]resourceslice.Slice, 0, (len(devices)+resourceapi.ResourceSliceMaxDevices-1)/resourceapi.ResourceSliceMaxDevices)
+	for chunk := range slices.Chunk(devices, resourceapi.ResourceSliceMaxDevices) {
+		chunks = append(chunks, resourceslice.Slice{Devices: chunk})
+	}
+	return chunks
+}
+
+func stringAttribute(device resourceapi.Device, name resourceapi.QualifiedName) string {
+	attr, ok := device.Attributes[name]
+	if !ok || attr.StringValue == nil {
+		return ""
+	}
+	return *attr.StringValue
+}
@@ -0,0 +1,111 @@
+package driver
+
+import (
+	"fmt"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/utils/ptr"
+
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
+)
+
+func newPoolTestDevice(name, pfName, resourceName string) resourceapi.Device {
+	device := resourceapi.Device{
+		Name: name,
+		Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+			consts.AttributePFName: {StringValue: ptr.To(pfName)},
+		},
+	}
+	if resourceName != "" {
+		device.Attributes[consts.AttributeResourceName] = resourceapi.DeviceAttribute{StringValue: ptr.To(resourceName)}
+	}
+	return device
+}
+
+var _ = Describe("Pools", func() {
+	devices := types.AllocatableDevices{
+		"0000-01-00-2": newPoolTestDevice("0000-01-00-2", "eth0", "fast"),
+		"0000-01-00-1": newPoolTestDevice("0000-01-00-1", "eth0", "fast"),
+		"0000-02-00-1": newPoolTestDevice("0000-02-00-1", "eth1", ""),
+	}
+
+	Context("ValidatePartitionMode", func() {
+		It("accepts the supported modes", func() {
+			Expect(ValidatePartitionMode(PartitionByNode)).To(Succeed())
+			Expect(ValidatePartitionMode(PartitionByPF)).To(Succeed())
+			Expect(ValidatePartitionMode(PartitionByResourceName)).To(Succeed())
+		})
+
+		It("rejects unknown modes", func() {
+			Expect(ValidatePartitionMode("vendor")).To(MatchError(ContainSubstring("unsupported resource slice partition")))
+		})
+	})
+
+	Context("buildPools", func() {
+		It("publishes a single pool named after the node", func() {
+			pools := buildPools("node1", PartitionByNode, devices)
+			Expect(pools).To(HaveLen(1))
+			Expect(pools).To(HaveKey("node1"))
+			Expect(pools["node1"].Slices).To(HaveLen(1))
+			Expect(pools["node1"].Slices[0].Devices).To(HaveLen(3))
+		})
+
+		It("splits devices by PF with sorted devices", func() {
+			pools := buildPools("node1", PartitionByPF, devices)
+			Expect(pools).To(HaveLen(2))
+			Expect(pools).To(HaveKey("node1/eth0"))
+			Expect(pools).To(HaveKey("node1/eth1"))
+
+			eth0 := pools["node1/eth0"].Slices[0].Devices
+			Expect(eth0).To(HaveLen(2))
+			Expect(eth0[0].Name).To(Equal("0000-01-00-1"))
+			Expect(eth0[1].Name).To(Equal("0000-01-00-2"))
+		})
+
+		It("splits devices by resource name and keeps unassigned devices in the node pool", func() {
+			pools := buildPools("node1", PartitionByResourceName, devices)
+			Expect(pools).To(HaveLen(2))
+			Expect(pools["node1/fast"].Slices[0].Devices).To(HaveLen(2))
+			Expect(pools["node1"].Slices[0].Devices).To(HaveLen(1))
+		})
+
+		It("publishes an empty node pool when there are no devices", func() {
+			pools := buildPools("node1", PartitionByPF, types.AllocatableDevices{})
+			Expect(pools).To(HaveLen(1))
+			Expect(pools["node1"].Slices).To(HaveLen(1))
+			Expect(pools["node1"].Slices[0].Devices).To(BeEmpty())
+		})
+
+		It("chunks large pools into slices of at most ResourceSliceMaxDevices", func() {
+			many := types.AllocatableDevices{}
+			for i := range resourceapi.ResourceSliceMaxDevices + 10 {
+				name := fmt.Sprintf("0000-01-%02x-%d", i/8, i%8)
+				many[name] = newPoolTestDevice(name, "eth0", "")
+			}
+			pools := buildPools("node1", PartitionByPF, many)
+			Expect(pools["node1/eth0"].Slices).To(HaveLen(2))
+			Expect(pools["node1/eth0"].Slices[0].Devices).To(HaveLen(resourceapi.ResourceSliceMaxDevices))
+			Expect(pools["node1/eth0"].Slices[1].Devices).To(HaveLen(10))
+		})
+
+		It("is deterministic across calls", func() {
+			Expect(buildPools("node1", PartitionByPF, devices)).To(Equal(buildPools("node1", PartitionByPF, devices)))
+		})
+	})
+
+	Context("poolName", func() {
+		It("sanitizes the partition key", func() {
+			Expect(poolName("node1", PartitionByResourceName, newPoolTestDevice("d", "eth0", "High_Perf"))).To(Equal("node1/high-perf"))
+		})
+
+		It("limits the pool name length", func() {
+			name := poolName("node1", PartitionByResourceName, newPoolTestDevice("d", "eth0", strings.Repeat("a", 300)))
+			Expect(len(name)).To(BeNumerically("<=", resourceapi.PoolNameMaxLength))
+		})
+	})
+})
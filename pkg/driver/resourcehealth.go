@@ -0,0 +1,91 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package driver
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+	drahealthv1alpha1 "k8s.io/kubelet/pkg/apis/dra-health/v1alpha1"
+
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/devicestate"
+	sriovdratype "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
+)
+
+// resourceHealthResendInterval is how often the health of all the devices is sent again to
+// the kubelet, so it doesn't consider it stale when nothing changed.
+const resourceHealthResendInterval = 30 * time.Second
+
+// NodeWatchResources streams the health of the devices to the kubelet, which reports it in
+// the status of the pods the devices are allocated to. The health of all the devices is sent
+// when the stream is opened, every time it changes and periodically.
+func (d *Driver) NodeWatchResources(_ *drahealthv1alpha1.NodeWatchResourcesRequest, stream drahealthv1alpha1.DRAResourceHealth_NodeWatchResourcesServer) error {
+	ctx := stream.Context()
+	logger := klog.FromContext(ctx).WithName("NodeWatchResources")
+	logger.V(1).Info("Kubelet started watching the device health")
+
+	updates, unsubscribe := d.deviceStateManager.SubscribeHealthUpdates()
+	defer unsubscribe()
+	ticker := time.NewTicker(resourceHealthResendInterval)
+	defer ticker.Stop()
+
+	for {
+		response := deviceHealthResponse(d.config.Flags, d.deviceStateManager.GetAllocatableDevices(), time.Now())
+		logger.V(3).Info("Sending device health", "devices", len(response.Devices))
+		if err := stream.Send(response); err != nil {
+			return fmt.Errorf("failed to send device health: %w", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			logger.V(1).Info("Kubelet stopped watching the device health")
+			return nil
+		case <-updates:
+		case <-ticker.C:
+		}
+	}
+}
+
+// deviceHealthResponse returns the health of the devices, identified by the pool they are
+// published in. The health is unknown when the devices are not monitored.
+func deviceHealthResponse(flags *sriovdratype.Flags, devices sriovdratype.AllocatableDevices, now time.Time) *drahealthv1alpha1.NodeWatchResourcesResponse {
+	response := &drahealthv1alpha1.NodeWatchResourcesResponse{}
+	for _, device := range devices {
+		health := drahealthv1alpha1.HealthStatus_UNKNOWN
+		if flags.DeviceHealthCheckInterval > 0 {
+			health = drahealthv1alpha1.HealthStatus_HEALTHY
+			if !devicestate.IsDeviceHealthy(device) {
+				health = drahealthv1alpha1.HealthStatus_UNHEALTHY
+			}
+		}
+		response.Devices = append(response.Devices, &drahealthv1alpha1.DeviceHealth{
+			Device: &drahealthv1alpha1.DeviceIdentifier{
+				PoolName:   poolName(flags.NodeName, flags.ResourceSlicePartition, device),
+				DeviceName: device.Name,
+			},
+			Health:          health,
+			LastUpdatedTime: now.Unix(),
+		})
+	}
+	slices.SortFunc(response.Devices, func(a, b *drahealthv1alpha1.DeviceHealth) int {
+		return strings.Compare(a.Device.DeviceName, b.Device.DeviceName)
+	})
+	return response
+}
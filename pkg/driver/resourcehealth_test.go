@@ -0,0 +1,92 @@
+package driver
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	resourceapi "k8s.io/api/resource/v1"
+	drahealthv1alpha1 "k8s.io/kubelet/pkg/apis/dra-health/v1alpha1"
+	"k8s.io/utils/ptr"
+
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/devicestate"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
+)
+
+type fakeHealthStream struct {
+	grpc.ServerStream
+	ctx       context.Context
+	responses chan *drahealthv1alpha1.NodeWatchResourcesResponse
+}
+
+func (f *fakeHealthStream) Context() context.Context {
+	return f.ctx
+}
+
+func (f *fakeHealthStream) Send(response *drahealthv1alpha1.NodeWatchResourcesResponse) error {
+	f.responses <- response
+	return nil
+}
+
+var _ = Describe("Resource health", func() {
+	devices := types.AllocatableDevices{
+		"0000-01-00-2": {
+			Name: "0000-01-00-2",
+			Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				consts.AttributePFName: {StringValue: ptr.To("eth0")},
+			},
+			Taints: []resourceapi.DeviceTaint{{Key: consts.TaintLinkDown, Value: "eth0", Effect: resourceapi.DeviceTaintEffectNoSchedule}},
+		},
+		"0000-01-00-1": {
+			Name: "0000-01-00-1",
+			Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				consts.AttributePFName: {StringValue: ptr.To("eth0")},
+			},
+			Taints: []resourceapi.DeviceTaint{{Key: consts.TaintHostDevice, Value: "inUse", Effect: resourceapi.DeviceTaintEffectNoSchedule}},
+		},
+	}
+	now := time.Unix(1700000000, 0)
+
+	It("reports the devices with health taints as unhealthy", func() {
+		flags := &types.Flags{NodeName: "node1", ResourceSlicePartition: PartitionByPF, DeviceHealthCheckInterval: time.Second}
+		response := deviceHealthResponse(flags, devices, now)
+		Expect(response.Devices).To(HaveLen(2))
+		Expect(response.Devices[0].Device.PoolName).To(Equal("node1/eth0"))
+		Expect(response.Devices[0].Device.DeviceName).To(Equal("0000-01-00-1"))
+		Expect(response.Devices[0].Health).To(Equal(drahealthv1alpha1.HealthStatus_HEALTHY))
+		Expect(response.Devices[0].LastUpdatedTime).To(Equal(now.Unix()))
+		Expect(response.Devices[1].Device.DeviceName).To(Equal("0000-01-00-2"))
+		Expect(response.Devices[1].Health).To(Equal(drahealthv1alpha1.HealthStatus_UNHEALTHY))
+	})
+
+	It("reports an unknown health when the devices are not monitored", func() {
+		flags := &types.Flags{NodeName: "node1", ResourceSlicePartition: PartitionByNode}
+		response := deviceHealthResponse(flags, devices, now)
+		Expect(response.Devices).To(HaveLen(2))
+		for _, device := range response.Devices {
+			Expect(device.Device.PoolName).To(Equal("node1"))
+			Expect(device.Health).To(Equal(drahealthv1alpha1.HealthStatus_UNKNOWN))
+		}
+	})
+
+	It("sends the device health when the stream is opened until it is closed", func() {
+		d := &Driver{
+			config:             &types.Config{Flags: &types.Flags{NodeName: "node1"}},
+			deviceStateManager: &devicestate.Manager{},
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		stream := &fakeHealthStream{ctx: ctx, responses: make(chan *drahealthv1alpha1.NodeWatchResourcesResponse, 1)}
+
+		done := make(chan error)
+		go func() {
+			done <- d.NodeWatchResources(&drahealthv1alpha1.NodeWatchResourcesRequest{}, stream)
+		}()
+		Eventually(stream.responses).Should(Receive())
+
+		cancel()
+		Eventually(done).Should(Receive(BeNil()))
+	})
+})
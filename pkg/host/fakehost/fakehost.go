@@ -0,0 +1,775 @@
+// Package fakehost implements an in-memory host.Interface simulating SR-IOV PFs, their VFs
+// and SFs, driver bindings, IOMMU groups, RDMA devices and kernel modules, for end-to-end
+// unit tests of the driver without a real host.
+package fakehost
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jaypipes/ghw"
+	"github.com/jaypipes/ghw/pkg/pci"
+	"github.com/jaypipes/pcidb"
+
+	configapi "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/virtualfunction/v1alpha1"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/audit"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
+)
+
+// sfPortIndexBase is the devlink port index of the first SF created on a fake host
+const sfPortIndexBase = 32768
+
+// PF is a simulated SR-IOV physical function
+type PF struct {
+	PciAddress       string
+	NetName          string
+	VendorID         string
+	DeviceID         string
+	Driver           string
+	EswitchMode      string // "legacy" when empty
+	NumaNode         string
+	PCIeRoot         string
+	ParentPciAddress string
+	RDMADevice       string
+	Link             host.LinkInfo
+	VFs              []VF
+	SFs              []host.SFInfo
+}
+
+// VF is a simulated SR-IOV virtual function. The driver it is created with is its default
+// driver.
+type VF struct {
+	PciAddress string
+	VFID       int
+	DeviceID   string
+	NetName    string // netdev name while bound to a kernel driver
+	Driver     string
+	IOMMUGroup string
+	RDMADevice string // RDMA device while bound to a kernel driver
+	MAC        string
+	GUID       string
+	Settings   types.VFLinkSettings // link settings applied through the PF
+	MTU        int                  // MTU of the netdev, 1500 when not set
+	Resets     int                  // number of function level resets
+	// AuditFields are the audit fields of the last driver change
+	AuditFields audit.Fields
+
+	pfPciAddress  string
+	defaultDriver string
+}
+
+// Host is an in-memory host.Interface. It is safe for concurrent use.
+type Host struct {
+	mutex         sync.Mutex
+	pfs           []*PF
+	vfs           map[string]*VF // VF PCI address to VF
+	modules       map[string]bool
+	hostUsage     map[string]string // interface name to host usage
+	aerCounters   map[string]host.AERCounters
+	rdmaNetnsMode string
+	rdmaNetns     map[string]string // RDMA device to network namespace path
+	nextPortIndex uint32
+	linkUpdates   []chan string
+	// Errors returned by the methods of the same name, for failure tests
+	BindDriverErr error
+	CreateSFErr   error
+	ResetErr      error
+}
+
+var _ host.Interface = &Host{}
+
+// New returns a fake host with the given PFs
+func New(pfs ...PF) *Host {
+	h := &Host{
+		vfs:           map[string]*VF{},
+		modules:       map[string]bool{},
+		hostUsage:     map[string]string{},
+		aerCounters:   map[string]host.AERCounters{},
+		rdmaNetnsMode: "shared",
+		rdmaNetns:     map[string]string{},
+		nextPortIndex: sfPortIndexBase,
+	}
+	for i := range pfs {
+		pf := pfs[i]
+		pf.VFs = append([]VF(nil), pf.VFs...)
+		for j := range pf.VFs {
+			pf.VFs[j].pfPciAddress = pf.PciAddress
+			pf.VFs[j].defaultDriver = pf.VFs[j].Driver
+			if pf.VFs[j].MTU == 0 {
+				pf.VFs[j].MTU = 1500
+			}
+			h.vfs[pf.VFs[j].PciAddress] = &pf.VFs[j]
+		}
+		pf.SFs = append([]host.SFInfo(nil), pf.SFs...)
+		h.pfs = append(h.pfs, &pf)
+	}
+	return h
+}
+
+// VF returns a copy of the current state of a VF
+func (h *Host) VF(pciAddress string) (VF, bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	vf, ok := h.vfs[pciAddress]
+	if !ok {
+		return VF{}, false
+	}
+	return *vf, true
+}
+
+// SetHostUsage marks an interface as used by the host, an empty reason clears it
+func (h *Host) SetHostUsage(ifName, reason string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.hostUsage[ifName] = reason
+}
+
+// SetAERCounters sets the PCIe AER error counters of a device
+func (h *Host) SetAERCounters(pciAddress string, counters host.AERCounters) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.aerCounters[pciAddress] = counters
+}
+
+// SetRDMANetnsMode sets the RDMA subsystem network namespace mode
+func (h *Host) SetRDMANetnsMode(mode string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.rdmaNetnsMode = mode
+}
+
+// RDMADeviceNetns returns the network namespace an RDMA device was moved to, empty when it
+// is in the host network namespace
+func (h *Host) RDMADeviceNetns(rdmaDevice string) string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.rdmaNetns[rdmaDevice]
+}
+
+// SetLink updates the link of a PF and notifies the link update subscribers
+func (h *Host) SetLink(pfName string, link host.LinkInfo) error {
+	h.mutex.Lock()
+	pf := h.pfByName(pfName)
+	if pf == nil {
+		h.mutex.Unlock()
+		return fmt.Errorf("PF %s not found", pfName)
+	}
+	pf.Link = link
+	subscribers := append([]chan string(nil), h.linkUpdates...)
+	h.mutex.Unlock()
+
+	for _, updates := range subscribers {
+		select {
+		case updates <- pfName:
+		default:
+		}
+	}
+	return nil
+}
+
+func (h *Host) pfByAddress(pciAddress string) *PF {
+	for _, pf := range h.pfs {
+		if pf.PciAddress == pciAddress {
+			return pf
+		}
+	}
+	return nil
+}
+
+func (h *Host) pfByName(name string) *PF {
+	for _, pf := range h.pfs {
+		if pf.NetName == name {
+			return pf
+		}
+	}
+	return nil
+}
+
+// pfOf returns the PF of a PF or VF PCI address
+func (h *Host) pfOf(pciAddress string) *PF {
+	if vf, ok := h.vfs[pciAddress]; ok {
+		return h.pfByAddress(vf.pfPciAddress)
+	}
+	return h.pfByAddress(pciAddress)
+}
+
+func (h *Host) vfByID(pfName string, vfID int) (*VF, error) {
+	pf := h.pfByName(pfName)
+	if pf == nil {
+		return nil, fmt.Errorf("PF %s not found", pfName)
+	}
+	for i := range pf.VFs {
+		if pf.VFs[i].VFID == vfID {
+			return h.vfs[pf.VFs[i].PciAddress], nil
+		}
+	}
+	return nil, fmt.Errorf("VF %d of %s not found", vfID, pfName)
+}
+
+// IsSriovVF returns true for the PCI addresses of the VFs
+func (h *Host) IsSriovVF(pciAddress string) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	_, ok := h.vfs[pciAddress]
+	return ok
+}
+
+// IsSriovPF returns true for the PCI addresses of the PFs
+func (h *Host) IsSriovPF(pciAddress string) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.pfByAddress(pciAddress) != nil
+}
+
+// GetVFList returns the VFs of a PF
+func (h *Host) GetVFList(pfPciAddress string) ([]host.VFInfo, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	pf := h.pfByAddress(pfPciAddress)
+	if pf == nil {
+		return nil, fmt.Errorf("failed to read PF directory %s", pfPciAddress)
+	}
+	vfs := []host.VFInfo{}
+	for _, vf := range pf.VFs {
+		vfs = append(vfs, host.VFInfo{PciAddress: vf.PciAddress, VFID: vf.VFID, DeviceID: vf.DeviceID})
+	}
+	return vfs, nil
+}
+
+// GetSFList returns the SFs of a PF
+func (h *Host) GetSFList(pfPciAddress string) ([]host.SFInfo, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	pf := h.pfByAddress(pfPciAddress)
+	if pf == nil {
+		return nil, fmt.Errorf("failed to read PCI device %s", pfPciAddress)
+	}
+	return append([]host.SFInfo{}, pf.SFs...), nil
+}
+
+// CreateSF adds an active SF to a PF in switchdev mode
+func (h *Host) CreateSF(pfPciAddress string, sfNum int) (*host.SFInfo, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.CreateSFErr != nil {
+		return nil, h.CreateSFErr
+	}
+	pf := h.pfByAddress(pfPciAddress)
+	if pf == nil {
+		return nil, fmt.Errorf("PF %s not found", pfPciAddress)
+	}
+	if pf.EswitchMode != "switchdev" {
+		return nil, fmt.Errorf("PF %s is not in switchdev mode", pfPciAddress)
+	}
+	for _, sf := range pf.SFs {
+		if sf.SFNum == sfNum {
+			return nil, fmt.Errorf("SF %d of %s already exists", sfNum, pfPciAddress)
+		}
+	}
+	sf := host.SFInfo{
+		AuxDevice: fmt.Sprintf("%s.sf.%d", pf.Driver, h.nextPortIndex-sfPortIndexBase+1),
+		SFNum:     sfNum,
+		NetName:   fmt.Sprintf("%ss%d", pf.NetName, sfNum),
+		PortIndex: h.nextPortIndex,
+	}
+	h.nextPortIndex++
+	pf.SFs = append(pf.SFs, sf)
+	return &sf, nil
+}
+
+// DeleteSF removes an SF created by CreateSF
+func (h *Host) DeleteSF(pfPciAddress string, portIndex uint32) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	pf := h.pfByAddress(pfPciAddress)
+	if pf == nil {
+		return fmt.Errorf("PF %s not found", pfPciAddress)
+	}
+	for i, sf := range pf.SFs {
+		if sf.PortIndex == portIndex && portIndex != 0 {
+			pf.SFs = append(pf.SFs[:i], pf.SFs[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("failed to delete SF port %d of %s: not found", portIndex, pfPciAddress)
+}
+
+// PCI returns the PFs and VFs as network PCI devices
+func (h *Host) PCI() (*ghw.PCIInfo, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	info := &pci.Info{}
+	for _, pf := range h.pfs {
+		info.Devices = append(info.Devices, newPCIDevice(pf.PciAddress, pf.VendorID, pf.DeviceID))
+		for _, vf := range pf.VFs {
+			info.Devices = append(info.Devices, newPCIDevice(vf.PciAddress, pf.VendorID, vf.DeviceID))
+		}
+	}
+	return info, nil
+}
+
+func newPCIDevice(address, vendorID, deviceID string) *pci.Device {
+	return &pci.Device{
+		Address: address,
+		Class:   &pcidb.Class{ID: fmt.Sprintf("%02x", consts.NetClass)},
+		Vendor:  &pcidb.Vendor{ID: vendorID},
+		Product: &pcidb.Product{ID: deviceID},
+	}
+}
+
+// TryGetInterfaceName returns the netdev of a PF, or of a VF bound to a kernel driver
+func (h *Host) TryGetInterfaceName(pciAddr string) string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if vf, ok := h.vfs[pciAddr]; ok {
+		if vf.Driver == "" || isDpdkDriver(vf.Driver) {
+			return ""
+		}
+		return vf.NetName
+	}
+	if pf := h.pfByAddress(pciAddr); pf != nil {
+		return pf.NetName
+	}
+	return ""
+}
+
+// GetNicSriovMode returns the eswitch mode of a PF
+func (h *Host) GetNicSriovMode(pciAddr string) string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if pf := h.pfByAddress(pciAddr); pf != nil && pf.EswitchMode != "" {
+		return pf.EswitchMode
+	}
+	return "legacy"
+}
+
+// GetLinkSpeed returns the link speed of a PF in Mbps
+func (h *Host) GetLinkSpeed(ifName string) (int, error) {
+	link, err := h.GetLinkInfo(ifName)
+	if err != nil {
+		return 0, err
+	}
+	return link.Speed, nil
+}
+
+// GetLinkInfo returns the link of a PF, or the MTU of the netdev of a VF
+func (h *Host) GetLinkInfo(ifName string) (*host.LinkInfo, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if vf := h.vfByNetName(ifName); vf != nil {
+		return &host.LinkInfo{MTU: vf.MTU}, nil
+	}
+	pf := h.pfByName(ifName)
+	if pf == nil {
+		return nil, fmt.Errorf("link %s not found", ifName)
+	}
+	link := pf.Link
+	return &link, nil
+}
+
+// SetLinkMTU sets the MTU of the netdev of a VF
+func (h *Host) SetLinkMTU(ifName string, mtu int) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	vf := h.vfByNetName(ifName)
+	if vf == nil {
+		return fmt.Errorf("link %s not found", ifName)
+	}
+	vf.MTU = mtu
+	return nil
+}
+
+// vfByNetName returns the VF whose netdev has the name, while it is bound to a kernel driver
+func (h *Host) vfByNetName(ifName string) *VF {
+	for _, vf := range h.vfs {
+		if vf.NetName == ifName && vf.Driver != "" && !isDpdkDriver(vf.Driver) {
+			return vf
+		}
+	}
+	return nil
+}
+
+// SubscribeLinkUpdates returns the names of the PFs updated with SetLink
+func (h *Host) SubscribeLinkUpdates(ctx context.Context) (<-chan string, error) {
+	updates := make(chan string, 16)
+	h.mutex.Lock()
+	h.linkUpdates = append(h.linkUpdates, updates)
+	h.mutex.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		for i, subscriber := range h.linkUpdates {
+			if subscriber == updates {
+				h.linkUpdates = append(h.linkUpdates[:i], h.linkUpdates[i+1:]...)
+				break
+			}
+		}
+		close(updates)
+	}()
+	return updates, nil
+}
+
+// GetHostUsage returns the host usage set with SetHostUsage
+func (h *Host) GetHostUsage(ifName string) (string, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.hostUsage[ifName], nil
+}
+
+// GetNumaNode returns the NUMA node of the PF of a device
+func (h *Host) GetNumaNode(pciAddress string) (string, error) {
+	pf, err := h.getPF(pciAddress)
+	if err != nil {
+		return "", err
+	}
+	if pf.NumaNode == "" {
+		return "0", nil
+	}
+	return pf.NumaNode, nil
+}
+
+// GetPCIeRoot returns the PCIe root complex of the PF of a device
+func (h *Host) GetPCIeRoot(pciAddress string) (string, error) {
+	pf, err := h.getPF(pciAddress)
+	if err != nil {
+		return "", err
+	}
+	return pf.PCIeRoot, nil
+}
+
+// GetParentPciAddress returns the parent PCI address of a PF, or the PF of a VF
+func (h *Host) GetParentPciAddress(pciAddress string) (string, error) {
+	if h.IsSriovVF(pciAddress) {
+		pf, err := h.getPF(pciAddress)
+		if err != nil {
+			return "", err
+		}
+		return pf.PciAddress, nil
+	}
+	pf, err := h.getPF(pciAddress)
+	if err != nil {
+		return "", err
+	}
+	return pf.ParentPciAddress, nil
+}
+
+func (h *Host) getPF(pciAddress string) (PF, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	pf := h.pfOf(pciAddress)
+	if pf == nil {
+		return PF{}, fmt.Errorf("device %s not found", pciAddress)
+	}
+	return *pf, nil
+}
+
+// GetAERCounters returns the counters set with SetAERCounters
+func (h *Host) GetAERCounters(pciAddress string) (*host.AERCounters, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	counters := h.aerCounters[pciAddress]
+	return &counters, nil
+}
+
+// BindDeviceDriver binds a device to the driver of the config, like the real host
+func (h *Host) BindDeviceDriver(pciAddress string, config *configapi.VfConfig, fields audit.Fields) (string, error) {
+	if config.Driver == "" {
+		return "", nil
+	}
+	currentDriver, err := h.GetDriverByBusAndDevice(pciAddress)
+	if err != nil {
+		return "", err
+	}
+	if config.Driver == "default" {
+		return currentDriver, h.bindDefaultDriver(pciAddress, fields)
+	}
+	if err := h.EnsureDpdkModuleLoaded(config.Driver); err != nil {
+		return "", err
+	}
+	if err := h.BindDriverByBusAndDevice(pciAddress, config.Driver, fields); err != nil {
+		return "", fmt.Errorf("failed to bind device %s to driver %s: %w", pciAddress, config.Driver, err)
+	}
+	return currentDriver, nil
+}
+
+// RestoreDeviceDriver binds a device back to its original driver, or its default driver
+func (h *Host) RestoreDeviceDriver(pciAddress string, originalDriver string, fields audit.Fields) error {
+	if originalDriver == "" {
+		return h.bindDefaultDriver(pciAddress, fields)
+	}
+	return h.BindDriverByBusAndDevice(pciAddress, originalDriver, fields)
+}
+
+// GetDriverByBusAndDevice returns the driver a VF is bound to
+func (h *Host) GetDriverByBusAndDevice(device string) (string, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if vf, ok := h.vfs[device]; ok {
+		return vf.Driver, nil
+	}
+	if pf := h.pfByAddress(device); pf != nil {
+		return pf.Driver, nil
+	}
+	return "", fmt.Errorf("device %s not found", device)
+}
+
+// BindDriverByBusAndDevice binds a VF to a driver
+func (h *Host) BindDriverByBusAndDevice(device, driver string, fields audit.Fields) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.BindDriverErr != nil {
+		return h.BindDriverErr
+	}
+	vf, ok := h.vfs[device]
+	if !ok {
+		return fmt.Errorf("VF %s not found", device)
+	}
+	vf.Driver = driver
+	vf.AuditFields = fields
+	return nil
+}
+
+// UnbindDriverByBusAndDevice unbinds a VF from its driver
+func (h *Host) UnbindDriverByBusAndDevice(device string, fields audit.Fields) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	vf, ok := h.vfs[device]
+	if !ok {
+		return fmt.Errorf("VF %s not found", device)
+	}
+	vf.Driver = ""
+	vf.AuditFields = fields
+	return nil
+}
+
+// BindDefaultDriver binds a VF back to the driver it was created with
+func (h *Host) BindDefaultDriver(pciAddress string) error {
+	return h.bindDefaultDriver(pciAddress, audit.Fields{})
+}
+
+func (h *Host) bindDefaultDriver(pciAddress string, fields audit.Fields) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	vf, ok := h.vfs[pciAddress]
+	if !ok {
+		return fmt.Errorf("VF %s not found", pciAddress)
+	}
+	vf.Driver = vf.defaultDriver
+	vf.AuditFields = fields
+	return nil
+}
+
+// ResetDevice counts the function level resets of a VF
+func (h *Host) ResetDevice(pciAddress string) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.ResetErr != nil {
+		return h.ResetErr
+	}
+	vf, ok := h.vfs[pciAddress]
+	if !ok {
+		return fmt.Errorf("VF %s not found", pciAddress)
+	}
+	vf.Resets++
+	return nil
+}
+
+// IsDpdkDriver returns true for the DPDK drivers, like the real host
+func (h *Host) IsDpdkDriver(driver string) bool {
+	return isDpdkDriver(driver)
+}
+
+func isDpdkDriver(driver string) bool {
+	return driver == "vfio-pci" || driver == "uio_pci_generic" || driver == "igb_uio"
+}
+
+// GetVFIODeviceFile returns the VFIO device of the IOMMU group of a VF bound to vfio-pci
+func (h *Host) GetVFIODeviceFile(pciAddress string) (devFileHost, devFileContainer string, err error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	vf, ok := h.vfs[pciAddress]
+	if !ok || vf.IOMMUGroup == "" {
+		return "", "", fmt.Errorf("GetVFIODeviceFile(): unable to find iommu_group of %s", pciAddress)
+	}
+	devFile := filepath.Join("/dev/vfio", vf.IOMMUGroup)
+	return devFile, devFile, nil
+}
+
+// GetRDMADevice returns the RDMA device of a PF, or of a VF bound to a kernel driver
+func (h *Host) GetRDMADevice(pciAddress string) (string, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if vf, ok := h.vfs[pciAddress]; ok {
+		if vf.Driver == "" || isDpdkDriver(vf.Driver) {
+			return "", nil
+		}
+		return vf.RDMADevice, nil
+	}
+	if pf := h.pfByAddress(pciAddress); pf != nil {
+		return pf.RDMADevice, nil
+	}
+	return "", nil
+}
+
+// GetRDMACharDevices returns the uverbs, umad and rdma_cm devices of a device with an RDMA
+// device. The uverbs and umad devices are numbered after the RDMA device, e.g. mlx5_3.
+func (h *Host) GetRDMACharDevices(pciAddress string) ([]string, error) {
+	rdmaDevice, err := h.GetRDMADevice(pciAddress)
+	if err != nil {
+		return nil, err
+	}
+	if rdmaDevice == "" {
+		return nil, fmt.Errorf("no uverbs or umad device found for %s", pciAddress)
+	}
+	index := rdmaDevice[strings.LastIndex(rdmaDevice, "_")+1:]
+	return []string{
+		filepath.Join(consts.RDMACharDevicesDir, "uverbs"+index),
+		filepath.Join(consts.RDMACharDevicesDir, "umad"+index),
+		filepath.Join(consts.RDMACharDevicesDir, "rdma_cm"),
+	}, nil
+}
+
+// GetRDMANetnsMode returns the mode set with SetRDMANetnsMode, "shared" by default
+func (h *Host) GetRDMANetnsMode() (string, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.rdmaNetnsMode, nil
+}
+
+// MoveRDMADeviceToNetns records the network namespace of an RDMA device
+func (h *Host) MoveRDMADeviceToNetns(rdmaDevice, netnsPath string) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.rdmaNetns[rdmaDevice] = netnsPath
+	return nil
+}
+
+// RestoreRDMADeviceNetns moves an RDMA device back to the host network namespace
+func (h *Host) RestoreRDMADeviceNetns(rdmaDevice, netnsPath string) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.rdmaNetns[rdmaDevice] != netnsPath {
+		return fmt.Errorf("RDMA device %s is not in network namespace %s", rdmaDevice, netnsPath)
+	}
+	delete(h.rdmaNetns, rdmaDevice)
+	return nil
+}
+
+// SetVFLinkSettings applies the set fields of the settings to a VF
+func (h *Host) SetVFLinkSettings(pfName string, vfID int, settings *types.VFLinkSettings) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	vf, err := h.vfByID(pfName, vfID)
+	if err != nil {
+		return err
+	}
+	current := &vf.Settings
+	if settings.Vlan != nil {
+		current.Vlan = settings.Vlan
+		current.VlanQoS = settings.VlanQoS
+	}
+	if settings.MAC != "" {
+		current.MAC = settings.MAC
+		vf.MAC = settings.MAC
+	}
+	for _, field := range []struct{ value, current *string }{
+		{&settings.SpoofChk, &current.SpoofChk},
+		{&settings.Trust, &current.Trust},
+		{&settings.LinkState, &current.LinkState},
+	} {
+		if *field.value != "" {
+			*field.current = *field.value
+		}
+	}
+	if settings.MinTxRate != nil {
+		current.MinTxRate = settings.MinTxRate
+	}
+	if settings.MaxTxRate != nil {
+		current.MaxTxRate = settings.MaxTxRate
+	}
+	return nil
+}
+
+// GetVFHardwareAddress returns the MAC address of a VF
+func (h *Host) GetVFHardwareAddress(pciAddress, pfName string, vfID int) (string, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	vf, err := h.vfByID(pfName, vfID)
+	if err != nil {
+		return "", err
+	}
+	return vf.MAC, nil
+}
+
+// SetVFGUID sets the GUID of a VF
+func (h *Host) SetVFGUID(pciAddress, pfName string, vfID int, guid string, fields audit.Fields) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	vf, err := h.vfByID(pfName, vfID)
+	if err != nil {
+		return err
+	}
+	vf.GUID = guid
+	return nil
+}
+
+// IsKernelModuleLoaded returns true for the modules loaded with LoadKernelModule
+func (h *Host) IsKernelModuleLoaded(moduleName string) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.modules[moduleName]
+}
+
+// LoadKernelModule loads a kernel module
+func (h *Host) LoadKernelModule(moduleName string) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.modules[moduleName] = true
+	return nil
+}
+
+// LoadedKernelModules returns the sorted names of the loaded kernel modules
+func (h *Host) LoadedKernelModules() []string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	modules := []string{}
+	for module := range h.modules {
+		modules = append(modules, module)
+	}
+	sort.Strings(modules)
+	return modules
+}
+
+// EnsureDpdkModuleLoaded loads the modules of vfio-pci
+func (h *Host) EnsureDpdkModuleLoaded(driver string) error {
+	if !isDpdkDriver(driver) {
+		return nil
+	}
+	if driver != "vfio-pci" {
+		return fmt.Errorf("unknown DPDK driver: %s", driver)
+	}
+	for _, module := range []string{"vfio", "vfio_pci"} {
+		if err := h.LoadKernelModule(module); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EnsureVhostModulesLoaded loads the tun and vhost_net modules
+func (h *Host) EnsureVhostModulesLoaded(fields audit.Fields) error {
+	for _, module := range []string{"tun", "vhost_net"} {
+		if err := h.LoadKernelModule(module); err != nil {
+			return err
+		}
+	}
+	return nil
+}
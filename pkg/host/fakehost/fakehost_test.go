@@ -0,0 +1,94 @@
+package fakehost_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	configapi "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/virtualfunction/v1alpha1"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/audit"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host/fakehost"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
+)
+
+var _ = Describe("Host", func() {
+	var h *fakehost.Host
+
+	BeforeEach(func() {
+		h = fakehost.New(fakehost.PF{
+			PciAddress:  "0000:01:00.0",
+			NetName:     "eth0",
+			VendorID:    "15b3",
+			DeviceID:    "101d",
+			Driver:      "mlx5_core",
+			EswitchMode: "switchdev",
+			RDMADevice:  "mlx5_0",
+			VFs: []fakehost.VF{
+				{PciAddress: "0000:01:00.2", VFID: 0, DeviceID: "101e", NetName: "eth0v0", Driver: "mlx5_core", IOMMUGroup: "7", RDMADevice: "mlx5_2"},
+			},
+		})
+	})
+
+	It("reports the PFs and VFs as network PCI devices", func() {
+		info, err := h.PCI()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Devices).To(HaveLen(2))
+		Expect(h.IsSriovPF("0000:01:00.0")).To(BeTrue())
+		Expect(h.IsSriovVF("0000:01:00.2")).To(BeTrue())
+
+		vfs, err := h.GetVFList("0000:01:00.0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(vfs).To(ConsistOf(HaveField("PciAddress", "0000:01:00.2")))
+		Expect(h.GetNicSriovMode("0000:01:00.0")).To(Equal("switchdev"))
+	})
+
+	It("hides the netdev and RDMA device of a VF bound to a DPDK driver", func() {
+		originalDriver, err := h.BindDeviceDriver("0000:01:00.2", &configapi.VfConfig{Driver: "vfio-pci"}, audit.Fields{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(originalDriver).To(Equal("mlx5_core"))
+		Expect(h.TryGetInterfaceName("0000:01:00.2")).To(BeEmpty())
+		Expect(h.GetRDMADevice("0000:01:00.2")).To(BeEmpty())
+
+		devFile, _, err := h.GetVFIODeviceFile("0000:01:00.2")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(devFile).To(Equal("/dev/vfio/7"))
+
+		Expect(h.RestoreDeviceDriver("0000:01:00.2", originalDriver, audit.Fields{})).To(Succeed())
+		Expect(h.TryGetInterfaceName("0000:01:00.2")).To(Equal("eth0v0"))
+		Expect(h.GetRDMADevice("0000:01:00.2")).To(Equal("mlx5_2"))
+	})
+
+	It("creates and deletes SFs", func() {
+		sf, err := h.CreateSF("0000:01:00.0", 5)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sf.PortIndex).To(Equal(uint32(32768)))
+		Expect(h.GetSFList("0000:01:00.0")).To(ConsistOf(*sf))
+
+		_, err = h.CreateSF("0000:01:00.0", 5)
+		Expect(err).To(MatchError(ContainSubstring("already exists")))
+
+		Expect(h.DeleteSF("0000:01:00.0", sf.PortIndex)).To(Succeed())
+		Expect(h.GetSFList("0000:01:00.0")).To(BeEmpty())
+	})
+
+	It("applies VF link settings", func() {
+		Expect(h.SetVFLinkSettings("eth0", 0, &types.VFLinkSettings{Trust: "on", MAC: "02:00:00:00:00:01"})).To(Succeed())
+		vf, ok := h.VF("0000:01:00.2")
+		Expect(ok).To(BeTrue())
+		Expect(vf.Settings.Trust).To(Equal("on"))
+		Expect(h.GetVFHardwareAddress("0000:01:00.2", "eth0", 0)).To(Equal("02:00:00:00:00:01"))
+
+		Expect(h.SetVFLinkSettings("eth0", 3, &types.VFLinkSettings{Trust: "on"})).NotTo(Succeed())
+	})
+
+	It("notifies link updates", func(ctx SpecContext) {
+		updates, err := h.SubscribeLinkUpdates(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(h.SetLink("eth0", host.LinkInfo{Speed: 100000, OperState: "up", Carrier: true})).To(Succeed())
+		Eventually(updates).Should(Receive(Equal("eth0")))
+
+		link, err := h.GetLinkInfo("eth0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(link.Speed).To(Equal(100000))
+	})
+})
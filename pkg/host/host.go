@@ -4,19 +4,26 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
-	"sync"
 
 	"github.com/jaypipes/ghw"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/dynamic-resource-allocation/deviceattribute"
 	"k8s.io/klog/v2"
 
 	configapi "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/virtualfunction/v1alpha1"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/audit"
 	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
 )
 
 var (
@@ -51,6 +58,12 @@ func buildSysBusPciDriverPath(driver, subPath string) string {
 	return buildSysPath(basePath)
 }
 
+// writeSysfsFile writes a sysfs attribute file. The fake topologies of tests replace it
+// to emulate the kernel.
+var writeSysfsFile = func(path string, data []byte) error {
+	return os.WriteFile(path, data, os.ModeAppend)
+}
+
 // buildProcPath constructs a path under /proc with RootDir prefix if set
 func buildProcPath(path string) string {
 	if RootDir != "" {
@@ -66,6 +79,33 @@ type VFInfo struct {
 	DeviceID   string
 }
 
+// LinkInfo holds the link properties of a network interface
+type LinkInfo struct {
+	Speed           int // Mbps, 0 when unknown
+	MTU             int
+	OperState       string
+	Carrier         bool
+	PermAddress     string
+	Driver          string
+	DriverVersion   string
+	FirmwareVersion string
+	LinkLayer       string // consts.LinkLayerEthernet or consts.LinkLayerInfiniBand, empty when unknown
+}
+
+// SFInfo holds information about a scalable function (SF) of a PF
+type SFInfo struct {
+	AuxDevice string // auxiliary bus device name, e.g. mlx5_core.sf.2
+	SFNum     int
+	NetName   string
+	PortIndex uint32 // devlink port index, only set for the SFs returned by CreateSF
+}
+
+// AERCounters holds the total PCIe Advanced Error Reporting error counts of a device
+type AERCounters struct {
+	Fatal    int
+	NonFatal int
+}
+
 // Interface defines the unified interface for all host system operations.
 // This interface allows for easy mocking in unit tests by implementing mock versions
 // of all the host-related methods.
@@ -77,27 +117,40 @@ type Interface interface {
 	IsSriovPF(pciAddress string) bool
 	GetVFList(pfPciAddress string) ([]VFInfo, error)
 
+	// Scalable function (SF) functions
+	GetSFList(pfPciAddress string) ([]SFInfo, error)
+	CreateSF(pfPciAddress string, sfNum int) (*SFInfo, error)
+	DeleteSF(pfPciAddress string, portIndex uint32) error
+
 	// PCI device discovery functionality
 	PCI() (*ghw.PCIInfo, error)
 
 	// Network interface functions
 	TryGetInterfaceName(pciAddr string) string
 	GetNicSriovMode(pciAddr string) string
+	GetLinkSpeed(ifName string) (int, error)
+	GetLinkInfo(ifName string) (*LinkInfo, error)
+	SetLinkMTU(ifName string, mtu int) error
+	SubscribeLinkUpdates(ctx context.Context) (<-chan string, error)
+	GetHostUsage(ifName string) (string, error)
 
 	// NUMA and topology functions
 	GetNumaNode(pciAddress string) (string, error)
 	GetPCIeRoot(pciAddress string) (string, error)
 	GetParentPciAddress(pciAddress string) (string, error)
+	GetAERCounters(pciAddress string) (*AERCounters, error)
 
-	// Driver binding operations
-	BindDeviceDriver(pciAddress string, config *configapi.VfConfig) (string, error)
-	RestoreDeviceDriver(pciAddress string, originalDriver string) error
+	// Driver binding operations, the audit fields are recorded with the binds, unbinds and
+	// module loads they do
+	BindDeviceDriver(pciAddress string, config *configapi.VfConfig, fields audit.Fields) (string, error)
+	RestoreDeviceDriver(pciAddress string, originalDriver string, fields audit.Fields) error
 
 	// Low-level driver operations
 	GetDriverByBusAndDevice(device string) (string, error)
-	BindDriverByBusAndDevice(device, driver string) error
-	UnbindDriverByBusAndDevice(device string) error
+	BindDriverByBusAndDevice(device, driver string, fields audit.Fields) error
+	UnbindDriverByBusAndDevice(device string, fields audit.Fields) error
 	BindDefaultDriver(pciAddress string) error
+	ResetDevice(pciAddress string) error
 
 	// Driver utility functions
 	IsDpdkDriver(driver string) bool
@@ -105,42 +158,59 @@ type Interface interface {
 	// VFIO device functions
 	GetVFIODeviceFile(pciAddress string) (devFileHost, devFileContainer string, err error)
 
+	// RDMA device functions
+	GetRDMADevice(pciAddress string) (string, error)
+	GetRDMACharDevices(pciAddress string) ([]string, error)
+	GetRDMANetnsMode() (string, error)
+	MoveRDMADeviceToNetns(rdmaDevice, netnsPath string) error
+	RestoreRDMADeviceNetns(rdmaDevice, netnsPath string) error
+
+	// VF link configuration functions
+	SetVFLinkSettings(pfName string, vfID int, settings *types.VFLinkSettings) error
+	GetVFHardwareAddress(pciAddress, pfName string, vfID int) (string, error)
+	SetVFGUID(pciAddress, pfName string, vfID int, guid string, fields audit.Fields) error
+
 	// Kernel module management functions
 	IsKernelModuleLoaded(moduleName string) bool
 	LoadKernelModule(moduleName string) error
 	EnsureDpdkModuleLoaded(driver string) error
-	EnsureVhostModulesLoaded() error
+	EnsureVhostModulesLoaded(fields audit.Fields) error
 }
 
 // Host provides unified host system functionality for SR-IOV, PCI operations, and driver management
 type Host struct {
-	log klog.Logger
+	log      klog.Logger
+	auditLog *audit.Logger
+	// auditFields are recorded with the audit events, set on the copies returned by withAuditFields
+	auditFields audit.Fields
 }
 
-// NewHost creates a new Host instance
-func NewHost() Interface {
-	return &Host{
-		log: klog.FromContext(context.Background()).WithName("Host"),
+// Option configures a Host
+type Option func(*Host)
+
+// WithAuditLogger records the driver binds and unbinds and the module loads in the audit log
+func WithAuditLogger(auditLog *audit.Logger) Option {
+	return func(h *Host) {
+		h.auditLog = auditLog
 	}
 }
 
-// Global Helpers instance for use throughout the application
-var (
-	Helpers     Interface
-	helpersOnce sync.Once
-)
-
-// initHelpers initializes the global Helpers instance
-func initHelpers() {
-	helpersOnce.Do(func() {
-		Helpers = NewHost()
-	})
+// NewHost creates a new Host instance
+func NewHost(opts ...Option) Interface {
+	h := &Host{
+		log: klog.FromContext(context.Background()).WithName("Host"),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
-// GetHelpers returns the global Helpers instance, initializing it if necessary
-func GetHelpers() Interface {
-	initHelpers()
-	return Helpers
+// withAuditFields returns a copy of the host recording the fields with its audit events
+func (h *Host) withAuditFields(fields audit.Fields) *Host {
+	scoped := *h
+	scoped.auditFields = fields
+	return &scoped
 }
 
 // SR-IOV Detection Functions
@@ -217,10 +287,107 @@ func (h *Host) GetVFList(pfPciAddress string) ([]VFInfo, error) {
 	return vfList, nil
 }
 
+// Scalable Function (SF) Functions
+
+// GetSFList returns the scalable functions of a PF. SFs are auxiliary bus devices created
+// under the PF PCI device.
+func (h *Host) GetSFList(pfPciAddress string) ([]SFInfo, error) {
+	entries, err := os.ReadDir(buildSysBusPciPath(pfPciAddress, ""))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PCI device %s: %w", pfPciAddress, err)
+	}
+
+	sfs := []SFInfo{}
+	for _, entry := range entries {
+		if !strings.Contains(entry.Name(), ".sf.") {
+			continue
+		}
+		sfNum, err := os.ReadFile(buildSysBusPciPath(pfPciAddress, filepath.Join(entry.Name(), "sfnum")))
+		if err != nil {
+			h.log.V(2).Info("GetSFList(): skipping auxiliary device without sfnum", "pf", pfPciAddress, "device", entry.Name())
+			continue
+		}
+		sf := SFInfo{AuxDevice: entry.Name()}
+		if sf.SFNum, err = strconv.Atoi(strings.TrimSpace(string(sfNum))); err != nil {
+			return nil, fmt.Errorf("failed to parse sfnum of %s: %w", entry.Name(), err)
+		}
+		// the netdev only exists once the SF is active and probed by its driver
+		if netDevs, err := os.ReadDir(buildSysBusPciPath(pfPciAddress, filepath.Join(entry.Name(), "net"))); err == nil && len(netDevs) > 0 {
+			sf.NetName = netDevs[0].Name()
+		}
+		sfs = append(sfs, sf)
+	}
+	return sfs, nil
+}
+
+// CreateSF adds a scalable function to a PF in switchdev mode through devlink, activates
+// it and waits for its netdev
+func (h *Host) CreateSF(pfPciAddress string, sfNum int) (*SFInfo, error) {
+	h.log.V(2).Info("CreateSF(): creating SF", "pf", pfPciAddress, "sfNum", sfNum)
+	pfNumber, err := strconv.ParseUint(pfPciAddress[strings.LastIndex(pfPciAddress, ".")+1:], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PCI address %s: %w", pfPciAddress, err)
+	}
+	port, err := netlink.DevLinkPortAdd("pci", pfPciAddress, nl.DEVLINK_PORT_FLAVOUR_PCI_SF, netlink.DevLinkPortAddAttrs{
+		SfNumber:      uint32(sfNum),
+		SfNumberValid: true,
+		PfNumber:      uint16(pfNumber),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to add SF %d to %s: %w", sfNum, pfPciAddress, err)
+	}
+	if err := netlink.DevlinkPortFnSet("pci", pfPciAddress, port.PortIndex, netlink.DevlinkPortFnSetAttrs{
+		FnAttrs:    netlink.DevlinkPortFn{State: nl.DEVLINK_PORT_FN_STATE_ACTIVE},
+		StateValid: true,
+	}); err != nil {
+		_ = h.DeleteSF(pfPciAddress, port.PortIndex)
+		return nil, fmt.Errorf("failed to activate SF %d of %s: %w", sfNum, pfPciAddress, err)
+	}
+
+	var sf *SFInfo
+	err = wait.ExponentialBackoff(consts.Backoff, func() (bool, error) {
+		sfs, err := h.GetSFList(pfPciAddress)
+		if err != nil {
+			return false, err
+		}
+		for i := range sfs {
+			if sfs[i].SFNum == sfNum && sfs[i].NetName != "" {
+				sf = &sfs[i]
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		_ = h.DeleteSF(pfPciAddress, port.PortIndex)
+		return nil, fmt.Errorf("SF %d of %s has no netdev: %w", sfNum, pfPciAddress, err)
+	}
+	sf.PortIndex = port.PortIndex
+	return sf, nil
+}
+
+// DeleteSF deactivates and removes a scalable function created by CreateSF
+func (h *Host) DeleteSF(pfPciAddress string, portIndex uint32) error {
+	h.log.V(2).Info("DeleteSF(): deleting SF", "pf", pfPciAddress, "portIndex", portIndex)
+	if err := netlink.DevlinkPortFnSet("pci", pfPciAddress, portIndex, netlink.DevlinkPortFnSetAttrs{
+		FnAttrs:    netlink.DevlinkPortFn{State: nl.DEVLINK_PORT_FN_STATE_INACTIVE},
+		StateValid: true,
+	}); err != nil {
+		h.log.V(2).Info("DeleteSF(): failed to deactivate SF", "pf", pfPciAddress, "portIndex", portIndex, "error", err.Error())
+	}
+	if err := netlink.DevLinkPortDel("pci", pfPciAddress, portIndex); err != nil {
+		return fmt.Errorf("failed to delete SF port %d of %s: %w", portIndex, pfPciAddress, err)
+	}
+	return nil
+}
+
 // PCI Hardware Discovery Functions
 
 // PCI returns PCI information using the public ghw library
 func (h *Host) PCI() (*ghw.PCIInfo, error) {
+	if RootDir != "" {
+		return ghw.PCI(ghw.WithChroot(RootDir))
+	}
 	return ghw.PCI()
 }
 
@@ -244,12 +411,152 @@ func (h *Host) TryGetInterfaceName(pciAddr string) string {
 	return fInfos[0].Name()
 }
 
-// GetNicSriovMode returns the interface mode (simplified implementation)
-// This is a simplified version that returns "legacy" mode as fallback
-func (h *Host) GetNicSriovMode(_ string) string {
-	// For simplicity, always return legacy mode
-	// A full implementation would use netlink to query the eswitch mode
-	return "legacy"
+// GetLinkSpeed returns the link speed of a network interface in Mbps
+func (h *Host) GetLinkSpeed(ifName string) (int, error) {
+	content, err := os.ReadFile(buildSysPath(filepath.Join("/sys/class/net", ifName, "speed")))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read link speed for %s: %w", ifName, err)
+	}
+	speed, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse link speed for %s: %w", ifName, err)
+	}
+	// the kernel reports -1 when the link is down or the speed is unknown
+	if speed <= 0 {
+		return 0, fmt.Errorf("unknown link speed for %s", ifName)
+	}
+	return speed, nil
+}
+
+// GetLinkInfo returns the link properties of a network interface from sysfs, netlink and ethtool.
+// Properties that can't be read are left empty.
+func (h *Host) GetLinkInfo(ifName string) (*LinkInfo, error) {
+	netPath := buildSysPath(filepath.Join("/sys/class/net", ifName))
+	mtu, err := os.ReadFile(filepath.Join(netPath, "mtu"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mtu for %s: %w", ifName, err)
+	}
+
+	info := &LinkInfo{}
+	if info.MTU, err = strconv.Atoi(strings.TrimSpace(string(mtu))); err != nil {
+		return nil, fmt.Errorf("failed to parse mtu for %s: %w", ifName, err)
+	}
+	if operState, err := os.ReadFile(filepath.Join(netPath, "operstate")); err == nil {
+		info.OperState = strings.TrimSpace(string(operState))
+	}
+	// reading the carrier fails when the interface is administratively down
+	if carrier, err := os.ReadFile(filepath.Join(netPath, "carrier")); err == nil {
+		info.Carrier = strings.TrimSpace(string(carrier)) == "1"
+	}
+	if speed, err := h.GetLinkSpeed(ifName); err == nil {
+		info.Speed = speed
+	}
+	if linkType, err := os.ReadFile(filepath.Join(netPath, "type")); err == nil {
+		switch strings.TrimSpace(string(linkType)) {
+		case strconv.Itoa(unix.ARPHRD_ETHER):
+			info.LinkLayer = consts.LinkLayerEthernet
+		case strconv.Itoa(unix.ARPHRD_INFINIBAND):
+			info.LinkLayer = consts.LinkLayerInfiniBand
+		}
+	}
+	if driverPath, err := os.Readlink(filepath.Join(netPath, "device", "driver")); err == nil {
+		info.Driver = filepath.Base(driverPath)
+	}
+
+	if link, err := netlink.LinkByName(ifName); err == nil {
+		info.PermAddress = link.Attrs().PermHWAddr.String()
+	} else {
+		h.log.V(2).Info("GetLinkInfo(): failed to get link", "interface", ifName, "error", err.Error())
+	}
+
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM, 0)
+	if err != nil {
+		h.log.V(2).Info("GetLinkInfo(): failed to open ethtool socket", "interface", ifName, "error", err.Error())
+		return info, nil
+	}
+	defer unix.Close(fd)
+	if drvInfo, err := unix.IoctlGetEthtoolDrvinfo(fd, ifName); err == nil {
+		info.DriverVersion = unix.ByteSliceToString(drvInfo.Version[:])
+		info.FirmwareVersion = unix.ByteSliceToString(drvInfo.Fw_version[:])
+	} else {
+		h.log.V(2).Info("GetLinkInfo(): failed to get ethtool driver info", "interface", ifName, "error", err.Error())
+	}
+
+	return info, nil
+}
+
+// SubscribeLinkUpdates returns a channel receiving the name of every link that changed.
+// The channel is closed when the context is done.
+func (h *Host) SubscribeLinkUpdates(ctx context.Context) (<-chan string, error) {
+	updates := make(chan netlink.LinkUpdate)
+	if err := netlink.LinkSubscribe(updates, ctx.Done()); err != nil {
+		return nil, fmt.Errorf("failed to subscribe to link updates: %w", err)
+	}
+
+	names := make(chan string)
+	go func() {
+		defer close(names)
+		for update := range updates {
+			select {
+			case names <- update.Attrs().Name:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return names, nil
+}
+
+// GetHostUsage returns why a network interface is used by the host system: it carries a
+// default route, has a global IP address or is enslaved to a bond or bridge. An empty
+// string is returned when the interface is not used by the host.
+func (h *Host) GetHostUsage(ifName string) (string, error) {
+	link, err := netlink.LinkByName(ifName)
+	if err != nil {
+		return "", fmt.Errorf("failed to get link %s: %w", ifName, err)
+	}
+
+	routes, err := netlink.RouteList(link, netlink.FAMILY_ALL)
+	if err != nil {
+		return "", fmt.Errorf("failed to list routes of %s: %w", ifName, err)
+	}
+	for _, route := range routes {
+		if route.Dst == nil {
+			return "default route", nil
+		}
+		if ones, _ := route.Dst.Mask.Size(); ones == 0 {
+			return "default route", nil
+		}
+	}
+
+	addrs, err := netlink.AddrList(link, netlink.FAMILY_ALL)
+	if err != nil {
+		return "", fmt.Errorf("failed to list addresses of %s: %w", ifName, err)
+	}
+	for _, addr := range addrs {
+		if addr.IP.IsGlobalUnicast() {
+			return fmt.Sprintf("address %s", addr.IPNet), nil
+		}
+	}
+
+	if masterIndex := link.Attrs().MasterIndex; masterIndex != 0 {
+		master, err := netlink.LinkByIndex(masterIndex)
+		if err != nil {
+			return "", fmt.Errorf("failed to get master of %s: %w", ifName, err)
+		}
+		return fmt.Sprintf("%s master %s", master.Type(), master.Attrs().Name), nil
+	}
+
+	return "", nil
+}
+
+// GetNicSriovMode returns the devlink eswitch mode of a PF, "legacy" when it can't be read
+func (h *Host) GetNicSriovMode(pciAddr string) string {
+	dev, err := netlink.DevLinkGetDeviceByName("pci", pciAddr)
+	if err != nil || dev.Attrs.Eswitch.Mode == "" {
+		return "legacy"
+	}
+	return dev.Attrs.Eswitch.Mode
 }
 
 // GetNumaNode returns the NUMA node for a given PCI device
@@ -288,11 +595,10 @@ func (h *Host) GetParentPciAddress(pciAddress string) (string, error) {
 	// For most cases, we can try to find the parent by checking if there's a bridge
 	// at bus 00 or look for the immediate parent in the PCI hierarchy
 
-	// First, try to get parent from sysfs
-	parentPath := buildSysBusPciPath(pciAddress, "../")
-	parentDir, err := filepath.EvalSymlinks(parentPath)
+	// First, try to get parent from sysfs, the device is a symlink into its parent dir
+	devicePath, err := filepath.EvalSymlinks(buildSysBusPciPath(pciAddress, ""))
 	if err == nil {
-		parentAddr := filepath.Base(parentDir)
+		parentAddr := filepath.Base(filepath.Dir(devicePath))
 		// Validate the parent address format
 		if len(strings.Split(parentAddr, ":")) == 3 {
 			return parentAddr, nil
@@ -315,10 +621,49 @@ func (h *Host) GetParentPciAddress(pciAddress string) (string, error) {
 	return "", nil
 }
 
+// GetAERCounters returns the fatal and non-fatal PCIe AER error counts of a device.
+// An error is returned when the device doesn't report AER errors.
+func (h *Host) GetAERCounters(pciAddress string) (*AERCounters, error) {
+	fatal, err := readAERTotal(buildSysBusPciPath(pciAddress, "aer_dev_fatal"), "TOTAL_ERR_FATAL")
+	if err != nil {
+		return nil, err
+	}
+	nonFatal, err := readAERTotal(buildSysBusPciPath(pciAddress, "aer_dev_nonfatal"), "TOTAL_ERR_NONFATAL")
+	if err != nil {
+		return nil, err
+	}
+	return &AERCounters{Fatal: fatal, NonFatal: nonFatal}, nil
+}
+
+// readAERTotal returns the value of the total line of an AER statistics file
+func readAERTotal(path, total string) (int, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read AER counters: %w", err)
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == total {
+			count, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return 0, fmt.Errorf("failed to parse %s in %s: %w", total, path, err)
+			}
+			return count, nil
+		}
+	}
+	return 0, fmt.Errorf("%s not found in %s", total, path)
+}
+
 // GetPCIeRoot returns the PCIe Root Complex for a given PCI device using the upstream Kubernetes implementation.
 // The PCIe Root Complex is returned in the format "pci<domain>:<bus>" (e.g., "pci0000:00").
 // This is used to identify devices that share the same PCIe Root Complex for resource alignment.
 func (h *Host) GetPCIeRoot(pciAddress string) (string, error) {
+	if RootDir != "" {
+		// the upstream implementation always reads the real /sys
+		if pcieRoot, err := getPCIeRootFromSysfs(pciAddress); err == nil {
+			return pcieRoot, nil
+		}
+	}
 	attr, err := deviceattribute.GetPCIeRootAttributeByPCIBusID(pciAddress)
 	if err != nil {
 		return "", fmt.Errorf("failed to get PCIe root for %s: %w", pciAddress, err)
@@ -332,13 +677,32 @@ func (h *Host) GetPCIeRoot(pciAddress string) (string, error) {
 	return "", fmt.Errorf("PCIe root attribute for %s has no string value", pciAddress)
 }
 
+// getPCIeRootFromSysfs returns the PCIe Root Complex of a device from the path of its
+// device dir under /sys/devices
+func getPCIeRootFromSysfs(pciAddress string) (string, error) {
+	devicePath, err := filepath.EvalSymlinks(buildSysBusPciPath(pciAddress, ""))
+	if err != nil {
+		return "", fmt.Errorf("failed to get PCIe root for %s: %w", pciAddress, err)
+	}
+	devicesPath, err := filepath.EvalSymlinks(buildSysPath("/sys/devices"))
+	if err != nil {
+		return "", fmt.Errorf("failed to get PCIe root for %s: %w", pciAddress, err)
+	}
+	relPath, err := filepath.Rel(devicesPath, devicePath)
+	if err != nil || !strings.HasPrefix(relPath, "pci") {
+		return "", fmt.Errorf("failed to get PCIe root for %s: device is not under %s", pciAddress, devicesPath)
+	}
+	return strings.Split(relPath, string(filepath.Separator))[0], nil
+}
+
 // High-level Driver Management Functions
 
 // BindDeviceDriver binds a device to the specified driver based on config.Driver:
 // - If config.Driver == "", nothing is done
 // - If config.Driver == "default", binds device to default driver
 // - Otherwise, binds device to the specified driver
-func (h *Host) BindDeviceDriver(pciAddress string, config *configapi.VfConfig) (string, error) {
+func (h *Host) BindDeviceDriver(pciAddress string, config *configapi.VfConfig, fields audit.Fields) (string, error) {
+	h = h.withAuditFields(fields)
 	if config.Driver == "" {
 		h.log.V(2).Info("BindDeviceDriver(): no driver specified, skipping", "device", pciAddress)
 		return "", nil
@@ -359,21 +723,22 @@ func (h *Host) BindDeviceDriver(pciAddress string, config *configapi.VfConfig) (
 	}
 
 	h.log.V(2).Info("BindDeviceDriver(): binding device to driver", "device", pciAddress, "driver", config.Driver)
-	if err := h.BindDriverByBusAndDevice(pciAddress, config.Driver); err != nil {
+	if err := h.BindDriverByBusAndDevice(pciAddress, config.Driver, fields); err != nil {
 		return "", fmt.Errorf("failed to bind device %s to driver %s: %w", pciAddress, config.Driver, err)
 	}
 	return currentDriver, nil
 }
 
 // RestoreDeviceDriver restores a device to its original driver
-func (h *Host) RestoreDeviceDriver(pciAddress string, originalDriver string) error {
+func (h *Host) RestoreDeviceDriver(pciAddress string, originalDriver string, fields audit.Fields) error {
+	h = h.withAuditFields(fields)
 	if originalDriver == "" {
 		h.log.V(2).Info("RestoreDeviceDriver(): no original driver, binding to default", "device", pciAddress)
 		return h.BindDefaultDriver(pciAddress)
 	}
 
 	h.log.V(2).Info("RestoreDeviceDriver(): restoring device to original driver", "device", pciAddress, "driver", originalDriver)
-	return h.BindDriverByBusAndDevice(pciAddress, originalDriver)
+	return h.BindDriverByBusAndDevice(pciAddress, originalDriver, fields)
 }
 
 // BindDefaultDriver binds a device to its default driver
@@ -391,7 +756,7 @@ func (h *Host) BindDefaultDriver(pciAddress string) error {
 				"device", pciAddress, "driver", curDriver)
 			return nil
 		}
-		if err := h.UnbindDriverByBusAndDevice(pciAddress); err != nil {
+		if err := h.UnbindDriverByBusAndDevice(pciAddress, h.auditFields); err != nil {
 			return err
 		}
 	}
@@ -407,7 +772,8 @@ func (h *Host) BindDefaultDriver(pciAddress string) error {
 // Low-level Driver Operations
 
 // BindDriverByBusAndDevice binds device to the provided driver
-func (h *Host) BindDriverByBusAndDevice(device, driver string) error {
+func (h *Host) BindDriverByBusAndDevice(device, driver string, fields audit.Fields) error {
+	h = h.withAuditFields(fields)
 	h.log.V(2).Info("BindDriverByBusAndDevice(): bind device to driver",
 		"device", device, "driver", driver)
 
@@ -426,7 +792,7 @@ func (h *Host) BindDriverByBusAndDevice(device, driver string) error {
 				"device", device, "driver", driver)
 			return nil
 		}
-		if err := h.UnbindDriverByBusAndDevice(device); err != nil {
+		if err := h.UnbindDriverByBusAndDevice(device, fields); err != nil {
 			return err
 		}
 	}
@@ -440,7 +806,8 @@ func (h *Host) BindDriverByBusAndDevice(device, driver string) error {
 }
 
 // UnbindDriverByBusAndDevice unbinds device from its current driver
-func (h *Host) UnbindDriverByBusAndDevice(device string) error {
+func (h *Host) UnbindDriverByBusAndDevice(device string, fields audit.Fields) error {
+	h = h.withAuditFields(fields)
 	h.log.V(2).Info("UnbindDriverByBusAndDevice(): unbind device driver for device", "device", device)
 	driver, err := h.GetDriverByBusAndDevice(device)
 	if err != nil {
@@ -475,7 +842,10 @@ func (h *Host) GetDriverByBusAndDevice(device string) (string, error) {
 func (h *Host) bindDriver(device, driver string) error {
 	h.log.V(2).Info("bindDriver(): bind to driver", "device", device, "driver", driver)
 	bindPath := buildSysBusPciDriverPath(driver, "bind")
-	err := os.WriteFile(bindPath, []byte(device), os.ModeAppend)
+	err := writeSysfsFile(bindPath, []byte(device))
+	event := h.auditFields.Event(audit.OperationBind)
+	event.PciAddress, event.Driver = device, driver
+	h.auditLog.Record(event, err)
 	if err != nil {
 		h.log.Error(err, "bindDriver(): failed to bind driver", "device", device, "driver", driver)
 		return err
@@ -483,11 +853,28 @@ func (h *Host) bindDriver(device, driver string) error {
 	return nil
 }
 
+// ResetDevice resets a PCI function, with a function level reset for the VFs, through its sysfs
+// reset attribute. The kernel saves and restores the state of the bound driver around the reset.
+func (h *Host) ResetDevice(pciAddress string) error {
+	h.log.V(2).Info("ResetDevice(): resetting device", "device", pciAddress)
+	resetPath := buildSysBusPciPath(pciAddress, "reset")
+	if _, err := os.Stat(resetPath); err != nil {
+		return fmt.Errorf("device %s doesn't support reset: %w", pciAddress, err)
+	}
+	if err := writeSysfsFile(resetPath, []byte("1")); err != nil {
+		return fmt.Errorf("failed to reset device %s: %w", pciAddress, err)
+	}
+	return nil
+}
+
 // unbindDriver unbinds device from the driver
 func (h *Host) unbindDriver(device, driver string) error {
 	h.log.V(2).Info("unbindDriver(): unbind from driver", "device", device, "driver", driver)
 	unbindPath := buildSysBusPciDriverPath(driver, "unbind")
-	err := os.WriteFile(unbindPath, []byte(device), os.ModeAppend)
+	err := writeSysfsFile(unbindPath, []byte(device))
+	event := h.auditFields.Event(audit.OperationUnbind)
+	event.PciAddress, event.Driver = device, driver
+	h.auditLog.Record(event, err)
 	if err != nil {
 		h.log.Error(err, "unbindDriver(): failed to unbind driver", "device", device, "driver", driver)
 		return err
@@ -499,7 +886,10 @@ func (h *Host) unbindDriver(device, driver string) error {
 func (h *Host) probeDriver(device string) error {
 	h.log.V(2).Info("probeDriver(): drivers probe", "device", device)
 	probePath := buildSysPath("/sys/bus/pci/drivers_probe")
-	err := os.WriteFile(probePath, []byte(device), os.ModeAppend)
+	err := writeSysfsFile(probePath, []byte(device))
+	event := h.auditFields.Event(audit.OperationBind)
+	event.PciAddress, event.Details = device, map[string]string{"probe": "true"}
+	h.auditLog.Record(event, err)
 	if err != nil {
 		h.log.Error(err, "probeDriver(): failed to trigger driver probe", "device", device)
 		return err
@@ -527,7 +917,7 @@ func (h *Host) setDriverOverride(device, override string) error {
 		h.log.V(2).Info("setDriverOverride(): reset driver override for device", "device", device)
 		overrideData = []byte("\x00")
 	}
-	err := os.WriteFile(driverOverridePath, overrideData, os.ModeAppend)
+	err := writeSysfsFile(driverOverridePath, overrideData)
 	if err != nil {
 		h.log.Error(err, "setDriverOverride(): fail to write driver_override for device",
 			"device", device, "driver", override)
@@ -618,6 +1008,254 @@ func (h *Host) GetVFIODeviceFile(pciAddress string) (devFileHost, devFileContain
 	return devFileHost, devFileContainer, err
 }
 
+// RDMA Device Functions
+
+// GetRDMADevice returns the name of the RDMA device of a PCI device, or an empty string
+// when the device has no RDMA device (not RDMA capable or not bound to its kernel driver)
+func (h *Host) GetRDMADevice(pciAddress string) (string, error) {
+	entries, err := os.ReadDir(buildSysBusPciPath(pciAddress, "infiniband"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to read RDMA devices of %s: %w", pciAddress, err)
+	}
+	if len(entries) == 0 {
+		return "", nil
+	}
+	return entries[0].Name(), nil
+}
+
+// GetRDMACharDevices returns the character devices to access the RDMA device of a PCI
+// device from userspace: its uverbs and umad devices and the rdma_cm device
+func (h *Host) GetRDMACharDevices(pciAddress string) ([]string, error) {
+	charDevices := []string{}
+	for _, class := range []struct{ dir, prefix string }{
+		{"infiniband_verbs", "uverbs"},
+		{"infiniband_mad", "umad"},
+	} {
+		entries, err := os.ReadDir(buildSysBusPciPath(pciAddress, class.dir))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read %s devices of %s: %w", class.prefix, pciAddress, err)
+		}
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Name(), class.prefix) {
+				charDevices = append(charDevices, filepath.Join(consts.RDMACharDevicesDir, entry.Name()))
+			}
+		}
+	}
+	if len(charDevices) == 0 {
+		return nil, fmt.Errorf("no uverbs or umad device found for %s", pciAddress)
+	}
+	return append(charDevices, filepath.Join(consts.RDMACharDevicesDir, "rdma_cm")), nil
+}
+
+// GetRDMANetnsMode returns the RDMA subsystem network namespace mode, "shared" or "exclusive"
+func (h *Host) GetRDMANetnsMode() (string, error) {
+	mode, err := netlink.RdmaSystemGetNetnsMode()
+	if err != nil {
+		return "", fmt.Errorf("failed to get RDMA netns mode: %w", err)
+	}
+	return mode, nil
+}
+
+// MoveRDMADeviceToNetns moves an RDMA device from the host to a network namespace, which
+// requires the RDMA subsystem to be in exclusive mode
+func (h *Host) MoveRDMADeviceToNetns(rdmaDevice, netnsPath string) error {
+	h.log.V(2).Info("MoveRDMADeviceToNetns(): moving RDMA device", "rdmaDevice", rdmaDevice, "netns", netnsPath)
+	targetNs, err := netns.GetFromPath(netnsPath)
+	if err != nil {
+		return fmt.Errorf("failed to open netns %s: %w", netnsPath, err)
+	}
+	defer targetNs.Close()
+
+	link, err := netlink.RdmaLinkByName(rdmaDevice)
+	if err != nil {
+		return fmt.Errorf("failed to get RDMA device %s: %w", rdmaDevice, err)
+	}
+	if err := netlink.RdmaLinkSetNsFd(link, uint32(targetNs)); err != nil {
+		return fmt.Errorf("failed to move RDMA device %s to netns %s: %w", rdmaDevice, netnsPath, err)
+	}
+	return nil
+}
+
+// RestoreRDMADeviceNetns moves an RDMA device back from a network namespace to the host
+func (h *Host) RestoreRDMADeviceNetns(rdmaDevice, netnsPath string) error {
+	h.log.V(2).Info("RestoreRDMADeviceNetns(): moving RDMA device back to the host", "rdmaDevice", rdmaDevice, "netns", netnsPath)
+	sourceNs, err := netns.GetFromPath(netnsPath)
+	if err != nil {
+		return fmt.Errorf("failed to open netns %s: %w", netnsPath, err)
+	}
+	defer sourceNs.Close()
+	hostNs, err := netns.Get()
+	if err != nil {
+		return fmt.Errorf("failed to get host netns: %w", err)
+	}
+	defer hostNs.Close()
+
+	handle, err := netlink.NewHandleAt(sourceNs)
+	if err != nil {
+		return fmt.Errorf("failed to get netlink handle in netns %s: %w", netnsPath, err)
+	}
+	defer handle.Close()
+
+	link, err := handle.RdmaLinkByName(rdmaDevice)
+	if err != nil {
+		return fmt.Errorf("failed to get RDMA device %s in netns %s: %w", rdmaDevice, netnsPath, err)
+	}
+	if err := handle.RdmaLinkSetNsFd(link, uint32(hostNs)); err != nil {
+		return fmt.Errorf("failed to move RDMA device %s back to the host: %w", rdmaDevice, err)
+	}
+	return nil
+}
+
+// VF Link Configuration Functions
+
+// SetVFLinkSettings applies the VF link settings through the PF netdev
+func (h *Host) SetVFLinkSettings(pfName string, vfID int, settings *types.VFLinkSettings) error {
+	h.log.V(2).Info("SetVFLinkSettings(): applying VF link settings", "pf", pfName, "vfID", vfID, "settings", settings)
+
+	pfLink, err := netlink.LinkByName(pfName)
+	if err != nil {
+		return fmt.Errorf("failed to get PF link %s: %w", pfName, err)
+	}
+
+	if settings.MAC != "" {
+		hwAddr, err := net.ParseMAC(settings.MAC)
+		if err != nil {
+			return fmt.Errorf("failed to parse MAC address %s: %w", settings.MAC, err)
+		}
+		if err := netlink.LinkSetVfHardwareAddr(pfLink, vfID, hwAddr); err != nil {
+			return fmt.Errorf("failed to set MAC address for VF %d on PF %s: %w", vfID, pfName, err)
+		}
+	}
+
+	if settings.Vlan != nil {
+		vlanQoS := 0
+		if settings.VlanQoS != nil {
+			vlanQoS = *settings.VlanQoS
+		}
+		if err := netlink.LinkSetVfVlanQos(pfLink, vfID, *settings.Vlan, vlanQoS); err != nil {
+			return fmt.Errorf("failed to set vlan %d for VF %d on PF %s: %w", *settings.Vlan, vfID, pfName, err)
+		}
+	}
+
+	if settings.SpoofChk != "" {
+		if err := netlink.LinkSetVfSpoofchk(pfLink, vfID, settings.SpoofChk == "on"); err != nil {
+			return fmt.Errorf("failed to set spoofchk for VF %d on PF %s: %w", vfID, pfName, err)
+		}
+	}
+
+	if settings.Trust != "" {
+		if err := netlink.LinkSetVfTrust(pfLink, vfID, settings.Trust == "on"); err != nil {
+			return fmt.Errorf("failed to set trust for VF %d on PF %s: %w", vfID, pfName, err)
+		}
+	}
+
+	if settings.LinkState != "" {
+		var state uint32
+		switch settings.LinkState {
+		case "auto":
+			state = netlink.VF_LINK_STATE_AUTO
+		case "enable":
+			state = netlink.VF_LINK_STATE_ENABLE
+		case "disable":
+			state = netlink.VF_LINK_STATE_DISABLE
+		default:
+			return fmt.Errorf("unknown link state %s for VF %d on PF %s", settings.LinkState, vfID, pfName)
+		}
+		if err := netlink.LinkSetVfState(pfLink, vfID, state); err != nil {
+			return fmt.Errorf("failed to set link state for VF %d on PF %s: %w", vfID, pfName, err)
+		}
+	}
+
+	if settings.MinTxRate != nil || settings.MaxTxRate != nil {
+		minTxRate, maxTxRate := 0, 0
+		if settings.MinTxRate != nil {
+			minTxRate = *settings.MinTxRate
+		}
+		if settings.MaxTxRate != nil {
+			maxTxRate = *settings.MaxTxRate
+		}
+		if err := netlink.LinkSetVfRate(pfLink, vfID, minTxRate, maxTxRate); err != nil {
+			return fmt.Errorf("failed to set tx rate for VF %d on PF %s: %w", vfID, pfName, err)
+		}
+	}
+
+	return nil
+}
+
+// SetLinkMTU sets the MTU of a netdev through its sysfs attribute
+func (h *Host) SetLinkMTU(ifName string, mtu int) error {
+	h.log.V(2).Info("SetLinkMTU(): setting MTU", "interface", ifName, "mtu", mtu)
+	mtuPath := buildSysPath(filepath.Join("/sys/class/net", ifName, "mtu"))
+	if err := writeSysfsFile(mtuPath, []byte(strconv.Itoa(mtu))); err != nil {
+		return fmt.Errorf("failed to set mtu %d for %s: %w", mtu, ifName, err)
+	}
+	return nil
+}
+
+// GetVFHardwareAddress returns the MAC address of a VF. The address of the VF netdev is used
+// when the VF is bound to a kernel driver, otherwise the administrative MAC from the PF is returned
+func (h *Host) GetVFHardwareAddress(pciAddress, pfName string, vfID int) (string, error) {
+	if netName := h.TryGetInterfaceName(pciAddress); netName != "" {
+		content, err := os.ReadFile(buildSysBusPciPath(pciAddress, filepath.Join("net", netName, "address")))
+		if err == nil {
+			return strings.TrimSpace(string(content)), nil
+		}
+		h.log.V(2).Info("GetVFHardwareAddress(): failed to read VF netdev address, falling back to PF", "device", pciAddress, "error", err.Error())
+	}
+
+	pfLink, err := netlink.LinkByName(pfName)
+	if err != nil {
+		return "", fmt.Errorf("failed to get PF link %s: %w", pfName, err)
+	}
+	for _, vf := range pfLink.Attrs().Vfs {
+		if vf.ID == vfID {
+			return vf.Mac.String(), nil
+		}
+	}
+	return "", fmt.Errorf("VF %d not found on PF %s", vfID, pfName)
+}
+
+// SetVFGUID sets the node and port GUID of an InfiniBand VF through the PF netdev. A VF
+// bound to a kernel driver is rebound so the driver picks up the new GUID.
+func (h *Host) SetVFGUID(pciAddress, pfName string, vfID int, guid string, fields audit.Fields) error {
+	h.log.V(2).Info("SetVFGUID(): setting VF GUID", "device", pciAddress, "pf", pfName, "vfID", vfID, "guid", guid)
+	hwAddr, err := net.ParseMAC(guid)
+	if err != nil || len(hwAddr) != 8 {
+		return fmt.Errorf("invalid GUID %q", guid)
+	}
+	pfLink, err := netlink.LinkByName(pfName)
+	if err != nil {
+		return fmt.Errorf("failed to get PF link %s: %w", pfName, err)
+	}
+	if err := netlink.LinkSetVfNodeGUID(pfLink, vfID, hwAddr); err != nil {
+		return fmt.Errorf("failed to set node GUID of VF %d of %s: %w", vfID, pfName, err)
+	}
+	if err := netlink.LinkSetVfPortGUID(pfLink, vfID, hwAddr); err != nil {
+		return fmt.Errorf("failed to set port GUID of VF %d of %s: %w", vfID, pfName, err)
+	}
+
+	driver, err := h.GetDriverByBusAndDevice(pciAddress)
+	if err != nil {
+		return fmt.Errorf("failed to get driver of %s: %w", pciAddress, err)
+	}
+	if driver == "" || h.IsDpdkDriver(driver) {
+		return nil
+	}
+	if err := h.UnbindDriverByBusAndDevice(pciAddress, fields); err != nil {
+		return fmt.Errorf("failed to unbind %s to apply the GUID: %w", pciAddress, err)
+	}
+	if err := h.BindDriverByBusAndDevice(pciAddress, driver, fields); err != nil {
+		return fmt.Errorf("failed to rebind %s to %s to apply the GUID: %w", pciAddress, driver, err)
+	}
+	return nil
+}
+
 // Kernel Module Management Functions
 
 // IsKernelModuleLoaded checks if a kernel module is currently loaded
@@ -648,6 +1286,9 @@ func (h *Host) LoadKernelModule(moduleName string) error {
 
 	cmd := exec.Command("chroot", "/proc/1/root", "modprobe", moduleName)
 	output, err := cmd.CombinedOutput()
+	event := h.auditFields.Event(audit.OperationModuleLoad)
+	event.Details = map[string]string{"module": moduleName}
+	h.auditLog.Record(event, err)
 	if err != nil {
 		h.log.Error(err, "LoadKernelModule(): failed to load kernel module",
 			"module", moduleName, "output", string(output))
@@ -719,7 +1360,8 @@ func (h *Host) EnsureDpdkModuleLoaded(driver string) error {
 }
 
 // EnsureVhostModulesLoaded ensures that the tun and vhost_net kernel modules are loaded
-func (h *Host) EnsureVhostModulesLoaded() error {
+func (h *Host) EnsureVhostModulesLoaded(fields audit.Fields) error {
+	h = h.withAuditFields(fields)
 	// Modules required for vhost functionality
 	modulesNames := []string{"tun", "vhost_net"}
 
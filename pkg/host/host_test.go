@@ -7,6 +7,7 @@ import (
 	. "github.com/onsi/gomega"
 
 	configapi "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/virtualfunction/v1alpha1"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/audit"
 	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host"
 )
 
@@ -130,6 +131,35 @@ var _ = Describe("Host", func() {
 				Expect(err.Error()).To(ContainSubstring("failed to read PF directory"))
 			})
 		})
+
+		Context("GetSFList", func() {
+			It("should return the SFs of the PF with their netdev", func() {
+				fs.Dirs = []string{
+					"sys/bus/pci/devices/0000:01:00.0/mlx5_core.sf.2/net/enp1s0f0s1",
+					"sys/bus/pci/devices/0000:01:00.0/mlx5_core.sf.3",
+					"sys/bus/pci/devices/0000:01:00.0/mlx5_core.eth.0",
+				}
+				fs.Files = map[string][]byte{
+					"sys/bus/pci/devices/0000:01:00.0/mlx5_core.sf.2/sfnum": []byte("1\n"),
+					"sys/bus/pci/devices/0000:01:00.0/mlx5_core.sf.3/sfnum": []byte("1000\n"),
+				}
+				tearDown = fs.Use()
+
+				sfList, err := h.GetSFList("0000:01:00.0")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(sfList).To(Equal([]host.SFInfo{
+					{AuxDevice: "mlx5_core.sf.2", SFNum: 1, NetName: "enp1s0f0s1"},
+					{AuxDevice: "mlx5_core.sf.3", SFNum: 1000},
+				}))
+			})
+
+			It("should return error when PF directory does not exist", func() {
+				tearDown = fs.Use()
+
+				_, err := h.GetSFList("0000:01:00.0")
+				Expect(err).To(HaveOccurred())
+			})
+		})
 	})
 
 	Describe("Network Interface Functions", func() {
@@ -166,6 +196,32 @@ var _ = Describe("Host", func() {
 			})
 		})
 
+		Context("GetVFHardwareAddress", func() {
+			It("should return the VF netdev address when the VF has a netdev", func() {
+				fs.Dirs = []string{
+					"sys/bus/pci/devices/0000:01:00.1/net/eth1",
+				}
+				fs.Files = map[string][]byte{
+					"sys/bus/pci/devices/0000:01:00.1/net/eth1/address": []byte("aa:bb:cc:dd:ee:ff\n"),
+				}
+				tearDown = fs.Use()
+
+				mac, err := h.GetVFHardwareAddress("0000:01:00.1", "eth0", 0)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(mac).To(Equal("aa:bb:cc:dd:ee:ff"))
+			})
+
+			It("should return error when the VF has no netdev and the PF does not exist", func() {
+				fs.Dirs = []string{
+					"sys/bus/pci/devices/0000:01:00.1",
+				}
+				tearDown = fs.Use()
+
+				_, err := h.GetVFHardwareAddress("0000:01:00.1", "does-not-exist0", 0)
+				Expect(err).To(HaveOccurred())
+			})
+		})
+
 		Context("GetNicSriovMode", func() {
 			It("should return legacy mode", func() {
 				tearDown = fs.Use()
@@ -215,6 +271,181 @@ var _ = Describe("Host", func() {
 			})
 		})
 
+		Context("GetLinkSpeed", func() {
+			It("should return the link speed in Mbps", func() {
+				fs.Dirs = []string{"sys/class/net/eth0"}
+				fs.Files = map[string][]byte{
+					"sys/class/net/eth0/speed": []byte("25000\n"),
+				}
+				tearDown = fs.Use()
+
+				speed, err := h.GetLinkSpeed("eth0")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(speed).To(Equal(25000))
+			})
+
+			It("should return an error when the speed is unknown", func() {
+				fs.Dirs = []string{"sys/class/net/eth0"}
+				fs.Files = map[string][]byte{
+					"sys/class/net/eth0/speed": []byte("-1"),
+				}
+				tearDown = fs.Use()
+
+				_, err := h.GetLinkSpeed("eth0")
+				Expect(err).To(MatchError(ContainSubstring("unknown link speed")))
+			})
+
+			It("should return an error when the interface does not exist", func() {
+				tearDown = fs.Use()
+
+				_, err := h.GetLinkSpeed("eth0")
+				Expect(err).To(HaveOccurred())
+			})
+		})
+
+		Context("GetLinkInfo", func() {
+			It("should read the link properties from sysfs", func() {
+				fs.Dirs = []string{"sys/class/net/fakepf0/device", "sys/bus/pci/drivers/ice"}
+				fs.Files = map[string][]byte{
+					"sys/class/net/fakepf0/mtu":       []byte("9000\n"),
+					"sys/class/net/fakepf0/operstate": []byte("up\n"),
+					"sys/class/net/fakepf0/carrier":   []byte("1\n"),
+					"sys/class/net/fakepf0/speed":     []byte("100000\n"),
+					"sys/class/net/fakepf0/type":      []byte("1\n"),
+				}
+				fs.Symlinks = map[string]string{
+					"sys/class/net/fakepf0/device/driver": "../../../bus/pci/drivers/ice",
+				}
+				tearDown = fs.Use()
+
+				info, err := h.GetLinkInfo("fakepf0")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(info.MTU).To(Equal(9000))
+				Expect(info.OperState).To(Equal("up"))
+				Expect(info.Carrier).To(BeTrue())
+				Expect(info.Speed).To(Equal(100000))
+				Expect(info.Driver).To(Equal("ice"))
+				Expect(info.LinkLayer).To(Equal("ethernet"))
+			})
+
+			It("should report the InfiniBand link layer", func() {
+				fs.Dirs = []string{"sys/class/net/ib0"}
+				fs.Files = map[string][]byte{
+					"sys/class/net/ib0/mtu":  []byte("4092\n"),
+					"sys/class/net/ib0/type": []byte("32\n"),
+				}
+				tearDown = fs.Use()
+
+				info, err := h.GetLinkInfo("ib0")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(info.LinkLayer).To(Equal("infiniband"))
+			})
+
+			It("should report no carrier and unknown speed for a down link", func() {
+				fs.Dirs = []string{"sys/class/net/fakepf0"}
+				fs.Files = map[string][]byte{
+					"sys/class/net/fakepf0/mtu":       []byte("1500"),
+					"sys/class/net/fakepf0/operstate": []byte("down"),
+					"sys/class/net/fakepf0/speed":     []byte("-1"),
+				}
+				tearDown = fs.Use()
+
+				info, err := h.GetLinkInfo("fakepf0")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(info.OperState).To(Equal("down"))
+				Expect(info.Carrier).To(BeFalse())
+				Expect(info.Speed).To(Equal(0))
+				Expect(info.Driver).To(BeEmpty())
+				Expect(info.LinkLayer).To(BeEmpty())
+			})
+
+			It("should return an error when the interface does not exist", func() {
+				tearDown = fs.Use()
+
+				_, err := h.GetLinkInfo("fakepf0")
+				Expect(err).To(HaveOccurred())
+			})
+		})
+
+		Context("GetHostUsage", func() {
+			It("should not report the loopback interface as used by the host", func() {
+				reason, err := h.GetHostUsage("lo")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(reason).To(BeEmpty())
+			})
+
+			It("should return an error when the interface does not exist", func() {
+				_, err := h.GetHostUsage("fakepf0")
+				Expect(err).To(HaveOccurred())
+			})
+		})
+
+		Context("GetAERCounters", func() {
+			It("should return the total fatal and non-fatal error counts", func() {
+				fs.Dirs = []string{"sys/bus/pci/devices/0000:01:00.1"}
+				fs.Files = map[string][]byte{
+					"sys/bus/pci/devices/0000:01:00.1/aer_dev_fatal":    []byte("Undefined 0\nDLP 1\nTOTAL_ERR_FATAL 1\n"),
+					"sys/bus/pci/devices/0000:01:00.1/aer_dev_nonfatal": []byte("Undefined 0\nPoisonTLP 3\nTOTAL_ERR_NONFATAL 3\n"),
+				}
+				tearDown = fs.Use()
+
+				counters, err := h.GetAERCounters("0000:01:00.1")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(*counters).To(Equal(host.AERCounters{Fatal: 1, NonFatal: 3}))
+			})
+
+			It("should return an error when the device does not report AER errors", func() {
+				fs.Dirs = []string{"sys/bus/pci/devices/0000:01:00.1"}
+				tearDown = fs.Use()
+
+				_, err := h.GetAERCounters("0000:01:00.1")
+				Expect(err).To(HaveOccurred())
+			})
+		})
+
+		Context("GetRDMADevice", func() {
+			It("should return the RDMA device of the PCI device", func() {
+				fs.Dirs = []string{"sys/bus/pci/devices/0000:01:00.1/infiniband/mlx5_2"}
+				tearDown = fs.Use()
+
+				rdmaDevice, err := h.GetRDMADevice("0000:01:00.1")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(rdmaDevice).To(Equal("mlx5_2"))
+			})
+
+			It("should return an empty name for a device without RDMA device", func() {
+				fs.Dirs = []string{"sys/bus/pci/devices/0000:01:00.1"}
+				tearDown = fs.Use()
+
+				rdmaDevice, err := h.GetRDMADevice("0000:01:00.1")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(rdmaDevice).To(BeEmpty())
+			})
+		})
+
+		Context("GetRDMACharDevices", func() {
+			It("should return the uverbs, umad and rdma_cm devices", func() {
+				fs.Dirs = []string{
+					"sys/bus/pci/devices/0000:01:00.1/infiniband_verbs/uverbs2",
+					"sys/bus/pci/devices/0000:01:00.1/infiniband_mad/umad2",
+					"sys/bus/pci/devices/0000:01:00.1/infiniband_mad/issm2",
+				}
+				tearDown = fs.Use()
+
+				charDevices, err := h.GetRDMACharDevices("0000:01:00.1")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(charDevices).To(Equal([]string{"/dev/infiniband/uverbs2", "/dev/infiniband/umad2", "/dev/infiniband/rdma_cm"}))
+			})
+
+			It("should return an error for a device without RDMA character devices", func() {
+				fs.Dirs = []string{"sys/bus/pci/devices/0000:01:00.1"}
+				tearDown = fs.Use()
+
+				_, err := h.GetRDMACharDevices("0000:01:00.1")
+				Expect(err).To(MatchError(ContainSubstring("no uverbs or umad device")))
+			})
+		})
+
 		Context("GetPCIeRoot", func() {
 			It("should return error for invalid PCI address format", func() {
 				// Test with invalid format - this is validated by the upstream implementation
@@ -334,7 +565,7 @@ var _ = Describe("Host", func() {
 				tearDown = fs.Use()
 				config := &configapi.VfConfig{Driver: ""}
 
-				originalDriver, err := h.BindDeviceDriver("0000:01:00.0", config)
+				originalDriver, err := h.BindDeviceDriver("0000:01:00.0", config, audit.Fields{})
 				Expect(err).NotTo(HaveOccurred())
 				Expect(originalDriver).To(BeEmpty())
 			})
@@ -350,7 +581,7 @@ var _ = Describe("Host", func() {
 				tearDown = fs.Use()
 				config := &configapi.VfConfig{Driver: "default"}
 
-				_, err := h.BindDeviceDriver("0000:01:00.0", config)
+				_, err := h.BindDeviceDriver("0000:01:00.0", config, audit.Fields{})
 				Expect(err).NotTo(HaveOccurred())
 			})
 		})
@@ -455,7 +686,7 @@ vhost_net 32768 1 tun, Live 0xffffffffa0456000`),
 				}
 				tearDown = fs.Use()
 
-				err := h.EnsureVhostModulesLoaded()
+				err := h.EnsureVhostModulesLoaded(audit.Fields{})
 				Expect(err).NotTo(HaveOccurred())
 			})
 		})
@@ -10,11 +10,14 @@
 package mock_host
 
 import (
+	context "context"
 	reflect "reflect"
 
 	ghw "github.com/jaypipes/ghw"
 	v1alpha1 "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/virtualfunction/v1alpha1"
+	audit "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/audit"
 	host "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host"
+	types "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
 	gomock "go.uber.org/mock/gomock"
 )
 
@@ -57,32 +60,61 @@ func (mr *MockInterfaceMockRecorder) BindDefaultDriver(pciAddress any) *gomock.C
 }
 
 // BindDeviceDriver mocks base method.
-func (m *MockInterface) BindDeviceDriver(pciAddress string, config *v1alpha1.VfConfig) (string, error) {
+func (m *MockInterface) BindDeviceDriver(pciAddress string, config *v1alpha1.VfConfig, fields audit.Fields) (string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "BindDeviceDriver", pciAddress, config)
+	ret := m.ctrl.Call(m, "BindDeviceDriver", pciAddress, config, fields)
 	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // BindDeviceDriver indicates an expected call of BindDeviceDriver.
-func (mr *MockInterfaceMockRecorder) BindDeviceDriver(pciAddress, config any) *gomock.Call {
+func (mr *MockInterfaceMockRecorder) BindDeviceDriver(pciAddress, config, fields any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BindDeviceDriver", reflect.TypeOf((*MockInterface)(nil).BindDeviceDriver), pciAddress, config)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BindDeviceDriver", reflect.TypeOf((*MockInterface)(nil).BindDeviceDriver), pciAddress, config, fields)
 }
 
 // BindDriverByBusAndDevice mocks base method.
-func (m *MockInterface) BindDriverByBusAndDevice(device, driver string) error {
+func (m *MockInterface) BindDriverByBusAndDevice(device, driver string, fields audit.Fields) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "BindDriverByBusAndDevice", device, driver)
+	ret := m.ctrl.Call(m, "BindDriverByBusAndDevice", device, driver, fields)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // BindDriverByBusAndDevice indicates an expected call of BindDriverByBusAndDevice.
-func (mr *MockInterfaceMockRecorder) BindDriverByBusAndDevice(device, driver any) *gomock.Call {
+func (mr *MockInterfaceMockRecorder) BindDriverByBusAndDevice(device, driver, fields any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BindDriverByBusAndDevice", reflect.TypeOf((*MockInterface)(nil).BindDriverByBusAndDevice), device, driver)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BindDriverByBusAndDevice", reflect.TypeOf((*MockInterface)(nil).BindDriverByBusAndDevice), device, driver, fields)
+}
+
+// CreateSF mocks base method.
+func (m *MockInterface) CreateSF(pfPciAddress string, sfNum int) (*host.SFInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateSF", pfPciAddress, sfNum)
+	ret0, _ := ret[0].(*host.SFInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateSF indicates an expected call of CreateSF.
+func (mr *MockInterfaceMockRecorder) CreateSF(pfPciAddress, sfNum any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateSF", reflect.TypeOf((*MockInterface)(nil).CreateSF), pfPciAddress, sfNum)
+}
+
+// DeleteSF mocks base method.
+func (m *MockInterface) DeleteSF(pfPciAddress string, portIndex uint32) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteSF", pfPciAddress, portIndex)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteSF indicates an expected call of DeleteSF.
+func (mr *MockInterfaceMockRecorder) DeleteSF(pfPciAddress, portIndex any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteSF", reflect.TypeOf((*MockInterface)(nil).DeleteSF), pfPciAddress, portIndex)
 }
 
 // EnsureDpdkModuleLoaded mocks base method.
@@ -100,17 +132,32 @@ func (mr *MockInterfaceMockRecorder) EnsureDpdkModuleLoaded(driver any) *gomock.
 }
 
 // EnsureVhostModulesLoaded mocks base method.
-func (m *MockInterface) EnsureVhostModulesLoaded() error {
+func (m *MockInterface) EnsureVhostModulesLoaded(fields audit.Fields) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "EnsureVhostModulesLoaded")
+	ret := m.ctrl.Call(m, "EnsureVhostModulesLoaded", fields)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // EnsureVhostModulesLoaded indicates an expected call of EnsureVhostModulesLoaded.
-func (mr *MockInterfaceMockRecorder) EnsureVhostModulesLoaded() *gomock.Call {
+func (mr *MockInterfaceMockRecorder) EnsureVhostModulesLoaded(fields any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnsureVhostModulesLoaded", reflect.TypeOf((*MockInterface)(nil).EnsureVhostModulesLoaded))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnsureVhostModulesLoaded", reflect.TypeOf((*MockInterface)(nil).EnsureVhostModulesLoaded), fields)
+}
+
+// GetAERCounters mocks base method.
+func (m *MockInterface) GetAERCounters(pciAddress string) (*host.AERCounters, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAERCounters", pciAddress)
+	ret0, _ := ret[0].(*host.AERCounters)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAERCounters indicates an expected call of GetAERCounters.
+func (mr *MockInterfaceMockRecorder) GetAERCounters(pciAddress any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAERCounters", reflect.TypeOf((*MockInterface)(nil).GetAERCounters), pciAddress)
 }
 
 // GetDriverByBusAndDevice mocks base method.
@@ -128,6 +175,51 @@ func (mr *MockInterfaceMockRecorder) GetDriverByBusAndDevice(device any) *gomock
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDriverByBusAndDevice", reflect.TypeOf((*MockInterface)(nil).GetDriverByBusAndDevice), device)
 }
 
+// GetHostUsage mocks base method.
+func (m *MockInterface) GetHostUsage(ifName string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetHostUsage", ifName)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetHostUsage indicates an expected call of GetHostUsage.
+func (mr *MockInterfaceMockRecorder) GetHostUsage(ifName any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetHostUsage", reflect.TypeOf((*MockInterface)(nil).GetHostUsage), ifName)
+}
+
+// GetLinkInfo mocks base method.
+func (m *MockInterface) GetLinkInfo(ifName string) (*host.LinkInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLinkInfo", ifName)
+	ret0, _ := ret[0].(*host.LinkInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLinkInfo indicates an expected call of GetLinkInfo.
+func (mr *MockInterfaceMockRecorder) GetLinkInfo(ifName any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLinkInfo", reflect.TypeOf((*MockInterface)(nil).GetLinkInfo), ifName)
+}
+
+// GetLinkSpeed mocks base method.
+func (m *MockInterface) GetLinkSpeed(ifName string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLinkSpeed", ifName)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLinkSpeed indicates an expected call of GetLinkSpeed.
+func (mr *MockInterfaceMockRecorder) GetLinkSpeed(ifName any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLinkSpeed", reflect.TypeOf((*MockInterface)(nil).GetLinkSpeed), ifName)
+}
+
 // GetNicSriovMode mocks base method.
 func (m *MockInterface) GetNicSriovMode(pciAddr string) string {
 	m.ctrl.T.Helper()
@@ -187,6 +279,81 @@ func (mr *MockInterfaceMockRecorder) GetParentPciAddress(pciAddress any) *gomock
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetParentPciAddress", reflect.TypeOf((*MockInterface)(nil).GetParentPciAddress), pciAddress)
 }
 
+// GetRDMACharDevices mocks base method.
+func (m *MockInterface) GetRDMACharDevices(pciAddress string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRDMACharDevices", pciAddress)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRDMACharDevices indicates an expected call of GetRDMACharDevices.
+func (mr *MockInterfaceMockRecorder) GetRDMACharDevices(pciAddress any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRDMACharDevices", reflect.TypeOf((*MockInterface)(nil).GetRDMACharDevices), pciAddress)
+}
+
+// GetRDMADevice mocks base method.
+func (m *MockInterface) GetRDMADevice(pciAddress string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRDMADevice", pciAddress)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRDMADevice indicates an expected call of GetRDMADevice.
+func (mr *MockInterfaceMockRecorder) GetRDMADevice(pciAddress any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRDMADevice", reflect.TypeOf((*MockInterface)(nil).GetRDMADevice), pciAddress)
+}
+
+// GetRDMANetnsMode mocks base method.
+func (m *MockInterface) GetRDMANetnsMode() (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRDMANetnsMode")
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRDMANetnsMode indicates an expected call of GetRDMANetnsMode.
+func (mr *MockInterfaceMockRecorder) GetRDMANetnsMode() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRDMANetnsMode", reflect.TypeOf((*MockInterface)(nil).GetRDMANetnsMode))
+}
+
+// GetSFList mocks base method.
+func (m *MockInterface) GetSFList(pfPciAddress string) ([]host.SFInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSFList", pfPciAddress)
+	ret0, _ := ret[0].([]host.SFInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSFList indicates an expected call of GetSFList.
+func (mr *MockInterfaceMockRecorder) GetSFList(pfPciAddress any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSFList", reflect.TypeOf((*MockInterface)(nil).GetSFList), pfPciAddress)
+}
+
+// GetVFHardwareAddress mocks base method.
+func (m *MockInterface) GetVFHardwareAddress(pciAddress, pfName string, vfID int) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetVFHardwareAddress", pciAddress, pfName, vfID)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetVFHardwareAddress indicates an expected call of GetVFHardwareAddress.
+func (mr *MockInterfaceMockRecorder) GetVFHardwareAddress(pciAddress, pfName, vfID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetVFHardwareAddress", reflect.TypeOf((*MockInterface)(nil).GetVFHardwareAddress), pciAddress, pfName, vfID)
+}
+
 // GetVFIODeviceFile mocks base method.
 func (m *MockInterface) GetVFIODeviceFile(pciAddress string) (string, string, error) {
 	m.ctrl.T.Helper()
@@ -288,6 +455,20 @@ func (mr *MockInterfaceMockRecorder) LoadKernelModule(moduleName any) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LoadKernelModule", reflect.TypeOf((*MockInterface)(nil).LoadKernelModule), moduleName)
 }
 
+// MoveRDMADeviceToNetns mocks base method.
+func (m *MockInterface) MoveRDMADeviceToNetns(rdmaDevice, netnsPath string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MoveRDMADeviceToNetns", rdmaDevice, netnsPath)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MoveRDMADeviceToNetns indicates an expected call of MoveRDMADeviceToNetns.
+func (mr *MockInterfaceMockRecorder) MoveRDMADeviceToNetns(rdmaDevice, netnsPath any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MoveRDMADeviceToNetns", reflect.TypeOf((*MockInterface)(nil).MoveRDMADeviceToNetns), rdmaDevice, netnsPath)
+}
+
 // PCI mocks base method.
 func (m *MockInterface) PCI() (*ghw.PCIInfo, error) {
 	m.ctrl.T.Helper()
@@ -303,18 +484,103 @@ func (mr *MockInterfaceMockRecorder) PCI() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PCI", reflect.TypeOf((*MockInterface)(nil).PCI))
 }
 
+// ResetDevice mocks base method.
+func (m *MockInterface) ResetDevice(pciAddress string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResetDevice", pciAddress)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ResetDevice indicates an expected call of ResetDevice.
+func (mr *MockInterfaceMockRecorder) ResetDevice(pciAddress any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetDevice", reflect.TypeOf((*MockInterface)(nil).ResetDevice), pciAddress)
+}
+
 // RestoreDeviceDriver mocks base method.
-func (m *MockInterface) RestoreDeviceDriver(pciAddress, originalDriver string) error {
+func (m *MockInterface) RestoreDeviceDriver(pciAddress, originalDriver string, fields audit.Fields) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "RestoreDeviceDriver", pciAddress, originalDriver)
+	ret := m.ctrl.Call(m, "RestoreDeviceDriver", pciAddress, originalDriver, fields)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // RestoreDeviceDriver indicates an expected call of RestoreDeviceDriver.
-func (mr *MockInterfaceMockRecorder) RestoreDeviceDriver(pciAddress, originalDriver any) *gomock.Call {
+func (mr *MockInterfaceMockRecorder) RestoreDeviceDriver(pciAddress, originalDriver, fields any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreDeviceDriver", reflect.TypeOf((*MockInterface)(nil).RestoreDeviceDriver), pciAddress, originalDriver, fields)
+}
+
+// RestoreRDMADeviceNetns mocks base method.
+func (m *MockInterface) RestoreRDMADeviceNetns(rdmaDevice, netnsPath string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreRDMADeviceNetns", rdmaDevice, netnsPath)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RestoreRDMADeviceNetns indicates an expected call of RestoreRDMADeviceNetns.
+func (mr *MockInterfaceMockRecorder) RestoreRDMADeviceNetns(rdmaDevice, netnsPath any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreRDMADeviceNetns", reflect.TypeOf((*MockInterface)(nil).RestoreRDMADeviceNetns), rdmaDevice, netnsPath)
+}
+
+// SetLinkMTU mocks base method.
+func (m *MockInterface) SetLinkMTU(ifName string, mtu int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetLinkMTU", ifName, mtu)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetLinkMTU indicates an expected call of SetLinkMTU.
+func (mr *MockInterfaceMockRecorder) SetLinkMTU(ifName, mtu any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetLinkMTU", reflect.TypeOf((*MockInterface)(nil).SetLinkMTU), ifName, mtu)
+}
+
+// SetVFGUID mocks base method.
+func (m *MockInterface) SetVFGUID(pciAddress, pfName string, vfID int, guid string, fields audit.Fields) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetVFGUID", pciAddress, pfName, vfID, guid, fields)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetVFGUID indicates an expected call of SetVFGUID.
+func (mr *MockInterfaceMockRecorder) SetVFGUID(pciAddress, pfName, vfID, guid, fields any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetVFGUID", reflect.TypeOf((*MockInterface)(nil).SetVFGUID), pciAddress, pfName, vfID, guid, fields)
+}
+
+// SetVFLinkSettings mocks base method.
+func (m *MockInterface) SetVFLinkSettings(pfName string, vfID int, settings *types.VFLinkSettings) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetVFLinkSettings", pfName, vfID, settings)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetVFLinkSettings indicates an expected call of SetVFLinkSettings.
+func (mr *MockInterfaceMockRecorder) SetVFLinkSettings(pfName, vfID, settings any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetVFLinkSettings", reflect.TypeOf((*MockInterface)(nil).SetVFLinkSettings), pfName, vfID, settings)
+}
+
+// SubscribeLinkUpdates mocks base method.
+func (m *MockInterface) SubscribeLinkUpdates(ctx context.Context) (<-chan string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SubscribeLinkUpdates", ctx)
+	ret0, _ := ret[0].(<-chan string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SubscribeLinkUpdates indicates an expected call of SubscribeLinkUpdates.
+func (mr *MockInterfaceMockRecorder) SubscribeLinkUpdates(ctx any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreDeviceDriver", reflect.TypeOf((*MockInterface)(nil).RestoreDeviceDriver), pciAddress, originalDriver)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SubscribeLinkUpdates", reflect.TypeOf((*MockInterface)(nil).SubscribeLinkUpdates), ctx)
 }
 
 // TryGetInterfaceName mocks base method.
@@ -332,15 +598,15 @@ func (mr *MockInterfaceMockRecorder) TryGetInterfaceName(pciAddr any) *gomock.Ca
 }
 
 // UnbindDriverByBusAndDevice mocks base method.
-func (m *MockInterface) UnbindDriverByBusAndDevice(device string) error {
+func (m *MockInterface) UnbindDriverByBusAndDevice(device string, fields audit.Fields) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UnbindDriverByBusAndDevice", device)
+	ret := m.ctrl.Call(m, "UnbindDriverByBusAndDevice", device, fields)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // UnbindDriverByBusAndDevice indicates an expected call of UnbindDriverByBusAndDevice.
-func (mr *MockInterfaceMockRecorder) UnbindDriverByBusAndDevice(device any) *gomock.Call {
+func (mr *MockInterfaceMockRecorder) UnbindDriverByBusAndDevice(device, fields any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnbindDriverByBusAndDevice", reflect.TypeOf((*MockInterface)(nil).UnbindDriverByBusAndDevice), device)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnbindDriverByBusAndDevice", reflect.TypeOf((*MockInterface)(nil).UnbindDriverByBusAndDevice), device, fields)
 }
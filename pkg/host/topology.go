@@ -0,0 +1,528 @@
+package host
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Topology is a declarative description of the PCI devices of a fake host. Use builds a
+// realistic sysfs tree from it and emulates the kernel driver binding, so the real Host
+// can run against it. Netlink and devlink are not emulated. Example:
+//
+//	drivers: [vfio-pci]
+//	modules: [vfio, vfio_pci]
+//	bridges:
+//	- address: "0000:00:01.0"
+//	pfs:
+//	- address: "0000:01:00.0"
+//	  parent: "0000:00:01.0"
+//	  vendor: "8086"
+//	  device: "159b"
+//	  driver: ice
+//	  netdev: ens1f0
+//	  numaNode: 0
+//	  link: {speed: 25000}
+//	  vfs:
+//	  - {address: "0000:01:01.0", device: "1889", driver: iavf, netdev: ens1f0v0, iommuGroup: 42}
+type Topology struct {
+	// Drivers are the PCI drivers available in addition to the drivers of the devices
+	Drivers []string `json:"drivers,omitempty"`
+	// Modules are the loaded kernel modules
+	Modules []string         `json:"modules,omitempty"`
+	Bridges []TopologyBridge `json:"bridges,omitempty"`
+	PFs     []TopologyPF     `json:"pfs"`
+
+	mutex   sync.Mutex
+	rootDir string
+	devices map[string]*topologyDevice
+}
+
+// TopologyBridge is a PCI bridge of a Topology
+type TopologyBridge struct {
+	Address string `json:"address"`
+	// Parent is the upstream bridge, the bridge is on the PCIe root complex of its bus otherwise
+	Parent string `json:"parent,omitempty"`
+}
+
+// TopologyFunction holds the fields common to the PFs and VFs of a Topology
+type TopologyFunction struct {
+	Address string `json:"address"`
+	Device  string `json:"device"`
+	// Driver is the driver the function is bound to, and probed with when not overridden
+	Driver     string `json:"driver,omitempty"`
+	NetDev     string `json:"netdev,omitempty"`
+	RDMADevice string `json:"rdmaDevice,omitempty"`
+	IOMMUGroup *int   `json:"iommuGroup,omitempty"`
+}
+
+// TopologyPF is an SR-IOV PF of a Topology. Its VFs share its vendor, NUMA node and parent.
+type TopologyPF struct {
+	TopologyFunction
+	Vendor string `json:"vendor"`
+	// Parent is the upstream bridge, the PF is on the PCIe root complex of its bus otherwise
+	Parent   string       `json:"parent,omitempty"`
+	NUMANode *int         `json:"numaNode,omitempty"`
+	Link     TopologyLink `json:"link,omitempty"`
+	VFs      []TopologyVF `json:"vfs,omitempty"`
+}
+
+// TopologyVF is a VF of a TopologyPF, its VF ID is its index
+type TopologyVF struct {
+	TopologyFunction
+}
+
+// TopologyLink holds the link properties of the netdevs of a PF and its VFs
+type TopologyLink struct {
+	Speed     int    `json:"speed,omitempty"`
+	MTU       int    `json:"mtu,omitempty"`
+	OperState string `json:"operState,omitempty"`
+}
+
+// topologyDevice is a PCI device of a Topology with its sysfs dir
+type topologyDevice struct {
+	TopologyFunction
+	path string // relative to the root dir
+	link TopologyLink
+	rdma int // index of the uverbs and umad devices
+}
+
+// LoadTopologyFile reads a Topology from a YAML file
+func LoadTopologyFile(path string) (*Topology, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read topology %s: %w", path, err)
+	}
+	return LoadTopology(data)
+}
+
+// LoadTopology parses and validates a YAML Topology
+func LoadTopology(data []byte) (*Topology, error) {
+	t := &Topology{}
+	if err := yaml.UnmarshalStrict(data, t); err != nil {
+		return nil, fmt.Errorf("failed to parse topology: %w", err)
+	}
+	if err := t.resolve(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// resolve validates the topology and computes the sysfs dir of every device
+func (t *Topology) resolve() error {
+	t.devices = map[string]*topologyDevice{}
+	bridgePaths := map[string]string{}
+	add := func(function TopologyFunction, parent string, link TopologyLink) (*topologyDevice, error) {
+		if len(strings.Split(function.Address, ":")) != 3 {
+			return nil, fmt.Errorf("invalid PCI address %q", function.Address)
+		}
+		if _, exists := t.devices[function.Address]; exists {
+			return nil, fmt.Errorf("duplicate PCI address %s", function.Address)
+		}
+		if _, exists := bridgePaths[function.Address]; exists {
+			return nil, fmt.Errorf("duplicate PCI address %s", function.Address)
+		}
+		parentPath, err := devicesDirOf(function.Address, parent, bridgePaths)
+		if err != nil {
+			return nil, err
+		}
+		device := &topologyDevice{TopologyFunction: function, path: filepath.Join(parentPath, function.Address), link: link}
+		t.devices[function.Address] = device
+		return device, nil
+	}
+
+	for _, bridge := range t.Bridges {
+		if len(strings.Split(bridge.Address, ":")) != 3 {
+			return fmt.Errorf("invalid PCI address %q", bridge.Address)
+		}
+		parentPath, err := devicesDirOf(bridge.Address, bridge.Parent, bridgePaths)
+		if err != nil {
+			return err
+		}
+		bridgePaths[bridge.Address] = filepath.Join(parentPath, bridge.Address)
+	}
+
+	rdma := 0
+	for _, pf := range t.PFs {
+		if pf.Vendor == "" || pf.Device == "" {
+			return fmt.Errorf("PF %s has no vendor or device ID", pf.Address)
+		}
+		pfDevice, err := add(pf.TopologyFunction, pf.Parent, pf.Link)
+		if err != nil {
+			return err
+		}
+		if pf.RDMADevice != "" {
+			pfDevice.rdma, rdma = rdma, rdma+1
+		}
+		for _, vf := range pf.VFs {
+			if vf.Device == "" {
+				return fmt.Errorf("VF %s has no device ID", vf.Address)
+			}
+			vfDevice, err := add(vf.TopologyFunction, pf.Parent, pf.Link)
+			if err != nil {
+				return err
+			}
+			if vf.RDMADevice != "" {
+				vfDevice.rdma, rdma = rdma, rdma+1
+			}
+		}
+	}
+	return nil
+}
+
+// devicesDirOf returns the dir under sys/devices of the devices behind a parent bridge, or
+// on the PCIe root complex of the bus of the device without a parent
+func devicesDirOf(address, parent string, bridgePaths map[string]string) (string, error) {
+	if parent == "" {
+		parts := strings.Split(address, ":")
+		return filepath.Join("sys/devices", fmt.Sprintf("pci%s:%s", parts[0], parts[1])), nil
+	}
+	parentPath, ok := bridgePaths[parent]
+	if !ok {
+		return "", fmt.Errorf("parent bridge %s of %s not found", parent, address)
+	}
+	return parentPath, nil
+}
+
+// Use builds the sysfs tree of the topology in a temporary root dir, points RootDir to it
+// and emulates the kernel on writes to the bind, unbind, drivers_probe and driver_override
+// files. It returns a function to tear it down. Example usage: defer topology.Use()()
+func (t *Topology) Use() func() {
+	fs := &FakeFilesystem{
+		Dirs:     []string{"sys/bus/pci/devices", "sys/class/net", "sys/kernel/iommu_groups", "proc"},
+		Files:    map[string][]byte{"sys/bus/pci/drivers_probe": nil},
+		Symlinks: map[string]string{},
+	}
+	fs.Files["proc/modules"] = []byte(modulesFile(t.Modules))
+	fs.Files["usr/share/hwdata/pci.ids"] = []byte(pciIDs)
+	fs.Dirs = append(fs.Dirs, "usr/share/hwdata")
+
+	drivers := append([]string{}, t.Drivers...)
+	for _, device := range t.devices {
+		if device.Driver != "" {
+			drivers = append(drivers, device.Driver)
+		}
+	}
+	for _, driver := range drivers {
+		fs.Dirs = append(fs.Dirs, filepath.Join("sys/bus/pci/drivers", driver))
+		fs.Files[filepath.Join("sys/bus/pci/drivers", driver, "bind")] = nil
+		fs.Files[filepath.Join("sys/bus/pci/drivers", driver, "unbind")] = nil
+	}
+
+	for address, bridgePath := range t.bridgePaths() {
+		addPCIDevice(fs, address, bridgePath, "8086", "0000", "060400")
+	}
+	for _, pf := range t.PFs {
+		pfDevice := t.devices[pf.Address]
+		addPCIDevice(fs, pf.Address, pfDevice.path, pf.Vendor, pf.Device, "020000")
+		fs.Files[filepath.Join(pfDevice.path, "sriov_totalvfs")] = []byte(fmt.Sprintf("%d\n", len(pf.VFs)))
+		fs.Files[filepath.Join(pfDevice.path, "sriov_numvfs")] = []byte(fmt.Sprintf("%d\n", len(pf.VFs)))
+		numaNode := -1
+		if pf.NUMANode != nil {
+			numaNode = *pf.NUMANode
+		}
+		for vfID, vf := range pf.VFs {
+			vfDevice := t.devices[vf.Address]
+			addPCIDevice(fs, vf.Address, vfDevice.path, pf.Vendor, vf.Device, "020000")
+			addSymlink(fs, filepath.Join(pfDevice.path, fmt.Sprintf("virtfn%d", vfID)), vfDevice.path)
+			addSymlink(fs, filepath.Join(vfDevice.path, "physfn"), pfDevice.path)
+			fs.Files[filepath.Join(vfDevice.path, "numa_node")] = []byte(fmt.Sprintf("%d\n", numaNode))
+			// VFs support function level reset
+			fs.Files[filepath.Join(vfDevice.path, "reset")] = []byte{}
+		}
+		fs.Files[filepath.Join(pfDevice.path, "numa_node")] = []byte(fmt.Sprintf("%d\n", numaNode))
+	}
+	for _, device := range t.devices {
+		if device.IOMMUGroup != nil {
+			groupPath := filepath.Join("sys/kernel/iommu_groups", fmt.Sprint(*device.IOMMUGroup))
+			fs.Dirs = append(fs.Dirs, filepath.Join(groupPath, "devices"))
+			addSymlink(fs, filepath.Join(device.path, "iommu_group"), groupPath)
+			addSymlink(fs, filepath.Join(groupPath, "devices", device.Address), device.path)
+		}
+	}
+
+	tearDown := fs.Use()
+	t.mutex.Lock()
+	t.rootDir = fs.RootDir
+	t.mutex.Unlock()
+	for _, device := range t.devices {
+		if device.Driver != "" {
+			if err := t.bind(device, device.Driver); err != nil {
+				panic(fmt.Errorf("error binding fake device %s: %s", device.Address, err.Error()))
+			}
+		}
+	}
+	writeSysfsFile = t.writeSysfsFile
+
+	return func() {
+		writeSysfsFile = func(path string, data []byte) error {
+			return os.WriteFile(path, data, os.ModeAppend)
+		}
+		RootDir = ""
+		tearDown()
+	}
+}
+
+// Path returns the path of a file of the topology, relative to its root dir, for assertions
+func (t *Topology) Path(path string) string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return filepath.Join(t.rootDir, path)
+}
+
+// bridgePaths returns the sysfs dirs of the bridges
+func (t *Topology) bridgePaths() map[string]string {
+	paths := map[string]string{}
+	for _, bridge := range t.Bridges {
+		parentPath, _ := devicesDirOf(bridge.Address, bridge.Parent, paths)
+		paths[bridge.Address] = filepath.Join(parentPath, bridge.Address)
+	}
+	return paths
+}
+
+// addPCIDevice adds the attribute files of a PCI device and its link in /sys/bus/pci/devices
+func addPCIDevice(fs *FakeFilesystem, address, path, vendor, device, class string) {
+	fs.Dirs = append(fs.Dirs, path)
+	fs.Files[filepath.Join(path, "vendor")] = []byte(fmt.Sprintf("0x%s\n", vendor))
+	fs.Files[filepath.Join(path, "device")] = []byte(fmt.Sprintf("0x%s\n", device))
+	fs.Files[filepath.Join(path, "class")] = []byte(fmt.Sprintf("0x%s\n", class))
+	fs.Files[filepath.Join(path, "modalias")] = []byte(fmt.Sprintf("pci:v0000%sd0000%ssv0000%ssd00000000bc%ssc%si%s\n",
+		strings.ToUpper(vendor), strings.ToUpper(device), strings.ToUpper(vendor), class[0:2], class[2:4], class[4:6]))
+	fs.Files[filepath.Join(path, "driver_override")] = []byte("(null)\n")
+	addSymlink(fs, filepath.Join("sys/bus/pci/devices", address), path)
+}
+
+// addSymlink adds a relative symlink, like the ones of sysfs
+func addSymlink(fs *FakeFilesystem, link, target string) {
+	relTarget, err := filepath.Rel(filepath.Dir(link), target)
+	if err != nil {
+		panic(fmt.Errorf("error creating fake symlink: %s", err.Error()))
+	}
+	fs.Symlinks[link] = relTarget
+}
+
+// modulesFile returns the content of /proc/modules with the modules loaded
+func modulesFile(modules []string) string {
+	lines := []string{}
+	for _, module := range modules {
+		lines = append(lines, fmt.Sprintf("%s 16384 0 - Live 0x0000000000000000", module))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// writeSysfsFile emulates the kernel for the writes to the driver files of the topology
+func (t *Topology) writeSysfsFile(path string, data []byte) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	relPath, err := filepath.Rel(t.rootDir, path)
+	if err != nil || strings.HasPrefix(relPath, "..") {
+		return os.WriteFile(path, data, os.ModeAppend)
+	}
+	value := strings.TrimSpace(strings.Trim(string(data), "\x00"))
+	parts := strings.Split(relPath, string(filepath.Separator))
+
+	switch {
+	case relPath == "sys/bus/pci/drivers_probe":
+		device, err := t.device(value, path)
+		if err != nil {
+			return err
+		}
+		if t.boundDriver(device) != "" {
+			return nil
+		}
+		driver := device.Driver
+		if override := t.driverOverride(device); override != "" {
+			driver = override
+		}
+		if driver == "" {
+			return nil
+		}
+		return t.bind(device, driver)
+	case len(parts) == 6 && strings.HasPrefix(relPath, "sys/bus/pci/drivers/") && (parts[5] == "bind" || parts[5] == "unbind"):
+		if _, err := os.Stat(path); err != nil {
+			return &os.PathError{Op: "open", Path: path, Err: syscall.ENOENT}
+		}
+		device, err := t.device(value, path)
+		if err != nil {
+			return err
+		}
+		if parts[5] == "bind" {
+			if t.boundDriver(device) != "" {
+				return &os.PathError{Op: "write", Path: path, Err: syscall.EBUSY}
+			}
+			return t.bind(device, parts[4])
+		}
+		if t.boundDriver(device) != parts[4] {
+			return &os.PathError{Op: "write", Path: path, Err: syscall.ENODEV}
+		}
+		return t.unbind(device, parts[4])
+	case len(parts) == 6 && strings.HasPrefix(relPath, "sys/bus/pci/devices/") && parts[5] == "driver_override":
+		if value == "" {
+			value = "(null)"
+		}
+		return os.WriteFile(path, []byte(value+"\n"), 0600)
+	default:
+		return os.WriteFile(path, data, os.ModeAppend)
+	}
+}
+
+// device returns the device of a PCI address written to a driver file
+func (t *Topology) device(address, path string) (*topologyDevice, error) {
+	device, ok := t.devices[address]
+	if !ok {
+		return nil, &os.PathError{Op: "write", Path: path, Err: syscall.ENODEV}
+	}
+	return device, nil
+}
+
+// boundDriver returns the driver a device is bound to
+func (t *Topology) boundDriver(device *topologyDevice) string {
+	driverLink, err := os.Readlink(filepath.Join(t.rootDir, device.path, "driver"))
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(driverLink)
+}
+
+// driverOverride returns the driver_override of a device
+func (t *Topology) driverOverride(device *topologyDevice) string {
+	override, err := os.ReadFile(filepath.Join(t.rootDir, device.path, "driver_override"))
+	if err != nil || strings.TrimSpace(string(override)) == "(null)" {
+		return ""
+	}
+	return strings.TrimSpace(string(override))
+}
+
+// bind links a device and a driver. The netdev and RDMA device of the device are created
+// when the driver is a kernel driver.
+func (t *Topology) bind(device *topologyDevice, driver string) error {
+	driverPath := filepath.Join("sys/bus/pci/drivers", driver)
+	if err := t.symlink(filepath.Join(device.path, "driver"), driverPath); err != nil {
+		return err
+	}
+	if err := t.symlink(filepath.Join(driverPath, device.Address), device.path); err != nil {
+		return err
+	}
+	if (&Host{}).IsDpdkDriver(driver) {
+		return nil
+	}
+
+	if device.NetDev != "" {
+		netPath := filepath.Join(device.path, "net", device.NetDev)
+		mtu := device.link.MTU
+		if mtu == 0 {
+			mtu = 1500
+		}
+		operState := device.link.OperState
+		if operState == "" {
+			operState = "up"
+		}
+		speed := device.link.Speed
+		if speed == 0 {
+			speed = -1
+		}
+		carrier := "0"
+		if operState == "up" {
+			carrier = "1"
+		}
+		for file, content := range map[string]string{
+			"mtu":       fmt.Sprint(mtu),
+			"operstate": operState,
+			"carrier":   carrier,
+			"speed":     fmt.Sprint(speed),
+			"type":      "1",
+		} {
+			if err := t.writeFile(filepath.Join(netPath, file), content+"\n"); err != nil {
+				return err
+			}
+		}
+		if err := t.symlink(filepath.Join(netPath, "device"), device.path); err != nil {
+			return err
+		}
+		if err := t.symlink(filepath.Join("sys/class/net", device.NetDev), netPath); err != nil {
+			return err
+		}
+	}
+	if device.RDMADevice != "" {
+		for _, dir := range []string{
+			filepath.Join("infiniband", device.RDMADevice),
+			filepath.Join("infiniband_verbs", fmt.Sprintf("uverbs%d", device.rdma)),
+			filepath.Join("infiniband_mad", fmt.Sprintf("umad%d", device.rdma)),
+		} {
+			//nolint: mnd
+			if err := os.MkdirAll(filepath.Join(t.rootDir, device.path, dir), 0755); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// unbind removes the links between a device and its driver, and the netdev and RDMA
+// device of the device
+func (t *Topology) unbind(device *topologyDevice, driver string) error {
+	paths := []string{
+		filepath.Join(device.path, "driver"),
+		filepath.Join("sys/bus/pci/drivers", driver, device.Address),
+		filepath.Join(device.path, "net"),
+		filepath.Join(device.path, "infiniband"),
+		filepath.Join(device.path, "infiniband_verbs"),
+		filepath.Join(device.path, "infiniband_mad"),
+	}
+	if device.NetDev != "" {
+		paths = append(paths, filepath.Join("sys/class/net", device.NetDev))
+	}
+	for _, path := range paths {
+		if err := os.RemoveAll(filepath.Join(t.rootDir, path)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// symlink creates a relative symlink in the root dir
+func (t *Topology) symlink(link, target string) error {
+	relTarget, err := filepath.Rel(filepath.Dir(link), target)
+	if err != nil {
+		return err
+	}
+	link = filepath.Join(t.rootDir, link)
+	//nolint: mnd
+	if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil {
+		return err
+	}
+	if err := os.Symlink(relTarget, link); err != nil && !errors.Is(err, os.ErrExist) {
+		return err
+	}
+	return nil
+}
+
+// writeFile writes a file in the root dir
+func (t *Topology) writeFile(path, content string) error {
+	path = filepath.Join(t.rootDir, path)
+	//nolint: mnd
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(content), 0600)
+}
+
+// pciIDs is a minimal PCI ID database for the devices of the topologies
+const pciIDs = `8086  Intel Corporation
+	0000  PCI Bridge
+	159b  Ethernet Controller E810-XXV for SFP
+	1889  Ethernet Adaptive Virtual Function
+15b3  Mellanox Technologies
+	101d  MT2892 Family [ConnectX-6 Dx]
+	101e  ConnectX Family mlx5Gen Virtual Function
+C 02  Network controller
+	00  Ethernet controller
+C 06  Bridge
+	04  PCI bridge
+`
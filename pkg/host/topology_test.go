@@ -0,0 +1,163 @@
+package host_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	configapi "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/virtualfunction/v1alpha1"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/audit"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host"
+)
+
+var _ = Describe("Topology", func() {
+	var (
+		h        host.Interface
+		topology *host.Topology
+		tearDown func()
+	)
+
+	BeforeEach(func() {
+		var err error
+		topology, err = host.LoadTopologyFile("testdata/topology.yaml")
+		Expect(err).NotTo(HaveOccurred())
+		tearDown = topology.Use()
+		h = host.NewHost()
+	})
+
+	AfterEach(func() {
+		tearDown()
+		Expect(host.RootDir).To(BeEmpty())
+	})
+
+	Context("LoadTopology", func() {
+		It("rejects unknown fields, duplicate addresses and unknown bridges", func() {
+			_, err := host.LoadTopology([]byte(`pfs: [{address: "0000:01:00.0", vendor: "8086", device: "159b", speed: 10}]`))
+			Expect(err).To(MatchError(ContainSubstring("unknown field")))
+
+			_, err = host.LoadTopology([]byte(`
+pfs:
+- {address: "0000:01:00.0", vendor: "8086", device: "159b", vfs: [{address: "0000:01:00.0", device: "1889"}]}`))
+			Expect(err).To(MatchError(ContainSubstring("duplicate PCI address 0000:01:00.0")))
+
+			_, err = host.LoadTopology([]byte(`pfs: [{address: "0000:01:00.0", parent: "0000:00:01.0", vendor: "8086", device: "159b"}]`))
+			Expect(err).To(MatchError(ContainSubstring("parent bridge 0000:00:01.0 of 0000:01:00.0 not found")))
+		})
+	})
+
+	Context("sysfs tree", func() {
+		It("is discovered by the real host", func() {
+			pci, err := h.PCI()
+			Expect(err).NotTo(HaveOccurred())
+			addresses := []string{}
+			for _, device := range pci.Devices {
+				addresses = append(addresses, device.Address)
+			}
+			Expect(addresses).To(ConsistOf("0000:00:01.0", "0000:80:01.0", "0000:01:00.0", "0000:01:01.0", "0000:01:01.1", "0000:81:00.0", "0000:81:00.2"))
+
+			Expect(h.IsSriovPF("0000:01:00.0")).To(BeTrue())
+			Expect(h.IsSriovVF("0000:01:01.1")).To(BeTrue())
+			Expect(h.GetVFList("0000:01:00.0")).To(ConsistOf(
+				host.VFInfo{PciAddress: "0000:01:01.0", VFID: 0, DeviceID: "1889"},
+				host.VFInfo{PciAddress: "0000:01:01.1", VFID: 1, DeviceID: "1889"},
+			))
+			Expect(h.TryGetInterfaceName("0000:01:01.0")).To(Equal("ens1f0v0"))
+			Expect(h.GetNumaNode("0000:81:00.2")).To(Equal("1"))
+			Expect(h.GetParentPciAddress("0000:81:00.0")).To(Equal("0000:80:01.0"))
+			Expect(h.GetPCIeRoot("0000:81:00.2")).To(Equal("pci0000:80"))
+			Expect(h.GetRDMADevice("0000:81:00.2")).To(Equal("mlx5_2"))
+			Expect(h.GetRDMACharDevices("0000:81:00.2")).To(ConsistOf("/dev/infiniband/uverbs1", "/dev/infiniband/umad1", "/dev/infiniband/rdma_cm"))
+
+			link, err := h.GetLinkInfo("ens1f0")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(link.Speed).To(Equal(25000))
+			Expect(link.MTU).To(Equal(9000))
+			Expect(link.Driver).To(Equal("ice"))
+		})
+	})
+
+	Context("kernel emulation", func() {
+		It("rebinds a VF to vfio-pci and back to its default driver", func() {
+			originalDriver, err := h.BindDeviceDriver("0000:01:01.1", &configapi.VfConfig{Driver: "vfio-pci"}, audit.Fields{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(originalDriver).To(Equal("iavf"))
+
+			Expect(os.Readlink(topology.Path("sys/bus/pci/devices/0000:01:01.1/driver"))).To(HaveSuffix("/drivers/vfio-pci"))
+			Expect(topology.Path("sys/bus/pci/drivers/vfio-pci/0000:01:01.1")).To(BeADirectory())
+			Expect(topology.Path("sys/bus/pci/drivers/iavf/0000:01:01.1")).NotTo(BeAnExistingFile())
+			Expect(topology.Path("sys/class/net/ens1f0v1")).NotTo(BeAnExistingFile())
+			Expect(os.ReadFile(topology.Path("sys/bus/pci/devices/0000:01:01.1/driver_override"))).To(Equal([]byte("(null)\n")))
+
+			devFile, _, err := h.GetVFIODeviceFile("0000:01:01.1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(devFile).To(Equal("/dev/vfio/41"))
+
+			Expect(h.RestoreDeviceDriver("0000:01:01.1", "", audit.Fields{})).To(Succeed())
+			Expect(h.GetDriverByBusAndDevice("0000:01:01.1")).To(Equal("iavf"))
+			Expect(filepath.Join(topology.Path("sys/class/net/ens1f0v1"), "mtu")).To(BeARegularFile())
+		})
+
+		It("resets a VF and sets the MTU of its netdev", func() {
+			Expect(h.ResetDevice("0000:01:01.0")).To(Succeed())
+			Expect(os.ReadFile(topology.Path("sys/bus/pci/devices/0000:01:01.0/reset"))).To(Equal([]byte("1")))
+			Expect(h.ResetDevice("0000:00:01.0")).To(MatchError(ContainSubstring("doesn't support reset")))
+
+			Expect(h.SetLinkMTU("ens1f0v0", 9000)).To(Succeed())
+			link, err := h.GetLinkInfo("ens1f0v0")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(link.MTU).To(Equal(9000))
+		})
+
+		It("records the driver changes in the audit log", func() {
+			auditPath := filepath.Join(GinkgoT().TempDir(), "audit.log")
+			auditLog, err := audit.NewLogger(auditPath, 0, 0)
+			Expect(err).NotTo(HaveOccurred())
+			h = host.NewHost(host.WithAuditLogger(auditLog))
+			fields := audit.Fields{ClaimUID: "claim1", Claim: "default/claim1", PodUID: "pod1"}
+
+			_, err = h.BindDeviceDriver("0000:01:01.1", &configapi.VfConfig{Driver: "vfio-pci"}, fields)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = h.BindDeviceDriver("0000:01:01.0", &configapi.VfConfig{Driver: "ixgbevf"}, audit.Fields{})
+			Expect(err).To(HaveOccurred())
+			Expect(h.RestoreDeviceDriver("0000:01:01.1", "iavf", fields)).To(Succeed())
+			Expect(auditLog.Close()).To(Succeed())
+
+			events, err := audit.Query(auditPath, audit.Filter{PciAddress: "0000:01:01.1"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(events).To(HaveLen(4))
+			Expect(events[0].Operation).To(Equal(audit.OperationUnbind))
+			Expect(events[0].Driver).To(Equal("iavf"))
+			Expect(events[1].Operation).To(Equal(audit.OperationBind))
+			Expect(events[1].Driver).To(Equal("vfio-pci"))
+			Expect(events[1].Outcome).To(Equal(audit.OutcomeSuccess))
+			Expect(events[2].Operation).To(Equal(audit.OperationUnbind))
+			Expect(events[2].Driver).To(Equal("vfio-pci"))
+			Expect(events[3].Operation).To(Equal(audit.OperationBind))
+			Expect(events[3].Driver).To(Equal("iavf"))
+			for _, event := range events {
+				Expect(event.ClaimUID).To(Equal("claim1"))
+				Expect(event.Claim).To(Equal("default/claim1"))
+				Expect(event.PodUID).To(Equal("pod1"))
+			}
+
+			events, err = audit.Query(auditPath, audit.Filter{PciAddress: "0000:01:01.0", Operation: audit.OperationBind})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(events).To(HaveLen(1))
+			Expect(events[0].Outcome).To(Equal(audit.OutcomeFailure))
+		})
+
+		It("fails to bind a device to a missing driver", func() {
+			_, err := h.BindDeviceDriver("0000:01:01.0", &configapi.VfConfig{Driver: "ixgbevf"}, audit.Fields{})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("hides the RDMA device of a VF bound to vfio-pci", func() {
+			_, err := h.BindDeviceDriver("0000:81:00.2", &configapi.VfConfig{Driver: "vfio-pci"}, audit.Fields{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(h.GetRDMADevice("0000:81:00.2")).To(BeEmpty())
+			Expect(h.TryGetInterfaceName("0000:81:00.2")).To(BeEmpty())
+		})
+	})
+})
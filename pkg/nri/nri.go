@@ -4,12 +4,16 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sync"
 
 	"github.com/containerd/nri/pkg/api"
 	"github.com/containerd/nri/pkg/stub"
+	configapi "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/virtualfunction/v1alpha1"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/audit"
 	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/cni"
 	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
 	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/flags"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host"
 	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/podmanager"
 	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
 	resourceapi "k8s.io/api/resource/v1"
@@ -19,6 +23,7 @@ import (
 	k8stypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -28,17 +33,29 @@ type Plugin struct {
 	stub       stub.Stub
 	podManager *podmanager.PodManager
 	cniRuntime cni.Interface
+	host       host.Interface
+	auditLog   *audit.Logger
 
 	k8sClient                   flags.ClientSets
 	networkDeviceDataUpdateChan chan types.NetworkDataChanStructList
 	interfacePrefix             string
+
+	// eventMutex is held for reading by the pod sandbox handlers and for writing by Stop, so
+	// the in-flight events complete before the plugin disconnects
+	eventMutex sync.RWMutex
+	// connMutex guards the (re)connection of the stub against Stop
+	connMutex sync.Mutex
+	stopped   bool
+	ctx       context.Context
 }
 
-// NewNRIPlugin creates a new NRI plugin.
-func NewNRIPlugin(config *types.Config, podManager *podmanager.PodManager, cniRuntime cni.Interface) (*Plugin, error) {
+// NewNRIPlugin creates a new NRI plugin. The stub options are added to the default ones.
+func NewNRIPlugin(config *types.Config, h host.Interface, podManager *podmanager.PodManager, cniRuntime cni.Interface, opts ...stub.Option) (*Plugin, error) {
 	p := &Plugin{
 		podManager:                  podManager,
 		cniRuntime:                  cniRuntime,
+		host:                        h,
+		auditLog:                    config.AuditLogger,
 		k8sClient:                   config.K8sClient,
 		interfacePrefix:             config.Flags.DefaultInterfacePrefix,
 		networkDeviceDataUpdateChan: make(chan types.NetworkDataChanStructList, 100),
@@ -49,10 +66,10 @@ func NewNRIPlugin(config *types.Config, podManager *podmanager.PodManager, cniRu
 		// https://github.com/containerd/nri/pull/173
 		// Otherwise it silently exits the program
 		stub.WithOnClose(func() {
-			klog.Infof("%s NRI plugin closed canceling context", consts.DriverName)
-			config.CancelMainCtx(fmt.Errorf("NRI plugin closed"))
+			go p.reconnect(config.CancelMainCtx)
 		}),
 	}
+	nriOpts = append(nriOpts, opts...)
 
 	p.stub, err = stub.New(p, nriOpts...)
 	if err != nil {
@@ -66,66 +83,167 @@ func NewNRIPlugin(config *types.Config, podManager *podmanager.PodManager, cniRu
 func (p *Plugin) Start(ctx context.Context) error {
 	logger := klog.FromContext(ctx).WithName("NRI Start")
 	logger.Info("Starting NRI plugin")
+	p.connMutex.Lock()
+	p.ctx = ctx
 	err := p.stub.Start(ctx)
+	p.connMutex.Unlock()
 	if err != nil {
 		logger.Error(err, "Failed to start NRI plugin")
 		return fmt.Errorf("failed to start NRI plugin: %w", err)
 	}
 
-	go p.updateNetworkDeviceDataRunner(ctx)
+	p.StartNetworkDeviceDataUpdater(ctx)
 	return nil
 }
 
-// Stop stops the NRI plugin.
+// StartNetworkDeviceDataUpdater starts the goroutine publishing the network device data of the
+// pods into the claim status. It is started by Start, and used on its own when the pod sandbox
+// events are not received from a container runtime.
+func (p *Plugin) StartNetworkDeviceDataUpdater(ctx context.Context) {
+	go p.updateNetworkDeviceDataRunner(ctx)
+}
+
+// Stop waits for the in-flight pod sandbox events and stops the NRI plugin. During a rolling
+// update the runtime delivers the following events to the new instance only.
 func (p *Plugin) Stop() {
+	p.eventMutex.Lock()
+	defer p.eventMutex.Unlock()
+	p.connMutex.Lock()
+	p.stopped = true
 	p.stub.Stop()
+	p.connMutex.Unlock()
 	close(p.networkDeviceDataUpdateChan)
 }
 
+// reconnect starts the stub again after the connection to the container runtime was lost,
+// e.g. on a runtime restart. The main context is canceled if the runtime stays unreachable.
+func (p *Plugin) reconnect(cancelMainCtx func(error)) {
+	p.connMutex.Lock()
+	ctx := p.ctx
+	stopped := p.stopped
+	p.connMutex.Unlock()
+	if stopped || ctx == nil {
+		return
+	}
+	logger := klog.FromContext(ctx).WithName("NRI reconnect")
+	logger.Info("NRI plugin connection closed, reconnecting", "driver", consts.DriverName)
+
+	err := wait.ExponentialBackoffWithContext(ctx, consts.NRIReconnectBackoff, func(ctx context.Context) (bool, error) {
+		p.connMutex.Lock()
+		defer p.connMutex.Unlock()
+		if p.stopped {
+			return true, nil
+		}
+		if err := p.stub.Start(ctx); err != nil {
+			logger.Error(err, "Failed to reconnect NRI plugin")
+			return false, nil
+		}
+		logger.Info("Reconnected NRI plugin")
+		return true, nil
+	})
+	if err != nil {
+		logger.Error(err, "Failed to reconnect NRI plugin, canceling context")
+		cancelMainCtx(fmt.Errorf("NRI plugin closed: %w", err))
+	}
+}
+
+// cniStateIs returns true if the CNI state of all the devices is state. The state of the
+// devices prepared by a version without it is empty and never matches.
+func cniStateIs(devices types.PreparedDevices, state string) bool {
+	for _, device := range devices {
+		if device.CNIState != state {
+			return false
+		}
+	}
+	return true
+}
+
 // RunPodSandbox runs the CNI ADD operation for each device in the devices list.
 func (p *Plugin) RunPodSandbox(ctx context.Context, pod *api.PodSandbox) error {
 	logger := klog.FromContext(ctx).WithName("NRI RunPodSandbox")
 	logger.Info("RunPodSandbox", "pod.UID", pod.Uid, "pod.Name", pod.Name, "pod.Namespace", pod.Namespace)
+	p.eventMutex.RLock()
+	defer p.eventMutex.RUnlock()
+
+	// the event is delivered to both instances of the plugin during a rolling update, the one
+	// locking the pod network first attaches it and the other one finds it attached
+	unlock, err := p.podManager.LockPodNetwork(k8stypes.UID(pod.Uid))
+	if err != nil {
+		logger.Error(err, "Failed to lock pod network", "pod.UID", pod.Uid)
+		return err
+	}
+	defer unlock()
 
 	devices, found := p.podManager.GetDevicesByPodUID(k8stypes.UID(pod.Uid))
 	if !found {
 		logger.Info("No prepared devices found for pod", "pod.UID", pod.Uid)
 		return nil
 	}
+	if cniStateIs(devices, types.CNIStateAttached) {
+		logger.Info("Networks already attached for pod", "pod.UID", pod.Uid)
+		return nil
+	}
 
 	// if we don't have a network namespace, we can't attach networks
-	// so we skip the network attachment
+	// so the devices are configured in host network mode
 	networkNamespace := getNetworkNamespace(pod)
 	if networkNamespace == "" {
-		logger.Info("No network namespace found for pod skipping network attachment", "pod.UID", pod.Uid, "pod.Name", pod.Name, "pod.Namespace", pod.Namespace)
-		return nil
+		logger.Info("No network namespace found for pod, configuring devices in host network mode", "pod.UID", pod.Uid, "pod.Name", pod.Name, "pod.Namespace", pod.Namespace)
 	}
 
 	networkDevicesData := types.NetworkDataChanStructList{}
 	for _, device := range devices {
+		if isHostModeDevice(networkNamespace, device) {
+			networkDeviceData, err := p.configureHostModeDevice(ctx, pod, networkNamespace == "", device)
+			if err != nil {
+				logger.Error(err, "Failed to configure device in host mode", "deviceName", device.Device.DeviceName, "pod.UID", pod.Uid, "pod.Name", pod.Name, "pod.Namespace", pod.Namespace)
+				return fmt.Errorf("failed to configure device in host mode: %w", err)
+			}
+			networkDevicesData = append(networkDevicesData, &types.NetworkDataChanStruct{
+				PreparedDevice:    device,
+				NetworkDeviceData: networkDeviceData,
+			})
+			logger.Info("Configured device in host mode", "deviceName", device.Device.DeviceName, "pod.UID", pod.Uid, "pod.Name", pod.Name, "pod.Namespace", pod.Namespace, "networkDeviceData", networkDeviceData)
+			continue
+		}
+
 		networkDeviceData, cniResultMap, err := p.cniRuntime.AttachNetwork(ctx, pod, networkNamespace, device)
+		p.auditLog.Record(device.AuditEvent(audit.OperationCNIAdd), err)
 		if err != nil {
 			logger.Error(err, "Failed to attach network", "deviceName", device.Device.DeviceName, "pod.UID", pod.Uid, "pod.Name", pod.Name, "pod.Namespace", pod.Namespace)
 			return fmt.Errorf("failed to attach network: %w", err)
 		}
-		// Parse NetAttachDefConfig into map[string]interface{} for CNIConfig
-		cniConfigMap := map[string]interface{}{}
-		if device.NetAttachDefConfig != "" {
-			if err := json.Unmarshal([]byte(device.NetAttachDefConfig), &cniConfigMap); err != nil {
-				logger.V(2).Info("Failed to unmarshal NetAttachDefConfig, proceeding with empty CNIConfig", "error", err.Error())
-				cniConfigMap = map[string]interface{}{}
-			}
-		}
-
 		networkDevicesData = append(networkDevicesData, &types.NetworkDataChanStruct{
 			PreparedDevice:    device,
 			NetworkDeviceData: networkDeviceData,
-			CNIConfig:         cniConfigMap,
 			CNIResult:         cniResultMap,
 		})
 		logger.Info("Attached network", "deviceName", device.Device.DeviceName, "pod.UID", pod.Uid, "pod.Name", pod.Name, "pod.Namespace", pod.Namespace, "networkDeviceData", networkDeviceData)
 	}
 
+	if err := moveRDMADevices(ctx, p.host, networkNamespace, devices); err != nil {
+		logger.Error(err, "Failed to move RDMA devices", "pod.UID", pod.Uid, "pod.Name", pod.Name, "pod.Namespace", pod.Namespace)
+		return err
+	}
+
+	// bonds are created once all their member VFs are attached to the pod
+	for _, bond := range getBondDevices(devices) {
+		if networkNamespace == "" {
+			logger.Info("Skipping bond for pod without a network namespace", "bond", bond.IfName, "pod.UID", pod.Uid)
+			continue
+		}
+		_, _, err := p.cniRuntime.AttachNetwork(ctx, pod, networkNamespace, bond)
+		p.auditLog.Record(bond.AuditEvent(audit.OperationCNIAdd), err)
+		if err != nil {
+			logger.Error(err, "Failed to attach bond", "bond", bond.IfName, "pod.UID", pod.Uid, "pod.Name", pod.Name, "pod.Namespace", pod.Namespace)
+			return fmt.Errorf("failed to attach bond %s: %w", bond.IfName, err)
+		}
+		logger.Info("Attached bond", "bond", bond.IfName, "pod.UID", pod.Uid, "pod.Name", pod.Name, "pod.Namespace", pod.Namespace)
+	}
+
+	if err := p.podManager.SetCNIState(k8stypes.UID(pod.Uid), types.CNIStateAttached); err != nil {
+		logger.Error(err, "Failed to record the attached networks", "pod.UID", pod.Uid)
+	}
 	p.networkDeviceDataUpdateChan <- networkDevicesData
 	return nil
 }
@@ -134,26 +252,125 @@ func (p *Plugin) RunPodSandbox(ctx context.Context, pod *api.PodSandbox) error {
 func (p *Plugin) StopPodSandbox(ctx context.Context, pod *api.PodSandbox) error {
 	logger := klog.FromContext(ctx).WithName("NRI StopPodSandbox")
 	logger.Info("StopPodSandbox", "pod.UID", pod.Uid, "pod.Name", pod.Name, "pod.Namespace", pod.Namespace)
+	p.eventMutex.RLock()
+	defer p.eventMutex.RUnlock()
+
+	unlock, err := p.podManager.LockPodNetwork(k8stypes.UID(pod.Uid))
+	if err != nil {
+		logger.Error(err, "Failed to lock pod network", "pod.UID", pod.Uid)
+		return err
+	}
+	defer unlock()
 
 	devices, found := p.podManager.GetDevicesByPodUID(k8stypes.UID(pod.Uid))
 	if !found {
 		logger.Info("No prepared devices found for pod", "pod.UID", pod.Uid)
 		return nil
 	}
+	if cniStateIs(devices, types.CNIStateDetached) {
+		logger.Info("Networks already detached for pod", "pod.UID", pod.Uid)
+		return nil
+	}
 
 	networkNamespace := getNetworkNamespace(pod)
-	if networkNamespace == "" {
-		return fmt.Errorf("error getting network namespace for pod '%s' in namespace '%s'", pod.Name, pod.Namespace)
-	}
+	restoreRDMADevices(ctx, p.host, networkNamespace, devices)
 
+	// release the member VFs of the bonds before detaching them
+	if networkNamespace != "" {
+		for _, bond := range getBondDevices(devices) {
+			err := p.cniRuntime.DetachNetwork(ctx, pod, networkNamespace, bond)
+			p.auditLog.Record(bond.AuditEvent(audit.OperationCNIDel), err)
+			if err != nil {
+				logger.Error(err, "Failed to detach bond", "bond", bond.IfName, "pod.UID", pod.Uid, "pod.Name", pod.Name, "pod.Namespace", pod.Namespace)
+				return fmt.Errorf("error CNI.DetachNetwork for bond %s of pod '%s' (uid: %s) in namespace '%s': %v", bond.IfName, pod.Name, pod.Uid, pod.Namespace, err)
+			}
+		}
+	}
 	for _, device := range devices {
+		// CNI ADD was never called for devices in host mode, the VF link settings applied
+		// from the host are reset instead
+		if isHostModeDevice(networkNamespace, device) {
+			if err := p.resetHostModeDevice(device); err != nil {
+				logger.Error(err, "Failed to reset device in host mode", "deviceName", device.Device.DeviceName, "pod.UID", pod.Uid, "pod.Name", pod.Name, "pod.Namespace", pod.Namespace)
+				return fmt.Errorf("failed to reset device in host mode: %w", err)
+			}
+			logger.Info("Reset device in host mode", "deviceName", device.Device.DeviceName)
+			continue
+		}
+
 		logger.Info("Detaching network", "device", device)
 		err := p.cniRuntime.DetachNetwork(ctx, pod, networkNamespace, device)
+		p.auditLog.Record(device.AuditEvent(audit.OperationCNIDel), err)
 		if err != nil {
 			logger.Error(err, "Failed to detach network", "deviceName", device.Device.DeviceName, "pod.UID", pod.Uid, "pod.Name", pod.Name, "pod.Namespace", pod.Namespace)
 			return fmt.Errorf("error CNI.DetachNetwork for pod '%s' (uid: %s) in namespace '%s': %v", pod.Name, pod.Uid, pod.Namespace, err)
 		}
 	}
+
+	if err := p.podManager.SetCNIState(k8stypes.UID(pod.Uid), types.CNIStateDetached); err != nil {
+		logger.Error(err, "Failed to record the detached networks", "pod.UID", pod.Uid)
+	}
+	return nil
+}
+
+// configureHostModeDevice applies the VF link settings from the host for devices that are
+// not attached through the CNI, and builds the network device data from the host state.
+func (p *Plugin) configureHostModeDevice(ctx context.Context, pod *api.PodSandbox, hostNetwork bool, device *types.PreparedDevice) (*resourceapi.NetworkDeviceData, error) {
+	logger := klog.FromContext(ctx).WithName("configureHostModeDevice")
+
+	// the netdev of a scalable function stays on the host without a pod network namespace
+	if device.SF != nil {
+		return &resourceapi.NetworkDeviceData{InterfaceName: device.SF.NetName}, nil
+	}
+
+	if hostNetwork && !p.host.IsDpdkDriver(device.Driver) {
+		klog.Warningf("VF %s (%s) using kernel driver %s is claimed by host network pod %s/%s (uid: %s), the VF netdev stays in the host network namespace",
+			device.Device.DeviceName, device.PciAddress, device.Driver, pod.Namespace, pod.Name, pod.Uid)
+	}
+
+	if device.NetAttachDefConfig != "" {
+		settings, err := types.GetVFLinkSettingsFromNetConf(device.NetAttachDefConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get VF link settings for device %s: %w", device.PciAddress, err)
+		}
+		if err := p.host.SetVFLinkSettings(device.PFName, device.VFID, settings); err != nil {
+			return nil, fmt.Errorf("failed to apply VF link settings for device %s: %w", device.PciAddress, err)
+		}
+	}
+
+	networkDeviceData := &resourceapi.NetworkDeviceData{
+		InterfaceName: p.host.TryGetInterfaceName(device.PciAddress),
+	}
+	hardwareAddress, err := p.host.GetVFHardwareAddress(device.PciAddress, device.PFName, device.VFID)
+	if err != nil {
+		logger.Error(err, "Failed to get VF hardware address", "deviceName", device.Device.DeviceName, "pciAddress", device.PciAddress)
+	} else {
+		networkDeviceData.HardwareAddress = hardwareAddress
+	}
+	return networkDeviceData, nil
+}
+
+// resetHostModeDevice resets the VF link settings applied from the host by
+// configureHostModeDevice to the defaults of a new VF, as the CNI DEL does for the attached
+// devices. The max tx rate enforcing a bandwidth share is kept, unprepare removes it.
+func (p *Plugin) resetHostModeDevice(device *types.PreparedDevice) error {
+	if device.SF != nil || device.NetAttachDefConfig == "" {
+		return nil
+	}
+	settings, err := types.GetVFLinkSettingsFromNetConf(device.NetAttachDefConfig)
+	if err != nil {
+		return fmt.Errorf("failed to get VF link settings for device %s: %w", device.PciAddress, err)
+	}
+	defaults := settings.Defaults()
+	if device.MaxTxRate > 0 {
+		defaults.MaxTxRate = nil
+	}
+	if *defaults == (types.VFLinkSettings{}) {
+		return nil
+	}
+	if err := p.host.SetVFLinkSettings(device.PFName, device.VFID, defaults); err != nil {
+		return fmt.Errorf("failed to reset VF link settings for device %s: %w", device.PciAddress, err)
+	}
 	return nil
 }
 
@@ -190,22 +407,17 @@ func (p *Plugin) updateNetworkDeviceData(ctx context.Context, networkDataChanStr
 		}
 
 		for idx, device := range claim.Status.Devices {
-			if device.Device != networkDataChanStruct.PreparedDevice.Device.DeviceName || device.Pool != networkDataChanStruct.PreparedDevice.Device.PoolName || device.Driver != consts.DriverName {
+			if device.Device != networkDataChanStruct.PreparedDevice.Device.DeviceName || device.Pool != networkDataChanStruct.PreparedDevice.Device.PoolName || device.Driver != consts.DriverName ||
+				ptr.Deref(device.ShareID, "") != networkDataChanStruct.PreparedDevice.ShareID {
 				continue
 			}
 			claim.Status.Devices[idx].NetworkData = networkDataChanStruct.NetworkDeviceData
 
-			// Build combined Data: { vfConfig, cniConfig, cniResult }
-			combined := map[string]interface{}{
-				"vfConfig":  networkDataChanStruct.PreparedDevice.Config,
-				"cniConfig": networkDataChanStruct.CNIConfig,
-				"cniResult": networkDataChanStruct.CNIResult,
-			}
-			raw, err := json.Marshal(combined)
+			statusData, err := buildDeviceStatusData(networkDataChanStruct).ToRawExtension()
 			if err != nil {
-				logger.V(2).Info("Failed to marshal combined Data, skipping Data update", "error", err.Error())
+				logger.V(2).Info("Failed to encode device status data, skipping Data update", "error", err.Error())
 			} else {
-				claim.Status.Devices[idx].Data = &runtime.RawExtension{Raw: raw}
+				claim.Status.Devices[idx].Data = statusData
 			}
 		}
 
@@ -217,6 +429,26 @@ func (p *Plugin) updateNetworkDeviceData(ctx context.Context, networkDataChanStr
 	}
 }
 
+// buildDeviceStatusData merges the result of the network attachment into the
+// status data we already know from the prepared device.
+func buildDeviceStatusData(networkDataChanStruct *types.NetworkDataChanStruct) *configapi.DeviceStatusData {
+	statusData := networkDataChanStruct.PreparedDevice.NewDeviceStatusData()
+	if networkDataChanStruct.NetworkDeviceData != nil {
+		// in host mode the interface name is the VF netdev name on the host
+		if networkDataChanStruct.NetworkDeviceData.InterfaceName != "" {
+			statusData.IfName = networkDataChanStruct.NetworkDeviceData.InterfaceName
+		}
+		statusData.HardwareAddress = networkDataChanStruct.NetworkDeviceData.HardwareAddress
+	}
+	if networkDataChanStruct.CNIResult != nil {
+		raw, err := json.Marshal(networkDataChanStruct.CNIResult)
+		if err == nil {
+			statusData.CNIResult = &runtime.RawExtension{Raw: raw}
+		}
+	}
+	return statusData
+}
+
 // updateClaimNetworkDataWithRetry updates the network device data for a claim with retries.
 func (p *Plugin) updateClaimNetworkDataWithRetry(ctx context.Context, claim *resourceapi.ResourceClaim) error {
 	logger := klog.FromContext(ctx).WithName("updateClaimNetworkDataWithRetry")
@@ -3,16 +3,25 @@ package nri
 import (
 	"context"
 	"errors"
+	"path/filepath"
+	"sync"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"go.uber.org/mock/gomock"
 
 	"github.com/containerd/nri/pkg/api"
+	"github.com/containerd/nri/pkg/stub"
+	configapi "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/virtualfunction/v1alpha1"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/audit"
 	cnimock "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/cni/mock"
+	hostmock "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host/mock"
 	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/podmanager"
 	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
+	resourceapi "k8s.io/api/resource/v1"
 	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
 )
 
 var _ = Describe("NRI Plugin", func() {
@@ -121,6 +130,412 @@ var _ = Describe("NRI Plugin", func() {
 
 		Expect(plugin.StopPodSandbox(ctx, pod)).To(Succeed())
 	})
+
+	It("records the CNI ADD and DEL in the audit log", func() {
+		auditPath := filepath.Join(GinkgoT().TempDir(), "audit.log")
+		auditLog, err := audit.NewLogger(auditPath, 0, 0)
+		Expect(err).ToNot(HaveOccurred())
+		defer auditLog.Close()
+		plugin.auditLog = auditLog
+
+		prepared := types.PreparedDevices{
+			&types.PreparedDevice{
+				IfName:             "vfnet0",
+				NetAttachDefConfig: `{"type":"sriov","name":"net1"}`,
+				PciAddress:         "0000:00:00.1",
+				PodUID:             pod.Uid,
+			},
+		}
+		prepared[0].ClaimNamespacedName.UID = "claim-1"
+		Expect(podManager.Set(k8stypes.UID(pod.Uid), k8stypes.UID("claim-1"), prepared)).To(Succeed())
+
+		mockCNI.EXPECT().
+			AttachNetwork(gomock.Any(), pod, "/proc/123/ns/net", prepared[0]).
+			Return(nil, nil, nil)
+		attached := prepared[0].DeepCopy()
+		attached.CNIState = types.CNIStateAttached
+		mockCNI.EXPECT().
+			DetachNetwork(gomock.Any(), pod, "/proc/123/ns/net", attached).
+			Return(errors.New("boom"))
+		Expect(plugin.RunPodSandbox(ctx, pod)).To(Succeed())
+		Expect(plugin.StopPodSandbox(ctx, pod)).ToNot(Succeed())
+
+		events, err := audit.Query(auditPath, audit.Filter{PodUID: pod.Uid})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(events).To(HaveLen(2))
+		Expect(events[0].Operation).To(Equal(audit.OperationCNIAdd))
+		Expect(events[0].ClaimUID).To(Equal("claim-1"))
+		Expect(events[0].PciAddress).To(Equal("0000:00:00.1"))
+		Expect(events[0].Outcome).To(Equal(audit.OutcomeSuccess))
+		Expect(events[1].Operation).To(Equal(audit.OperationCNIDel))
+		Expect(events[1].Outcome).To(Equal(audit.OutcomeFailure))
+		Expect(events[1].Error).To(Equal("boom"))
+	})
+
+	Context("rolling update", func() {
+		var prepared types.PreparedDevices
+
+		BeforeEach(func() {
+			prepared = types.PreparedDevices{
+				&types.PreparedDevice{
+					IfName:             "vfnet0",
+					NetAttachDefConfig: `{"type":"sriov","name":"net1"}`,
+					PciAddress:         "0000:00:00.1",
+					PodUID:             pod.Uid,
+				},
+			}
+			Expect(podManager.Set(k8stypes.UID(pod.Uid), k8stypes.UID("claim-1"), prepared)).To(Succeed())
+		})
+
+		It("runs the CNI ADD and DEL once when both instances receive the events", func() {
+			otherPodManager, err := podmanager.NewPodManager(cfg)
+			Expect(err).ToNot(HaveOccurred())
+			other := &Plugin{
+				podManager:                  otherPodManager,
+				cniRuntime:                  mockCNI,
+				networkDeviceDataUpdateChan: make(chan types.NetworkDataChanStructList, 10),
+			}
+
+			mockCNI.EXPECT().AttachNetwork(gomock.Any(), pod, "/proc/123/ns/net", gomock.Any()).Return(nil, nil, nil).Times(1)
+			mockCNI.EXPECT().DetachNetwork(gomock.Any(), pod, "/proc/123/ns/net", gomock.Any()).Return(nil).Times(1)
+
+			Expect(plugin.RunPodSandbox(ctx, pod)).To(Succeed())
+			Expect(other.RunPodSandbox(ctx, pod)).To(Succeed())
+			Expect(other.StopPodSandbox(ctx, pod)).To(Succeed())
+			Expect(plugin.StopPodSandbox(ctx, pod)).To(Succeed())
+		})
+
+		It("runs the CNI ADD and DEL once when both instances receive the events concurrently", func() {
+			otherPodManager, err := podmanager.NewPodManager(cfg)
+			Expect(err).ToNot(HaveOccurred())
+			other := &Plugin{
+				podManager:                  otherPodManager,
+				cniRuntime:                  mockCNI,
+				networkDeviceDataUpdateChan: make(chan types.NetworkDataChanStructList, 10),
+			}
+
+			// the slow CNI calls overlap with the events of the other instance without the lock
+			mockCNI.EXPECT().AttachNetwork(gomock.Any(), pod, "/proc/123/ns/net", gomock.Any()).DoAndReturn(
+				func(context.Context, *api.PodSandbox, string, *types.PreparedDevice) (*resourceapi.NetworkDeviceData, map[string]interface{}, error) {
+					time.Sleep(50 * time.Millisecond)
+					return nil, nil, nil
+				}).Times(1)
+			mockCNI.EXPECT().DetachNetwork(gomock.Any(), pod, "/proc/123/ns/net", gomock.Any()).DoAndReturn(
+				func(context.Context, *api.PodSandbox, string, *types.PreparedDevice) error {
+					time.Sleep(50 * time.Millisecond)
+					return nil
+				}).Times(1)
+
+			for _, event := range []func(*Plugin) error{
+				func(p *Plugin) error { return p.RunPodSandbox(ctx, pod) },
+				func(p *Plugin) error { return p.StopPodSandbox(ctx, pod) },
+			} {
+				var wg sync.WaitGroup
+				for _, p := range []*Plugin{plugin, other} {
+					wg.Add(1)
+					go func() {
+						defer GinkgoRecover()
+						defer wg.Done()
+						Expect(event(p)).To(Succeed())
+					}()
+				}
+				wg.Wait()
+			}
+		})
+
+		It("runs the CNI DEL for devices prepared without a CNI state", func() {
+			mockCNI.EXPECT().DetachNetwork(gomock.Any(), pod, "/proc/123/ns/net", prepared[0]).Return(nil)
+			Expect(plugin.StopPodSandbox(ctx, pod)).To(Succeed())
+		})
+
+		It("waits for the in-flight events before stopping", func() {
+			fake := &fakeStub{}
+			plugin.stub = fake
+
+			plugin.eventMutex.RLock()
+			stopped := make(chan struct{})
+			go func() {
+				plugin.Stop()
+				close(stopped)
+			}()
+			Consistently(stopped, "100ms").ShouldNot(BeClosed())
+			Expect(fake.isStopped()).To(BeFalse())
+
+			plugin.eventMutex.RUnlock()
+			Eventually(stopped).Should(BeClosed())
+			Expect(fake.isStopped()).To(BeTrue())
+		})
+	})
+
+	Context("bonds", func() {
+		var prepared types.PreparedDevices
+
+		BeforeEach(func() {
+			bond := &types.PreparedBond{IfName: "bond0", Mode: "active-backup", Members: []string{"vfnet0", "vfnet1"}, NetAttachDefConfig: `{"type":"bond","name":"bond"}`}
+			prepared = types.PreparedDevices{
+				&types.PreparedDevice{IfName: "vfnet0", NetAttachDefConfig: `{"type":"sriov","name":"net1"}`, PciAddress: "0000:01:00.1", PodUID: pod.Uid, Bond: bond},
+				&types.PreparedDevice{IfName: "vfnet1", NetAttachDefConfig: `{"type":"sriov","name":"net1"}`, PciAddress: "0000:02:00.1", PodUID: pod.Uid, Bond: bond},
+			}
+			prepared[0].ClaimNamespacedName.UID = "claim-1"
+			prepared[1].ClaimNamespacedName.UID = "claim-1"
+			Expect(podManager.Set(k8stypes.UID(pod.Uid), k8stypes.UID("claim-1"), prepared)).To(Succeed())
+		})
+
+		It("creates the bond once after its members are attached", func() {
+			gomock.InOrder(
+				mockCNI.EXPECT().AttachNetwork(gomock.Any(), pod, "/proc/123/ns/net", prepared[0]).Return(nil, nil, nil),
+				mockCNI.EXPECT().AttachNetwork(gomock.Any(), pod, "/proc/123/ns/net", prepared[1]).Return(nil, nil, nil),
+				mockCNI.EXPECT().AttachNetwork(gomock.Any(), pod, "/proc/123/ns/net", prepared[0].BondDevice()).Return(nil, nil, nil),
+			)
+			Expect(plugin.RunPodSandbox(ctx, pod)).To(Succeed())
+		})
+
+		It("deletes the bond before detaching its members", func() {
+			gomock.InOrder(
+				mockCNI.EXPECT().DetachNetwork(gomock.Any(), pod, "/proc/123/ns/net", prepared[0].BondDevice()).Return(nil),
+				mockCNI.EXPECT().DetachNetwork(gomock.Any(), pod, "/proc/123/ns/net", prepared[0]).Return(nil),
+				mockCNI.EXPECT().DetachNetwork(gomock.Any(), pod, "/proc/123/ns/net", prepared[1]).Return(nil),
+			)
+			Expect(plugin.StopPodSandbox(ctx, pod)).To(Succeed())
+		})
+
+		It("returns error when the bond can't be created", func() {
+			mockCNI.EXPECT().AttachNetwork(gomock.Any(), pod, "/proc/123/ns/net", prepared[0]).Return(nil, nil, nil)
+			mockCNI.EXPECT().AttachNetwork(gomock.Any(), pod, "/proc/123/ns/net", prepared[1]).Return(nil, nil, nil)
+			mockCNI.EXPECT().AttachNetwork(gomock.Any(), pod, "/proc/123/ns/net", prepared[0].BondDevice()).Return(nil, nil, errors.New("boom"))
+			Expect(plugin.RunPodSandbox(ctx, pod)).To(MatchError(ContainSubstring("failed to attach bond bond0")))
+		})
+	})
+
+	Context("RDMA devices", func() {
+		var (
+			mockHost *hostmock.MockInterface
+			prepared types.PreparedDevices
+		)
+
+		BeforeEach(func() {
+			mockHost = hostmock.NewMockInterface(ctrl)
+			plugin.host = mockHost
+
+			prepared = types.PreparedDevices{
+				&types.PreparedDevice{
+					IfName:             "vfnet0",
+					NetAttachDefConfig: `{"type":"sriov","name":"net1"}`,
+					PciAddress:         "0000:00:00.1",
+					PodUID:             pod.Uid,
+					RDMADevice:         "mlx5_2",
+				},
+			}
+			Expect(podManager.Set(k8stypes.UID(pod.Uid), k8stypes.UID("claim-1"), prepared)).To(Succeed())
+		})
+
+		It("moves the RDMA device to the pod netns in exclusive mode", func() {
+			mockCNI.EXPECT().AttachNetwork(gomock.Any(), pod, "/proc/123/ns/net", prepared[0]).Return(nil, nil, nil)
+			mockHost.EXPECT().GetRDMANetnsMode().Return("exclusive", nil)
+			mockHost.EXPECT().MoveRDMADeviceToNetns("mlx5_2", "/proc/123/ns/net").Return(nil)
+
+			Expect(plugin.RunPodSandbox(ctx, pod)).To(Succeed())
+		})
+
+		It("keeps the RDMA device on the host in shared mode", func() {
+			mockCNI.EXPECT().AttachNetwork(gomock.Any(), pod, "/proc/123/ns/net", prepared[0]).Return(nil, nil, nil)
+			mockHost.EXPECT().GetRDMANetnsMode().Return("shared", nil)
+
+			Expect(plugin.RunPodSandbox(ctx, pod)).To(Succeed())
+		})
+
+		It("returns error when the RDMA device can't be moved", func() {
+			mockCNI.EXPECT().AttachNetwork(gomock.Any(), pod, "/proc/123/ns/net", prepared[0]).Return(nil, nil, nil)
+			mockHost.EXPECT().GetRDMANetnsMode().Return("exclusive", nil)
+			mockHost.EXPECT().MoveRDMADeviceToNetns("mlx5_2", "/proc/123/ns/net").Return(errors.New("boom"))
+
+			Expect(plugin.RunPodSandbox(ctx, pod)).To(MatchError(ContainSubstring("failed to move RDMA device")))
+		})
+
+		It("moves the RDMA device back to the host before detaching the network", func() {
+			gomock.InOrder(
+				mockHost.EXPECT().GetRDMANetnsMode().Return("exclusive", nil),
+				mockHost.EXPECT().RestoreRDMADeviceNetns("mlx5_2", "/proc/123/ns/net").Return(errors.New("ignored")),
+				mockCNI.EXPECT().DetachNetwork(gomock.Any(), pod, "/proc/123/ns/net", prepared[0]).Return(nil),
+			)
+
+			Expect(plugin.StopPodSandbox(ctx, pod)).To(Succeed())
+		})
+	})
+
+	Context("host mode devices", func() {
+		var (
+			mockHost *hostmock.MockInterface
+		)
+
+		BeforeEach(func() {
+			mockHost = hostmock.NewMockInterface(ctrl)
+			plugin.host = mockHost
+		})
+
+		It("configures devices from the host for host network pods", func() {
+			pod.Linux = &api.LinuxPodSandbox{}
+			prepared := types.PreparedDevices{
+				&types.PreparedDevice{
+					NetAttachDefConfig: `{"type":"sriov","name":"net1","vlan":100}`,
+					PciAddress:         "0000:00:00.1",
+					PFName:             "eth0",
+					VFID:               1,
+					Driver:             "vfio-pci",
+					PodUID:             pod.Uid,
+				},
+			}
+			Expect(podManager.Set(k8stypes.UID(pod.Uid), k8stypes.UID("claim-1"), prepared)).To(Succeed())
+
+			mockHost.EXPECT().IsDpdkDriver("vfio-pci").Return(true)
+			mockHost.EXPECT().SetVFLinkSettings("eth0", 1, gomock.Any()).DoAndReturn(
+				func(_ string, _ int, settings *types.VFLinkSettings) error {
+					Expect(settings.Vlan).ToNot(BeNil())
+					Expect(*settings.Vlan).To(Equal(100))
+					return nil
+				})
+			mockHost.EXPECT().TryGetInterfaceName("0000:00:00.1").Return("")
+			mockHost.EXPECT().GetVFHardwareAddress("0000:00:00.1", "eth0", 1).Return("aa:bb:cc:dd:ee:ff", nil)
+
+			Expect(plugin.RunPodSandbox(ctx, pod)).To(Succeed())
+
+			var networkDataList types.NetworkDataChanStructList
+			Eventually(plugin.networkDeviceDataUpdateChan).Should(Receive(&networkDataList))
+			Expect(networkDataList).To(HaveLen(1))
+			Expect(networkDataList[0].NetworkDeviceData.HardwareAddress).To(Equal("aa:bb:cc:dd:ee:ff"))
+			Expect(networkDataList[0].CNIResult).To(BeNil())
+
+			// no CNI DEL for devices configured in host mode, their VF link settings are reset
+			mockHost.EXPECT().SetVFLinkSettings("eth0", 1, &types.VFLinkSettings{Vlan: ptr.To(0)}).Return(nil)
+			Expect(plugin.StopPodSandbox(ctx, pod)).To(Succeed())
+		})
+
+		It("keeps the max tx rate of a bandwidth share when resetting a host mode device", func() {
+			pod.Linux = &api.LinuxPodSandbox{}
+			prepared := types.PreparedDevices{
+				&types.PreparedDevice{
+					NetAttachDefConfig: `{"type":"sriov","name":"net1","trust":"on","max_tx_rate":1000}`,
+					PciAddress:         "0000:00:00.1",
+					PFName:             "eth0",
+					VFID:               1,
+					Driver:             "vfio-pci",
+					MaxTxRate:          1000,
+					PodUID:             pod.Uid,
+				},
+			}
+			Expect(podManager.Set(k8stypes.UID(pod.Uid), k8stypes.UID("claim-1"), prepared)).To(Succeed())
+			Expect(podManager.SetCNIState(k8stypes.UID(pod.Uid), types.CNIStateAttached)).To(Succeed())
+
+			mockHost.EXPECT().SetVFLinkSettings("eth0", 1, &types.VFLinkSettings{Trust: "off"}).Return(nil)
+			Expect(plugin.StopPodSandbox(ctx, pod)).To(Succeed())
+		})
+
+		It("skips the CNI for DPDK only devices without a net attach def", func() {
+			prepared := types.PreparedDevices{
+				&types.PreparedDevice{
+					PciAddress: "0000:00:00.1",
+					PFName:     "eth0",
+					Driver:     "vfio-pci",
+					PodUID:     pod.Uid,
+				},
+			}
+			Expect(podManager.Set(k8stypes.UID(pod.Uid), k8stypes.UID("claim-1"), prepared)).To(Succeed())
+
+			mockHost.EXPECT().TryGetInterfaceName("0000:00:00.1").Return("")
+			mockHost.EXPECT().GetVFHardwareAddress("0000:00:00.1", "eth0", 0).Return("aa:bb:cc:dd:ee:ff", nil)
+
+			Expect(plugin.RunPodSandbox(ctx, pod)).To(Succeed())
+			Expect(plugin.StopPodSandbox(ctx, pod)).To(Succeed())
+		})
+
+		It("reports the host netdev of a scalable function for host network pods", func() {
+			pod.Linux = &api.LinuxPodSandbox{}
+			prepared := types.PreparedDevices{
+				&types.PreparedDevice{
+					NetAttachDefConfig: `{"type":"host-device","name":"net1","device":"enp1s0f0s1"}`,
+					PciAddress:         "0000:00:00.0",
+					PFName:             "eth0",
+					PodUID:             pod.Uid,
+					SF:                 &types.PreparedSF{AuxDevice: "mlx5_core.sf.2", SFNum: 1, NetName: "enp1s0f0s1"},
+				},
+			}
+			Expect(podManager.Set(k8stypes.UID(pod.Uid), k8stypes.UID("claim-1"), prepared)).To(Succeed())
+
+			Expect(plugin.RunPodSandbox(ctx, pod)).To(Succeed())
+
+			var networkDataList types.NetworkDataChanStructList
+			Eventually(plugin.networkDeviceDataUpdateChan).Should(Receive(&networkDataList))
+			Expect(networkDataList).To(HaveLen(1))
+			Expect(networkDataList[0].NetworkDeviceData.InterfaceName).To(Equal("enp1s0f0s1"))
+		})
+
+		It("returns error when applying the VF link settings fails", func() {
+			pod.Linux = &api.LinuxPodSandbox{}
+			prepared := types.PreparedDevices{
+				&types.PreparedDevice{
+					NetAttachDefConfig: `{"type":"sriov","name":"net1"}`,
+					PciAddress:         "0000:00:00.1",
+					PFName:             "eth0",
+					Driver:             "iavf",
+					PodUID:             pod.Uid,
+				},
+			}
+			Expect(podManager.Set(k8stypes.UID(pod.Uid), k8stypes.UID("claim-1"), prepared)).To(Succeed())
+
+			mockHost.EXPECT().IsDpdkDriver("iavf").Return(false)
+			mockHost.EXPECT().SetVFLinkSettings("eth0", 0, gomock.Any()).Return(errors.New("boom"))
+
+			Expect(plugin.RunPodSandbox(ctx, pod)).ToNot(Succeed())
+		})
+	})
+
+	It("builds the device status data from the network attachment", func() {
+		statusData := buildDeviceStatusData(&types.NetworkDataChanStruct{
+			PreparedDevice: &types.PreparedDevice{
+				IfName:             "vfnet0",
+				NetAttachDefConfig: `{"type":"sriov","name":"net1","vlan":20}`,
+				PciAddress:         "0000:00:00.1",
+				PFName:             "eth0",
+				Driver:             "iavf",
+			},
+			NetworkDeviceData: &resourceapi.NetworkDeviceData{
+				InterfaceName:   "net1",
+				HardwareAddress: "aa:bb:cc:dd:ee:ff",
+			},
+			CNIResult: map[string]interface{}{"cniVersion": "1.0.0"},
+		})
+
+		raw, err := statusData.ToRawExtension()
+		Expect(err).ToNot(HaveOccurred())
+		decoded, err := configapi.DecodeDeviceStatusData(raw)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(decoded.PciAddress).To(Equal("0000:00:00.1"))
+		Expect(decoded.PFName).To(Equal("eth0"))
+		Expect(decoded.IfName).To(Equal("net1"))
+		Expect(decoded.HardwareAddress).To(Equal("aa:bb:cc:dd:ee:ff"))
+		Expect(decoded.Vlan).To(Equal(20))
+		Expect(decoded.Driver).To(Equal("iavf"))
+		Expect(string(decoded.CNIResult.Raw)).To(MatchJSON(`{"cniVersion":"1.0.0"}`))
+	})
 })
 
 // No stub needed for unit tests; we do not call Start/Stop on the plugin
+
+// fakeStub records the Stop of the NRI plugin stub
+type fakeStub struct {
+	stub.Stub
+	mutex   sync.Mutex
+	stopped bool
+}
+
+func (f *fakeStub) Stop() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.stopped = true
+}
+
+func (f *fakeStub) isStopped() bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.stopped
+}
@@ -1,7 +1,14 @@
 package nri
 
 import (
+	"context"
+	"fmt"
+
 	"github.com/containerd/nri/pkg/api"
+	"k8s.io/klog/v2"
+
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
 )
 
 func getNetworkNamespace(pod *api.PodSandbox) string {
@@ -13,3 +20,98 @@ func getNetworkNamespace(pod *api.PodSandbox) string {
 
 	return ""
 }
+
+// isHostModeDevice returns true if the device is configured from the host instead of the CNI.
+// This is the case for pods without a network namespace (host network pods) and for
+// DPDK only devices without a net attach def.
+func isHostModeDevice(networkNamespace string, device *types.PreparedDevice) bool {
+	return networkNamespace == "" || device.NetAttachDefConfig == ""
+}
+
+// getBondDevices returns a pseudo device for every bond of the prepared devices, to create
+// and delete the bonds through the CNI.
+func getBondDevices(devices types.PreparedDevices) types.PreparedDevices {
+	bonds := types.PreparedDevices{}
+	seen := map[string]bool{}
+	for _, device := range devices {
+		if device.Bond == nil {
+			continue
+		}
+		key := string(device.ClaimNamespacedName.UID) + "/" + device.Bond.IfName
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		bonds = append(bonds, device.BondDevice())
+	}
+	return bonds
+}
+
+// rdmaExclusiveMode returns true if the RDMA subsystem is in exclusive mode, where an RDMA
+// device is only visible from the network namespace it belongs to. In shared mode the
+// RDMA devices are visible from every network namespace and are not moved.
+func rdmaExclusiveMode(ctx context.Context, h host.Interface) (bool, error) {
+	mode, err := h.GetRDMANetnsMode()
+	if err != nil {
+		return false, err
+	}
+	if mode != "exclusive" {
+		klog.FromContext(ctx).V(2).Info("RDMA subsystem not in exclusive mode, RDMA devices stay visible from the host", "mode", mode)
+		return false, nil
+	}
+	return true, nil
+}
+
+// moveRDMADevices moves the RDMA devices of the prepared devices to the pod network namespace
+func moveRDMADevices(ctx context.Context, h host.Interface, networkNamespace string, devices types.PreparedDevices) error {
+	if networkNamespace == "" || !hasRDMADevice(devices) {
+		return nil
+	}
+	exclusive, err := rdmaExclusiveMode(ctx, h)
+	if err != nil || !exclusive {
+		return err
+	}
+	for _, device := range devices {
+		if device.RDMADevice == "" {
+			continue
+		}
+		if err := h.MoveRDMADeviceToNetns(device.RDMADevice, networkNamespace); err != nil {
+			return fmt.Errorf("failed to move RDMA device of %s to the pod network namespace: %w", device.Device.DeviceName, err)
+		}
+	}
+	return nil
+}
+
+// restoreRDMADevices moves the RDMA devices of the prepared devices back to the host. Errors
+// are only logged, the kernel moves them back when the network namespace is destroyed.
+func restoreRDMADevices(ctx context.Context, h host.Interface, networkNamespace string, devices types.PreparedDevices) {
+	logger := klog.FromContext(ctx).WithName("restoreRDMADevices")
+	if networkNamespace == "" || !hasRDMADevice(devices) {
+		return
+	}
+	exclusive, err := rdmaExclusiveMode(ctx, h)
+	if err != nil {
+		logger.Error(err, "Failed to get the RDMA netns mode")
+		return
+	}
+	if !exclusive {
+		return
+	}
+	for _, device := range devices {
+		if device.RDMADevice == "" {
+			continue
+		}
+		if err := h.RestoreRDMADeviceNetns(device.RDMADevice, networkNamespace); err != nil {
+			logger.Error(err, "Failed to move RDMA device back to the host", "deviceName", device.Device.DeviceName, "rdmaDevice", device.RDMADevice)
+		}
+	}
+}
+
+func hasRDMADevice(devices types.PreparedDevices) bool {
+	for _, device := range devices {
+		if device.RDMADevice != "" {
+			return true
+		}
+	}
+	return false
+}
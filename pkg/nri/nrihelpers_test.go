@@ -5,6 +5,8 @@ import (
 	. "github.com/onsi/gomega"
 
 	"github.com/containerd/nri/pkg/api"
+
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
 )
 
 var _ = Describe("NRI Helpers", func() {
@@ -21,4 +23,18 @@ var _ = Describe("NRI Helpers", func() {
 			Expect(getNetworkNamespace(pod)).To(Equal(""))
 		})
 	})
+
+	Context("isHostModeDevice", func() {
+		It("returns true for pods without network namespace", func() {
+			Expect(isHostModeDevice("", &types.PreparedDevice{NetAttachDefConfig: `{"type":"sriov"}`})).To(BeTrue())
+		})
+
+		It("returns true for devices without net attach def", func() {
+			Expect(isHostModeDevice("/proc/1/ns/net", &types.PreparedDevice{})).To(BeTrue())
+		})
+
+		It("returns false for devices attached through the CNI", func() {
+			Expect(isHostModeDevice("/proc/1/ns/net", &types.PreparedDevice{NetAttachDefConfig: `{"type":"sriov"}`})).To(BeFalse())
+		})
+	})
 })
@@ -2,8 +2,13 @@ package podmanager
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"sync"
+	"syscall"
+	"time"
 
+	"golang.org/x/sys/unix"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/dynamic-resource-allocation/kubeletplugin"
 	"k8s.io/klog/v2"
@@ -16,10 +21,30 @@ import (
 // PodManager provides a thread-safe, centralized store for all prepared network devices
 // across multiple Pods. It is indexed by the Pod's UID, and for each Pod, it maps
 // claim IDs to their specific PreparedDevices.
+//
+// The checkpoint is shared with the other instance of the plugin during a rolling update,
+// every access locks it and reloads it when the other instance changed it. The changes fail
+// when it can't be locked or reloaded.
 type PodManager struct {
-	mu                     sync.RWMutex
+	mu                     sync.Mutex
 	preparedClaimsByPodUID drasriovtypes.PreparedClaimsByPodUID
 	checkpointManager      checkpointmanager.CheckpointManager
+	// checkpointPath is the checkpoint file, lockPath the file locked around its accesses as
+	// the checkpoint itself is replaced on every write
+	checkpointPath string
+	lockPath       string
+	// podLocksPath is the directory of the files locked around the CNI calls of a pod
+	podLocksPath string
+	// loaded is the state of the checkpoint file when it was last loaded or written
+	loaded checkpointFileState
+}
+
+// checkpointFileState detects the changes of the checkpoint file made by another instance,
+// every write replaces the file with a new inode
+type checkpointFileState struct {
+	inode   uint64
+	modTime time.Time
+	size    int64
 }
 
 func NewPodManager(config *drasriovtypes.Config) (*PodManager, error) {
@@ -28,25 +53,32 @@ func NewPodManager(config *drasriovtypes.Config) (*PodManager, error) {
 		return nil, fmt.Errorf("unable to create checkpoint manager: %v", err)
 	}
 
-	checkpoints, err := checkpointManager.ListCheckpoints()
-	if err != nil {
-		return nil, fmt.Errorf("unable to list checkpoints: %v", err)
-	}
-
 	podmManager := &PodManager{
-		mu:                     sync.RWMutex{},
 		checkpointManager:      checkpointManager,
 		preparedClaimsByPodUID: make(drasriovtypes.PreparedClaimsByPodUID),
+		checkpointPath:         filepath.Join(config.DriverPluginPath(), consts.DriverPluginCheckpointFile),
+		lockPath:               filepath.Join(config.DriverPluginPath(), consts.DriverPluginCheckpointLockFile),
+		podLocksPath:           filepath.Join(config.DriverPluginPath(), consts.DriverPluginPodLocksDirectory),
+	}
+
+	// the other instance of the plugin may be writing the checkpoint during a rolling update
+	unlock, err := podmManager.lockCheckpoint(unix.LOCK_EX)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	checkpoints, err := checkpointManager.ListCheckpoints()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list checkpoints: %v", err)
 	}
 
 	for _, c := range checkpoints {
 		if c == consts.DriverPluginCheckpointFile {
 			klog.Infof("Found checkpoint: %s", c)
-			checkpoint := drasriovtypes.NewCheckpoint()
-			if err := checkpointManager.GetCheckpoint(consts.DriverPluginCheckpointFile, checkpoint); err != nil {
-				return nil, fmt.Errorf("unable to load checkpoint: %v", err)
+			if err := podmManager.loadCheckpoint(); err != nil {
+				return nil, err
 			}
-			podmManager.preparedClaimsByPodUID = checkpoint.V1.PreparedClaimsByPodUID
 			klog.Infof("Loaded checkpoint with %d pods", len(podmManager.preparedClaimsByPodUID))
 			return podmManager, nil
 		}
@@ -56,69 +88,184 @@ func NewPodManager(config *drasriovtypes.Config) (*PodManager, error) {
 	if err := checkpointManager.CreateCheckpoint(consts.DriverPluginCheckpointFile, checkpoint); err != nil {
 		return nil, fmt.Errorf("unable to sync to checkpoint: %v", err)
 	}
+	podmManager.loaded = podmManager.checkpointFileState()
 	klog.Infof("Created checkpoint: %v", *checkpoint)
 
 	return podmManager, nil
 }
 
+// lockCheckpoint locks the checkpoint against the other instance of the plugin, shared with
+// unix.LOCK_SH or exclusive with unix.LOCK_EX, and returns the function unlocking it
+func (s *PodManager) lockCheckpoint(how int) (func(), error) {
+	file, err := os.OpenFile(s.lockPath, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open checkpoint lock: %v", err)
+	}
+	if err := unix.Flock(int(file.Fd()), how); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("unable to lock checkpoint: %v", err)
+	}
+	return func() {
+		// closing the file releases the lock
+		file.Close()
+	}, nil
+}
+
+// loadCheckpoint replaces the prepared claims with the ones of the checkpoint
+func (s *PodManager) loadCheckpoint() error {
+	checkpoint := drasriovtypes.NewCheckpoint()
+	if err := s.checkpointManager.GetCheckpoint(consts.DriverPluginCheckpointFile, checkpoint); err != nil {
+		return fmt.Errorf("unable to load checkpoint: %v", err)
+	}
+	s.preparedClaimsByPodUID = checkpoint.V1.PreparedClaimsByPodUID
+	if s.preparedClaimsByPodUID == nil {
+		s.preparedClaimsByPodUID = make(drasriovtypes.PreparedClaimsByPodUID)
+	}
+	s.loaded = s.checkpointFileState()
+	return nil
+}
+
+func (s *PodManager) checkpointFileState() checkpointFileState {
+	info, err := os.Stat(s.checkpointPath)
+	if err != nil {
+		return checkpointFileState{}
+	}
+	state := checkpointFileState{modTime: info.ModTime(), size: info.Size()}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		state.inode = stat.Ino
+	}
+	return state
+}
+
+// lock locks the pod manager and the checkpoint, and reloads the checkpoint if the other
+// instance of the plugin changed it. It returns the function unlocking both, or an error if
+// the checkpoint can't be locked or reloaded, as the prepared claims in memory may be stale.
+func (s *PodManager) lock(how int) (func(), error) {
+	s.mu.Lock()
+	unlockCheckpoint, err := s.lockCheckpoint(how)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	unlock := func() {
+		unlockCheckpoint()
+		s.mu.Unlock()
+	}
+	if state := s.checkpointFileState(); state != s.loaded {
+		if err := s.loadCheckpoint(); err != nil {
+			unlock()
+			return nil, err
+		}
+		klog.V(2).Infof("Reloaded checkpoint changed by another instance with %d pods", len(s.preparedClaimsByPodUID))
+	}
+	return unlock, nil
+}
+
+// readLock locks the pod manager and the checkpoint for reading. When the checkpoint can't
+// be locked or reloaded the prepared claims in memory are read, the changes fail on the error.
+func (s *PodManager) readLock() func() {
+	unlock, err := s.lock(unix.LOCK_SH)
+	if err != nil {
+		klog.ErrorS(err, "Reading the prepared claims in memory")
+		s.mu.Lock()
+		return s.mu.Unlock
+	}
+	return unlock
+}
+
 // Set stores the configuration for all prepared devices under a given Pod UID.
 // If a configuration for the Pod UID or claim ID already exists, it will be overwritten.
 func (s *PodManager) Set(podUID types.UID, claimID types.UID, preparedDevices drasriovtypes.PreparedDevices) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	unlock, err := s.lock(unix.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	if _, ok := s.preparedClaimsByPodUID[podUID]; !ok {
 		s.preparedClaimsByPodUID[podUID] = make(drasriovtypes.PreparedDevicesByClaimID)
 	}
-	s.preparedClaimsByPodUID[podUID][claimID] = preparedDevices
+	s.preparedClaimsByPodUID[podUID][claimID] = preparedDevices.DeepCopy()
 
 	return s.syncToCheckpoint()
 }
 
 // Get retrieves the configuration for a specific claim under a given Pod UID.
-// It returns the Config and true if found, otherwise an empty Config and false.
-func (s *PodManager) Get(podUID types.UID, claimID types.UID) (drasriovtypes.PreparedDevices, bool) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+// It returns the Config and true if found, otherwise an empty Config and false. It fails
+// when the checkpoint can't be locked or reloaded, so a claim is not prepared twice.
+// The getters return copies of the prepared devices, the stored ones change under the lock.
+func (s *PodManager) Get(podUID types.UID, claimID types.UID) (drasriovtypes.PreparedDevices, bool, error) {
+	unlock, err := s.lock(unix.LOCK_SH)
+	if err != nil {
+		return nil, false, err
+	}
+	defer unlock()
 	if podConfigs, ok := s.preparedClaimsByPodUID[podUID]; ok {
 		configs, found := podConfigs[claimID]
-		return configs, found
+		return configs.DeepCopy(), found, nil
 	}
-	return drasriovtypes.PreparedDevices{}, false
+	return drasriovtypes.PreparedDevices{}, false, nil
 }
 
 // GetDevicesByPodUID retrieves the configuration for all claims under a given Pod UID.
 // It returns the Config and true if found, otherwise an empty Config and false.
 func (s *PodManager) GetDevicesByPodUID(podUID types.UID) (drasriovtypes.PreparedDevices, bool) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	defer s.readLock()()
 	claims, exists := s.preparedClaimsByPodUID[podUID]
 	if !exists {
 		return drasriovtypes.PreparedDevices{}, false
 	}
 	preparedDevices := drasriovtypes.PreparedDevices{}
 	for _, devices := range claims {
-		preparedDevices = append(preparedDevices, devices...)
+		preparedDevices = append(preparedDevices, devices.DeepCopy()...)
 	}
 	return preparedDevices, true
 }
 
+// GetAllPreparedDevices returns the prepared devices of all the pods.
+func (s *PodManager) GetAllPreparedDevices() drasriovtypes.PreparedDevices {
+	defer s.readLock()()
+	preparedDevices := drasriovtypes.PreparedDevices{}
+	for _, claims := range s.preparedClaimsByPodUID {
+		for _, devices := range claims {
+			preparedDevices = append(preparedDevices, devices.DeepCopy()...)
+		}
+	}
+	return preparedDevices
+}
+
+// SetCNIState records whether the network of the devices of a pod is attached. Pods without
+// prepared devices are ignored.
+func (s *PodManager) SetCNIState(podUID types.UID, state string) error {
+	unlock, err := s.lock(unix.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	claims, exists := s.preparedClaimsByPodUID[podUID]
+	if !exists {
+		return nil
+	}
+	for _, devices := range claims {
+		for _, device := range devices {
+			device.CNIState = state
+		}
+	}
+	return s.syncToCheckpoint()
+}
+
 // DeletePod removes all configurations associated with a given Pod UID.
 func (s *PodManager) DeletePod(podUID types.UID) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	delete(s.preparedClaimsByPodUID, podUID)
-	return s.syncToCheckpoint()
+	return s.deletePods(func() []types.UID { return []types.UID{podUID} })
 }
 
 // GetByClaim retrieves the configuration for a specific claim.
 func (s *PodManager) GetByClaim(claim kubeletplugin.NamespacedObject) (drasriovtypes.PreparedDevices, bool) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	defer s.readLock()()
 	preparedDevices := drasriovtypes.PreparedDevices{}
 	for _, preparedDevicesByClaimID := range s.preparedClaimsByPodUID {
 		devices, found := preparedDevicesByClaimID[claim.UID]
 		if found {
-			preparedDevices = append(preparedDevices, devices...)
+			preparedDevices = append(preparedDevices, devices.DeepCopy()...)
 			return preparedDevices, true
 		}
 	}
@@ -128,31 +275,100 @@ func (s *PodManager) GetByClaim(claim kubeletplugin.NamespacedObject) (drasriovt
 // DeleteClaim removes all configurations associated with a given claim.
 // NOTE: for now we only support one pod per claim as VFs are not shared between pods
 func (s *PodManager) DeleteClaim(claim kubeletplugin.NamespacedObject) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	podsToDelete := []types.UID{}
-	for uid, preparedDevicesByClaimID := range s.preparedClaimsByPodUID {
-		_, found := preparedDevicesByClaimID[claim.UID]
-		if found {
-			podsToDelete = append(podsToDelete, uid)
-			break
+	return s.deletePods(func() []types.UID {
+		for uid, preparedDevicesByClaimID := range s.preparedClaimsByPodUID {
+			if _, found := preparedDevicesByClaimID[claim.UID]; found {
+				return []types.UID{uid}
+			}
 		}
-	}
+		return nil
+	})
+}
 
+// deletePods removes the pods selected under the lock and their network lock files
+func (s *PodManager) deletePods(selectPods func() []types.UID) error {
+	unlock, err := s.lock(unix.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	podsToDelete := selectPods()
+	for _, uid := range podsToDelete {
+		delete(s.preparedClaimsByPodUID, uid)
+	}
 	if len(podsToDelete) > 0 {
-		for _, uid := range podsToDelete {
-			delete(s.preparedClaimsByPodUID, uid)
-		}
-		return s.syncToCheckpoint()
+		err = s.syncToCheckpoint()
+	}
+	unlock()
+	if err != nil {
+		return err
+	}
+
+	// the network lock is taken before the checkpoint one, so it is removed once the checkpoint
+	// is unlocked
+	for _, uid := range podsToDelete {
+		s.removePodNetworkLock(uid)
 	}
 	return nil
 }
 
+// LockPodNetwork locks the networks of a pod against the other instance of the plugin, both
+// receive the pod sandbox events during a rolling update. It is held across the check of the
+// CNI state, the CNI calls and the update of the CNI state, and returns the function unlocking
+// it.
+func (s *PodManager) LockPodNetwork(podUID types.UID) (func(), error) {
+	if err := os.MkdirAll(s.podLocksPath, 0700); err != nil {
+		return nil, fmt.Errorf("unable to create pod locks directory: %v", err)
+	}
+	path := s.podNetworkLockPath(podUID)
+	for {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open network lock of pod %s: %v", podUID, err)
+		}
+		if err := unix.Flock(int(file.Fd()), unix.LOCK_EX); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("unable to lock network of pod %s: %v", podUID, err)
+		}
+		// the lock file is removed with the pod, the lock is taken again on the new file if it
+		// was removed while waiting for it
+		var locked, current unix.Stat_t
+		if unix.Fstat(int(file.Fd()), &locked) == nil && unix.Stat(path, &current) == nil && locked.Ino == current.Ino {
+			return func() {
+				// closing the file releases the lock
+				file.Close()
+			}, nil
+		}
+		file.Close()
+	}
+}
+
+// removePodNetworkLock removes the network lock file of a deleted pod while holding it
+func (s *PodManager) removePodNetworkLock(podUID types.UID) {
+	path := s.podNetworkLockPath(podUID)
+	if _, err := os.Stat(path); err != nil {
+		return
+	}
+	unlock, err := s.LockPodNetwork(podUID)
+	if err != nil {
+		klog.ErrorS(err, "Failed to remove network lock of pod", "pod.UID", podUID)
+		return
+	}
+	defer unlock()
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		klog.ErrorS(err, "Failed to remove network lock of pod", "pod.UID", podUID)
+	}
+}
+
+func (s *PodManager) podNetworkLockPath(podUID types.UID) string {
+	return filepath.Join(s.podLocksPath, string(podUID)+".lock")
+}
+
 func (s *PodManager) syncToCheckpoint() error {
 	checkpoint := drasriovtypes.NewCheckpoint()
 	checkpoint.V1.PreparedClaimsByPodUID = s.preparedClaimsByPodUID
 	if err := s.checkpointManager.CreateCheckpoint(consts.DriverPluginCheckpointFile, checkpoint); err != nil {
 		return fmt.Errorf("unable to sync to checkpoint: %v", err)
 	}
+	s.loaded = s.checkpointFileState()
 	return nil
 }
@@ -6,6 +6,7 @@ import (
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"golang.org/x/sys/unix"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/dynamic-resource-allocation/kubeletplugin"
 	drapbv1 "k8s.io/kubelet/pkg/apis/dra/v1beta1"
@@ -102,7 +103,8 @@ var _ = Describe("PodManager", func() {
 			Expect(err).NotTo(HaveOccurred())
 
 			// Verify data was loaded
-			loadedDevices, found := pm2.Get(podUID, claimUID)
+			loadedDevices, found, err := pm2.Get(podUID, claimUID)
+			Expect(err).NotTo(HaveOccurred())
 			Expect(found).To(BeTrue())
 			Expect(len(loadedDevices)).To(Equal(len(devices)))
 			Expect(loadedDevices[0].PciAddress).To(Equal(devices[0].PciAddress))
@@ -132,7 +134,8 @@ var _ = Describe("PodManager", func() {
 			err := pm.Set(podUID, claimUID, devices)
 			Expect(err).NotTo(HaveOccurred())
 
-			retrievedDevices, found := pm.Get(podUID, claimUID)
+			retrievedDevices, found, err := pm.Get(podUID, claimUID)
+			Expect(err).NotTo(HaveOccurred())
 			Expect(found).To(BeTrue())
 			Expect(len(retrievedDevices)).To(Equal(2))
 			Expect(retrievedDevices[0].PciAddress).To(Equal("0000:01:00.0"))
@@ -140,7 +143,8 @@ var _ = Describe("PodManager", func() {
 		})
 
 		It("should return false for non-existent pod/claim", func() {
-			_, found := pm.Get(types.UID("non-existent-pod"), types.UID("non-existent-claim"))
+			_, found, err := pm.Get(types.UID("non-existent-pod"), types.UID("non-existent-claim"))
+			Expect(err).NotTo(HaveOccurred())
 			Expect(found).To(BeFalse())
 		})
 
@@ -148,7 +152,8 @@ var _ = Describe("PodManager", func() {
 			err := pm.Set(podUID, claimUID, devices)
 			Expect(err).NotTo(HaveOccurred())
 
-			_, found := pm.Get(podUID, types.UID("non-existent-claim"))
+			_, found, err := pm.Get(podUID, types.UID("non-existent-claim"))
+			Expect(err).NotTo(HaveOccurred())
 			Expect(found).To(BeFalse())
 		})
 
@@ -172,7 +177,8 @@ var _ = Describe("PodManager", func() {
 			Expect(err).NotTo(HaveOccurred())
 
 			// Verify new devices replaced old ones
-			retrievedDevices, found := pm.Get(podUID, claimUID)
+			retrievedDevices, found, err := pm.Get(podUID, claimUID)
+			Expect(err).NotTo(HaveOccurred())
 			Expect(found).To(BeTrue())
 			Expect(len(retrievedDevices)).To(Equal(1))
 			Expect(retrievedDevices[0].PciAddress).To(Equal("0000:02:00.0"))
@@ -197,11 +203,13 @@ var _ = Describe("PodManager", func() {
 			Expect(err).NotTo(HaveOccurred())
 
 			// Verify both claims exist
-			devices1, found1 := pm.Get(podUID, claimUID)
+			devices1, found1, err := pm.Get(podUID, claimUID)
+			Expect(err).NotTo(HaveOccurred())
 			Expect(found1).To(BeTrue())
 			Expect(len(devices1)).To(Equal(2))
 
-			devices2Retrieved, found2 := pm.Get(podUID, claim2UID)
+			devices2Retrieved, found2, err := pm.Get(podUID, claim2UID)
+			Expect(err).NotTo(HaveOccurred())
 			Expect(found2).To(BeTrue())
 			Expect(len(devices2Retrieved)).To(Equal(1))
 			Expect(devices2Retrieved[0].PciAddress).To(Equal("0000:02:00.0"))
@@ -260,6 +268,22 @@ var _ = Describe("PodManager", func() {
 		})
 	})
 
+	Context("GetAllPreparedDevices", func() {
+		BeforeEach(func() {
+			var err error
+			pm, err = podmanager.NewPodManager(config)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should return the devices of all the pods", func() {
+			devices2 := draTypes.PreparedDevices{{PciAddress: "0000:02:00.0"}}
+			Expect(pm.Set(podUID, claimUID, devices)).To(Succeed())
+			Expect(pm.Set(types.UID("other-pod"), types.UID("other-claim"), devices2)).To(Succeed())
+
+			Expect(pm.GetAllPreparedDevices()).To(HaveLen(3))
+		})
+	})
+
 	Context("GetByClaim", func() {
 		BeforeEach(func() {
 			var err error
@@ -336,7 +360,8 @@ var _ = Describe("PodManager", func() {
 			Expect(found).To(BeFalse())
 
 			// Verify specific claim also not found
-			_, found = pm.Get(podUID, claimUID)
+			_, found, err = pm.Get(podUID, claimUID)
+			Expect(err).NotTo(HaveOccurred())
 			Expect(found).To(BeFalse())
 		})
 
@@ -402,7 +427,8 @@ var _ = Describe("PodManager", func() {
 			Expect(err).NotTo(HaveOccurred())
 
 			// Verify data persisted
-			retrievedDevices, found := pm2.Get(podUID, claimUID)
+			retrievedDevices, found, err := pm2.Get(podUID, claimUID)
+			Expect(err).NotTo(HaveOccurred())
 			Expect(found).To(BeTrue())
 			Expect(len(retrievedDevices)).To(Equal(2))
 
@@ -414,7 +440,8 @@ var _ = Describe("PodManager", func() {
 			pm3, err := podmanager.NewPodManager(config)
 			Expect(err).NotTo(HaveOccurred())
 
-			_, found = pm3.Get(podUID, claimUID)
+			_, found, err = pm3.Get(podUID, claimUID)
+			Expect(err).NotTo(HaveOccurred())
 			Expect(found).To(BeFalse())
 		})
 
@@ -426,6 +453,130 @@ var _ = Describe("PodManager", func() {
 		})
 	})
 
+	Context("Rolling update handover", func() {
+		var other *podmanager.PodManager
+
+		BeforeEach(func() {
+			var err error
+			pm, err = podmanager.NewPodManager(config)
+			Expect(err).NotTo(HaveOccurred())
+			// the instance of the plugin replacing pm
+			other, err = podmanager.NewPodManager(config)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should see the claims prepared and unprepared by the other instance", func() {
+			Expect(pm.Set(podUID, claimUID, devices)).To(Succeed())
+
+			retrievedDevices, found := other.GetByClaim(kubeletplugin.NamespacedObject{UID: claimUID})
+			Expect(found).To(BeTrue())
+			Expect(retrievedDevices).To(HaveLen(2))
+
+			Expect(other.DeleteClaim(kubeletplugin.NamespacedObject{UID: claimUID})).To(Succeed())
+			_, found, err := pm.Get(podUID, claimUID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeFalse())
+			Expect(pm.GetAllPreparedDevices()).To(BeEmpty())
+		})
+
+		It("should share the CNI state of the pods", func() {
+			Expect(pm.Set(podUID, claimUID, devices)).To(Succeed())
+			Expect(pm.SetCNIState(podUID, draTypes.CNIStateAttached)).To(Succeed())
+
+			retrievedDevices, found := other.GetDevicesByPodUID(podUID)
+			Expect(found).To(BeTrue())
+			for _, device := range retrievedDevices {
+				Expect(device.CNIState).To(Equal(draTypes.CNIStateAttached))
+			}
+
+			// pods without prepared devices are ignored
+			Expect(other.SetCNIState(types.UID("unknown"), draTypes.CNIStateDetached)).To(Succeed())
+		})
+
+		It("should wait for the other instance to release the checkpoint", func() {
+			lock, err := os.OpenFile(filepath.Join(config.DriverPluginPath(), "checkpoint.lock"), os.O_RDWR, 0)
+			Expect(err).NotTo(HaveOccurred())
+			defer lock.Close()
+			Expect(unix.Flock(int(lock.Fd()), unix.LOCK_EX)).To(Succeed())
+
+			done := make(chan error)
+			go func() {
+				done <- pm.Set(podUID, claimUID, devices)
+			}()
+			Consistently(done, "200ms").ShouldNot(Receive())
+
+			Expect(unix.Flock(int(lock.Fd()), unix.LOCK_UN)).To(Succeed())
+			Eventually(done).Should(Receive(BeNil()))
+			_, found, err := other.Get(podUID, claimUID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeTrue())
+		})
+		It("should lock the network of a pod against the other instance", func() {
+			Expect(pm.Set(podUID, claimUID, devices)).To(Succeed())
+			unlock, err := pm.LockPodNetwork(podUID)
+			Expect(err).NotTo(HaveOccurred())
+
+			locked := make(chan func())
+			go func() {
+				defer GinkgoRecover()
+				otherUnlock, err := other.LockPodNetwork(podUID)
+				Expect(err).NotTo(HaveOccurred())
+				locked <- otherUnlock
+			}()
+			Consistently(locked, "200ms").ShouldNot(Receive())
+			// the networks of the other pods are not locked
+			otherPodUnlock, err := other.LockPodNetwork(types.UID("other-pod"))
+			Expect(err).NotTo(HaveOccurred())
+			otherPodUnlock()
+
+			unlock()
+			var otherUnlock func()
+			Eventually(locked).Should(Receive(&otherUnlock))
+			otherUnlock()
+		})
+
+		It("should remove the network lock of the deleted pods", func() {
+			Expect(pm.Set(podUID, claimUID, devices)).To(Succeed())
+			unlock, err := pm.LockPodNetwork(podUID)
+			Expect(err).NotTo(HaveOccurred())
+			lockPath := filepath.Join(config.DriverPluginPath(), "pod-locks", string(podUID)+".lock")
+			Expect(lockPath).To(BeAnExistingFile())
+
+			deleted := make(chan error)
+			go func() {
+				deleted <- other.DeleteClaim(kubeletplugin.NamespacedObject{UID: claimUID})
+			}()
+			// the lock file is removed once the pod network is unlocked
+			Consistently(lockPath, "200ms").Should(BeAnExistingFile())
+			unlock()
+			Eventually(deleted).Should(Receive(BeNil()))
+			Expect(lockPath).NotTo(BeAnExistingFile())
+
+			unlock, err = pm.LockPodNetwork(podUID)
+			Expect(err).NotTo(HaveOccurred())
+			unlock()
+		})
+
+		It("should fail the changes when the checkpoint of the other instance can't be loaded", func() {
+			Expect(pm.Set(podUID, claimUID, devices)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(config.DriverPluginPath(), "checkpoint.json"), []byte("{"), 0600)).To(Succeed())
+
+			Expect(pm.Set(podUID, types.UID("claim-2"), devices)).To(MatchError(ContainSubstring("unable to load checkpoint")))
+			Expect(pm.SetCNIState(podUID, draTypes.CNIStateAttached)).To(MatchError(ContainSubstring("unable to load checkpoint")))
+			Expect(pm.DeleteClaim(kubeletplugin.NamespacedObject{UID: claimUID})).To(MatchError(ContainSubstring("unable to load checkpoint")))
+			_, _, err := pm.Get(podUID, claimUID)
+			Expect(err).To(MatchError(ContainSubstring("unable to load checkpoint")))
+
+			// the reads fall back to the prepared claims in memory
+			retrievedDevices, found := pm.GetDevicesByPodUID(podUID)
+			Expect(found).To(BeTrue())
+			Expect(retrievedDevices).To(HaveLen(2))
+			for _, device := range retrievedDevices {
+				Expect(device.CNIState).To(BeEmpty())
+			}
+		})
+	})
+
 	Context("Concurrent access", func() {
 		BeforeEach(func() {
 			var err error
@@ -456,7 +607,7 @@ var _ = Describe("PodManager", func() {
 				for i := 0; i < 10; i++ {
 					testPodUID := types.UID("test-pod-" + string(rune(i)))
 					testClaimUID := types.UID("test-claim-" + string(rune(i)))
-					_, _ = pm.Get(testPodUID, testClaimUID) // Don't care about result, just that it doesn't panic
+					_, _, _ = pm.Get(testPodUID, testClaimUID) // Don't care about result, just that it doesn't panic
 				}
 				done <- true
 			}()
@@ -465,6 +616,27 @@ var _ = Describe("PodManager", func() {
 			<-done
 			<-done
 		})
+
+		It("should not change the devices returned while the CNI state is set", func() {
+			Expect(pm.Set(podUID, claimUID, devices)).To(Succeed())
+			returned, found := pm.GetDevicesByPodUID(podUID)
+			Expect(found).To(BeTrue())
+
+			done := make(chan bool)
+			go func() {
+				defer GinkgoRecover()
+				Expect(pm.SetCNIState(podUID, draTypes.CNIStateAttached)).To(Succeed())
+				done <- true
+			}()
+			for _, device := range returned {
+				Expect(device.CNIState).To(BeEmpty())
+			}
+			<-done
+
+			Expect(devices[0].CNIState).To(BeEmpty())
+			returned, _ = pm.GetDevicesByPodUID(podUID)
+			Expect(returned[0].CNIState).To(Equal(draTypes.CNIStateAttached))
+		})
 	})
 
 	Context("Edge cases", func() {
@@ -480,7 +652,8 @@ var _ = Describe("PodManager", func() {
 			err := pm.Set(podUID, claimUID, emptyDevices)
 			Expect(err).NotTo(HaveOccurred())
 
-			retrievedDevices, found := pm.Get(podUID, claimUID)
+			retrievedDevices, found, err := pm.Get(podUID, claimUID)
+			Expect(err).NotTo(HaveOccurred())
 			Expect(found).To(BeTrue())
 			Expect(len(retrievedDevices)).To(Equal(0))
 		})
@@ -491,7 +664,8 @@ var _ = Describe("PodManager", func() {
 			err := pm.Set(podUID, claimUID, nilDevices)
 			Expect(err).NotTo(HaveOccurred())
 
-			retrievedDevices, found := pm.Get(podUID, claimUID)
+			retrievedDevices, found, err := pm.Get(podUID, claimUID)
+			Expect(err).NotTo(HaveOccurred())
 			Expect(found).To(BeTrue())
 			Expect(len(retrievedDevices)).To(Equal(0))
 		})
@@ -500,7 +674,8 @@ var _ = Describe("PodManager", func() {
 			err := pm.Set(types.UID(""), types.UID(""), devices)
 			Expect(err).NotTo(HaveOccurred())
 
-			retrievedDevices, found := pm.Get(types.UID(""), types.UID(""))
+			retrievedDevices, found, err := pm.Get(types.UID(""), types.UID(""))
+			Expect(err).NotTo(HaveOccurred())
 			Expect(found).To(BeTrue())
 			Expect(len(retrievedDevices)).To(Equal(2))
 		})
@@ -0,0 +1,109 @@
+package simulator
+
+import (
+	"context"
+	"fmt"
+
+	resourceapi "k8s.io/api/resource/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/dynamic-resource-allocation/cel"
+	"k8s.io/dynamic-resource-allocation/structured"
+)
+
+// allocatorFeatures are the DRA features the simulated scheduler supports, the ones used by
+// the driver: device taints and the consumable capacity of the PF bandwidth mode
+var allocatorFeatures = structured.Features{
+	AdminAccess:        true,
+	ConsumableCapacity: true,
+	DeviceTaints:       true,
+	PrioritizedList:    true,
+}
+
+// deviceClassLister serves the DeviceClasses listed from the clientset before an allocation
+type deviceClassLister []*resourceapi.DeviceClass
+
+func (l deviceClassLister) List() ([]*resourceapi.DeviceClass, error) {
+	return l, nil
+}
+
+func (l deviceClassLister) Get(className string) (*resourceapi.DeviceClass, error) {
+	for _, class := range l {
+		if class.Name == className {
+			return class, nil
+		}
+	}
+	return nil, apierrors.NewNotFound(resourceapi.Resource("deviceclasses"), className)
+}
+
+// allocate computes the allocation of the claims on the node the way the scheduler does,
+// with the structured parameters allocator, the published ResourceSlices and the devices
+// already allocated to other claims
+func (s *Simulator) allocate(ctx context.Context, claims []*resourceapi.ResourceClaim) ([]resourceapi.AllocationResult, error) {
+	slices, err := s.Clients.ResourceV1().ResourceSlices().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list resource slices: %w", err)
+	}
+	sliceList := make([]*resourceapi.ResourceSlice, 0, len(slices.Items))
+	for i := range slices.Items {
+		sliceList = append(sliceList, &slices.Items[i])
+	}
+
+	classes, err := s.Clients.ResourceV1().DeviceClasses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list device classes: %w", err)
+	}
+	classLister := make(deviceClassLister, 0, len(classes.Items))
+	for i := range classes.Items {
+		classLister = append(classLister, &classes.Items[i])
+	}
+
+	allocatedState, err := s.allocatedState(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	allocator, err := structured.NewAllocator(ctx, allocatorFeatures, allocatedState, classLister, sliceList,
+		cel.NewCache(10, cel.Features{EnableConsumableCapacity: allocatorFeatures.ConsumableCapacity}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create allocator: %w", err)
+	}
+	results, err := allocator.Allocate(ctx, s.node, claims)
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate claims: %w", err)
+	}
+	if results == nil {
+		return nil, fmt.Errorf("claims can't be allocated on node %s", s.node.Name)
+	}
+	return results, nil
+}
+
+// allocatedState returns the devices and the capacity allocated to the claims of the clientset
+func (s *Simulator) allocatedState(ctx context.Context) (structured.AllocatedState, error) {
+	state := structured.AllocatedState{
+		AllocatedDevices:         sets.New[structured.DeviceID](),
+		AllocatedSharedDeviceIDs: sets.New[structured.SharedDeviceID](),
+		AggregatedCapacity:       structured.NewConsumedCapacityCollection(),
+	}
+
+	claims, err := s.Clients.ResourceV1().ResourceClaims(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return state, fmt.Errorf("failed to list resource claims: %w", err)
+	}
+	for _, claim := range claims.Items {
+		if claim.Status.Allocation == nil {
+			continue
+		}
+		for _, result := range claim.Status.Allocation.Devices.Results {
+			deviceID := structured.MakeDeviceID(result.Driver, result.Pool, result.Device)
+			if result.ShareID == nil {
+				state.AllocatedDevices.Insert(deviceID)
+				continue
+			}
+			state.AllocatedSharedDeviceIDs.Insert(structured.MakeSharedDeviceID(deviceID, result.ShareID))
+			state.AggregatedCapacity.Insert(structured.NewDeviceConsumedCapacity(deviceID, result.ConsumedCapacity))
+		}
+	}
+	return state, nil
+}
@@ -0,0 +1,83 @@
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/containerd/nri/pkg/api"
+	resourceapi "k8s.io/api/resource/v1"
+
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/cni"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
+)
+
+// Attachment is a network attached by the fake CNI to a pod
+type Attachment struct {
+	PodUID           string
+	NetworkNamespace string
+	IfName           string
+	PciAddress       string
+	NetAttachDef     string
+}
+
+// FakeCNI is a cni.Interface recording the networks attached to the pods instead of
+// executing the CNI plugins. It is safe for concurrent use.
+type FakeCNI struct {
+	mutex       sync.Mutex
+	attachments []Attachment
+	// Errors returned by the methods of the same name, for failure tests
+	AttachNetworkErr error
+	DetachNetworkErr error
+}
+
+var _ cni.Interface = &FakeCNI{}
+
+// AttachNetwork records the attachment and returns the network data a CNI plugin would
+func (c *FakeCNI) AttachNetwork(_ context.Context, pod *api.PodSandbox, podNetworkNamespace string, deviceConfig *types.PreparedDevice) (*resourceapi.NetworkDeviceData, map[string]interface{}, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.AttachNetworkErr != nil {
+		return nil, nil, c.AttachNetworkErr
+	}
+
+	c.attachments = append(c.attachments, Attachment{
+		PodUID:           pod.Uid,
+		NetworkNamespace: podNetworkNamespace,
+		IfName:           deviceConfig.IfName,
+		PciAddress:       deviceConfig.PciAddress,
+		NetAttachDef:     deviceConfig.NetAttachDefConfig,
+	})
+	hardwareAddress := fmt.Sprintf("02:00:00:00:00:%02x", len(c.attachments))
+	result := map[string]interface{}{
+		"cniVersion": "1.0.0",
+		"interfaces": []interface{}{
+			map[string]interface{}{"name": deviceConfig.IfName, "mac": hardwareAddress, "sandbox": podNetworkNamespace},
+		},
+	}
+	return &resourceapi.NetworkDeviceData{InterfaceName: deviceConfig.IfName, HardwareAddress: hardwareAddress}, result, nil
+}
+
+// DetachNetwork removes the attachment of the device from the pod
+func (c *FakeCNI) DetachNetwork(_ context.Context, pod *api.PodSandbox, _ string, deviceConfig *types.PreparedDevice) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.DetachNetworkErr != nil {
+		return c.DetachNetworkErr
+	}
+
+	for i, attachment := range c.attachments {
+		if attachment.PodUID == pod.Uid && attachment.IfName == deviceConfig.IfName {
+			c.attachments = append(c.attachments[:i], c.attachments[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("no network %s attached to pod %s", deviceConfig.IfName, pod.Uid)
+}
+
+// Attachments returns the networks currently attached to the pods
+func (c *FakeCNI) Attachments() []Attachment {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return append([]Attachment{}, c.attachments...)
+}
@@ -0,0 +1,431 @@
+// Package simulator runs the node plugin of the driver end to end without a cluster nor a
+// kubelet: the published ResourceSlices are stored in a fake clientset, the claims are
+// allocated by the structured parameters allocator of the scheduler, prepared through the
+// DRA hooks of the driver, and the pod sandbox events are sent to the NRI plugin with a fake
+// CNI, the simulator playing the part of the kubelet, the scheduler and the container runtime.
+package simulator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/containerd/nri/pkg/stub"
+	corev1 "k8s.io/api/core/v1"
+	resourceapi "k8s.io/api/resource/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/util/wait"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+	"k8s.io/klog/v2"
+	"k8s.io/kubernetes/pkg/kubelet/checkpointmanager"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	sriovdrav1alpha1 "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/sriovdra/v1alpha1"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/cdi"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/controller"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/devicestate"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/driver"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/flags"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/nri"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/podmanager"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
+)
+
+// publishTimeout is how long the simulator waits for the devices to be published
+const publishTimeout = 10 * time.Second
+
+// Options configures a Simulator
+type Options struct {
+	// Host the devices are discovered and configured on, a fakehost.Host or the real host
+	// on a host.Topology
+	Host host.Interface
+	// Flags of the driver. NodeName defaults to "node1", the directories to temporary ones
+	// and the healthcheck is disabled.
+	Flags types.Flags
+	// Objects of the controller-runtime client, e.g. NetworkAttachmentDefinitions
+	Objects []client.Object
+}
+
+// Simulator runs the node plugin of the driver for one node
+type Simulator struct {
+	Clients    flags.ClientSets
+	Config     *types.Config
+	Manager    *devicestate.Manager
+	PodManager *podmanager.PodManager
+	Driver     *driver.Driver
+	NRI        *nri.Plugin
+	CNI        *FakeCNI
+
+	node   *corev1.Node
+	dir    string
+	cancel context.CancelCauseFunc
+
+	mutex sync.Mutex
+	pods  map[k8stypes.UID][]*resourceapi.ResourceClaim
+}
+
+// New starts the node plugin and waits for its devices to be published
+func New(ctx context.Context, opts Options) (*Simulator, error) {
+	// the kubelet plugin sockets are created in this directory, keep its path short
+	dir, err := os.MkdirTemp("", "dra-sriov-sim")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the simulator directory: %w", err)
+	}
+
+	s := &Simulator{
+		CNI:  &FakeCNI{},
+		dir:  dir,
+		pods: map[k8stypes.UID][]*resourceapi.ResourceClaim{},
+	}
+	if err := s.start(ctx, opts); err != nil {
+		s.Stop(ctx)
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Simulator) start(ctx context.Context, opts Options) error {
+	config := &types.Config{Flags: newFlags(opts.Flags, s.dir)}
+	s.Config = config
+	s.node = &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name:   config.Flags.NodeName,
+		UID:    k8stypes.UID(config.Flags.NodeName + "-uid"),
+		Labels: map[string]string{corev1.LabelHostname: config.Flags.NodeName},
+	}}
+	deviceClass := &resourceapi.DeviceClass{
+		ObjectMeta: metav1.ObjectMeta{Name: consts.DriverName},
+		Spec: resourceapi.DeviceClassSpec{Selectors: []resourceapi.DeviceSelector{{
+			CEL: &resourceapi.CELDeviceSelector{Expression: fmt.Sprintf("device.driver == '%s'", consts.DriverName)},
+		}}},
+	}
+
+	objects := append([]client.Object{s.node.DeepCopy()}, opts.Objects...)
+	clientset := kubefake.NewClientset(s.node, deviceClass)
+	s.Clients = flags.ClientSets{
+		Interface: clientset,
+		Client: &claimReader{
+			Client:    fake.NewClientBuilder().WithScheme(flags.Scheme).WithObjects(objects...).Build(),
+			clientset: clientset,
+		},
+	}
+	config.K8sClient = s.Clients
+
+	// the node plugin runs until Stop, not until the end of the context of New
+	ctx, cancel := context.WithCancelCause(context.WithoutCancel(ctx))
+	s.cancel = cancel
+	config.CancelMainCtx = cancel
+
+	for _, dir := range []string{config.Flags.CdiRoot, config.Flags.KubeletRegistrarDirectoryPath, config.DriverPluginPath()} {
+		if err := os.MkdirAll(dir, 0750); err != nil {
+			return err
+		}
+	}
+
+	cdiHandler, err := cdi.NewHandler(config.Flags.CdiRoot)
+	if err != nil {
+		return fmt.Errorf("unable to create CDI handler: %w", err)
+	}
+	s.PodManager, err = podmanager.NewPodManager(config)
+	if err != nil {
+		return err
+	}
+	s.Manager, err = devicestate.NewManager(config, opts.Host, cdiHandler, s.PodManager.GetAllPreparedDevices())
+	if err != nil {
+		return err
+	}
+
+	s.Driver, err = driver.Start(ctx, config, s.Manager, s.PodManager, cdiHandler)
+	if err != nil {
+		return fmt.Errorf("failed to start DRA driver: %w", err)
+	}
+	s.Manager.SetRepublishCallback(s.Driver.PublishResources)
+	go s.Manager.WatchPreBind(ctx)
+
+	s.NRI, err = nri.NewNRIPlugin(config, opts.Host, s.PodManager, s.CNI, stub.WithPluginName("simulator"), stub.WithPluginIdx("99"))
+	if err != nil {
+		return fmt.Errorf("failed to create NRI plugin: %w", err)
+	}
+	// the simulator sends the pod sandbox events, the plugin is not connected to a runtime
+	s.NRI.StartNetworkDeviceDataUpdater(ctx)
+
+	return s.WaitForPublishedDevices(ctx)
+}
+
+// newFlags returns the flags with the defaults of the simulator
+func newFlags(f types.Flags, dir string) *types.Flags {
+	if f.NodeName == "" {
+		f.NodeName = "node1"
+	}
+	if f.Namespace == "" {
+		f.Namespace = "dra-sriov-driver"
+	}
+	if f.CdiRoot == "" {
+		f.CdiRoot = filepath.Join(dir, "cdi")
+	}
+	if f.KubeletRegistrarDirectoryPath == "" {
+		f.KubeletRegistrarDirectoryPath = filepath.Join(dir, "registry")
+	}
+	if f.KubeletPluginsDirectoryPath == "" {
+		f.KubeletPluginsDirectoryPath = filepath.Join(dir, "plugins")
+	}
+	if f.HealthcheckPort == 0 {
+		f.HealthcheckPort = -1
+	}
+	if f.DefaultInterfacePrefix == "" {
+		f.DefaultInterfacePrefix = "net"
+	}
+	if f.ResourceSlicePartition == "" {
+		f.ResourceSlicePartition = driver.PartitionByNode
+	}
+	if f.HostDevicePolicy == "" {
+		f.HostDevicePolicy = devicestate.HostDevicePolicySkip
+	}
+	return &f
+}
+
+// Stop stops the node plugin and removes the files it created
+func (s *Simulator) Stop(ctx context.Context) {
+	logger := klog.FromContext(ctx)
+	if s.Driver != nil {
+		if err := s.Driver.Shutdown(logger); err != nil {
+			logger.Error(err, "Failed to shut down the driver")
+		}
+	}
+	if s.cancel != nil {
+		s.cancel(errors.New("simulator stopped"))
+	}
+	if err := os.RemoveAll(s.dir); err != nil {
+		logger.Error(err, "Failed to remove the simulator directory", "dir", s.dir)
+	}
+}
+
+// WaitForPublishedDevices waits until the ResourceSlices of the node publish the current
+// allocatable devices of the device state manager
+func (s *Simulator) WaitForPublishedDevices(ctx context.Context) error {
+	err := wait.PollUntilContextTimeout(ctx, 20*time.Millisecond, publishTimeout, true, func(ctx context.Context) (bool, error) {
+		published, err := s.PublishedDevices(ctx)
+		if err != nil {
+			return false, err
+		}
+		allocatable := s.Manager.GetAllocatableDevices()
+		if len(published) != len(allocatable) {
+			return false, nil
+		}
+		for _, device := range allocatable {
+			if !apiequality.Semantic.DeepEqual(published[device.Name], device) {
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("devices of node %s not published: %w", s.node.Name, err)
+	}
+	return nil
+}
+
+// PublishedDevices returns the devices of the ResourceSlices of the node by name
+func (s *Simulator) PublishedDevices(ctx context.Context) (map[string]resourceapi.Device, error) {
+	slices, err := s.Clients.ResourceV1().ResourceSlices().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list resource slices: %w", err)
+	}
+	devices := map[string]resourceapi.Device{}
+	for _, slice := range slices.Items {
+		if slice.Spec.NodeName == nil || *slice.Spec.NodeName != s.node.Name {
+			continue
+		}
+		for _, device := range slice.Spec.Devices {
+			devices[device.Name] = device
+		}
+	}
+	return devices, nil
+}
+
+// ApplyResourceFilter creates or updates a SriovResourceFilter, reconciles it like the
+// controller of the node plugin and waits for the devices to be republished
+func (s *Simulator) ApplyResourceFilter(ctx context.Context, filter *sriovdrav1alpha1.SriovResourceFilter) error {
+	if filter.Namespace == "" {
+		filter.Namespace = s.Config.Flags.Namespace
+	}
+	current := &sriovdrav1alpha1.SriovResourceFilter{}
+	err := s.Clients.Get(ctx, client.ObjectKeyFromObject(filter), current)
+	switch {
+	case err == nil:
+		filter.ResourceVersion = current.ResourceVersion
+		err = s.Clients.Update(ctx, filter)
+	case client.IgnoreNotFound(err) == nil:
+		err = s.Clients.Create(ctx, filter)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to apply SriovResourceFilter %s: %w", filter.Name, err)
+	}
+
+	reconciler := controller.NewSriovResourceFilterReconciler(s.Clients, s.node.Name, s.Config.Flags.Namespace, s.Manager)
+	if _, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(filter)}); err != nil {
+		return fmt.Errorf("failed to reconcile SriovResourceFilter %s: %w", filter.Name, err)
+	}
+	return s.WaitForPublishedDevices(ctx)
+}
+
+// RunPod allocates the claims of the pod on the node, prepares them like the kubelet and
+// runs the pod sandbox like the container runtime. The claims are created in the namespace
+// of the pod and only need their spec.
+func (s *Simulator) RunPod(ctx context.Context, pod *corev1.Pod, claims ...*resourceapi.ResourceClaim) error {
+	for _, claim := range claims {
+		if claim.Namespace == "" {
+			claim.Namespace = pod.Namespace
+		}
+		if claim.UID == "" {
+			claim.UID = uuid.NewUUID()
+		}
+	}
+	results, err := s.allocate(ctx, claims)
+	if err != nil {
+		return err
+	}
+
+	allocated := make([]*resourceapi.ResourceClaim, 0, len(claims))
+	for i, claim := range claims {
+		claim, err := s.Clients.ResourceV1().ResourceClaims(claim.Namespace).Create(ctx, claim, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to create claim %s: %w", claim.Name, err)
+		}
+		claim.Status.Allocation = &results[i]
+		claim.Status.ReservedFor = []resourceapi.ResourceClaimConsumerReference{{Resource: "pods", Name: pod.Name, UID: pod.UID}}
+		claim, err = s.Clients.ResourceV1().ResourceClaims(claim.Namespace).UpdateStatus(ctx, claim, metav1.UpdateOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to allocate claim %s: %w", claim.Name, err)
+		}
+		allocated = append(allocated, claim)
+	}
+	s.mutex.Lock()
+	s.pods[pod.UID] = allocated
+	s.mutex.Unlock()
+
+	prepared, err := s.Driver.PrepareResourceClaims(ctx, allocated)
+	if err != nil {
+		return fmt.Errorf("failed to prepare the claims of pod %s: %w", pod.Name, err)
+	}
+	var errs []error
+	for _, claim := range allocated {
+		if prepared[claim.UID].Err != nil {
+			errs = append(errs, fmt.Errorf("failed to prepare claim %s: %w", claim.Name, prepared[claim.UID].Err))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	return s.NRI.RunPodSandbox(ctx, podSandbox(pod))
+}
+
+// StopPod stops the pod sandbox, unprepares the claims of the pod and deletes them
+func (s *Simulator) StopPod(ctx context.Context, pod *corev1.Pod) error {
+	s.mutex.Lock()
+	claims, found := s.pods[pod.UID]
+	delete(s.pods, pod.UID)
+	s.mutex.Unlock()
+	if !found {
+		return fmt.Errorf("pod %s not running", pod.Name)
+	}
+
+	var errs []error
+	if err := s.NRI.StopPodSandbox(ctx, podSandbox(pod)); err != nil {
+		errs = append(errs, err)
+	}
+
+	objects := make([]kubeletplugin.NamespacedObject, 0, len(claims))
+	for _, claim := range claims {
+		objects = append(objects, kubeletplugin.NamespacedObject{
+			NamespacedName: k8stypes.NamespacedName{Namespace: claim.Namespace, Name: claim.Name},
+			UID:            claim.UID,
+		})
+	}
+	unprepared, err := s.Driver.UnprepareResourceClaims(ctx, objects)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for _, claim := range claims {
+		if unprepared[claim.UID] != nil {
+			errs = append(errs, fmt.Errorf("failed to unprepare claim %s: %w", claim.Name, unprepared[claim.UID]))
+		}
+		if err := s.Clients.ResourceV1().ResourceClaims(claim.Namespace).Delete(ctx, claim.Name, metav1.DeleteOptions{}); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete claim %s: %w", claim.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Claim returns the current state of a claim
+func (s *Simulator) Claim(ctx context.Context, namespace, name string) (*resourceapi.ResourceClaim, error) {
+	return s.Clients.ResourceV1().ResourceClaims(namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+// CDISpecFiles returns the paths of the CDI specs written by the driver
+func (s *Simulator) CDISpecFiles() ([]string, error) {
+	return filepath.Glob(filepath.Join(s.Config.Flags.CdiRoot, "*"))
+}
+
+// Checkpoint reads and verifies the checkpoint of the prepared claims
+func (s *Simulator) Checkpoint() (*types.Checkpoint, error) {
+	checkpointManager, err := checkpointmanager.NewCheckpointManager(s.Config.DriverPluginPath())
+	if err != nil {
+		return nil, fmt.Errorf("unable to create checkpoint manager: %w", err)
+	}
+	checkpoint := types.NewCheckpoint()
+	if err := checkpointManager.GetCheckpoint(consts.DriverPluginCheckpointFile, checkpoint); err != nil {
+		return nil, fmt.Errorf("unable to get checkpoint: %w", err)
+	}
+	return checkpoint, nil
+}
+
+// podSandbox returns the pod sandbox the container runtime sends to the NRI plugins for
+// a pod. Host network pods have no network namespace.
+func podSandbox(pod *corev1.Pod) *api.PodSandbox {
+	sandbox := &api.PodSandbox{
+		Id:        "sandbox-" + string(pod.UID),
+		Name:      pod.Name,
+		Uid:       string(pod.UID),
+		Namespace: pod.Namespace,
+		Labels:    pod.Labels,
+		Linux:     &api.LinuxPodSandbox{},
+	}
+	if !pod.Spec.HostNetwork {
+		sandbox.Linux.Namespaces = []*api.LinuxNamespace{{Type: "network", Path: "/var/run/netns/cni-" + string(pod.UID)}}
+	}
+	return sandbox
+}
+
+// claimReader reads the ResourceClaims of the controller-runtime client from the clientset
+// the driver updates them in
+type claimReader struct {
+	client.Client
+	clientset *kubefake.Clientset
+}
+
+func (c *claimReader) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	claim, ok := obj.(*resourceapi.ResourceClaim)
+	if !ok {
+		return c.Client.Get(ctx, key, obj, opts...)
+	}
+	current, err := c.clientset.ResourceV1().ResourceClaims(key.Namespace).Get(ctx, key.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	current.DeepCopyInto(claim)
+	return nil
+}
@@ -0,0 +1,243 @@
+package simulator_test
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+
+	netattdefv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	resourceapi "k8s.io/api/resource/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	sriovdrav1alpha1 "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/sriovdra/v1alpha1"
+	configapi "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/virtualfunction/v1alpha1"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host/fakehost"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/simulator"
+)
+
+var _ = Describe("Simulator", func() {
+	var (
+		fakeHost *fakehost.Host
+		sim      *simulator.Simulator
+	)
+
+	newPod := func(name string) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: k8stypes.UID("uid-" + name)}}
+	}
+
+	// newClaim returns a claim of count devices of the driver with a VfConfig, if set
+	newClaim := func(name string, count int64, vfConfig *configapi.VfConfig, selectors ...string) *resourceapi.ResourceClaim {
+		request := resourceapi.ExactDeviceRequest{DeviceClassName: consts.DriverName, AllocationMode: resourceapi.DeviceAllocationModeExactCount, Count: count}
+		for _, selector := range selectors {
+			request.Selectors = append(request.Selectors, resourceapi.DeviceSelector{CEL: &resourceapi.CELDeviceSelector{Expression: selector}})
+		}
+		claim := &resourceapi.ResourceClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: resourceapi.ResourceClaimSpec{Devices: resourceapi.DeviceClaim{
+				Requests: []resourceapi.DeviceRequest{{Name: "vf", Exactly: &request}},
+			}},
+		}
+		if vfConfig == nil {
+			return claim
+		}
+		vfConfig.TypeMeta = metav1.TypeMeta{APIVersion: configapi.GroupName + "/" + configapi.Version, Kind: configapi.VfConfigKind}
+		encoded, err := runtime.Encode(configapi.Decoder.(runtime.Encoder), vfConfig)
+		Expect(err).NotTo(HaveOccurred())
+		claim.Spec.Devices.Config = []resourceapi.DeviceClaimConfiguration{{
+			Requests: []string{"vf"},
+			DeviceConfiguration: resourceapi.DeviceConfiguration{Opaque: &resourceapi.OpaqueDeviceConfiguration{
+				Driver:     consts.DriverName,
+				Parameters: runtime.RawExtension{Raw: encoded},
+			}},
+		}}
+		return claim
+	}
+
+	BeforeEach(func(ctx SpecContext) {
+		fakeHost = fakehost.New(fakehost.PF{
+			PciAddress: "0000:01:00.0",
+			NetName:    "eth0",
+			VendorID:   "15b3",
+			DeviceID:   "101d",
+			Driver:     "mlx5_core",
+			Link:       host.LinkInfo{Speed: 100000, MTU: 1500, OperState: "up", Carrier: true},
+			VFs: []fakehost.VF{
+				{PciAddress: "0000:01:00.1", VFID: 0, DeviceID: "101e", NetName: "eth0v0", Driver: "mlx5_core", IOMMUGroup: "42"},
+				{PciAddress: "0000:01:00.2", VFID: 1, DeviceID: "101e", NetName: "eth0v1", Driver: "mlx5_core", IOMMUGroup: "43"},
+			},
+		})
+		var err error
+		sim, err = simulator.New(ctx, simulator.Options{
+			Host: fakeHost,
+			Objects: []client.Object{&netattdefv1.NetworkAttachmentDefinition{
+				ObjectMeta: metav1.ObjectMeta{Name: "sriov", Namespace: "default"},
+				Spec:       netattdefv1.NetworkAttachmentDefinitionSpec{Config: `{"cniVersion":"1.0.0","name":"sriov","type":"sriov"}`},
+			}},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(sim.Stop)
+	})
+
+	It("publishes the VFs of the node", func(ctx SpecContext) {
+		devices, err := sim.PublishedDevices(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(devices).To(HaveLen(2))
+		Expect(devices).To(HaveKey("0000-01-00-1"))
+		Expect(devices).To(HaveKey("0000-01-00-2"))
+	})
+
+	It("runs a pod with a vfio-pci VF", func(ctx SpecContext) {
+		pod := newPod("dpdk")
+		Expect(sim.RunPod(ctx, pod, newClaim("vfio", 1, &configapi.VfConfig{Driver: "vfio-pci"}))).To(Succeed())
+
+		By("allocating and preparing the claim")
+		claim, err := sim.Claim(ctx, "default", "vfio")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(claim.Status.Allocation.Devices.Results).To(HaveLen(1))
+		Expect(claim.Status.ReservedFor).To(ConsistOf(HaveField("UID", pod.UID)))
+		device := claim.Status.Allocation.Devices.Results[0].Device
+		vf, _ := fakeHost.VF(strings.Replace(strings.Replace(device, "-", ":", 2), "-", ".", 1))
+		Expect(vf.Driver).To(Equal("vfio-pci"))
+		Expect(sim.CNI.Attachments()).To(BeEmpty())
+
+		By("writing the CDI specs of the claim and the pod")
+		specs, err := sim.CDISpecFiles()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(specs).To(HaveLen(2))
+		Expect(specs).To(ContainElement(ContainSubstring(string(claim.UID))))
+		for _, path := range specs {
+			if strings.Contains(path, string(claim.UID)) {
+				spec, err := os.ReadFile(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(spec)).To(ContainSubstring("/dev/vfio/" + vf.IOMMUGroup))
+			}
+		}
+
+		By("checkpointing the prepared claim")
+		checkpoint, err := sim.Checkpoint()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(checkpoint.V1.PreparedClaimsByPodUID).To(HaveKey(pod.UID))
+		Expect(checkpoint.V1.PreparedClaimsByPodUID[pod.UID]).To(HaveKey(claim.UID))
+
+		By("stopping the pod")
+		Expect(sim.StopPod(ctx, pod)).To(Succeed())
+		vf, _ = fakeHost.VF(vf.PciAddress)
+		Expect(vf.Driver).To(Equal("mlx5_core"))
+		checkpoint, err = sim.Checkpoint()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(checkpoint.V1.PreparedClaimsByPodUID).NotTo(HaveKey(pod.UID))
+		Expect(sim.CDISpecFiles()).To(BeEmpty())
+		_, err = sim.Claim(ctx, "default", "vfio")
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("attaches a kernel VF through the CNI and publishes its network data", func(ctx SpecContext) {
+		pod := newPod("netdev")
+		Expect(sim.RunPod(ctx, pod, newClaim("netdev", 1, &configapi.VfConfig{NetAttachDefName: "sriov"}))).To(Succeed())
+
+		Expect(sim.CNI.Attachments()).To(ConsistOf(And(
+			HaveField("PodUID", string(pod.UID)),
+			HaveField("IfName", "net0"),
+			HaveField("NetworkNamespace", "/var/run/netns/cni-"+string(pod.UID)),
+		)))
+		Eventually(func(g Gomega) {
+			claim, err := sim.Claim(ctx, "default", "netdev")
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(claim.Status.Devices).To(ConsistOf(HaveField("NetworkData", HaveField("InterfaceName", "net0"))))
+		}).Should(Succeed())
+
+		Expect(sim.StopPod(ctx, pod)).To(Succeed())
+		Expect(sim.CNI.Attachments()).To(BeEmpty())
+	})
+
+	It("doesn't allocate a VF twice", func(ctx SpecContext) {
+		Expect(sim.RunPod(ctx, newPod("first"), newClaim("first", 2, &configapi.VfConfig{Driver: "vfio-pci"}))).To(Succeed())
+		Expect(sim.RunPod(ctx, newPod("second"), newClaim("second", 1, &configapi.VfConfig{Driver: "vfio-pci"}))).
+			To(MatchError(ContainSubstring("can't be allocated")))
+
+		Expect(sim.StopPod(ctx, newPod("first"))).To(Succeed())
+		Expect(sim.RunPod(ctx, newPod("second"), newClaim("second", 1, &configapi.VfConfig{Driver: "vfio-pci"}))).To(Succeed())
+	})
+
+	It("allocates the VFs of a resource filter with a CEL selector", func(ctx SpecContext) {
+		Expect(sim.ApplyResourceFilter(ctx, &sriovdrav1alpha1.SriovResourceFilter{
+			ObjectMeta: metav1.ObjectMeta{Name: "filter"},
+			Spec: sriovdrav1alpha1.SriovResourceFilterSpec{Configs: []sriovdrav1alpha1.Config{{
+				ResourceName:    "vf0",
+				ResourceFilters: []sriovdrav1alpha1.ResourceFilter{{PciAddresses: []string{"0000:01:00.1"}}},
+			}}},
+		})).To(Succeed())
+
+		selector := `device.attributes["` + consts.DriverName + `"].resourceName == "vf0"`
+		Expect(sim.RunPod(ctx, newPod("filtered"), newClaim("filtered", 1, &configapi.VfConfig{Driver: "vfio-pci"}, selector))).To(Succeed())
+		claim, err := sim.Claim(ctx, "default", "filtered")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(claim.Status.Allocation.Devices.Results).To(ConsistOf(HaveField("Device", "0000-01-00-1")))
+	})
+
+	It("prepares the VFs of a resource with its default config", func(ctx SpecContext) {
+		Expect(sim.ApplyResourceFilter(ctx, &sriovdrav1alpha1.SriovResourceFilter{
+			ObjectMeta: metav1.ObjectMeta{Name: "filter"},
+			Spec: sriovdrav1alpha1.SriovResourceFilterSpec{Configs: []sriovdrav1alpha1.Config{{
+				ResourceName:    "dpdk",
+				ResourceFilters: []sriovdrav1alpha1.ResourceFilter{{VfIDs: []string{"1"}}},
+				DefaultConfig:   &configapi.VfConfig{Driver: "vfio-pci", AddVhostMount: true},
+			}, {
+				ResourceName: "netdev",
+			}}},
+		})).To(Succeed())
+
+		selector := `device.attributes["` + consts.DriverName + `"].resourceName == "dpdk"`
+		Expect(sim.RunPod(ctx, newPod("dpdk"), newClaim("dpdk", 1, nil, selector))).To(Succeed())
+		vf, _ := fakeHost.VF("0000:01:00.2")
+		Expect(vf.Driver).To(Equal("vfio-pci"))
+
+		claim, err := sim.Claim(ctx, "default", "dpdk")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(claim.Status.Devices).To(HaveLen(1))
+		statusData := &configapi.DeviceStatusData{}
+		Expect(json.Unmarshal(claim.Status.Devices[0].Data.Raw, statusData)).To(Succeed())
+		Expect(statusData.Config).NotTo(BeNil())
+		Expect(statusData.Config.Driver).To(Equal("vfio-pci"))
+		Expect(statusData.Config.AddVhostMount).To(BeTrue())
+	})
+
+	It("pre-binds the idle VFs of a resource to the driver of its default config", func(ctx SpecContext) {
+		Expect(sim.ApplyResourceFilter(ctx, &sriovdrav1alpha1.SriovResourceFilter{
+			ObjectMeta: metav1.ObjectMeta{Name: "filter"},
+			Spec: sriovdrav1alpha1.SriovResourceFilterSpec{Configs: []sriovdrav1alpha1.Config{{
+				ResourceName:    "dpdk",
+				ResourceFilters: []sriovdrav1alpha1.ResourceFilter{{VfIDs: []string{"1"}}},
+				DefaultConfig:   &configapi.VfConfig{Driver: "vfio-pci"},
+				PreBind:         true,
+			}, {
+				ResourceName: "netdev",
+			}}},
+		})).To(Succeed())
+
+		Eventually(func(g Gomega) {
+			devices, err := sim.PublishedDevices(ctx)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(devices["0000-01-00-2"].Attributes).To(HaveKeyWithValue(
+				resourceapi.QualifiedName(consts.AttributeDriver), HaveField("StringValue", HaveValue(Equal("vfio-pci")))))
+		}).Should(Succeed())
+		vf, _ := fakeHost.VF("0000:01:00.2")
+		Expect(vf.Driver).To(Equal("vfio-pci"))
+
+		attributes := `device.attributes["` + consts.DriverName + `"]`
+		selector := `"driver" in ` + attributes + ` && ` + attributes + `.driver == "vfio-pci"`
+		Expect(sim.RunPod(ctx, newPod("dpdk"), newClaim("dpdk", 1, nil, selector))).To(Succeed())
+		Expect(sim.StopPod(ctx, newPod("dpdk"))).To(Succeed())
+		vf, _ = fakeHost.VF("0000:01:00.2")
+		Expect(vf.Driver).To(Equal("vfio-pci"))
+	})
+})
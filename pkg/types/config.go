@@ -2,7 +2,9 @@ package types
 
 import (
 	"path/filepath"
+	"time"
 
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/audit"
 	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
 	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/flags"
 )
@@ -18,14 +20,40 @@ type Flags struct {
 	KubeletPluginsDirectoryPath   string
 	HealthcheckPort               int
 	DefaultInterfacePrefix        string
+	RejectKernelVfHostNetwork     bool
+	ResourceSlicePartition        string
+	PFBandwidthMode               bool
+	LinkAttributesRefreshInterval time.Duration
+	DeviceHealthCheckInterval     time.Duration
+	HostDevicePolicy              string
+	HostDeviceDenylist            []string
+	IBGUIDPool                    string
+	PublishSFs                    bool
+	SFsPerPF                      int
+	VFSanitizeSteps               []string
+	AuditLogMaxSize               int
+	AuditLogMaxBackups            int
+	RollingUpdateUID              string
 }
 
 type Config struct {
 	Flags         *Flags
 	K8sClient     flags.ClientSets
 	CancelMainCtx func(error)
+	// AuditLogger records the host mutations, nil when the audit log is disabled
+	AuditLogger *audit.Logger
 }
 
 func (c Config) DriverPluginPath() string {
 	return filepath.Join(c.Flags.KubeletPluginsDirectoryPath, consts.DriverName)
 }
+
+// AuditLogPath returns the path of the audit log of the host mutations
+func (c Config) AuditLogPath() string {
+	return filepath.Join(c.DriverPluginPath(), consts.DriverPluginAuditLogFile)
+}
+
+// SanitizeFailuresPath returns the path of the file recording the VFs that failed to be sanitized
+func (c Config) SanitizeFailuresPath() string {
+	return filepath.Join(c.DriverPluginPath(), consts.DriverPluginSanitizeFailuresFile)
+}
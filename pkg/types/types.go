@@ -3,15 +3,20 @@ package types
 import (
 	"encoding/json"
 	"fmt"
+	"slices"
+	"strconv"
 
 	configapi "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/virtualfunction/v1alpha1"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/audit"
 	resourceapi "k8s.io/api/resource/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	k8stypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/dynamic-resource-allocation/kubeletplugin"
 	drapbv1 "k8s.io/kubelet/pkg/apis/dra/v1beta1"
 	"k8s.io/kubernetes/pkg/kubelet/checkpointmanager/checksum"
+	"k8s.io/utils/ptr"
 	cdiapi "tags.cncf.io/container-device-interface/pkg/cdi"
+	cdispec "tags.cncf.io/container-device-interface/specs-go"
 )
 
 // AllocatableDevices is a map of device pci address to dra device objects
@@ -29,7 +34,6 @@ type PreparedClaimsByPodUID map[k8stypes.UID]PreparedDevicesByClaimID
 type NetworkDataChanStruct struct {
 	PreparedDevice    *PreparedDevice
 	NetworkDeviceData *resourceapi.NetworkDeviceData
-	CNIConfig         map[string]interface{}
 	CNIResult         map[string]interface{}
 }
 type NetworkDataChanStructList []*NetworkDataChanStruct
@@ -54,11 +58,162 @@ func AddDeviceIDToNetConf(originalConfig, deviceID string) (string, error) {
 	return string(modifiedConfig), nil
 }
 
+// SetMaxTxRateInNetConf sets the max_tx_rate (Mbps) in a sriov-cni compatible netconf
+func SetMaxTxRateInNetConf(originalConfig string, maxTxRate int) (string, error) {
+	var rawConfig map[string]interface{}
+	if err := json.Unmarshal([]byte(originalConfig), &rawConfig); err != nil {
+		return "", fmt.Errorf("failed to unmarshal existing config: %w", err)
+	}
+
+	rawConfig["max_tx_rate"] = maxTxRate
+
+	modifiedConfig, err := json.Marshal(rawConfig)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal modified config: %w", err)
+	}
+
+	return string(modifiedConfig), nil
+}
+
+// SetDeviceInNetConf sets the netdev to move to the pod in a host-device CNI compatible netconf
+func SetDeviceInNetConf(originalConfig, netName string) (string, error) {
+	var rawConfig map[string]interface{}
+	if err := json.Unmarshal([]byte(originalConfig), &rawConfig); err != nil {
+		return "", fmt.Errorf("failed to unmarshal existing config: %w", err)
+	}
+
+	rawConfig["device"] = netName
+
+	modifiedConfig, err := json.Marshal(rawConfig)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal modified config: %w", err)
+	}
+
+	return string(modifiedConfig), nil
+}
+
+// SetInfiniBandInNetConf sets the GUID and the partition key of the VF in an ib-sriov-cni
+// compatible netconf. An empty pkey is not set.
+func SetInfiniBandInNetConf(originalConfig, guid, pkey string) (string, error) {
+	var rawConfig map[string]interface{}
+	if err := json.Unmarshal([]byte(originalConfig), &rawConfig); err != nil {
+		return "", fmt.Errorf("failed to unmarshal existing config: %w", err)
+	}
+
+	runtimeConfig, _ := rawConfig["runtimeConfig"].(map[string]interface{})
+	if runtimeConfig == nil {
+		runtimeConfig = map[string]interface{}{}
+	}
+	runtimeConfig["infinibandGUID"] = guid
+	rawConfig["runtimeConfig"] = runtimeConfig
+	if pkey != "" {
+		rawConfig["pkey"] = pkey
+	}
+
+	modifiedConfig, err := json.Marshal(rawConfig)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal modified config: %w", err)
+	}
+
+	return string(modifiedConfig), nil
+}
+
+// BuildBondNetConf sets the bonding mode, the link monitoring interval and the member
+// links, already moved into the pod network namespace, in a bond-cni compatible netconf
+func BuildBondNetConf(originalConfig, mode string, miimon int, links []string) (string, error) {
+	var rawConfig map[string]interface{}
+	if err := json.Unmarshal([]byte(originalConfig), &rawConfig); err != nil {
+		return "", fmt.Errorf("failed to unmarshal existing config: %w", err)
+	}
+
+	bondLinks := make([]map[string]string, 0, len(links))
+	for _, link := range links {
+		bondLinks = append(bondLinks, map[string]string{"name": link})
+	}
+	rawConfig["mode"] = mode
+	rawConfig["miimon"] = strconv.Itoa(miimon)
+	rawConfig["linksInContainer"] = true
+	rawConfig["links"] = bondLinks
+
+	modifiedConfig, err := json.Marshal(rawConfig)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal modified config: %w", err)
+	}
+
+	return string(modifiedConfig), nil
+}
+
+// GetVlanFromNetConf returns the vlan configured in a sriov-cni compatible netconf, 0 if none is set
+func GetVlanFromNetConf(netConf string) (int, error) {
+	vlanConfig := struct {
+		Vlan int `json:"vlan,omitempty"`
+	}{}
+	if err := json.Unmarshal([]byte(netConf), &vlanConfig); err != nil {
+		return 0, fmt.Errorf("failed to unmarshal netconf: %w", err)
+	}
+	return vlanConfig.Vlan, nil
+}
+
+// VFLinkSettings holds the VF settings from a sriov-cni compatible netconf that are
+// applied through the PF, nil fields are left untouched.
+type VFLinkSettings struct {
+	Vlan      *int   `json:"vlan,omitempty"`
+	VlanQoS   *int   `json:"vlanQoS,omitempty"`
+	MAC       string `json:"mac,omitempty"`
+	SpoofChk  string `json:"spoofchk,omitempty"`
+	Trust     string `json:"trust,omitempty"`
+	LinkState string `json:"link_state,omitempty"`
+	MinTxRate *int   `json:"min_tx_rate,omitempty"`
+	MaxTxRate *int   `json:"max_tx_rate,omitempty"`
+}
+
+// GetVFLinkSettingsFromNetConf returns the VF link settings configured in a sriov-cni compatible netconf
+func GetVFLinkSettingsFromNetConf(netConf string) (*VFLinkSettings, error) {
+	settings := &VFLinkSettings{}
+	if err := json.Unmarshal([]byte(netConf), settings); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal netconf: %w", err)
+	}
+	return settings, nil
+}
+
+// Defaults returns the settings resetting the ones set to the defaults of a new VF, the
+// settings not set are left nil or empty
+func (s *VFLinkSettings) Defaults() *VFLinkSettings {
+	defaults := &VFLinkSettings{}
+	if s.Vlan != nil {
+		defaults.Vlan = ptr.To(0)
+	}
+	if s.VlanQoS != nil {
+		defaults.VlanQoS = ptr.To(0)
+	}
+	if s.MAC != "" {
+		defaults.MAC = "00:00:00:00:00:00"
+	}
+	if s.SpoofChk != "" {
+		defaults.SpoofChk = "on"
+	}
+	if s.Trust != "" {
+		defaults.Trust = "off"
+	}
+	if s.LinkState != "" {
+		defaults.LinkState = "auto"
+	}
+	if s.MinTxRate != nil {
+		defaults.MinTxRate = ptr.To(0)
+	}
+	if s.MaxTxRate != nil {
+		defaults.MaxTxRate = ptr.To(0)
+	}
+	return defaults
+}
+
 type OpaqueDeviceConfig struct {
 	Requests []string
 	Config   runtime.Object
 }
 
+// PreparedDevice is stored in the checkpoint, new fields must be omitempty
+// so checkpoints written by older versions still pass checksum verification.
 type PreparedDevice struct {
 	Device              drapbv1.Device
 	ClaimNamespacedName kubeletplugin.NamespacedObject
@@ -66,9 +221,210 @@ type PreparedDevice struct {
 	Config              *configapi.VfConfig
 	IfName              string
 	PciAddress          string
+	PFName              string `json:",omitempty"`
+	VFID                int    `json:",omitempty"`
 	PodUID              string
 	NetAttachDefConfig  string
-	OriginalDriver      string // Store original driver for restoration during unprepare
+	OriginalDriver      string        // Store original driver for restoration during unprepare
+	Driver              string        `json:",omitempty"` // Driver the device is bound to after prepare
+	ShareID             string        `json:",omitempty"` // Allocation share of a PF published with consumable capacity
+	MaxTxRate           int           `json:",omitempty"` // VF max_tx_rate in Mbps enforcing the bandwidth share
+	Bond                *PreparedBond `json:",omitempty"` // Bond the VF is a member of
+	RDMADevice          string        `json:",omitempty"` // RDMA device exposed to the pod
+	GUID                string        `json:",omitempty"` // node and port GUID set on an InfiniBand VF
+	PKey                string        `json:",omitempty"` // partition key of an InfiniBand VF
+	SF                  *PreparedSF   `json:",omitempty"` // Scalable function prepared instead of a VF
+	VendorID            string        `json:",omitempty"` // PCI vendor ID selecting the vendor plugin hooks
+	OriginalMTU         int           `json:",omitempty"` // MTU of the VF netdev before prepare, restored by the sanitization
+	CNIState            string        `json:",omitempty"` // whether the network of the pod sandbox is attached, empty when unknown
+}
+
+// CNI states of a prepared device, they make the CNI ADD and DEL idempotent when two instances
+// of the plugin receive the pod sandbox events during a rolling update
+const (
+	CNIStateAttached = "attached"
+	CNIStateDetached = "detached"
+)
+
+// PreparedSF is a scalable function of a PF handed to a pod. SFs created on demand are
+// deleted on unprepare.
+type PreparedSF struct {
+	AuxDevice string
+	SFNum     int
+	NetName   string
+	PortIndex uint32 `json:",omitempty"` // devlink port index of an SF created on prepare
+	Created   bool   `json:",omitempty"`
+}
+
+// PreparedBond is a bond of VFs of the same claim created in the pod network namespace
+// once its members are attached.
+type PreparedBond struct {
+	IfName             string
+	Mode               string
+	Members            []string // interface names of the member VFs in the pod
+	NetAttachDefConfig string
+}
+
+// BondDevice returns a pseudo prepared device to attach and detach the bond through the CNI
+func (p *PreparedDevice) BondDevice() *PreparedDevice {
+	return &PreparedDevice{
+		ClaimNamespacedName: p.ClaimNamespacedName,
+		IfName:              p.Bond.IfName,
+		PodUID:              p.PodUID,
+		NetAttachDefConfig:  p.Bond.NetAttachDefConfig,
+	}
+}
+
+// AuditFields returns the claim and the pod of the prepared device, recorded with the host
+// operations done for it
+func (p *PreparedDevice) AuditFields() audit.Fields {
+	return audit.Fields{
+		ClaimUID: string(p.ClaimNamespacedName.UID),
+		Claim:    p.ClaimNamespacedName.NamespacedName.String(),
+		PodUID:   p.PodUID,
+	}
+}
+
+// AuditEvent returns the audit event of an operation on the prepared device
+func (p *PreparedDevice) AuditEvent(operation string) audit.Event {
+	event := audit.Event{
+		Operation:  operation,
+		ClaimUID:   string(p.ClaimNamespacedName.UID),
+		Claim:      p.ClaimNamespacedName.NamespacedName.String(),
+		PodUID:     p.PodUID,
+		Device:     p.Device.DeviceName,
+		PciAddress: p.PciAddress,
+		Driver:     p.Driver,
+		Details:    map[string]string{},
+	}
+	if p.Config != nil {
+		event.Config = p.Config
+	}
+	if p.IfName != "" {
+		event.Details["ifName"] = p.IfName
+	}
+	if p.OriginalDriver != "" {
+		event.Details["originalDriver"] = p.OriginalDriver
+	}
+	if p.SF != nil {
+		event.Details["auxDevice"] = p.SF.AuxDevice
+	}
+	return event
+}
+
+// CDIDeviceName returns the name of the CDI device for the prepared device. Shares of the
+// same PF get their own CDI device.
+func (p *PreparedDevice) CDIDeviceName() string {
+	if p.ShareID != "" {
+		return p.Device.DeviceName + "-" + p.ShareID
+	}
+	return p.Device.DeviceName
+}
+
+// DeepCopy returns a copy of the prepared device sharing no memory with it, so the copy can
+// be read while the checkpoint changes the device
+func (p *PreparedDevice) DeepCopy() *PreparedDevice {
+	if p == nil {
+		return nil
+	}
+	out := *p
+	out.Device = drapbv1.Device{
+		RequestNames: slices.Clone(p.Device.RequestNames),
+		PoolName:     p.Device.PoolName,
+		DeviceName:   p.Device.DeviceName,
+		CDIDeviceIDs: slices.Clone(p.Device.CDIDeviceIDs),
+	}
+	if p.ContainerEdits != nil && p.ContainerEdits.ContainerEdits != nil {
+		out.ContainerEdits = &cdiapi.ContainerEdits{ContainerEdits: deepCopyContainerEdits(p.ContainerEdits.ContainerEdits)}
+	}
+	out.Config = p.Config.DeepCopy()
+	if p.Bond != nil {
+		bond := *p.Bond
+		bond.Members = slices.Clone(p.Bond.Members)
+		out.Bond = &bond
+	}
+	if p.SF != nil {
+		sf := *p.SF
+		out.SF = &sf
+	}
+	return &out
+}
+
+// DeepCopy returns deep copies of the prepared devices
+func (p PreparedDevices) DeepCopy() PreparedDevices {
+	if p == nil {
+		return nil
+	}
+	out := make(PreparedDevices, 0, len(p))
+	for _, device := range p {
+		out = append(out, device.DeepCopy())
+	}
+	return out
+}
+
+func deepCopyContainerEdits(in *cdispec.ContainerEdits) *cdispec.ContainerEdits {
+	out := &cdispec.ContainerEdits{
+		Env:            slices.Clone(in.Env),
+		AdditionalGIDs: slices.Clone(in.AdditionalGIDs),
+	}
+	for _, node := range in.DeviceNodes {
+		copied := *node
+		copied.FileMode = clonePtr(node.FileMode)
+		copied.UID = clonePtr(node.UID)
+		copied.GID = clonePtr(node.GID)
+		out.DeviceNodes = append(out.DeviceNodes, &copied)
+	}
+	for _, hook := range in.Hooks {
+		copied := *hook
+		copied.Args = slices.Clone(hook.Args)
+		copied.Env = slices.Clone(hook.Env)
+		copied.Timeout = clonePtr(hook.Timeout)
+		out.Hooks = append(out.Hooks, &copied)
+	}
+	for _, mount := range in.Mounts {
+		copied := *mount
+		copied.Options = slices.Clone(mount.Options)
+		out.Mounts = append(out.Mounts, &copied)
+	}
+	out.IntelRdt = clonePtr(in.IntelRdt)
+	return out
+}
+
+func clonePtr[T any](in *T) *T {
+	if in == nil {
+		return nil
+	}
+	out := *in
+	return &out
+}
+
+// NewDeviceStatusData builds the claim status data for a prepared device
+// from the information known at prepare time.
+func (p *PreparedDevice) NewDeviceStatusData() *configapi.DeviceStatusData {
+	statusData := configapi.NewDeviceStatusData()
+	statusData.PciAddress = p.PciAddress
+	statusData.PFName = p.PFName
+	statusData.IfName = p.IfName
+	statusData.Driver = p.Driver
+	statusData.RDMADevice = p.RDMADevice
+	if p.SF != nil {
+		statusData.AuxDevice = p.SF.AuxDevice
+	}
+	statusData.GUID = p.GUID
+	statusData.PKey = p.PKey
+	statusData.Config = p.Config
+	if p.NetAttachDefConfig != "" {
+		// the netconf was already validated when the device was prepared
+		statusData.Vlan, _ = GetVlanFromNetConf(p.NetAttachDefConfig)
+	}
+	if p.Bond != nil {
+		statusData.Bond = &configapi.BondStatus{
+			IfName:  p.Bond.IfName,
+			Mode:    p.Bond.Mode,
+			Members: p.Bond.Members,
+		}
+	}
+	return statusData
 }
 
 type Checkpoint struct {
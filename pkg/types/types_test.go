@@ -6,11 +6,242 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"k8s.io/apimachinery/pkg/types"
+	cdiapi "tags.cncf.io/container-device-interface/pkg/cdi"
+	cdispec "tags.cncf.io/container-device-interface/specs-go"
 
+	configapi "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/virtualfunction/v1alpha1"
 	draTypes "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
 )
 
 var _ = Describe("Types", func() {
+	Context("GetVlanFromNetConf", func() {
+		It("should return the configured vlan", func() {
+			vlan, err := draTypes.GetVlanFromNetConf(`{"type": "sriov", "vlan": 100}`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(vlan).To(Equal(100))
+		})
+
+		It("should return 0 when no vlan is configured", func() {
+			vlan, err := draTypes.GetVlanFromNetConf(`{"type": "sriov"}`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(vlan).To(Equal(0))
+		})
+
+		It("should return error for invalid JSON", func() {
+			_, err := draTypes.GetVlanFromNetConf(`{invalid`)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("GetVFLinkSettingsFromNetConf", func() {
+		It("should parse the sriov-cni VF settings", func() {
+			settings, err := draTypes.GetVFLinkSettingsFromNetConf(`{"type": "sriov", "vlan": 100, "vlanQoS": 2,
+				"mac": "aa:bb:cc:dd:ee:ff", "spoofchk": "off", "trust": "on", "link_state": "enable",
+				"min_tx_rate": 10, "max_tx_rate": 100}`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*settings.Vlan).To(Equal(100))
+			Expect(*settings.VlanQoS).To(Equal(2))
+			Expect(settings.MAC).To(Equal("aa:bb:cc:dd:ee:ff"))
+			Expect(settings.SpoofChk).To(Equal("off"))
+			Expect(settings.Trust).To(Equal("on"))
+			Expect(settings.LinkState).To(Equal("enable"))
+			Expect(*settings.MinTxRate).To(Equal(10))
+			Expect(*settings.MaxTxRate).To(Equal(100))
+		})
+
+		It("should leave unset settings nil", func() {
+			settings, err := draTypes.GetVFLinkSettingsFromNetConf(`{"type": "sriov"}`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(settings.Vlan).To(BeNil())
+			Expect(settings.MaxTxRate).To(BeNil())
+			Expect(settings.MAC).To(BeEmpty())
+		})
+
+		It("should return error for invalid JSON", func() {
+			_, err := draTypes.GetVFLinkSettingsFromNetConf(`{invalid`)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should reset only the settings set to their defaults", func() {
+			settings, err := draTypes.GetVFLinkSettingsFromNetConf(`{"type": "sriov", "vlan": 100,
+				"mac": "aa:bb:cc:dd:ee:ff", "trust": "on", "max_tx_rate": 100}`)
+			Expect(err).NotTo(HaveOccurred())
+			defaults := settings.Defaults()
+			Expect(*defaults.Vlan).To(Equal(0))
+			Expect(defaults.MAC).To(Equal("00:00:00:00:00:00"))
+			Expect(defaults.Trust).To(Equal("off"))
+			Expect(*defaults.MaxTxRate).To(Equal(0))
+			Expect(defaults.VlanQoS).To(BeNil())
+			Expect(defaults.SpoofChk).To(BeEmpty())
+			Expect(defaults.LinkState).To(BeEmpty())
+			Expect(defaults.MinTxRate).To(BeNil())
+		})
+	})
+
+	Context("PreparedDevice NewDeviceStatusData", func() {
+		It("should fill the status data from the prepared device", func() {
+			preparedDevice := &draTypes.PreparedDevice{
+				PciAddress:         "0000:01:00.1",
+				PFName:             "eth0",
+				IfName:             "vfnet0",
+				Driver:             "vfio-pci",
+				NetAttachDefConfig: `{"type": "sriov", "vlan": 10}`,
+			}
+
+			statusData := preparedDevice.NewDeviceStatusData()
+			Expect(statusData.Kind).To(Equal(configapi.DeviceStatusDataKind))
+			Expect(statusData.PciAddress).To(Equal("0000:01:00.1"))
+			Expect(statusData.PFName).To(Equal("eth0"))
+			Expect(statusData.IfName).To(Equal("vfnet0"))
+			Expect(statusData.Driver).To(Equal("vfio-pci"))
+			Expect(statusData.Vlan).To(Equal(10))
+			Expect(statusData.CNIResult).To(BeNil())
+		})
+	})
+
+	Context("SetMaxTxRateInNetConf", func() {
+		It("should set max_tx_rate and override an existing value", func() {
+			result, err := draTypes.SetMaxTxRateInNetConf(`{"type": "sriov", "max_tx_rate": 100}`, 2500)
+			Expect(err).NotTo(HaveOccurred())
+
+			var config map[string]interface{}
+			Expect(json.Unmarshal([]byte(result), &config)).To(Succeed())
+			Expect(config["max_tx_rate"]).To(BeEquivalentTo(2500))
+			Expect(config["type"]).To(Equal("sriov"))
+		})
+
+		It("should return error for invalid JSON", func() {
+			_, err := draTypes.SetMaxTxRateInNetConf(`{invalid`, 2500)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("SetDeviceInNetConf", func() {
+		It("should set the device", func() {
+			result, err := draTypes.SetDeviceInNetConf(`{"type": "host-device"}`, "enp1s0f0s1000")
+			Expect(err).NotTo(HaveOccurred())
+
+			var config map[string]interface{}
+			Expect(json.Unmarshal([]byte(result), &config)).To(Succeed())
+			Expect(config["type"]).To(Equal("host-device"))
+			Expect(config["device"]).To(Equal("enp1s0f0s1000"))
+		})
+
+		It("should return error for invalid JSON", func() {
+			_, err := draTypes.SetDeviceInNetConf(`{invalid`, "sf0")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("SetInfiniBandInNetConf", func() {
+		It("should set the GUID in the runtime config and the pkey", func() {
+			result, err := draTypes.SetInfiniBandInNetConf(`{"type": "ib-sriov", "runtimeConfig": {"mac": "aa"}}`, "02:00:00:00:00:00:00:01", "0x8001")
+			Expect(err).NotTo(HaveOccurred())
+
+			var config map[string]interface{}
+			Expect(json.Unmarshal([]byte(result), &config)).To(Succeed())
+			Expect(config["type"]).To(Equal("ib-sriov"))
+			Expect(config["pkey"]).To(Equal("0x8001"))
+			Expect(config["runtimeConfig"]).To(Equal(map[string]interface{}{"mac": "aa", "infinibandGUID": "02:00:00:00:00:00:00:01"}))
+		})
+
+		It("should not set an empty pkey", func() {
+			result, err := draTypes.SetInfiniBandInNetConf(`{"type": "ib-sriov"}`, "02:00:00:00:00:00:00:01", "")
+			Expect(err).NotTo(HaveOccurred())
+
+			var config map[string]interface{}
+			Expect(json.Unmarshal([]byte(result), &config)).To(Succeed())
+			Expect(config).NotTo(HaveKey("pkey"))
+		})
+
+		It("should return error for invalid JSON", func() {
+			_, err := draTypes.SetInfiniBandInNetConf(`{invalid`, "02:00:00:00:00:00:00:01", "")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("BuildBondNetConf", func() {
+		It("should set the bond mode and the member links in the pod", func() {
+			result, err := draTypes.BuildBondNetConf(`{"type": "bond", "ipam": {"type": "static"}}`, "active-backup", 100, []string{"net1", "net2"})
+			Expect(err).NotTo(HaveOccurred())
+
+			var config map[string]interface{}
+			Expect(json.Unmarshal([]byte(result), &config)).To(Succeed())
+			Expect(config["type"]).To(Equal("bond"))
+			Expect(config["mode"]).To(Equal("active-backup"))
+			Expect(config["miimon"]).To(Equal("100"))
+			Expect(config["linksInContainer"]).To(BeTrue())
+			Expect(config["links"]).To(Equal([]interface{}{
+				map[string]interface{}{"name": "net1"},
+				map[string]interface{}{"name": "net2"},
+			}))
+			Expect(config["ipam"]).To(HaveKeyWithValue("type", "static"))
+		})
+
+		It("should return error for invalid JSON", func() {
+			_, err := draTypes.BuildBondNetConf(`{invalid`, "802.3ad", 100, []string{"net1"})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("CDIDeviceName", func() {
+		It("should use the device name", func() {
+			p := &draTypes.PreparedDevice{}
+			p.Device.DeviceName = "0000-01-00-1"
+			Expect(p.CDIDeviceName()).To(Equal("0000-01-00-1"))
+		})
+
+		It("should append the share ID for shared devices", func() {
+			p := &draTypes.PreparedDevice{ShareID: "abc"}
+			p.Device.DeviceName = "0000-01-00-0"
+			Expect(p.CDIDeviceName()).To(Equal("0000-01-00-0-abc"))
+		})
+	})
+
+	Context("PreparedDevice DeepCopy", func() {
+		It("should copy the device without sharing memory", func() {
+			uid := uint32(1000)
+			p := &draTypes.PreparedDevice{
+				ContainerEdits: &cdiapi.ContainerEdits{ContainerEdits: &cdispec.ContainerEdits{
+					Env:         []string{"A=1"},
+					DeviceNodes: []*cdispec.DeviceNode{{Path: "/dev/vfio/40", UID: &uid}},
+				}},
+				Config:   &configapi.VfConfig{Driver: "vfio-pci"},
+				Bond:     &draTypes.PreparedBond{IfName: "bond0", Members: []string{"net1"}},
+				SF:       &draTypes.PreparedSF{AuxDevice: "mlx5_core.sf.2"},
+				CNIState: draTypes.CNIStateAttached,
+			}
+			p.Device.RequestNames = []string{"req"}
+			p.Device.DeviceName = "0000-01-00-1"
+
+			copied := p.DeepCopy()
+			Expect(copied).To(Equal(p))
+
+			copied.CNIState = draTypes.CNIStateDetached
+			copied.Device.RequestNames[0] = "other"
+			copied.ContainerEdits.Env[0] = "A=2"
+			*copied.ContainerEdits.DeviceNodes[0].UID = 0
+			copied.Config.Driver = "netdevice"
+			copied.Bond.Members[0] = "net2"
+			copied.SF.AuxDevice = "mlx5_core.sf.3"
+			Expect(p.CNIState).To(Equal(draTypes.CNIStateAttached))
+			Expect(p.Device.RequestNames).To(Equal([]string{"req"}))
+			Expect(p.ContainerEdits.Env).To(Equal([]string{"A=1"}))
+			Expect(*p.ContainerEdits.DeviceNodes[0].UID).To(Equal(uint32(1000)))
+			Expect(p.Config.Driver).To(Equal("vfio-pci"))
+			Expect(p.Bond.Members).To(Equal([]string{"net1"}))
+			Expect(p.SF.AuxDevice).To(Equal("mlx5_core.sf.2"))
+		})
+
+		It("should copy the prepared devices", func() {
+			devices := draTypes.PreparedDevices{{PciAddress: "0000:01:00.1"}}
+			copied := devices.DeepCopy()
+			Expect(copied).To(Equal(devices))
+			Expect(copied[0]).NotTo(BeIdenticalTo(devices[0]))
+			Expect(draTypes.PreparedDevices(nil).DeepCopy()).To(BeNil())
+		})
+	})
+
 	Context("AddDeviceIDToNetConf", func() {
 		It("should add deviceID to valid JSON config", func() {
 			originalConfig := `{"type": "sriov", "name": "mynet"}`
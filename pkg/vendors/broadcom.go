@@ -0,0 +1,86 @@
+package vendors
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+
+	resourceapi "k8s.io/api/resource/v1"
+
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
+)
+
+// BroadcomVendorID is the PCI vendor ID of Broadcom
+const BroadcomVendorID = "14e4"
+
+// Resource tags of the PCI Vital Product Data
+const (
+	vpdEndTag      = 0x78
+	vpdReadOnlyTag = 0x90
+)
+
+func init() {
+	Register(BroadcomVendorID, &Broadcom{})
+}
+
+// Broadcom is the plugin of Broadcom NetXtreme NICs
+type Broadcom struct {
+	Generic
+}
+
+// Name returns the name of the vendor
+func (*Broadcom) Name() string {
+	return "broadcom"
+}
+
+// PFAttributes returns the part number of the PF as its board ID, read from the PCI Vital
+// Product Data. The part number identifies the card model, e.g. BCM957414A4142CC.
+func (*Broadcom) PFAttributes(pfPciAddress string) (map[resourceapi.QualifiedName]resourceapi.DeviceAttribute, error) {
+	vpd, err := os.ReadFile(sysBusPciPath(pfPciAddress, "vpd"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read VPD of %s: %w", pfPciAddress, err)
+	}
+
+	partNumber := vpdKeyword(vpd, "PN")
+	if partNumber == "" {
+		return nil, nil
+	}
+	return map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+		consts.AttributePFBoardID: stringAttribute(partNumber),
+	}, nil
+}
+
+// vpdKeyword returns the value of a keyword of the read-only section of a PCI VPD, or an
+// empty string if it isn't set. The parsing stops at the end tag or at a truncated resource.
+func vpdKeyword(vpd []byte, keyword string) string {
+	for len(vpd) > 0 && vpd[0] != vpdEndTag {
+		tag := vpd[0]
+		if tag&0x80 == 0 {
+			// small resource, its size is in the tag
+			vpd = vpd[min(1+int(tag&0x07), len(vpd)):]
+			continue
+		}
+		if len(vpd) < 3 {
+			return ""
+		}
+		size := int(binary.LittleEndian.Uint16(vpd[1:3]))
+		data := vpd[3:min(3+size, len(vpd))]
+		vpd = vpd[3+len(data):]
+		if tag != vpdReadOnlyTag {
+			continue
+		}
+		// the read-only section is a list of 2 characters keywords with a 1 byte size
+		for len(data) >= 3 {
+			value := data[3:min(3+int(data[2]), len(data))]
+			if string(data[:2]) == keyword {
+				return strings.TrimSpace(string(value))
+			}
+			data = data[3+len(value):]
+		}
+	}
+	return ""
+}
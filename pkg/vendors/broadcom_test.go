@@ -0,0 +1,72 @@
+package vendors_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/utils/ptr"
+
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/vendors"
+)
+
+// bcm57414VPD is the VPD of a BCM57414 NIC: its identifier string, a read-only section with
+// the part number, serial number and checksum, and the end tag
+const bcm57414VPD = "\x82\x0c\x00BCM57414 NIC" +
+	"\x90\x24" + "\x00" + "PN\x10BCM957414A4142CC" + "SN\x0aP210TP1234" + "RV\x01\x00" +
+	"\x78"
+
+var _ = Describe("Broadcom", func() {
+	var (
+		fs       *host.FakeFilesystem
+		tearDown func()
+		plugin   vendors.Plugin
+	)
+
+	BeforeEach(func() {
+		fs = &host.FakeFilesystem{Dirs: []string{"sys/bus/pci/devices/0000:01:00.0"}}
+		plugin = vendors.Get(vendors.BroadcomVendorID)
+	})
+
+	AfterEach(func() {
+		tearDown()
+		host.RootDir = ""
+	})
+
+	It("publishes the part number of the VPD of the PF as its board ID", func() {
+		fs.Files = map[string][]byte{"sys/bus/pci/devices/0000:01:00.0/vpd": []byte(bcm57414VPD)}
+		tearDown = fs.Use()
+
+		Expect(plugin.Name()).To(Equal("broadcom"))
+		attributes, err := plugin.PFAttributes("0000:01:00.0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(attributes).To(HaveLen(1))
+		Expect(attributes[consts.AttributePFBoardID].StringValue).To(Equal(ptr.To("BCM957414A4142CC")))
+	})
+
+	It("publishes no attribute without VPD", func() {
+		tearDown = fs.Use()
+
+		attributes, err := plugin.PFAttributes("0000:01:00.0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(attributes).To(BeEmpty())
+	})
+
+	It("publishes no attribute without part number", func() {
+		fs.Files = map[string][]byte{"sys/bus/pci/devices/0000:01:00.0/vpd": []byte("\x82\x0c\x00BCM57414 NIC\x90\x04\x00RV\x01\x00\x78")}
+		tearDown = fs.Use()
+
+		attributes, err := plugin.PFAttributes("0000:01:00.0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(attributes).To(BeEmpty())
+	})
+
+	It("publishes no attribute from a truncated VPD", func() {
+		fs.Files = map[string][]byte{"sys/bus/pci/devices/0000:01:00.0/vpd": []byte(bcm57414VPD[:20])}
+		tearDown = fs.Use()
+
+		attributes, err := plugin.PFAttributes("0000:01:00.0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(attributes).To(BeEmpty())
+	})
+})
@@ -0,0 +1,102 @@
+package vendors
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
+)
+
+// IntelVendorID is the PCI vendor ID of Intel
+const IntelVendorID = "8086"
+
+// iceDDPPackagePaths are the paths the ice driver loads the DDP package from, by priority
+var iceDDPPackagePaths = []string{
+	"lib/firmware/updates/intel/ice/ddp/ice.pkg",
+	"lib/firmware/intel/ice/ddp/ice.pkg",
+}
+
+func init() {
+	Register(IntelVendorID, &Intel{})
+}
+
+// Intel is the plugin of Intel Ethernet NICs
+type Intel struct {
+	Generic
+}
+
+// Name returns the name of the vendor
+func (*Intel) Name() string {
+	return "intel"
+}
+
+// PFAttributes returns the Dynamic Device Personalization (DDP) package of ice PFs. The
+// package is a symlink to the versioned file, e.g. ice-1.3.30.0.pkg, in the firmware dir.
+func (*Intel) PFAttributes(pfPciAddress string) (map[resourceapi.QualifiedName]resourceapi.DeviceAttribute, error) {
+	driverLink, err := os.Readlink(sysBusPciPath(pfPciAddress, "driver"))
+	if err != nil || filepath.Base(driverLink) != "ice" {
+		return nil, nil
+	}
+
+	for _, packagePath := range iceDDPPackagePaths {
+		target, err := os.Readlink(filepath.Join(host.RootDir, "/", packagePath))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			// the package is a regular file, its version is unknown
+			return nil, nil
+		}
+		return map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+			consts.AttributeDDPPackage: stringAttribute(strings.TrimSuffix(filepath.Base(target), ".pkg")),
+		}, nil
+	}
+	return nil, nil
+}
+
+// PrepareDevice trusts the VFs bound to a DPDK driver whose config requests the promiscuous
+// mode. The DPDK iavf driver can only enable the promiscuous and all-multicast modes of trusted
+// VFs, a trusted VF can also change its MAC address, so the other VFs are left untrusted. A
+// trust setting of the net attach def takes precedence.
+func (*Intel) PrepareDevice(ctx context.Context, h host.Interface, device *types.PreparedDevice) error {
+	if !needsTrust(h, device) {
+		return nil
+	}
+	klog.FromContext(ctx).V(2).Info("Trusting Intel VF bound to a DPDK driver", "device", device.PciAddress, "driver", device.Driver)
+	if err := h.SetVFLinkSettings(device.PFName, device.VFID, &types.VFLinkSettings{Trust: "on"}); err != nil {
+		return fmt.Errorf("failed to trust VF %s: %w", device.PciAddress, err)
+	}
+	return nil
+}
+
+// UnprepareDevice reverts the trust set by PrepareDevice
+func (*Intel) UnprepareDevice(_ context.Context, h host.Interface, device *types.PreparedDevice) error {
+	if !needsTrust(h, device) {
+		return nil
+	}
+	if err := h.SetVFLinkSettings(device.PFName, device.VFID, &types.VFLinkSettings{Trust: "off"}); err != nil {
+		return fmt.Errorf("failed to untrust VF %s: %w", device.PciAddress, err)
+	}
+	return nil
+}
+
+// needsTrust returns true for the VFs bound to a DPDK driver requesting the promiscuous mode
+// without a trust setting in their net attach def
+func needsTrust(h host.Interface, device *types.PreparedDevice) bool {
+	if device.Config == nil || !device.Config.Promiscuous || device.Config.Driver == "" || !h.IsDpdkDriver(device.Config.Driver) {
+		return false
+	}
+	if device.NetAttachDefConfig == "" {
+		return true
+	}
+	settings, err := types.GetVFLinkSettingsFromNetConf(device.NetAttachDefConfig)
+	return err == nil && settings.Trust == ""
+}
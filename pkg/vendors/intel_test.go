@@ -0,0 +1,142 @@
+package vendors_test
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+	"k8s.io/utils/ptr"
+
+	configapi "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/virtualfunction/v1alpha1"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host"
+	mock_host "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host/mock"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/vendors"
+)
+
+var _ = Describe("Intel", func() {
+	var plugin vendors.Plugin
+
+	BeforeEach(func() {
+		plugin = vendors.Get(vendors.IntelVendorID)
+	})
+
+	Context("PFAttributes", func() {
+		var (
+			fs       *host.FakeFilesystem
+			tearDown func()
+		)
+
+		BeforeEach(func() {
+			fs = &host.FakeFilesystem{
+				Dirs: []string{
+					"sys/bus/pci/devices/0000:01:00.0",
+					"sys/bus/pci/drivers/ice",
+					"sys/bus/pci/drivers/i40e",
+					"lib/firmware/intel/ice/ddp",
+					"lib/firmware/updates/intel/ice/ddp",
+				},
+				Files: map[string][]byte{
+					"lib/firmware/intel/ice/ddp/ice-1.3.30.0.pkg":         []byte("ddp"),
+					"lib/firmware/updates/intel/ice/ddp/ice-1.3.36.0.pkg": []byte("ddp"),
+				},
+				Symlinks: map[string]string{
+					"lib/firmware/intel/ice/ddp/ice.pkg": "ice-1.3.30.0.pkg",
+				},
+			}
+		})
+
+		AfterEach(func() {
+			tearDown()
+			host.RootDir = ""
+		})
+
+		It("publishes the DDP package of ice PFs", func() {
+			fs.Symlinks["sys/bus/pci/devices/0000:01:00.0/driver"] = "../../../bus/pci/drivers/ice"
+			tearDown = fs.Use()
+
+			attributes, err := plugin.PFAttributes("0000:01:00.0")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(attributes[consts.AttributeDDPPackage].StringValue).To(Equal(ptr.To("ice-1.3.30.0")))
+		})
+
+		It("prefers the DDP package of the firmware updates", func() {
+			fs.Symlinks["sys/bus/pci/devices/0000:01:00.0/driver"] = "../../../bus/pci/drivers/ice"
+			fs.Symlinks["lib/firmware/updates/intel/ice/ddp/ice.pkg"] = "ice-1.3.36.0.pkg"
+			tearDown = fs.Use()
+
+			attributes, err := plugin.PFAttributes("0000:01:00.0")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(attributes[consts.AttributeDDPPackage].StringValue).To(Equal(ptr.To("ice-1.3.36.0")))
+		})
+
+		It("publishes no attribute for other drivers", func() {
+			fs.Symlinks["sys/bus/pci/devices/0000:01:00.0/driver"] = "../../../bus/pci/drivers/i40e"
+			tearDown = fs.Use()
+
+			attributes, err := plugin.PFAttributes("0000:01:00.0")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(attributes).To(BeEmpty())
+		})
+	})
+
+	Context("prepare and unprepare", func() {
+		var (
+			mockCtrl *gomock.Controller
+			mockHost *mock_host.MockInterface
+			device   *types.PreparedDevice
+		)
+
+		BeforeEach(func() {
+			mockCtrl = gomock.NewController(GinkgoT())
+			mockHost = mock_host.NewMockInterface(mockCtrl)
+
+			device = &types.PreparedDevice{
+				PciAddress: "0000:01:00.1",
+				PFName:     "eth0",
+				VFID:       1,
+				Driver:     "vfio-pci",
+				Config:     &configapi.VfConfig{Driver: "vfio-pci", Promiscuous: true},
+			}
+			mockHost.EXPECT().IsDpdkDriver("vfio-pci").Return(true).AnyTimes()
+			mockHost.EXPECT().IsDpdkDriver("").Return(false).AnyTimes()
+		})
+
+		AfterEach(func() {
+			mockCtrl.Finish()
+		})
+
+		It("trusts VFs bound to a DPDK driver requesting the promiscuous mode and reverts it on unprepare", func() {
+			mockHost.EXPECT().SetVFLinkSettings("eth0", 1, &types.VFLinkSettings{Trust: "on"}).Return(nil)
+			Expect(plugin.PrepareDevice(context.Background(), mockHost, device)).To(Succeed())
+
+			mockHost.EXPECT().SetVFLinkSettings("eth0", 1, &types.VFLinkSettings{Trust: "off"}).Return(nil)
+			Expect(plugin.UnprepareDevice(context.Background(), mockHost, device)).To(Succeed())
+		})
+
+		It("keeps the trust setting of the net attach def", func() {
+			device.NetAttachDefConfig = `{"type":"sriov","trust":"off"}`
+			Expect(plugin.PrepareDevice(context.Background(), mockHost, device)).To(Succeed())
+			Expect(plugin.UnprepareDevice(context.Background(), mockHost, device)).To(Succeed())
+		})
+
+		It("doesn't trust VFs not requesting the promiscuous mode", func() {
+			device.Config = &configapi.VfConfig{Driver: "vfio-pci"}
+			Expect(plugin.PrepareDevice(context.Background(), mockHost, device)).To(Succeed())
+			Expect(plugin.UnprepareDevice(context.Background(), mockHost, device)).To(Succeed())
+		})
+
+		It("doesn't trust VFs bound to a kernel driver", func() {
+			device.Config = &configapi.VfConfig{Promiscuous: true}
+			Expect(plugin.PrepareDevice(context.Background(), mockHost, device)).To(Succeed())
+		})
+
+		It("returns error when the VF can't be trusted", func() {
+			mockHost.EXPECT().SetVFLinkSettings("eth0", 1, gomock.Any()).Return(errors.New("boom"))
+			Expect(plugin.PrepareDevice(context.Background(), mockHost, device)).To(MatchError(ContainSubstring("failed to trust VF")))
+		})
+	})
+})
@@ -0,0 +1,51 @@
+package vendors
+
+import (
+	"fmt"
+	"os"
+
+	resourceapi "k8s.io/api/resource/v1"
+
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
+)
+
+// NvidiaVendorID is the PCI vendor ID of NVIDIA/Mellanox
+const NvidiaVendorID = "15b3"
+
+func init() {
+	Register(NvidiaVendorID, &Nvidia{})
+}
+
+// Nvidia is the plugin of NVIDIA/Mellanox ConnectX NICs
+type Nvidia struct {
+	Generic
+}
+
+// Name returns the name of the vendor
+func (*Nvidia) Name() string {
+	return "nvidia"
+}
+
+// PFAttributes returns the board ID (PSID) of the PF, read from its RDMA device. The board
+// ID identifies the card model and firmware flavor, e.g. MT_0000000222.
+func (*Nvidia) PFAttributes(pfPciAddress string) (map[resourceapi.QualifiedName]resourceapi.DeviceAttribute, error) {
+	rdmaDevices, err := os.ReadDir(sysBusPciPath(pfPciAddress, "infiniband"))
+	if os.IsNotExist(err) || len(rdmaDevices) == 0 {
+		// the mlx5_ib module is not loaded
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read RDMA devices of %s: %w", pfPciAddress, err)
+	}
+
+	boardID, err := readSysfsValue(sysBusPciPath(pfPciAddress, "infiniband", rdmaDevices[0].Name(), "board_id"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read board ID of %s: %w", pfPciAddress, err)
+	}
+	if boardID == "" {
+		return nil, nil
+	}
+	return map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+		consts.AttributePFBoardID: stringAttribute(boardID),
+	}, nil
+}
@@ -0,0 +1,60 @@
+package vendors_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/utils/ptr"
+
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/vendors"
+)
+
+var _ = Describe("Nvidia", func() {
+	var (
+		fs       *host.FakeFilesystem
+		tearDown func()
+		plugin   vendors.Plugin
+	)
+
+	BeforeEach(func() {
+		fs = &host.FakeFilesystem{}
+		plugin = vendors.Get(vendors.NvidiaVendorID)
+	})
+
+	AfterEach(func() {
+		tearDown()
+		host.RootDir = ""
+	})
+
+	It("publishes the board ID of the RDMA device of the PF", func() {
+		fs.Dirs = []string{"sys/bus/pci/devices/0000:01:00.0/infiniband/mlx5_0"}
+		fs.Files = map[string][]byte{
+			"sys/bus/pci/devices/0000:01:00.0/infiniband/mlx5_0/board_id": []byte("MT_0000000222\n"),
+		}
+		tearDown = fs.Use()
+
+		attributes, err := plugin.PFAttributes("0000:01:00.0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(attributes).To(HaveLen(1))
+		Expect(attributes[consts.AttributePFBoardID].StringValue).To(Equal(ptr.To("MT_0000000222")))
+	})
+
+	It("publishes no attribute without RDMA device", func() {
+		fs.Dirs = []string{"sys/bus/pci/devices/0000:01:00.0"}
+		tearDown = fs.Use()
+
+		attributes, err := plugin.PFAttributes("0000:01:00.0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(attributes).To(BeEmpty())
+	})
+
+	It("publishes no attribute without board ID", func() {
+		fs.Dirs = []string{"sys/bus/pci/devices/0000:01:00.0/infiniband/mlx5_0"}
+		tearDown = fs.Use()
+
+		attributes, err := plugin.PFAttributes("0000:01:00.0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(attributes).To(BeEmpty())
+	})
+})
@@ -0,0 +1,108 @@
+// Package vendors implements the NIC specific behaviors of the vendors. A vendor plugin is
+// registered for a PCI vendor ID and can add attributes to the published devices and hooks
+// when the devices are prepared and unprepared. Devices of vendors without a plugin get the
+// generic behavior.
+package vendors
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	resourceapi "k8s.io/api/resource/v1"
+
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
+)
+
+// Plugin implements the NIC specific behaviors of a vendor
+type Plugin interface {
+	// Name returns the name of the vendor
+	Name() string
+	// PFAttributes returns the vendor specific attributes published on the devices of a PF
+	PFAttributes(pfPciAddress string) (map[resourceapi.QualifiedName]resourceapi.DeviceAttribute, error)
+	// PrepareDevice is called once a VF is configured for a claim, before it is handed to the pod
+	PrepareDevice(ctx context.Context, h host.Interface, device *types.PreparedDevice) error
+	// UnprepareDevice is called when a VF is unprepared, before its original driver is restored
+	UnprepareDevice(ctx context.Context, h host.Interface, device *types.PreparedDevice) error
+}
+
+var (
+	pluginsMutex sync.RWMutex
+	plugins      = map[string]Plugin{}
+)
+
+// Register registers the plugin of a PCI vendor ID, e.g. "15b3", replacing any previous one
+func Register(vendorID string, plugin Plugin) {
+	pluginsMutex.Lock()
+	defer pluginsMutex.Unlock()
+	plugins[normalizeVendorID(vendorID)] = plugin
+}
+
+// Get returns the plugin registered for a PCI vendor ID, or the generic plugin
+func Get(vendorID string) Plugin {
+	pluginsMutex.RLock()
+	defer pluginsMutex.RUnlock()
+	if plugin, ok := plugins[normalizeVendorID(vendorID)]; ok {
+		return plugin
+	}
+	return Generic{}
+}
+
+func normalizeVendorID(vendorID string) string {
+	return strings.TrimPrefix(strings.ToLower(vendorID), "0x")
+}
+
+// Generic is the behavior of the devices of vendors without a plugin. Vendor plugins embed
+// it to only implement the behaviors they change.
+type Generic struct{}
+
+// Name returns the name of the generic plugin
+func (Generic) Name() string {
+	return "generic"
+}
+
+// PFAttributes returns no attribute
+func (Generic) PFAttributes(string) (map[resourceapi.QualifiedName]resourceapi.DeviceAttribute, error) {
+	return nil, nil
+}
+
+// PrepareDevice does nothing
+func (Generic) PrepareDevice(context.Context, host.Interface, *types.PreparedDevice) error {
+	return nil
+}
+
+// UnprepareDevice does nothing
+func (Generic) UnprepareDevice(context.Context, host.Interface, *types.PreparedDevice) error {
+	return nil
+}
+
+// sysBusPciPath returns the sysfs path of a PCI device file, respecting host.RootDir
+func sysBusPciPath(pciAddress string, subPath ...string) string {
+	return filepath.Join(append([]string{host.RootDir, consts.SysBusPci, pciAddress}, subPath...)...)
+}
+
+// readSysfsValue returns the trimmed content of a sysfs file, or an empty string if it
+// doesn't exist
+func readSysfsValue(path string) (string, error) {
+	value, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(value)), nil
+}
+
+// stringAttribute returns a string device attribute, truncated to the maximum length of
+// attribute values
+func stringAttribute(value string) resourceapi.DeviceAttribute {
+	if len(value) > resourceapi.DeviceAttributeMaxValueLength {
+		value = value[:resourceapi.DeviceAttributeMaxValueLength]
+	}
+	return resourceapi.DeviceAttribute{StringValue: &value}
+}
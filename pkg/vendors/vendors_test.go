@@ -0,0 +1,48 @@
+package vendors_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	resourceapi "k8s.io/api/resource/v1"
+
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/vendors"
+)
+
+type fakePlugin struct {
+	vendors.Generic
+}
+
+func (fakePlugin) Name() string {
+	return "fake"
+}
+
+var _ = Describe("Vendors", func() {
+	It("returns the plugin registered for a vendor ID", func() {
+		Expect(vendors.Get("15b3").Name()).To(Equal("nvidia"))
+		Expect(vendors.Get("0x8086").Name()).To(Equal("intel"))
+	})
+
+	It("returns the generic plugin for unknown vendors", func() {
+		plugin := vendors.Get("1077")
+		Expect(plugin.Name()).To(Equal("generic"))
+
+		attributes, err := plugin.PFAttributes("0000:01:00.0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(attributes).To(BeEmpty())
+		Expect(plugin.PrepareDevice(context.Background(), nil, &types.PreparedDevice{})).To(Succeed())
+		Expect(plugin.UnprepareDevice(context.Background(), nil, &types.PreparedDevice{})).To(Succeed())
+	})
+
+	It("registers new plugins", func() {
+		vendors.Register("ABCD", fakePlugin{})
+		plugin := vendors.Get("abcd")
+		Expect(plugin.Name()).To(Equal("fake"))
+
+		attributes, err := plugin.PFAttributes("0000:01:00.0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(attributes).To(Equal(map[resourceapi.QualifiedName]resourceapi.DeviceAttribute(nil)))
+	})
+})
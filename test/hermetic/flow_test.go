@@ -0,0 +1,173 @@
+package hermetic_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	resourceapi "k8s.io/api/resource/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	sriovdrav1alpha1 "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/sriovdra/v1alpha1"
+	configapi "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/api/virtualfunction/v1alpha1"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/cdi"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/consts"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/controller"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/devicestate"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/flags"
+	"github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/host"
+	drasriovtypes "github.com/k8snetworkplumbingwg/dra-driver-sriov/pkg/types"
+)
+
+const topologyYAML = `
+drivers: [vfio-pci]
+modules: [vfio, vfio_pci]
+bridges:
+- address: "0000:00:01.0"
+- address: "0000:80:01.0"
+pfs:
+- address: "0000:01:00.0"
+  parent: "0000:00:01.0"
+  vendor: "8086"
+  device: "159b"
+  driver: ice
+  netdev: ens1f0
+  numaNode: 0
+  link: {speed: 25000}
+  vfs:
+  - {address: "0000:01:01.0", device: "1889", driver: iavf, netdev: ens1f0v0, iommuGroup: 40}
+  - {address: "0000:01:01.1", device: "1889", driver: iavf, netdev: ens1f0v1, iommuGroup: 41}
+- address: "0000:81:00.0"
+  parent: "0000:80:01.0"
+  vendor: "15b3"
+  device: "101d"
+  driver: mlx5_core
+  netdev: ens2f0np0
+  numaNode: 1
+  link: {speed: 100000}
+  vfs:
+  - {address: "0000:81:00.2", device: "101e", driver: mlx5_core, netdev: ens2f0v0, iommuGroup: 50}
+`
+
+var _ = Describe("Node plugin on a fake sysfs topology", func() {
+	var (
+		topology *host.Topology
+		tearDown func()
+		manager  *devicestate.Manager
+	)
+
+	BeforeEach(func() {
+		var err error
+		topology, err = host.LoadTopology([]byte(topologyYAML))
+		Expect(err).NotTo(HaveOccurred())
+		tearDown = topology.Use()
+
+		cdiHandler, err := cdi.NewHandler(topology.Path("var/run/cdi"))
+		Expect(err).NotTo(HaveOccurred())
+		manager, err = devicestate.NewManager(&drasriovtypes.Config{
+			Flags: &drasriovtypes.Flags{
+				NodeName:               "node1",
+				DefaultInterfacePrefix: "net",
+				HostDevicePolicy:       devicestate.HostDevicePolicySkip,
+			},
+			K8sClient: flags.ClientSets{Client: fake.NewClientBuilder().WithScheme(flags.Scheme).Build()},
+		}, host.NewHost(), cdiHandler, nil)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		tearDown()
+	})
+
+	It("discovers, filters, prepares and unprepares a VF with a driver rebind", func(ctx SpecContext) {
+		By("discovering the VFs of the topology")
+		devices := manager.GetAllocatableDevices()
+		Expect(devices).To(HaveLen(3))
+		vf := devices["0000-81-00-2"]
+		Expect(vf.Attributes[consts.AttributeNumaNode].IntValue).To(HaveValue(BeEquivalentTo(1)))
+		Expect(vf.Attributes[consts.AttributePFName].StringValue).To(HaveValue(Equal("ens2f0np0")))
+		Expect(vf.Attributes[consts.AttributeParentPciAddress].StringValue).To(HaveValue(Equal("0000:80:01.0")))
+
+		By("filtering the Mellanox VFs into a resource")
+		k8sClient := fake.NewClientBuilder().WithScheme(flags.Scheme).WithObjects(
+			&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}},
+			&sriovdrav1alpha1.SriovResourceFilter{
+				ObjectMeta: metav1.ObjectMeta{Name: "filter", Namespace: "dra-sriov-driver"},
+				Spec: sriovdrav1alpha1.SriovResourceFilterSpec{Configs: []sriovdrav1alpha1.Config{{
+					ResourceName:    "mellanox-vfs",
+					ResourceFilters: []sriovdrav1alpha1.ResourceFilter{{Vendors: []string{"15b3"}}},
+				}}},
+			},
+		).Build()
+		reconciler := controller.NewSriovResourceFilterReconciler(k8sClient, "node1", "dra-sriov-driver", manager)
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: k8stypes.NamespacedName{Name: "filter", Namespace: "dra-sriov-driver"}})
+		Expect(err).NotTo(HaveOccurred())
+		devices = manager.GetAllocatableDevices()
+		Expect(devices["0000-81-00-2"].Attributes[consts.AttributeResourceName].StringValue).To(HaveValue(Equal("mellanox-vfs")))
+		Expect(devices["0000-01-01-1"].Attributes).NotTo(HaveKey(consts.AttributeResourceName))
+
+		By("preparing the VF with the vfio-pci driver")
+		claim := newClaim("0000-81-00-2", &configapi.VfConfig{Driver: "vfio-pci"})
+		ifNameIndex := 0
+		prepared, err := manager.PrepareDevicesForClaim(context.Background(), &ifNameIndex, claim)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(prepared).To(HaveLen(1))
+		Expect(prepared[0].OriginalDriver).To(Equal("mlx5_core"))
+
+		Expect(os.Readlink(topology.Path("sys/bus/pci/devices/0000:81:00.2/driver"))).To(HaveSuffix("/vfio-pci"))
+		Expect(topology.Path("sys/class/net/ens2f0v0")).NotTo(BeAnExistingFile())
+		Expect(os.Readlink(topology.Path("sys/bus/pci/devices/0000:01:01.1/driver"))).To(HaveSuffix("/iavf"))
+
+		By("writing the CDI spec of the claim")
+		specs, err := filepath.Glob(topology.Path("var/run/cdi/*" + string(claim.UID) + "*"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(specs).To(HaveLen(1))
+		spec, err := os.ReadFile(specs[0])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(spec)).To(ContainSubstring("/dev/vfio/50"))
+
+		By("unpreparing the claim")
+		Expect(manager.Unprepare(string(claim.UID), prepared)).To(Succeed())
+		Expect(os.Readlink(topology.Path("sys/bus/pci/devices/0000:81:00.2/driver"))).To(HaveSuffix("/mlx5_core"))
+		Expect(topology.Path("sys/class/net/ens2f0v0/mtu")).To(BeARegularFile())
+		Expect(os.ReadFile(topology.Path("sys/bus/pci/devices/0000:81:00.2/driver_override"))).To(Equal([]byte("(null)\n")))
+		Expect(filepath.Glob(topology.Path("var/run/cdi/*" + string(claim.UID) + "*"))).To(BeEmpty())
+	})
+})
+
+// newClaim returns a claim allocated with a device and an opaque VfConfig
+func newClaim(device string, vfConfig *configapi.VfConfig) *resourceapi.ResourceClaim {
+	vfConfig.TypeMeta = metav1.TypeMeta{APIVersion: "sriovnetwork.k8snetworkplumbingwg.io/v1alpha1", Kind: "VfConfig"}
+	encoded, err := runtime.Encode(configapi.Decoder.(runtime.Encoder), vfConfig)
+	Expect(err).NotTo(HaveOccurred())
+	return &resourceapi.ResourceClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "claim1", Namespace: "default", UID: "claim1-uid"},
+		Status: resourceapi.ResourceClaimStatus{
+			ReservedFor: []resourceapi.ResourceClaimConsumerReference{{Name: "pod", UID: "pod-uid"}},
+			Allocation: &resourceapi.AllocationResult{
+				Devices: resourceapi.DeviceAllocationResult{
+					Results: []resourceapi.DeviceRequestAllocationResult{
+						{Request: "req", Driver: consts.DriverName, Pool: "node1", Device: device},
+					},
+					Config: []resourceapi.DeviceAllocationConfiguration{{
+						Source:   resourceapi.AllocationConfigSourceClaim,
+						Requests: []string{"req"},
+						DeviceConfiguration: resourceapi.DeviceConfiguration{
+							Opaque: &resourceapi.OpaqueDeviceConfiguration{
+								Driver:     consts.DriverName,
+								Parameters: runtime.RawExtension{Raw: encoded},
+							},
+						},
+					}},
+				},
+			},
+		},
+	}
+}
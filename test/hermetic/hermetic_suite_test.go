@@ -0,0 +1,13 @@
+package hermetic_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestHermetic(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Hermetic Suite")
+}